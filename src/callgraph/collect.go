@@ -0,0 +1,183 @@
+package callgraph
+
+import (
+	"github.com/setpill/noverify/src/linter"
+	"github.com/setpill/noverify/src/meta"
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/node/expr"
+	"github.com/setpill/noverify/src/php/parser/node/stmt"
+	"github.com/setpill/noverify/src/php/parser/walker"
+	"github.com/setpill/noverify/src/solver"
+)
+
+// Collector fills the graph during the linter analysis phase.
+type Collector struct {
+	Graph *Graph
+
+	// Internal controls whether calls to the internal (builtin)
+	// functions and methods of internal classes are recorded.
+	Internal bool
+}
+
+// Register adds root and block checkers that fill c.Graph to the linter.
+//
+// Should be called after the indexing is complete.
+func (c *Collector) Register(l *linter.Linter) {
+	l.RegisterRootChecker(func(ctx *linter.RootContext) linter.RootChecker {
+		return &rootCollector{c: c, ctx: ctx}
+	})
+	l.RegisterBlockChecker(func(ctx *linter.BlockContext) linter.BlockChecker {
+		return &blockCollector{c: c, ctx: ctx}
+	})
+}
+
+type rootCollector struct {
+	linter.RootCheckerDefaults
+
+	c   *Collector
+	ctx *linter.RootContext
+}
+
+func (r *rootCollector) AfterEnterNode(w walker.Walkable) {
+	var kind NodeKind
+	switch w.(type) {
+	case *stmt.Class:
+		kind = KindClass
+	case *stmt.Interface:
+		kind = KindInterface
+	case *stmt.Trait:
+		kind = KindTrait
+	default:
+		return
+	}
+
+	st := r.ctx.ClassParseState()
+	info := st.MetaInfo()
+	className := st.CurrentClass
+	class, ok := info.GetClassOrTrait(className)
+	if !ok {
+		return
+	}
+	from := classNode(className, kind, class.Pos)
+	g := r.c.Graph
+	g.AddNode(from)
+
+	if class.Parent != "" {
+		g.AddEdge(from, lookupClassNode(info, class.Parent, KindClass), EdgeExtends)
+	}
+	for _, iface := range class.ParentInterfaces {
+		g.AddEdge(from, lookupClassNode(info, iface, KindInterface), EdgeExtends)
+	}
+	for iface := range class.Interfaces {
+		g.AddEdge(from, lookupClassNode(info, iface, KindInterface), EdgeImplements)
+	}
+	for trait := range class.Traits {
+		g.AddEdge(from, lookupClassNode(info, trait, KindTrait), EdgeUses)
+	}
+}
+
+type blockCollector struct {
+	linter.BlockCheckerDefaults
+
+	c   *Collector
+	ctx *linter.BlockContext
+}
+
+func (b *blockCollector) BeforeEnterNode(w walker.Walkable) {
+	st := b.ctx.ClassParseState()
+	if st.CurrentFunction == "" {
+		// Root-level calls are not recorded.
+		return
+	}
+
+	switch n := w.(type) {
+	case *expr.FunctionCall:
+		fqName, defined := b.ctx.FunctionCallName(n)
+		if !defined {
+			return
+		}
+		fn, ok := st.MetaInfo().GetFunction(fqName)
+		if !ok || (!b.c.Internal && isInternalFunction(st.MetaInfo(), fqName)) {
+			return
+		}
+		b.addCall(Node{ID: fqName, Kind: KindFunction, Filename: fn.Pos.Filename, Line: int(fn.Pos.Line)})
+
+	case *expr.MethodCall:
+		id, ok := n.Method.(*node.Identifier)
+		if !ok {
+			return
+		}
+		solver.ExprType(b.ctx.Scope(), st, n.Variable).Iterate(func(typ string) {
+			b.addMethodCall(typ, id.Value)
+		})
+
+	case *expr.StaticCall:
+		id, ok := n.Call.(*node.Identifier)
+		if !ok {
+			return
+		}
+		className, ok := solver.GetClassName(st, n.Class)
+		if !ok {
+			return
+		}
+		b.addMethodCall(className, id.Value)
+
+	case *expr.New:
+		className, ok := solver.GetClassName(st, n.Class)
+		if !ok {
+			return
+		}
+		b.addMethodCall(className, "__construct")
+	}
+}
+
+func (b *blockCollector) addMethodCall(className, methodName string) {
+	info := b.ctx.ClassParseState().MetaInfo()
+	fn, implClass, ok := solver.FindMethod(info, className, methodName)
+	if !ok || (!b.c.Internal && info.IsInternalClass(implClass)) {
+		return
+	}
+	b.addCall(Node{
+		ID:       implClass + "::" + methodName,
+		Kind:     KindMethod,
+		Filename: fn.Pos.Filename,
+		Line:     int(fn.Pos.Line),
+	})
+}
+
+func (b *blockCollector) addCall(to Node) {
+	st := b.ctx.ClassParseState()
+	from := Node{Kind: KindFunction}
+	if st.CurrentClass != "" {
+		from.ID = st.CurrentClass + "::" + st.CurrentFunction
+		from.Kind = KindMethod
+		if fn, _, ok := solver.FindMethod(st.MetaInfo(), st.CurrentClass, st.CurrentFunction); ok {
+			from.Filename = fn.Pos.Filename
+			from.Line = int(fn.Pos.Line)
+		}
+	} else {
+		from.ID = st.Namespace + `\` + st.CurrentFunction
+		if fn, ok := st.MetaInfo().GetFunction(from.ID); ok {
+			from.Filename = fn.Pos.Filename
+			from.Line = int(fn.Pos.Line)
+		}
+	}
+	b.c.Graph.AddEdge(from, to, EdgeCall)
+}
+
+func lookupClassNode(info *meta.Index, className string, kind NodeKind) Node {
+	class, ok := info.GetClassOrTrait(className)
+	if !ok {
+		return Node{ID: className, Kind: kind}
+	}
+	return classNode(className, kind, class.Pos)
+}
+
+func classNode(className string, kind NodeKind, pos meta.ElementPosition) Node {
+	return Node{ID: className, Kind: kind, Filename: pos.Filename, Line: int(pos.Line)}
+}
+
+func isInternalFunction(info *meta.Index, fqName string) bool {
+	_, ok := info.GetInternalFunctionInfo(fqName)
+	return ok
+}
@@ -0,0 +1,74 @@
+package callgraph
+
+import (
+	"testing"
+
+	"github.com/setpill/noverify/src/linter"
+)
+
+func collectGraph(code string) *Graph {
+	readFiles := func(ch chan linter.FileInfo) {
+		ch <- linter.FileInfo{Filename: "test.php", Contents: []byte(code)}
+	}
+
+	l := linter.NewLinter(linter.NewConfig())
+	l.Index(readFiles)
+	c := &Collector{Graph: NewGraph()}
+	c.Register(l)
+	l.Analyze(readFiles)
+	return c.Graph
+}
+
+func TestCollect(t *testing.T) {
+	g := collectGraph(`<?php
+namespace App;
+
+interface Named {}
+
+trait Loggable {}
+
+class Base {
+  public function __construct() {}
+  public function name() { return "base"; }
+}
+
+class Child extends Base implements Named {
+  use Loggable;
+
+  /** @var Base */
+  public $parent;
+
+  public static function make() { return new Child(); }
+
+  public function parentName() {
+    return $this->parent->name();
+  }
+}
+
+function helper() {}
+
+function main() {
+  $c = Child::make();
+  echo $c->name();
+  echo $c->parentName();
+  $b = new Base();
+  helper();
+}
+
+main();
+`)
+
+	want := `\App\Child -extends-> \App\Base; ` +
+		`\App\Child -uses-> \App\Loggable; ` +
+		`\App\Child -implements-> \App\Named; ` +
+		`\App\Child::make -call-> \App\Base::__construct; ` +
+		`\App\Child::parentName -call-> \App\Base::name; ` +
+		`\App\main -call-> \App\Base::__construct; ` +
+		`\App\main -call-> \App\Base::name; ` +
+		`\App\main -call-> \App\Child::make; ` +
+		`\App\main -call-> \App\Child::parentName; ` +
+		`\App\main -call-> \App\helper`
+	if have := graphString(g); have != want {
+		t.Errorf("edges mismatch:\nhave: %s\nwant: %s", have, want)
+	}
+}
@@ -0,0 +1,301 @@
+// Package callgraph builds function/method call graph and class hierarchy
+// of the analyzed project and exports them in DOT or JSON formats.
+package callgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// NodeKind is a graph node kind.
+type NodeKind string
+
+const (
+	KindFunction  NodeKind = "function"
+	KindMethod    NodeKind = "method"
+	KindClass     NodeKind = "class"
+	KindInterface NodeKind = "interface"
+	KindTrait     NodeKind = "trait"
+)
+
+// EdgeKind is a graph edge kind.
+type EdgeKind string
+
+const (
+	EdgeCall       EdgeKind = "call"
+	EdgeExtends    EdgeKind = "extends"
+	EdgeImplements EdgeKind = "implements"
+	EdgeUses       EdgeKind = "uses"
+)
+
+// Node is a function, method, class, interface or trait.
+//
+// ID is a fully qualified symbol name, like `\NS\f` for functions,
+// `\NS\C::m` for methods and `\NS\C` for classes.
+type Node struct {
+	ID       string   `json:"id"`
+	Kind     NodeKind `json:"kind"`
+	Filename string   `json:"filename,omitempty"`
+	Line     int      `json:"line,omitempty"`
+}
+
+// Edge is a directed connection between two nodes.
+type Edge struct {
+	From string   `json:"from"`
+	To   string   `json:"to"`
+	Kind EdgeKind `json:"kind"`
+
+	// Count is a number of times this edge was found.
+	// For calls, it's a number of call sites.
+	Count int `json:"count"`
+}
+
+type edgeKey struct {
+	from string
+	to   string
+	kind EdgeKind
+}
+
+// Graph is a call graph combined with a class hierarchy.
+//
+// It's safe to add nodes and edges from several goroutines concurrently.
+type Graph struct {
+	mu    sync.Mutex
+	nodes map[string]*Node
+	edges map[edgeKey]*Edge
+}
+
+// NewGraph returns a new empty graph.
+func NewGraph() *Graph {
+	return &Graph{
+		nodes: make(map[string]*Node),
+		edges: make(map[edgeKey]*Edge),
+	}
+}
+
+// AddNode adds n to the graph. If node with the same ID
+// is already present, it's not replaced.
+func (g *Graph) AddNode(n Node) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.addNode(n)
+}
+
+// AddEdge adds an edge between two nodes.
+// Nodes are added to the graph if they are not present yet.
+func (g *Graph) AddEdge(from, to Node, kind EdgeKind) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.addNode(from)
+	g.addNode(to)
+
+	key := edgeKey{from: from.ID, to: to.ID, kind: kind}
+	e := g.edges[key]
+	if e == nil {
+		e = &Edge{From: from.ID, To: to.ID, Kind: kind}
+		g.edges[key] = e
+	}
+	e.Count++
+}
+
+func (g *Graph) addNode(n Node) {
+	if old, ok := g.nodes[n.ID]; ok {
+		// Position can be unknown when node was added
+		// as an edge target, fill it if it's available now.
+		if old.Filename == "" {
+			old.Filename = n.Filename
+			old.Line = n.Line
+		}
+		return
+	}
+	g.nodes[n.ID] = &n
+}
+
+// Nodes returns all graph nodes sorted by ID.
+func (g *Graph) Nodes() []*Node {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	res := make([]*Node, 0, len(g.nodes))
+	for _, n := range g.nodes {
+		res = append(res, n)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
+	return res
+}
+
+// Edges returns all graph edges sorted by (From, To, Kind).
+func (g *Graph) Edges() []*Edge {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	res := make([]*Edge, 0, len(g.edges))
+	for _, e := range g.edges {
+		res = append(res, e)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		switch {
+		case res[i].From != res[j].From:
+			return res[i].From < res[j].From
+		case res[i].To != res[j].To:
+			return res[i].To < res[j].To
+		default:
+			return res[i].Kind < res[j].Kind
+		}
+	})
+	return res
+}
+
+// FilterOptions describe what parts of the graph should be kept.
+type FilterOptions struct {
+	// Namespace selects root nodes: only nodes from this namespace
+	// (or its sub-namespaces) are roots. Empty string selects all nodes.
+	Namespace string
+
+	// Depth is a max number of edges that can be followed from the root nodes.
+	// Negative value means "no limit".
+	Depth int
+
+	// Calls and Hierarchy select edge kinds to keep.
+	Calls     bool
+	Hierarchy bool
+}
+
+// Filter returns a new graph that only contains nodes and edges
+// that satisfy the options.
+func (g *Graph) Filter(opts FilterOptions) *Graph {
+	keepEdge := func(e *Edge) bool {
+		if e.Kind == EdgeCall {
+			return opts.Calls
+		}
+		return opts.Hierarchy
+	}
+
+	edges := g.Edges()
+	adj := make(map[string][]*Edge)
+	connected := make(map[string]bool)
+	for _, e := range edges {
+		if keepEdge(e) {
+			adj[e.From] = append(adj[e.From], e)
+			connected[e.From] = true
+			connected[e.To] = true
+		}
+	}
+
+	// Breadth-first search from the root nodes.
+	dist := make(map[string]int)
+	var queue []string
+	for _, n := range g.Nodes() {
+		// Nodes that have only filtered out edges are not included.
+		if !connected[n.ID] || !inNamespace(n.ID, opts.Namespace) {
+			continue
+		}
+		dist[n.ID] = 0
+		queue = append(queue, n.ID)
+	}
+	for len(queue) != 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if opts.Depth >= 0 && dist[id] >= opts.Depth {
+			continue
+		}
+		for _, e := range adj[id] {
+			if _, ok := dist[e.To]; !ok {
+				dist[e.To] = dist[id] + 1
+				queue = append(queue, e.To)
+			}
+		}
+	}
+
+	res := NewGraph()
+	g.mu.Lock()
+	for id := range dist {
+		res.nodes[id] = g.nodes[id]
+	}
+	g.mu.Unlock()
+	for _, e := range edges {
+		_, fromOK := dist[e.From]
+		_, toOK := dist[e.To]
+		if fromOK && toOK && keepEdge(e) {
+			res.edges[edgeKey{from: e.From, to: e.To, kind: e.Kind}] = e
+		}
+	}
+	return res
+}
+
+// inNamespace reports whether symbol with a given ID belongs to ns.
+// Class names are also permitted as ns, so methods can be selected by their class.
+func inNamespace(id, ns string) bool {
+	ns = strings.Trim(ns, `\`)
+	if ns == "" {
+		return true
+	}
+	ns = `\` + ns
+	return id == ns || strings.HasPrefix(id, ns+`\`) || strings.HasPrefix(id, ns+"::")
+}
+
+// WriteJSON writes graph as a JSON object with "nodes" and "edges" arrays.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	type graphJSON struct {
+		Nodes []*Node `json:"nodes"`
+		Edges []*Edge `json:"edges"`
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(graphJSON{Nodes: g.Nodes(), Edges: g.Edges()})
+}
+
+// WriteDOT writes graph in a Graphviz DOT format.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var buf strings.Builder
+
+	buf.WriteString("digraph noverify {\n")
+	buf.WriteString("  rankdir=LR;\n")
+	for _, n := range g.Nodes() {
+		fmt.Fprintf(&buf, "  %s [label=%s, shape=%s];\n", dotQuote(n.ID), dotQuote(n.ID), dotShape(n.Kind))
+	}
+	for _, e := range g.Edges() {
+		fmt.Fprintf(&buf, "  %s -> %s [%s];\n", dotQuote(e.From), dotQuote(e.To), dotEdgeAttrs(e))
+	}
+	buf.WriteString("}\n")
+
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func dotShape(kind NodeKind) string {
+	switch kind {
+	case KindClass:
+		return "box"
+	case KindInterface:
+		return "component"
+	case KindTrait:
+		return "box3d"
+	default:
+		return "ellipse"
+	}
+}
+
+func dotEdgeAttrs(e *Edge) string {
+	switch e.Kind {
+	case EdgeExtends:
+		return "arrowhead=empty"
+	case EdgeImplements:
+		return "arrowhead=empty, style=dashed"
+	case EdgeUses:
+		return "style=dotted"
+	default:
+		return fmt.Sprintf("label=%d", e.Count)
+	}
+}
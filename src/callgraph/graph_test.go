@@ -0,0 +1,82 @@
+package callgraph
+
+import (
+	"strings"
+	"testing"
+)
+
+func testGraph() *Graph {
+	fn := func(id string) Node { return Node{ID: id, Kind: KindFunction} }
+	class := func(id string) Node { return Node{ID: id, Kind: KindClass} }
+
+	g := NewGraph()
+	g.AddEdge(fn(`\A\f`), fn(`\A\g`), EdgeCall)
+	g.AddEdge(fn(`\A\f`), fn(`\A\g`), EdgeCall)
+	g.AddEdge(fn(`\A\g`), fn(`\B\h`), EdgeCall)
+	g.AddEdge(fn(`\B\h`), fn(`\C\k`), EdgeCall)
+	g.AddEdge(class(`\A\Foo`), class(`\B\Base`), EdgeExtends)
+	return g
+}
+
+func graphString(g *Graph) string {
+	var parts []string
+	for _, e := range g.Edges() {
+		parts = append(parts, e.From+" -"+string(e.Kind)+"-> "+e.To)
+	}
+	return strings.Join(parts, "; ")
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		opts FilterOptions
+		want string
+	}{
+		{
+			opts: FilterOptions{Depth: -1, Calls: true, Hierarchy: true},
+			want: `\A\Foo -extends-> \B\Base; \A\f -call-> \A\g; \A\g -call-> \B\h; \B\h -call-> \C\k`,
+		},
+		{
+			opts: FilterOptions{Depth: -1, Hierarchy: true},
+			want: `\A\Foo -extends-> \B\Base`,
+		},
+		{
+			opts: FilterOptions{Namespace: `A`, Depth: 0, Calls: true},
+			want: `\A\f -call-> \A\g`,
+		},
+		{
+			opts: FilterOptions{Namespace: `\A\`, Depth: 1, Calls: true},
+			want: `\A\f -call-> \A\g; \A\g -call-> \B\h`,
+		},
+		{
+			opts: FilterOptions{Namespace: `B`, Depth: -1, Calls: true, Hierarchy: true},
+			want: `\B\h -call-> \C\k`,
+		},
+	}
+
+	g := testGraph()
+	for _, test := range tests {
+		have := graphString(g.Filter(test.opts))
+		if have != test.want {
+			t.Errorf("Filter(%+v):\nhave: %s\nwant: %s", test.opts, have, test.want)
+		}
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	var buf strings.Builder
+	g := testGraph().Filter(FilterOptions{Namespace: `A`, Depth: 0, Calls: true, Hierarchy: true})
+	if err := g.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `digraph noverify {
+  rankdir=LR;
+  "\\A\\Foo" [label="\\A\\Foo", shape=box];
+  "\\A\\f" [label="\\A\\f", shape=ellipse];
+  "\\A\\g" [label="\\A\\g", shape=ellipse];
+  "\\A\\f" -> "\\A\\g" [label=2];
+}
+`
+	if buf.String() != want {
+		t.Errorf("DOT mismatch:\nhave:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,190 @@
+package cmd
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/setpill/noverify/src/linter"
+	"github.com/setpill/noverify/src/linter/lintapi"
+	"github.com/setpill/noverify/src/rules"
+)
+
+var checksCommand = &subCommand{
+	name:        "checks",
+	description: "Print documentation for all checks and -rules in markdown or JSON format",
+	bindFlags:   bindChecksFlags,
+	main:        checksMain,
+}
+
+var checksFormat string
+
+func bindChecksFlags() {
+	flag.StringVar(&checksFormat, "format", "markdown", "Output format: markdown or json")
+}
+
+// checkDoc is a check documentation entry.
+// Rule-specific fields are empty for the built-in checks.
+type checkDoc struct {
+	Name     string `json:"name"`
+	Default  bool   `json:"default"`
+	Severity string `json:"severity,omitempty"`
+	Comment  string `json:"comment"`
+
+	Message  string `json:"message,omitempty"`
+	Pattern  string `json:"pattern,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+func checksMain() (int, error) {
+	var write func(w io.Writer, checks, rules []checkDoc) error
+	switch checksFormat {
+	case "markdown":
+		write = writeChecksMarkdown
+	case "json":
+		write = writeChecksJSON
+	default:
+		return 0, fmt.Errorf("unexpected -format value %q", checksFormat)
+	}
+
+	checks := collectCheckDocs()
+	enabled := make(map[string]bool)
+	for _, c := range checks {
+		enabled[c.Name] = c.Default
+	}
+
+	var ruleDocs []checkDoc
+	if rulesList != "" {
+		rset, err := rules.ParseFiles(strings.Split(rulesList, ","))
+		if err != nil {
+			return 0, err
+		}
+		ruleDocs = collectRuleDocs(rset, enabled)
+	}
+
+	if err := write(os.Stdout, checks, ruleDocs); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// collectCheckDocs returns the declared checks documentation.
+func collectCheckDocs() []checkDoc {
+	var res []checkDoc
+	for _, info := range linter.GetDeclaredChecks() {
+		res = append(res, checkDoc{
+			Name:     info.Name,
+			Default:  info.Default,
+			Severity: severityName(info.Severity),
+			Comment:  info.Comment,
+		})
+	}
+	return res
+}
+
+// collectRuleDocs returns rset rules documentation sorted by the rule location.
+// Unnamed rules are always enabled, named rules are enabled by default
+// only if their name is enabled by default.
+func collectRuleDocs(rset *rules.Set, enabled map[string]bool) []checkDoc {
+	for _, name := range rset.AlwaysAllowed {
+		enabled[name] = true
+	}
+
+	var res []checkDoc
+	for _, scoped := range []*rules.ScopedSet{rset.Any, rset.Root, rset.Local} {
+		for _, list := range scoped.RulesByKind {
+			for _, rule := range list {
+				res = append(res, checkDoc{
+					Name:     rule.Name,
+					Default:  enabled[rule.Name],
+					Severity: severityName(rule.Level),
+					Comment:  rule.Doc,
+					Message:  rule.Message,
+					Pattern:  rule.Pattern,
+					Filename: rule.Filename,
+					Line:     rule.Line,
+				})
+			}
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Filename != res[j].Filename {
+			return res[i].Filename < res[j].Filename
+		}
+		return res[i].Line < res[j].Line
+	})
+	return res
+}
+
+func severityName(level int) string {
+	switch level {
+	case lintapi.LevelError:
+		return "error"
+	case lintapi.LevelWarning:
+		return "warning"
+	case lintapi.LevelInformation:
+		return "info"
+	case lintapi.LevelHint:
+		return "hint"
+	case lintapi.LevelUnused:
+		return "unused"
+	case lintapi.LevelMaybe:
+		return "maybe"
+	case lintapi.LevelSyntax:
+		return "syntax"
+	default:
+		return ""
+	}
+}
+
+func writeChecksJSON(w io.Writer, checks, rules []checkDoc) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(append(checks, rules...))
+}
+
+func writeChecksMarkdown(w io.Writer, checks, rules []checkDoc) error {
+	var buf strings.Builder
+
+	buf.WriteString("## Checks\n\n")
+	buf.WriteString("| Name | Severity | Enabled by default | Description |\n")
+	buf.WriteString("| ---- | -------- | ------------------ | ----------- |\n")
+	for _, c := range checks {
+		fmt.Fprintf(&buf, "| `%s` | %s | %s | %s |\n", c.Name, c.Severity, yesNo(c.Default), markdownCell(c.Comment))
+	}
+
+	if len(rules) != 0 {
+		buf.WriteString("\n## Rules\n")
+	}
+	for _, r := range rules {
+		fmt.Fprintf(&buf, "\n### `%s`\n\n", r.Name)
+		if r.Comment != "" {
+			buf.WriteString(r.Comment + "\n\n")
+		}
+		fmt.Fprintf(&buf, "* Severity: %s\n", r.Severity)
+		fmt.Fprintf(&buf, "* Enabled by default: %s\n", yesNo(r.Default))
+		fmt.Fprintf(&buf, "* Message: %s\n", r.Message)
+		fmt.Fprintf(&buf, "* Defined at: %s:%d\n", r.Filename, r.Line)
+		fmt.Fprintf(&buf, "\n```php\n%s\n```\n", r.Pattern)
+	}
+
+	_, err := io.WriteString(w, buf.String())
+	return err
+}
+
+func yesNo(v bool) string {
+	if v {
+		return "yes"
+	}
+	return "no"
+}
+
+func markdownCell(s string) string {
+	return strings.Replace(s, "|", `\|`, -1)
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChecksSeverity(t *testing.T) {
+	checks := collectCheckDocs()
+	for _, c := range checks {
+		if c.Severity == "" {
+			t.Errorf("%s: severity is not declared", c.Name)
+		}
+	}
+
+	var buf strings.Builder
+	if err := writeChecksMarkdown(&buf, checks, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"| `undefined` | error | yes |",
+		"| `unused` | unused | yes |",
+		"| `arraySyntax` | maybe | yes |",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("no %q line in:\n%s", want, buf.String())
+		}
+	}
+}
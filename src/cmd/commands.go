@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+
+	"github.com/setpill/noverify/src/linter"
+)
+
+// subCommand is a noverify mode that is selected by the first
+// command-line argument, like `noverify graph`.
+//
+// Subcommands share the global flags (like -stubs-dir or -cores)
+// and can bind their own flags in addition to them.
+type subCommand struct {
+	name string
+
+	// description is a short one-line command summary.
+	description string
+
+	// bindFlags registers command-specific flags.
+	// Can be nil.
+	bindFlags func()
+
+	// main is executed instead of mainNoExit.
+	// Same return value conventions apply.
+	main func() (int, error)
+}
+
+var subCommands = []*subCommand{
+	graphCommand,
+	fmtCommand,
+	grepCommand,
+	rewriteCommand,
+	testRulesCommand,
+	checksCommand,
+}
+
+// findSubCommand returns a subcommand selected by args.
+// Returns nil if no subcommand is selected.
+func findSubCommand(args []string) *subCommand {
+	if len(args) == 0 {
+		return nil
+	}
+	for _, cmd := range subCommands {
+		if cmd.name == args[0] {
+			return cmd
+		}
+	}
+	return nil
+}
+
+func printSubCommands(w io.Writer) {
+	fmt.Fprintf(w, "Commands:\n")
+	for _, cmd := range subCommands {
+		fmt.Fprintf(w, "  %s\n", cmd.name)
+		fmt.Fprintf(w, "    \t%s\n", cmd.description)
+	}
+}
+
+// forEachFile calls fn for every PHP file from the paths list.
+// Directories are walked recursively, files that match -exclude are skipped.
+func forEachFile(paths []string, fn func(filename string, src []byte)) {
+	ch := make(chan linter.FileInfo)
+	go func() {
+		linter.ReadFilenames(paths, linter.ExcludeRegex)(ch)
+		close(ch)
+	}()
+
+	for f := range ch {
+		src, err := ioutil.ReadFile(f.Filename)
+		if err != nil {
+			log.Printf("Could not read %s: %v", f.Filename, err)
+			continue
+		}
+		fn(f.Filename, src)
+	}
+}
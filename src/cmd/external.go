@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/setpill/noverify/src/linter"
+)
+
+// startExternalCheckers runs checker commands from the comma-separated list.
+//
+// Like plugins, external checkers can declare checks that are enabled by default,
+// so -allow-checks default value is updated after they're started.
+func startExternalCheckers(list string) error {
+	if list == "" {
+		return nil
+	}
+
+	for _, command := range strings.Split(list, ",") {
+		c, err := linter.StartExternalChecker(command)
+		if err != nil {
+			linter.CloseExternalCheckers()
+			return fmt.Errorf("start external checker %q: %v", command, err)
+		}
+		linter.ExternalCheckers = append(linter.ExternalCheckers, c)
+	}
+
+	updateAllowChecksDefault()
+	return nil
+}
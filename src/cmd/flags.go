@@ -52,6 +52,18 @@ var (
 
 	rulesList string
 
+	pluginsList string
+
+	externalCheckersList string
+
+	configFile string
+	depsGraph  bool
+
+	dupCode          bool
+	dupCodeMinStmts  int
+	dupCodeMinTokens int
+	dupCodeJSON      string
+
 	output     string
 	outputJSON bool
 
@@ -61,19 +73,27 @@ var (
 	memProfile string
 )
 
-func bindFlags() {
-	var enabledByDefault []string
-	declaredChecks := linter.GetDeclaredChecks()
-	for _, info := range declaredChecks {
+// enabledByDefault returns the names of all declared checks that are enabled by default.
+func enabledByDefault() []string {
+	var names []string
+	for _, info := range linter.GetDeclaredChecks() {
 		if info.Default {
-			enabledByDefault = append(enabledByDefault, info.Name)
+			names = append(names, info.Name)
 		}
 	}
+	return names
+}
+
+func bindFlags() {
+	declaredChecks := linter.GetDeclaredChecks()
 
 	flag.Usage = func() {
 		out := flag.CommandLine.Output()
 		fmt.Fprintf(out, "Usage of noverify:\n")
 		fmt.Fprintf(out, "  $ noverify -stubs-dir=/path/to/phpstorm-stubs -cache-dir=/cache/dir /project/root\n")
+		fmt.Fprintf(out, "  $ noverify <command> [flags] /project/root\n")
+		fmt.Fprintln(out)
+		printSubCommands(out)
 		fmt.Fprintln(out)
 		fmt.Fprintf(out, "Flags:\n")
 		flag.PrintDefaults()
@@ -97,6 +117,23 @@ func bindFlags() {
 	flag.StringVar(&rulesList, "rules", "",
 		"Comma-separated list of rules files")
 
+	flag.StringVar(&pluginsList, "plugins", "",
+		"Comma-separated list of Go plugins (.so files) with custom checkers, see docs/writing-checks-in-go.md")
+	flag.StringVar(&externalCheckersList, "external-checkers", "",
+		"Comma-separated list of external checker commands, see docs/external-checkers.md")
+	flag.DurationVar(&linter.ExternalCheckerTimeout, "external-checker-timeout", linter.ExternalCheckerTimeout,
+		"Max time to wait for an external checker response, the checker is disabled after the timeout")
+
+	flag.StringVar(&configFile, "config", "",
+		"JSON config file with architecture layers definitions, see docs/layers.md")
+	flag.BoolVar(&depsGraph, "deps-graph", false,
+		"Print namespace dependency graph and its cycles after the analysis")
+
+	flag.BoolVar(&dupCode, "dup-code", false, "Enable duplicated code (clones) detection, see dupCode check")
+	flag.IntVar(&dupCodeMinStmts, "dup-code-min-stmts", 5, "Min number of consecutive statements in a reported clone")
+	flag.IntVar(&dupCodeMinTokens, "dup-code-min-tokens", 50, "Min size of a reported clone, measured in AST nodes")
+	flag.StringVar(&dupCodeJSON, "dup-code-json", "", "Write clones summary in JSON format to a specified file")
+
 	flag.StringVar(&gitRepo, "git", "", "Path to git repository to analyze")
 	flag.StringVar(&gitCommitFrom, "git-commit-from", "", "Analyze changes between commits <git-commit-from> and <git-commit-to>")
 	flag.StringVar(&gitCommitTo, "git-commit-to", "", "")
@@ -112,7 +149,7 @@ func bindFlags() {
 	flag.StringVar(&reportsExclude, "exclude", "", "Exclude regexp for filenames in reports list")
 	flag.StringVar(&reportsExcludeChecks, "exclude-checks", "", "Comma-separated list of check names to be excluded")
 	flag.StringVar(&allowDisable, "allow-disable", "", "Regexp for filenames where '@linter disable' is allowed")
-	flag.StringVar(&allowChecks, "allow-checks", strings.Join(enabledByDefault, ","),
+	flag.StringVar(&allowChecks, "allow-checks", strings.Join(enabledByDefault(), ","),
 		"Comma-separated list of check names to be enabled")
 
 	flag.StringVar(&phpExtensionsArg, "php-extensions", "php,inc,php5,phtml,inc", "List of PHP extensions to be recognized")
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/setpill/noverify/src/linter"
+	"github.com/setpill/noverify/src/phpfmt"
+)
+
+var fmtCommand = &subCommand{
+	name:        "fmt",
+	description: "Format PHP files according to the PSR-12 coding style",
+	bindFlags:   bindFmtFlags,
+	main:        fmtMain,
+}
+
+var (
+	fmtList  bool
+	fmtDiff  bool
+	fmtWrite bool
+)
+
+func bindFmtFlags() {
+	flag.BoolVar(&fmtList, "l", false, "List files whose formatting differs from the PSR-12 one")
+	flag.BoolVar(&fmtDiff, "d", false, "Print diffs instead of the formatted sources")
+	flag.BoolVar(&fmtWrite, "w", false, "Write the formatted sources back to the files instead of stdout")
+}
+
+// fmtMain formats files and directories specified in the command line.
+// If no files are specified, stdin is formatted.
+//
+// In -l and -d modes exit status is 2 if some files are not formatted.
+func fmtMain() (int, error) {
+	linter.PHPExtensions = strings.Split(phpExtensionsArg, ",")
+	if err := compileRegexes(); err != nil {
+		return 0, err
+	}
+
+	if flag.NArg() == 0 {
+		if fmtWrite {
+			return 0, fmt.Errorf("can't use -w while formatting stdin")
+		}
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return 0, err
+		}
+		changed, err := fmtFile("<stdin>", src)
+		if err != nil {
+			return 0, err
+		}
+		return fmtStatus(changed), nil
+	}
+
+	changed := false
+	failed := false
+	forEachFile(flag.Args(), func(filename string, src []byte) {
+		fileChanged, err := fmtFile(filename, src)
+		if err != nil {
+			log.Printf("%s: %v", filename, err)
+			failed = true
+			return
+		}
+		changed = changed || fileChanged
+	})
+
+	if failed {
+		return 1, nil
+	}
+	return fmtStatus(changed), nil
+}
+
+func fmtStatus(changed bool) int {
+	if changed && (fmtList || fmtDiff) {
+		return 2
+	}
+	return 0
+}
+
+// fmtFile formats a single file contents according to the fmt flags.
+// Reports whether the formatted contents differs from src.
+func fmtFile(filename string, src []byte) (bool, error) {
+	res, err := phpfmt.Format(filename, src)
+	if err != nil {
+		return false, err
+	}
+	changed := !bytes.Equal(src, res)
+
+	if fmtList && changed {
+		fmt.Println(filename)
+	}
+	if fmtDiff && changed {
+		fmt.Print(phpfmt.Diff(filename, src, res))
+	}
+	if fmtWrite && changed {
+		if err := ioutil.WriteFile(filename, res, 0644); err != nil {
+			return changed, err
+		}
+	}
+	if !fmtList && !fmtDiff && !fmtWrite {
+		os.Stdout.Write(res)
+	}
+	return changed, nil
+}
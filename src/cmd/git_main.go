@@ -8,10 +8,10 @@ import (
 
 	"github.com/setpill/noverify/src/git"
 	"github.com/setpill/noverify/src/linter"
-	"github.com/setpill/noverify/src/meta"
 )
 
-func gitParseUntracked() []*linter.Report {
+// gitUntrackedFiles returns the untracked files if they should be analyzed.
+func gitUntrackedFiles() []string {
 	if !gitIncludeUntracked {
 		return nil
 	}
@@ -21,20 +21,19 @@ func gitParseUntracked() []*linter.Report {
 		log.Fatalf("get untracked files: %v", err)
 	}
 
-	return linter.ParseFilenames(linter.ReadFilenames(filenames, nil))
+	return filenames
 }
 
-func parseIndexOnlyFiles() {
+func indexOnlyFilesList() []string {
 	if indexOnlyFiles == "" {
-		return
+		return nil
 	}
-	filenames := strings.Split(indexOnlyFiles, ",")
-	linter.ParseFilenames(linter.ReadFilenames(filenames, nil))
+	return strings.Split(indexOnlyFiles, ",")
 }
 
 // Not the best name, and not the best function signature.
 // Refactor this function whenever you get the idea how to separate logic better.
-func gitRepoComputeReportsFromCommits(logArgs, diffArgs []string) (oldReports, reports []*linter.Report, changes []git.Change, changeLog []git.Commit, ok bool) {
+func gitRepoComputeReportsFromCommits(l *linter.Linter, logArgs, diffArgs []string) (oldReports, reports []*linter.Report, changes []git.Change, changeLog []git.Commit, ok bool) {
 	// TODO(quasilyte): hard to replace fatalf with error return here. Use panicf for now.
 
 	start := time.Now()
@@ -53,59 +52,51 @@ func gitRepoComputeReportsFromCommits(logArgs, diffArgs []string) (oldReports, r
 	}
 
 	if gitFullDiff {
-		meta.ResetInfo()
-		linter.InitStubs()
+		// The old commit is analyzed with its own index.
+		oldLinter, err := newLinter()
+		if err != nil {
+			log.Panicf("Could not init stubs: %s", err.Error())
+		}
 
 		start = time.Now()
-		linter.ParseFilenames(linter.ReadFilesFromGit(gitRepo, gitCommitFrom, nil))
-		parseIndexOnlyFiles()
+		oldLinter.Index(linter.ReadFilesFromGit(gitRepo, gitCommitFrom, nil))
+		oldLinter.Index(linter.ReadFilenames(indexOnlyFilesList(), nil))
 		log.Printf("Indexed old commit in %s", time.Since(start))
 
-		meta.SetIndexingComplete(true)
-
 		start = time.Now()
-		oldReports = linter.ParseFilenames(linter.ReadFilesFromGit(gitRepo, gitCommitFrom, linter.ExcludeRegex))
+		oldReports = oldLinter.Analyze(linter.ReadFilesFromGit(gitRepo, gitCommitFrom, oldLinter.Config().ExcludeRegex))
 		log.Printf("Parsed old commit for %s (%d reports)", time.Since(start), len(oldReports))
 
-		meta.ResetInfo()
-		linter.InitStubs()
-
 		start = time.Now()
-		linter.ParseFilenames(linter.ReadFilesFromGit(gitRepo, gitCommitTo, nil))
+		l.Index(linter.ReadFilesFromGit(gitRepo, gitCommitTo, nil))
 		log.Printf("Indexed new commit in %s", time.Since(start))
 
-		meta.SetIndexingComplete(true)
-
 		start = time.Now()
-		reports = linter.ParseFilenames(linter.ReadFilesFromGit(gitRepo, gitCommitTo, linter.ExcludeRegex))
+		reports = l.Analyze(linter.ReadFilesFromGit(gitRepo, gitCommitTo, l.Config().ExcludeRegex))
 		log.Printf("Parsed new commit in %s (%d reports)", time.Since(start), len(reports))
 	} else {
 		start = time.Now()
-		linter.ParseFilenames(linter.ReadFilesFromGit(gitRepo, gitCommitTo, nil))
-		parseIndexOnlyFiles()
+		l.Index(linter.ReadFilesFromGit(gitRepo, gitCommitTo, nil))
+		l.Index(linter.ReadFilenames(indexOnlyFilesList(), nil))
 		log.Printf("Indexing complete in %s", time.Since(start))
 
-		meta.SetIndexingComplete(true)
-
 		start = time.Now()
-		oldReports = linter.ParseFilenames(linter.ReadOldFilesFromGit(gitRepo, gitCommitFrom, changes))
+		oldReports = l.Analyze(linter.ReadOldFilesFromGit(gitRepo, gitCommitFrom, changes))
 		log.Printf("Parsed old files versions for %s", time.Since(start))
 
 		start = time.Now()
-		meta.SetIndexingComplete(false)
-		linter.ParseFilenames(linter.ReadFilesFromGitWithChanges(gitRepo, gitCommitTo, changes))
-		meta.SetIndexingComplete(true)
+		l.Index(linter.ReadFilesFromGitWithChanges(gitRepo, gitCommitTo, changes))
 		log.Printf("Indexed files versions for %s", time.Since(start))
 
 		start = time.Now()
-		reports = linter.ParseFilenames(linter.ReadFilesFromGitWithChanges(gitRepo, gitCommitTo, changes))
+		reports = l.Analyze(linter.ReadFilesFromGitWithChanges(gitRepo, gitCommitTo, changes))
 		log.Printf("Parsed new file versions in %s", time.Since(start))
 	}
 
 	return oldReports, reports, changes, changeLog, true
 }
 
-func gitRepoComputeReportsFromLocalChanges() (oldReports, reports []*linter.Report, changes []git.Change, ok bool) {
+func gitRepoComputeReportsFromLocalChanges(l *linter.Linter) (oldReports, reports []*linter.Report, changes []git.Change, ok bool) {
 	// TODO(quasilyte): hard to replace fatalf with error return here. Use panicf for now.
 
 	if gitWorkTree == "" {
@@ -125,26 +116,24 @@ func gitRepoComputeReportsFromLocalChanges() (oldReports, reports []*linter.Repo
 	log.Printf("You have changes in your work tree, showing diff between %s and work tree", gitCommitFrom)
 
 	start := time.Now()
-	linter.ParseFilenames(linter.ReadFilesFromGit(gitRepo, gitCommitFrom, nil))
-	parseIndexOnlyFiles()
+	l.Index(linter.ReadFilesFromGit(gitRepo, gitCommitFrom, nil))
+	l.Index(linter.ReadFilenames(indexOnlyFilesList(), nil))
 	log.Printf("Indexing complete in %s", time.Since(start))
 
-	meta.SetIndexingComplete(true)
-
 	start = time.Now()
-	oldReports = linter.ParseFilenames(linter.ReadOldFilesFromGit(gitRepo, gitCommitFrom, changes))
+	oldReports = l.Analyze(linter.ReadOldFilesFromGit(gitRepo, gitCommitFrom, changes))
 	log.Printf("Parsed old files versions for %s", time.Since(start))
 
+	untracked := gitUntrackedFiles()
+
 	start = time.Now()
-	meta.SetIndexingComplete(false)
-	linter.ParseFilenames(linter.ReadChangesFromWorkTree(gitWorkTree, changes))
-	gitParseUntracked()
-	meta.SetIndexingComplete(true)
+	l.Index(linter.ReadChangesFromWorkTree(gitWorkTree, changes))
+	l.Index(linter.ReadFilenames(untracked, nil))
 	log.Printf("Indexed new files versions for %s", time.Since(start))
 
 	start = time.Now()
-	reports = linter.ParseFilenames(linter.ReadChangesFromWorkTree(gitWorkTree, changes))
-	reports = append(reports, gitParseUntracked()...)
+	reports = l.Analyze(linter.ReadChangesFromWorkTree(gitWorkTree, changes))
+	reports = append(reports, l.Analyze(linter.ReadFilenames(untracked, nil))...)
 	log.Printf("Parsed new file versions in %s", time.Since(start))
 
 	return oldReports, reports, changes, true
@@ -165,9 +154,14 @@ func gitMain() (int, error) {
 		return 0, err
 	}
 
-	oldReports, reports, changes, ok = gitRepoComputeReportsFromLocalChanges()
+	l, err := newLinter()
+	if err != nil {
+		return 0, fmt.Errorf("Init stubs: %v", err)
+	}
+
+	oldReports, reports, changes, ok = gitRepoComputeReportsFromLocalChanges(l)
 	if !ok {
-		oldReports, reports, changes, changeLog, ok = gitRepoComputeReportsFromCommits(logArgs, diffArgs)
+		oldReports, reports, changes, changeLog, ok = gitRepoComputeReportsFromCommits(l, logArgs, diffArgs)
 		if !ok {
 			return 0, nil
 		}
@@ -180,7 +174,7 @@ func gitMain() (int, error) {
 	}
 	log.Printf("Computed reports diff for %s", time.Since(start))
 
-	criticalReports := analyzeReports(diff)
+	criticalReports := analyzeReports(l.Config(), diff)
 
 	if criticalReports > 0 {
 		log.Printf("Found %d critical issues, please fix them.", criticalReports)
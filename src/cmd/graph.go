@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/setpill/noverify/src/callgraph"
+	"github.com/setpill/noverify/src/linter"
+)
+
+var graphCommand = &subCommand{
+	name:        "graph",
+	description: "Export call graph and class hierarchy in DOT or JSON format",
+	bindFlags:   bindGraphFlags,
+	main:        graphMain,
+}
+
+var (
+	graphFormat    string
+	graphNamespace string
+	graphDepth     int
+	graphKind      string
+	graphInternal  bool
+)
+
+func bindGraphFlags() {
+	flag.StringVar(&graphFormat, "format", "dot", "Graph output format: dot or json")
+	flag.StringVar(&graphNamespace, "namespace", "", "Only start from the symbols of the specified namespace (e.g. App\\Model)")
+	flag.IntVar(&graphDepth, "depth", -1, "Max number of edges to follow from the -namespace symbols (negative means no limit)")
+	flag.StringVar(&graphKind, "kind", "all", "Edges to export: calls, hierarchy or all")
+	flag.BoolVar(&graphInternal, "internal", false, "Include calls to the builtin functions and classes")
+}
+
+func graphMain() (int, error) {
+	filter := callgraph.FilterOptions{
+		Namespace: graphNamespace,
+		Depth:     graphDepth,
+	}
+	switch graphKind {
+	case "calls":
+		filter.Calls = true
+	case "hierarchy":
+		filter.Hierarchy = true
+	case "all":
+		filter.Calls = true
+		filter.Hierarchy = true
+	default:
+		return 0, fmt.Errorf("unexpected -kind value %q", graphKind)
+	}
+
+	var write func(g *callgraph.Graph, w io.Writer) error
+	switch graphFormat {
+	case "dot":
+		write = (*callgraph.Graph).WriteDOT
+	case "json":
+		write = (*callgraph.Graph).WriteJSON
+	default:
+		return 0, fmt.Errorf("unexpected -format value %q", graphFormat)
+	}
+
+	if err := initLinter(); err != nil {
+		return 0, err
+	}
+	l, err := newLinter()
+	if err != nil {
+		return 0, err
+	}
+
+	log.Printf("Indexing %+v", flag.Args())
+	l.Index(linter.ReadFilenames(flag.Args(), nil))
+
+	collector := &callgraph.Collector{
+		Graph:    callgraph.NewGraph(),
+		Internal: graphInternal,
+	}
+	collector.Register(l)
+
+	log.Printf("Building graph")
+	l.Analyze(linter.ReadFilenames(flag.Args(), l.Config().ExcludeRegex))
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			return 0, fmt.Errorf("Could not open output file: %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := write(collector.Graph.Filter(filter), w); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
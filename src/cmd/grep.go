@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/setpill/noverify/src/linter"
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/php7"
+	"github.com/setpill/noverify/src/phpfmt"
+	"github.com/setpill/noverify/src/phpgrep"
+)
+
+var grepCommand = &subCommand{
+	name:        "grep",
+	description: "Search PHP code by a phpgrep pattern: grep 'pattern' [filters] paths...",
+	bindFlags:   bindGrepFlags,
+	main:        grepMain,
+}
+
+var rewriteCommand = &subCommand{
+	name:        "rewrite",
+	description: "Replace phpgrep pattern matches: rewrite 'pattern' 'replacement' [filters] paths...",
+	bindFlags:   bindRewriteFlags,
+	main:        rewriteMain,
+}
+
+var (
+	grepJSON    bool
+	rewriteDiff bool
+)
+
+func bindGrepFlags() {
+	flag.BoolVar(&grepJSON, "json", false, "Print every match as a JSON object on its own line")
+}
+
+func bindRewriteFlags() {
+	flag.BoolVar(&rewriteDiff, "d", false, "Dry run: print diffs instead of rewriting files")
+}
+
+// grepMatch is a JSON representation of the found match.
+type grepMatch struct {
+	Filename string            `json:"filename"`
+	Line     int               `json:"line"`
+	Text     string            `json:"text"`
+	Captures map[string]string `json:"captures,omitempty"`
+}
+
+// grepMain prints all pattern matches.
+// Exit status is 1 if nothing is found.
+func grepMain() (int, error) {
+	args, err := parsePatternArgs(flag.Args(), 1)
+	if err != nil {
+		return 0, err
+	}
+	var c phpgrep.Compiler
+	m, err := c.Compile([]byte(args.patterns[0]))
+	if err != nil {
+		return 0, fmt.Errorf("compile pattern: %v", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	found := false
+	forEachFile(args.paths, func(filename string, src []byte) {
+		root := parseForGrep(filename, src)
+		if root == nil {
+			return
+		}
+		m.Find(root, func(data *phpgrep.MatchData) bool {
+			if !phpgrep.MatchFilters(data, src, args.filters) {
+				return true
+			}
+			found = true
+			text := string(data.Text(src))
+			line := data.Node.GetPosition().StartLine
+			if !grepJSON {
+				fmt.Printf("%s:%d: %s\n", filename, line, oneLine(text))
+				return true
+			}
+			match := grepMatch{Filename: filename, Line: line, Text: text}
+			for name, n := range data.Named {
+				if n == nil {
+					continue
+				}
+				if match.Captures == nil {
+					match.Captures = make(map[string]string)
+				}
+				match.Captures[name] = string(phpgrep.NodeText(n, src))
+			}
+			if err := enc.Encode(match); err != nil {
+				log.Printf("encode match: %v", err)
+			}
+			return true
+		})
+	})
+
+	if !found {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// rewriteMain replaces pattern matches with the replacement template.
+// In -d mode exit status is 2 if some files would be changed.
+func rewriteMain() (int, error) {
+	args, err := parsePatternArgs(flag.Args(), 2)
+	if err != nil {
+		return 0, err
+	}
+	var c phpgrep.Compiler
+	m, err := c.Compile([]byte(args.patterns[0]))
+	if err != nil {
+		return 0, fmt.Errorf("compile pattern: %v", err)
+	}
+	tmpl, err := phpgrep.CompileTemplate([]byte(args.patterns[1]))
+	if err != nil {
+		return 0, fmt.Errorf("compile replacement: %v", err)
+	}
+
+	changed := false
+	forEachFile(args.paths, func(filename string, src []byte) {
+		root := parseForGrep(filename, src)
+		if root == nil {
+			return
+		}
+		res, count := m.Replace(root, src, tmpl, func(data *phpgrep.MatchData) bool {
+			return phpgrep.MatchFilters(data, src, args.filters)
+		})
+		if count == 0 {
+			return
+		}
+		changed = true
+
+		if rewriteDiff {
+			fmt.Print(phpfmt.Diff(filename, src, res))
+			return
+		}
+		if err := ioutil.WriteFile(filename, res, 0644); err != nil {
+			log.Printf("Could not write %s: %v", filename, err)
+			return
+		}
+		log.Printf("%s: %d replacements", filename, count)
+	})
+
+	if changed && rewriteDiff {
+		return 2, nil
+	}
+	return 0, nil
+}
+
+type patternArgs struct {
+	patterns []string
+	filters  []*phpgrep.Filter
+	paths    []string
+}
+
+// parsePatternArgs splits command arguments into n patterns,
+// followed by optional filters and a list of paths.
+//
+// An argument is a filter if it looks like a filter and there is no file
+// with such name, so `x=foo/` is a path if the directory exists.
+// The first path ends the filters, so does the `--` argument,
+// all arguments after it are paths.
+func parsePatternArgs(args []string, n int) (*patternArgs, error) {
+	if len(args) < n {
+		return nil, fmt.Errorf("expected %d pattern arguments, got %d", n, len(args))
+	}
+	res := &patternArgs{patterns: args[:n]}
+	args = args[n:]
+	for len(args) != 0 {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+		if !phpgrep.IsFilter(args[0]) || fileExists(args[0]) {
+			break
+		}
+		f, err := phpgrep.ParseFilter(args[0])
+		if err != nil {
+			return nil, err
+		}
+		res.filters = append(res.filters, f)
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no paths to search in are specified")
+	}
+	res.paths = args
+
+	linter.PHPExtensions = strings.Split(phpExtensionsArg, ",")
+	if err := compileRegexes(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return err == nil
+}
+
+func parseForGrep(filename string, src []byte) node.Node {
+	p := php7.NewParser(bytes.NewReader(src), filename)
+	p.Parse()
+	if errs := p.GetErrors(); len(errs) != 0 {
+		log.Printf("Could not parse %s: %s", filename, errs[0])
+		return nil
+	}
+	return p.GetRootNode()
+}
+
+var whitespaceWithNewlines = regexp.MustCompile(`\s*\n\s*`)
+
+// oneLine joins multi-line text lines with a space.
+func oneLine(s string) string {
+	return whitespaceWithNewlines.ReplaceAllString(s, " ")
+}
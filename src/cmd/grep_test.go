@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPatternArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grep-args")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A path that looks like a filter.
+	existing := filepath.Join(dir, "x=foo")
+	if err := os.Mkdir(existing, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args    []string
+		filters []string
+		paths   []string
+	}{
+		{
+			args:    []string{"f($x, $y)", "x=a,b", "$y!~^_", "src", "lib"},
+			filters: []string{"x", "y"},
+			paths:   []string{"src", "lib"},
+		},
+		{
+			args:    []string{"f($x)", existing, "x=a"},
+			filters: nil,
+			paths:   []string{existing, "x=a"},
+		},
+		{
+			args:    []string{"f($x)", "x=a", "--", "y~b.php"},
+			filters: []string{"x"},
+			paths:   []string{"y~b.php"},
+		},
+	}
+
+	for _, test := range tests {
+		args, err := parsePatternArgs(test.args, 1)
+		if err != nil {
+			t.Errorf("%q: %v", test.args, err)
+			continue
+		}
+		var filters []string
+		for _, f := range args.filters {
+			filters = append(filters, f.Name)
+		}
+		if !reflect.DeepEqual(filters, test.filters) {
+			t.Errorf("%q: filters: have %q, want %q", test.args, filters, test.filters)
+		}
+		if !reflect.DeepEqual(args.paths, test.paths) {
+			t.Errorf("%q: paths: have %q, want %q", test.args, args.paths, test.paths)
+		}
+	}
+
+	for _, args := range [][]string{{"f($x)"}, {"f($x)", "x=a"}, {"f($x)", "x=a", "--"}} {
+		if _, err := parsePatternArgs(args, 1); err == nil {
+			t.Errorf("%q: expected an error for missing paths", args)
+		}
+	}
+}
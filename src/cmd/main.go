@@ -1,11 +1,9 @@
 package cmd
 
 import (
-	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"net/http"
 	_ "net/http/pprof" // it is ok for actually main package
@@ -17,10 +15,11 @@ import (
 	"sync/atomic"
 
 	"github.com/setpill/noverify/src/cmd/stubs"
+	"github.com/setpill/noverify/src/dupcode"
 	"github.com/setpill/noverify/src/langsrv"
+	"github.com/setpill/noverify/src/layers"
 	"github.com/setpill/noverify/src/lintdebug"
 	"github.com/setpill/noverify/src/linter"
-	"github.com/setpill/noverify/src/meta"
 	"github.com/setpill/noverify/src/rules"
 )
 
@@ -36,7 +35,7 @@ func isCritical(r *linter.Report) bool {
 	return r.IsCritical()
 }
 
-func isEnabled(r *linter.Report) bool {
+func isEnabled(excludeRegex *regexp.Regexp, r *linter.Report) bool {
 	if !reportsIncludeChecksSet[r.CheckName()] {
 		return false // Not enabled by -allow-checks
 	}
@@ -45,12 +44,12 @@ func isEnabled(r *linter.Report) bool {
 		return false // Disabled by -exclude-checks
 	}
 
-	if linter.ExcludeRegex == nil {
+	if excludeRegex == nil {
 		return true
 	}
 
 	// Disabled by a file comment.
-	return !linter.ExcludeRegex.MatchString(r.GetFilename())
+	return !excludeRegex.MatchString(r.GetFilename())
 }
 
 // canBeDisabled returns whether or not '@linter disable' can be used for the specified file
@@ -71,13 +70,29 @@ func Main(cfg *MainConfig) {
 		cfg = &MainConfig{}
 	}
 
+	args := os.Args[1:]
+	mainFunc := mainNoExit
 	bindFlags()
-	flag.Parse()
+	if cmd := findSubCommand(args); cmd != nil {
+		args = args[1:]
+		mainFunc = cmd.main
+		if cmd.bindFlags != nil {
+			cmd.bindFlags()
+		}
+	}
+	flag.CommandLine.Parse(args)
+	if err := loadPlugins(pluginsList); err != nil {
+		log.Fatal(err)
+	}
+	if err := startExternalCheckers(externalCheckersList); err != nil {
+		log.Fatal(err)
+	}
 	if cfg.AfterFlagParse != nil {
 		cfg.AfterFlagParse()
 	}
 
-	status, err := mainNoExit()
+	status, err := mainFunc()
+	linter.CloseExternalCheckers()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -127,23 +142,16 @@ func mainNoExit() (int, error) {
 		}()
 	}
 
-	if err := setDiscardVarPredicate(); err != nil {
-		return 0, fmt.Errorf("compile unused-var-regex: %v", err)
-	}
-
-	linter.PHPExtensions = strings.Split(phpExtensionsArg, ",")
-	if err := compileRegexes(); err != nil {
+	if err := initLinter(); err != nil {
 		return 0, err
 	}
 
-	buildCheckMappings()
-
-	lintdebug.Register(func(msg string) { linter.DebugMessage("%s", msg) })
-	go linter.MemoryLimiterThread()
-
 	if linter.LangServer {
-		langsrv.RegisterDebug()
-		langsrv.Start()
+		var ruleFiles []string
+		if rulesList != "" {
+			ruleFiles = strings.Split(rulesList, ",")
+		}
+		langsrv.Start(ruleFiles)
 		return 0, nil
 	}
 
@@ -157,23 +165,31 @@ func mainNoExit() (int, error) {
 
 	log.Printf("Started")
 
-	if err := initStubs(); err != nil {
-		return 0, fmt.Errorf("Init stubs: %v", err)
-	}
-
 	if err := initRules(); err != nil {
 		return 0, fmt.Errorf("Init rules: %v", err)
 	}
 
+	if err := initLayers(); err != nil {
+		return 0, fmt.Errorf("Init layers: %v", err)
+	}
+
 	if gitRepo != "" {
 		return gitMain()
 	}
 
 	linter.AnalysisFiles = flag.Args()
 
+	if dupCode {
+		linter.DupCode = dupcode.NewIndex(dupCodeMinStmts, dupCodeMinTokens)
+	}
+
+	l, err := newLinter()
+	if err != nil {
+		return 0, fmt.Errorf("Init stubs: %v", err)
+	}
+
 	log.Printf("Indexing %+v", flag.Args())
-	linter.ParseFilenames(linter.ReadFilenames(flag.Args(), nil))
-	meta.SetIndexingComplete(true)
+	l.Index(linter.ReadFilenames(flag.Args(), nil))
 	log.Printf("Linting")
 
 	filenames := flag.Args()
@@ -181,8 +197,19 @@ func mainNoExit() (int, error) {
 		filenames = strings.Split(fullAnalysisFiles, ",")
 	}
 
-	reports := linter.ParseFilenames(linter.ReadFilenames(filenames, linter.ExcludeRegex))
-	criticalReports := analyzeReports(reports)
+	config := l.Config()
+	reports := l.Analyze(linter.ReadFilenames(filenames, config.ExcludeRegex))
+	if config.DupCode != nil {
+		reports = append(reports, l.DupCodeReports()...)
+		if err := writeDupCodeSummary(config.DupCode); err != nil {
+			return 0, fmt.Errorf("write clones summary: %v", err)
+		}
+	}
+	criticalReports := analyzeReports(config, reports)
+
+	if config.DepsGraph != nil {
+		config.DepsGraph.Print(outputFp)
+	}
 
 	if criticalReports > 0 {
 		log.Printf("Found %d critical reports", criticalReports)
@@ -191,6 +218,25 @@ func mainNoExit() (int, error) {
 	return 0, nil
 }
 
+// initLinter applies the global flags to the linter settings.
+func initLinter() error {
+	if err := setDiscardVarPredicate(); err != nil {
+		return fmt.Errorf("compile unused-var-regex: %v", err)
+	}
+
+	linter.PHPExtensions = strings.Split(phpExtensionsArg, ",")
+	if err := compileRegexes(); err != nil {
+		return err
+	}
+
+	buildCheckMappings()
+
+	lintdebug.Register(func(msg string) { linter.DebugMessage("%s", msg) })
+	go linter.MemoryLimiterThread()
+
+	return nil
+}
+
 func compileRegexes() error {
 	var err error
 
@@ -227,11 +273,11 @@ func buildCheckMappings() {
 	}
 }
 
-func analyzeReports(diff []*linter.Report) (criticalReports int) {
+func analyzeReports(config *linter.Config, diff []*linter.Report) (criticalReports int) {
 	filtered := make([]*linter.Report, 0, len(diff))
 	var linterErrors []string
 	for _, r := range diff {
-		if !isEnabled(r) {
+		if !isEnabled(config.ExcludeRegex, r) {
 			continue
 		}
 
@@ -282,88 +328,93 @@ func analyzeReports(diff []*linter.Report) (criticalReports int) {
 }
 
 func setDiscardVarPredicate() error {
-	switch unusedVarPattern {
-	case "^_$":
-		// Default pattern, only $_ is allowed.
-		// Don't change anything.
-	case "^_.*$":
-		// Leading underscore plus anything after it.
-		// Recognize as quite common pattern.
-		linter.IsDiscardVar = func(s string) bool {
-			return strings.HasPrefix(s, "_")
-		}
-	default:
-		re, err := regexp.Compile(unusedVarPattern)
-		if err != nil {
-			return err
-		}
-		linter.IsDiscardVar = re.MatchString
+	isDiscardVar, err := linter.DiscardVarPredicate(unusedVarPattern)
+	if err != nil {
+		return err
 	}
-
+	linter.IsDiscardVar = isDiscardVar
 	return nil
 }
 
-func initRules() error {
-	if rulesList == "" {
+func writeDupCodeSummary(index *dupcode.Index) error {
+	if dupCodeJSON == "" {
 		return nil
 	}
 
-	appendRules := func(dst, src *rules.ScopedSet) {
-		for i, list := range src.RulesByKind {
-			dst.RulesByKind[i] = append(dst.RulesByKind[i], list...)
-		}
+	f, err := os.Create(dupCodeJSON)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
 
-	p := rules.NewParser()
-	linter.Rules = rules.NewSet()
-	for _, filename := range strings.Split(rulesList, ",") {
-		data, err := ioutil.ReadFile(filename)
-		if err != nil {
-			return err
-		}
-		rset, err := p.Parse(filename, bytes.NewReader(data))
-		if err != nil {
-			return err
-		}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dupcode.NewSummary(index.Groups()))
+}
 
-		appendRules(linter.Rules.Any, rset.Any)
-		appendRules(linter.Rules.Root, rset.Root)
-		appendRules(linter.Rules.Local, rset.Local)
+func initLayers() error {
+	if depsGraph {
+		linter.DepsGraph = layers.NewGraph()
+	}
 
-		for _, name := range rset.AlwaysAllowed {
-			reportsIncludeChecksSet[name] = true
-		}
-		for _, name := range rset.AlwaysCritical {
-			reportsCriticalSet[name] = true
-		}
+	if configFile == "" {
+		return nil
 	}
 
-	return nil
+	f, err := os.Open(configFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	linter.Layers, err = layers.Parse(f)
+	return err
 }
 
-func initStubs() error {
-	if linter.StubsDir != "" {
-		linter.InitStubs()
+func initRules() error {
+	if rulesList == "" {
 		return nil
 	}
 
-	// Try to use embedded stubs (from stubs/phpstorm_stubs.go).
-	if err := loadEmbeddedStubs(); err != nil {
-		return fmt.Errorf("failed to load embedded stubs: %v", err)
+	rset, err := rules.ParseFiles(strings.Split(rulesList, ","))
+	if err != nil {
+		return err
+	}
+	linter.Rules = rset
+
+	for _, name := range rset.AlwaysAllowed {
+		reportsIncludeChecksSet[name] = true
+	}
+	for _, name := range rset.AlwaysCritical {
+		reportsCriticalSet[name] = true
 	}
 
 	return nil
 }
 
-func LoadEmbeddedStubs(filenames []string) error {
+// LoadEmbeddedStubs loads the embedded stubs files into the linter.
+func LoadEmbeddedStubs(l *linter.Linter, filenames []string) error {
 	var errorsCount int64
 
-	readStubs := func(ch chan linter.FileInfo) {
+	l.LoadStubs(readEmbeddedStubs(filenames, &errorsCount))
+
+	// Using atomic here for consistency.
+	if atomic.LoadInt64(&errorsCount) != 0 {
+		return fmt.Errorf("failed to load %d embedded files", errorsCount)
+	}
+
+	return nil
+}
+
+// readEmbeddedStubs reads the embedded stubs files, errorsCount
+// is incremented for every file that can't be read.
+func readEmbeddedStubs(filenames []string, errorsCount *int64) linter.ReadCallback {
+	return func(ch chan linter.FileInfo) {
 		for _, filename := range filenames {
 			data, err := stubs.Asset(filename)
 			if err != nil {
 				log.Printf("Failed to read embedded %q file: %v", filename, err)
-				atomic.AddInt64(&errorsCount, 1)
+				atomic.AddInt64(errorsCount, 1)
 				continue
 			}
 			ch <- linter.FileInfo{
@@ -372,22 +423,23 @@ func LoadEmbeddedStubs(filenames []string) error {
 			}
 		}
 	}
+}
 
-	linter.ParseFilenames(readStubs)
-	meta.Info.InitStubs()
-
-	// Using atomic here for consistency.
-	if atomic.LoadInt64(&errorsCount) != 0 {
-		return fmt.Errorf("failed to load %d embedded files", errorsCount)
+// newLinter creates the linter with the command line settings.
+// The embedded stubs are loaded into it unless the stubs directory is specified.
+func newLinter() (*linter.Linter, error) {
+	l := linter.NewLinter(linter.GlobalConfig())
+	if linter.StubsDir != "" {
+		return l, nil
 	}
 
-	return nil
-}
-
-func loadEmbeddedStubs() error {
 	filenames := stubs.AssetNames()
 	if len(filenames) == 0 {
-		return fmt.Errorf("empty file list")
+		return nil, fmt.Errorf("failed to load embedded stubs: empty file list")
+	}
+	if err := LoadEmbeddedStubs(l, filenames); err != nil {
+		return nil, fmt.Errorf("failed to load embedded stubs: %v", err)
 	}
-	return LoadEmbeddedStubs(filenames)
+
+	return l, nil
 }
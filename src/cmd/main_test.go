@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/setpill/noverify/src/dupcode"
+	"github.com/setpill/noverify/src/linter"
+)
+
+func TestDupCodeSummary(t *testing.T) {
+	files := map[string]string{
+		"a.php": `<?php
+function f($a) {
+  $x = $a + 1;
+  $y = $x * 2;
+  echo "hello";
+  return $y;
+}
+
+function g($a) {
+  $x = $a + 1;
+  return $x;
+}
+`,
+		"b.php": `<?php
+function h($b) {
+  $p = $b + 1;
+  $q = $p * 2;
+  echo "world";
+  return $q;
+}
+
+function k($b) {
+  $p = $b + 1;
+  return $p;
+}
+`,
+	}
+	readFiles := func(ch chan linter.FileInfo) {
+		for filename, contents := range files {
+			ch <- linter.FileInfo{Filename: filename, Contents: []byte(contents)}
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "dupcode-summary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oldDupCodeJSON := dupCodeJSON
+	defer func() { dupCodeJSON = oldDupCodeJSON }()
+	dupCodeJSON = filepath.Join(dir, "clones.json")
+
+	config := linter.NewConfig()
+	config.DupCode = dupcode.NewIndex(3, 0)
+	l := linter.NewLinter(config)
+	l.Index(readFiles)
+	l.Analyze(readFiles)
+	if err := writeDupCodeSummary(config.DupCode); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(dupCodeJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var have interface{}
+	if err := json.Unmarshal(data, &have); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only f and h bodies are clones, g and k have less statements.
+	fragment := func(filename string) map[string]interface{} {
+		return map[string]interface{}{
+			"filename":   filename,
+			"start_line": 3.0,
+			"end_line":   6.0,
+			"statements": 4.0,
+		}
+	}
+	want := map[string]interface{}{
+		"groups":           1.0,
+		"fragments":        2.0,
+		"duplicated_lines": 8.0,
+		"clones": []interface{}{
+			map[string]interface{}{
+				"fragments": []interface{}{fragment("a.php"), fragment("b.php")},
+			},
+		},
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("summary mismatch:\nhave: %s\nwant: %v", data, want)
+	}
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"plugin"
+	"strings"
+
+	"github.com/setpill/noverify/src/linter"
+)
+
+// Plugin symbols.
+//
+// A plugin is a Go package main that is built with -buildmode=plugin.
+// It must export an int variable with linter.PluginAPIVersion value
+// and a function that registers plugin checkers.
+const (
+	pluginAPIVersionSymbol = "NoVerifyAPIVersion"
+	pluginInitSymbol       = "NoVerifyInit"
+)
+
+// loadPlugins loads Go plugins from the comma-separated list of files.
+//
+// Plugins can declare checks that are enabled by default,
+// so -allow-checks default value is updated after they're loaded.
+func loadPlugins(list string) error {
+	if list == "" {
+		return nil
+	}
+
+	for _, filename := range strings.Split(list, ",") {
+		if err := loadPlugin(filename); err != nil {
+			return fmt.Errorf("load plugin %s: %v", filename, err)
+		}
+	}
+
+	updateAllowChecksDefault()
+	return nil
+}
+
+// updateAllowChecksDefault recomputes -allow-checks default value
+// after new checks were declared, unless it's set explicitly.
+func updateAllowChecksDefault() {
+	allowChecksSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "allow-checks" {
+			allowChecksSet = true
+		}
+	})
+	if !allowChecksSet {
+		allowChecks = strings.Join(enabledByDefault(), ",")
+	}
+}
+
+func loadPlugin(filename string) error {
+	p, err := plugin.Open(filename)
+	if err != nil {
+		// Usually happens when a plugin is built against
+		// different versions of the noverify packages.
+		return fmt.Errorf("%v (is it built with the same noverify sources and Go version?)", err)
+	}
+	return initPlugin(p.Lookup)
+}
+
+// initPlugin validates the plugin symbols that are found with lookup
+// and calls the plugin init function.
+func initPlugin(lookup func(name string) (plugin.Symbol, error)) error {
+	sym, err := lookup(pluginAPIVersionSymbol)
+	if err != nil {
+		return fmt.Errorf("%s variable is not exported", pluginAPIVersionSymbol)
+	}
+	version, ok := sym.(*int)
+	if !ok {
+		return fmt.Errorf("%s must be an int variable, got %T", pluginAPIVersionSymbol, sym)
+	}
+	if *version != linter.PluginAPIVersion {
+		return fmt.Errorf("plugin is built for checkers API version %d, but noverify uses version %d: rebuild the plugin",
+			*version, linter.PluginAPIVersion)
+	}
+
+	sym, err = lookup(pluginInitSymbol)
+	if err != nil {
+		return fmt.Errorf("%s function is not exported", pluginInitSymbol)
+	}
+	initFunc, ok := sym.(func())
+	if !ok {
+		return fmt.Errorf("%s must be a func(), got %T", pluginInitSymbol, sym)
+	}
+	initFunc()
+	return nil
+}
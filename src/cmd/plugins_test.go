@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"plugin"
+	"strings"
+	"testing"
+
+	"github.com/setpill/noverify/src/linter"
+)
+
+func TestInitPlugin(t *testing.T) {
+	version := linter.PluginAPIVersion
+	oldVersion := linter.PluginAPIVersion - 1
+	badVersion := "1"
+	initCalls := 0
+	pluginInit := func() { initCalls++ }
+	badInit := func() error { return nil }
+
+	tests := []struct {
+		symbols map[string]plugin.Symbol
+		err     string
+	}{
+		{
+			symbols: map[string]plugin.Symbol{pluginAPIVersionSymbol: &version, pluginInitSymbol: pluginInit},
+		},
+		{
+			symbols: map[string]plugin.Symbol{pluginInitSymbol: pluginInit},
+			err:     "NoVerifyAPIVersion variable is not exported",
+		},
+		{
+			symbols: map[string]plugin.Symbol{pluginAPIVersionSymbol: &badVersion, pluginInitSymbol: pluginInit},
+			err:     "NoVerifyAPIVersion must be an int variable, got *string",
+		},
+		{
+			symbols: map[string]plugin.Symbol{pluginAPIVersionSymbol: &oldVersion, pluginInitSymbol: pluginInit},
+			err: fmt.Sprintf("plugin is built for checkers API version %d, but noverify uses version %d",
+				oldVersion, linter.PluginAPIVersion),
+		},
+		{
+			symbols: map[string]plugin.Symbol{pluginAPIVersionSymbol: &version},
+			err:     "NoVerifyInit function is not exported",
+		},
+		{
+			symbols: map[string]plugin.Symbol{pluginAPIVersionSymbol: &version, pluginInitSymbol: badInit},
+			err:     "NoVerifyInit must be a func(), got func() error",
+		},
+	}
+
+	for i, test := range tests {
+		initCalls = 0
+		lookup := func(name string) (plugin.Symbol, error) {
+			sym, ok := test.symbols[name]
+			if !ok {
+				return nil, fmt.Errorf("symbol %s not found", name)
+			}
+			return sym, nil
+		}
+
+		err := initPlugin(lookup)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("test %d: unexpected error: %v", i, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("test %d: expected %q error, got %v", i, test.err, err)
+		}
+
+		wantCalls := 0
+		if test.err == "" {
+			wantCalls = 1
+		}
+		if initCalls != wantCalls {
+			t.Errorf("test %d: init is called %d times, expected %d", i, initCalls, wantCalls)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/setpill/noverify/src/rules"
+)
+
+var testRulesCommand = &subCommand{
+	name:        "test-rules",
+	description: "Run @test-match and @test-nomatch test cases of the rule files",
+	main:        testRulesMain,
+}
+
+// testRulesMain runs rules test cases from the files specified in the command line.
+// Exit status is 2 if some tests failed.
+func testRulesMain() (int, error) {
+	if flag.NArg() == 0 {
+		return 0, fmt.Errorf("no rule files are specified")
+	}
+
+	rset, err := rules.ParseFiles(flag.Args())
+	if err != nil {
+		return 0, err
+	}
+
+	if err := initLinter(); err != nil {
+		return 0, err
+	}
+	l, err := newLinter()
+	if err != nil {
+		return 0, err
+	}
+
+	total, failures := l.RunRuleTests(rset)
+	for _, f := range failures {
+		kind := "@test-nomatch"
+		if f.Test.Match {
+			kind = "@test-match"
+		}
+		fmt.Printf("%s:%d: rule on line %d: %s %s: %s\n",
+			f.Rule.Filename, f.Test.Line, f.Rule.Line, kind, f.Test.Code, f.Message)
+	}
+
+	log.Printf("%d tests, %d failed", total, len(failures))
+	if len(failures) != 0 {
+		return 2, nil
+	}
+	return 0, nil
+}
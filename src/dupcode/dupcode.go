@@ -0,0 +1,375 @@
+// Package dupcode implements duplicated code (clones) detection.
+//
+// Every statement is hashed after normalization: variable names and
+// literal values are abstracted away, positions and comments are ignored.
+// Then all sequences of MinStatements consecutive statements are indexed
+// by a combined hash. Sequences that have equal hashes are clones.
+//
+// Both hashing and grouping are linear in the number of statements
+// (multiplied by MinStatements, which is a small constant).
+package dupcode
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/node/expr"
+	"github.com/setpill/noverify/src/php/parser/node/name"
+	"github.com/setpill/noverify/src/php/parser/node/scalar"
+	"github.com/setpill/noverify/src/php/parser/node/stmt"
+	"github.com/setpill/noverify/src/php/parser/walker"
+)
+
+// Index collects statement sequences of the analyzed files.
+//
+// It's safe to add files from several goroutines concurrently.
+type Index struct {
+	// MinStatements is a min number of statements in a clone.
+	MinStatements int
+
+	// MinTokens is a min clone size, measured in AST nodes.
+	MinTokens int
+
+	mu      sync.Mutex
+	lists   []*stmtList
+	windows map[uint64][]window
+}
+
+// Fragment is a single clone location.
+type Fragment struct {
+	Filename   string `json:"filename"`
+	StartLine  int    `json:"start_line"`
+	EndLine    int    `json:"end_line"`
+	Statements int    `json:"statements"`
+
+	// StartLineText is the source code of the first fragment line.
+	StartLineText string `json:"-"`
+}
+
+// Group is a set of code fragments that are clones of each other.
+type Group struct {
+	Fragments []*Fragment `json:"fragments"`
+}
+
+// stmtList is an indexed statements list, like function body.
+type stmtList struct {
+	filename string
+	stmts    []stmtInfo
+}
+
+type stmtInfo struct {
+	startLine int
+	endLine   int
+	text      string
+}
+
+// window is a sequence of MinStatements statements that start at the index.
+type window struct {
+	list  *stmtList
+	index int
+}
+
+// NewIndex returns a new empty index.
+func NewIndex(minStatements, minTokens int) *Index {
+	return &Index{
+		MinStatements: minStatements,
+		MinTokens:     minTokens,
+		windows:       make(map[uint64][]window),
+	}
+}
+
+// AddFile indexes all statement lists of the file.
+// lines are file contents split by lines, they're used
+// to fill Fragment.StartLineText.
+func (idx *Index) AddFile(filename string, root node.Node, lines [][]byte) {
+	h := &hasher{idx: idx, filename: filename, lines: lines}
+	root.Walk(h)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	for _, l := range h.lists {
+		idx.lists = append(idx.lists, l.list)
+		for _, w := range l.windows {
+			idx.windows[w.hash] = append(idx.windows[w.hash], window{list: l.list, index: w.index})
+		}
+	}
+}
+
+// Groups returns all clone groups found so far.
+//
+// Overlapping clone sequences of the same statements list
+// are merged into a single fragment.
+func (idx *Index) Groups() []*Group {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	// Mark every duplicated window, remembering its hash.
+	dups := make(map[*stmtList]map[int]uint64)
+	for hash, windows := range idx.windows {
+		if len(windows) < 2 {
+			continue
+		}
+		for _, w := range windows {
+			m := dups[w.list]
+			if m == nil {
+				m = make(map[int]uint64)
+				dups[w.list] = m
+			}
+			m[w.index] = hash
+		}
+	}
+
+	// Merge consecutive duplicated windows into fragments.
+	// Fragments are grouped by their first window hash.
+	groups := make(map[uint64]*Group)
+	for _, l := range idx.lists {
+		m := dups[l]
+		if m == nil {
+			continue
+		}
+		for i := 0; i < len(l.stmts); i++ {
+			hash, ok := m[i]
+			if !ok {
+				continue
+			}
+			end := i + idx.MinStatements
+			for j := i + 1; j < len(l.stmts); j++ {
+				if _, ok := m[j]; !ok {
+					break
+				}
+				end = j + idx.MinStatements
+			}
+			g := groups[hash]
+			if g == nil {
+				g = &Group{}
+				groups[hash] = g
+			}
+			g.Fragments = append(g.Fragments, &Fragment{
+				Filename:      l.filename,
+				StartLine:     l.stmts[i].startLine,
+				EndLine:       l.stmts[end-1].endLine,
+				Statements:    end - i,
+				StartLineText: l.stmts[i].text,
+			})
+			i = end - 1
+		}
+	}
+
+	res := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		if len(g.Fragments) < 2 {
+			// All clones were merged into a single fragment.
+			continue
+		}
+		sort.Slice(g.Fragments, func(i, j int) bool {
+			return fragmentLess(g.Fragments[i], g.Fragments[j])
+		})
+		res = append(res, g)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return fragmentLess(res[i].Fragments[0], res[j].Fragments[0])
+	})
+	return res
+}
+
+func fragmentLess(a, b *Fragment) bool {
+	if a.Filename != b.Filename {
+		return a.Filename < b.Filename
+	}
+	return a.StartLine < b.StartLine
+}
+
+type hashedWindow struct {
+	index int
+	hash  uint64
+}
+
+type hashedList struct {
+	list    *stmtList
+	windows []hashedWindow
+}
+
+// frame is a node that is being hashed.
+type frame struct {
+	n        node.Node
+	children []hashedNode
+}
+
+type hashedNode struct {
+	n    node.Node
+	hash uint64
+	size int
+}
+
+// hasher computes normalized hashes for every node
+// in a single post-order traversal.
+type hasher struct {
+	idx      *Index
+	filename string
+	lines    [][]byte
+
+	stack []frame
+	lists []hashedList
+}
+
+func (h *hasher) EnterNode(w walker.Walkable) bool {
+	h.stack = append(h.stack, frame{n: w.(node.Node)})
+	return true
+}
+
+func (h *hasher) LeaveNode(w walker.Walkable) {
+	f := h.stack[len(h.stack)-1]
+	h.stack = h.stack[:len(h.stack)-1]
+
+	hn := hashedNode{n: f.n, size: 1}
+	fnvHash := fnv.New64a()
+	fnvHash.Write([]byte(reflect.TypeOf(f.n).String()))
+	if v := leafValue(f.n); v != "" {
+		fnvHash.Write([]byte{0})
+		fnvHash.Write([]byte(v))
+	}
+	var buf [8]byte
+	for _, c := range f.children {
+		binary.LittleEndian.PutUint64(buf[:], c.hash)
+		fnvHash.Write(buf[:])
+		hn.size += c.size
+	}
+	hn.hash = fnvHash.Sum64()
+
+	if stmts := statementList(f.n); stmts != nil {
+		h.addList(stmts, f.children)
+	}
+
+	if len(h.stack) != 0 {
+		parent := &h.stack[len(h.stack)-1]
+		parent.children = append(parent.children, hn)
+	}
+}
+
+// addList records hashes of all statement windows of the list.
+func (h *hasher) addList(stmts []node.Node, children []hashedNode) {
+	k := h.idx.MinStatements
+	if len(stmts) < k || k <= 0 {
+		return
+	}
+
+	isStmt := make(map[node.Node]bool, len(stmts))
+	for _, s := range stmts {
+		isStmt[s] = true
+	}
+	hashed := make([]hashedNode, 0, len(stmts))
+	for _, c := range children {
+		if isStmt[c.n] {
+			hashed = append(hashed, c)
+		}
+	}
+
+	l := hashedList{list: &stmtList{filename: h.filename}}
+	for _, s := range hashed {
+		info := stmtInfo{}
+		if pos := s.n.GetPosition(); pos != nil {
+			info.startLine = pos.StartLine
+			info.endLine = pos.EndLine
+			if pos.StartLine >= 1 && pos.StartLine <= len(h.lines) {
+				info.text = string(h.lines[pos.StartLine-1])
+			}
+		}
+		l.list.stmts = append(l.list.stmts, info)
+	}
+
+	var buf [8]byte
+	for i := 0; i+k <= len(hashed); i++ {
+		size := 0
+		fnvHash := fnv.New64a()
+		ok := true
+		for _, s := range hashed[i : i+k] {
+			if isDeclaration(s.n) {
+				ok = false
+				break
+			}
+			size += s.size
+			binary.LittleEndian.PutUint64(buf[:], s.hash)
+			fnvHash.Write(buf[:])
+		}
+		if ok && size >= h.idx.MinTokens {
+			l.windows = append(l.windows, hashedWindow{index: i, hash: fnvHash.Sum64()})
+		}
+	}
+	if len(l.windows) != 0 {
+		h.lists = append(h.lists, l)
+	}
+}
+
+// statementList returns a statement list that is stored inside n.
+// Returns nil if n is not a statements container.
+func statementList(n node.Node) []node.Node {
+	switch n := n.(type) {
+	case *node.Root:
+		return n.Stmts
+	case *stmt.StmtList:
+		return n.Stmts
+	case *stmt.Namespace:
+		return n.Stmts
+	case *stmt.Function:
+		return n.Stmts
+	case *expr.Closure:
+		return n.Stmts
+	case *stmt.Case:
+		return n.Stmts
+	case *stmt.Default:
+		return n.Stmts
+	}
+	return nil
+}
+
+// isDeclaration reports whether n is a declaration statement.
+// Declarations are not included into the clone sequences:
+// their bodies are indexed on their own.
+func isDeclaration(n node.Node) bool {
+	switch n.(type) {
+	case *stmt.Function, *stmt.Class, *stmt.Interface, *stmt.Trait, *stmt.ClassMethod:
+		return true
+	}
+	return false
+}
+
+// leafValue returns a node value that should be hashed along with its type.
+// Variable names and literal values are abstracted, so they're not returned.
+func leafValue(n node.Node) string {
+	switch n := n.(type) {
+	case *node.Identifier:
+		return n.Value
+	case *name.NamePart:
+		return n.Value
+	case *scalar.MagicConstant:
+		return n.Value
+	}
+	return ""
+}
+
+// Summary is a clones detection report summary.
+type Summary struct {
+	Groups          int      `json:"groups"`
+	Fragments       int      `json:"fragments"`
+	DuplicatedLines int      `json:"duplicated_lines"`
+	Clones          []*Group `json:"clones"`
+}
+
+// NewSummary returns a summary for the specified clone groups.
+func NewSummary(groups []*Group) *Summary {
+	s := &Summary{
+		Groups: len(groups),
+		Clones: groups,
+	}
+	for _, g := range groups {
+		s.Fragments += len(g.Fragments)
+		for _, f := range g.Fragments {
+			s.DuplicatedLines += f.EndLine - f.StartLine + 1
+		}
+	}
+	return s
+}
@@ -0,0 +1,107 @@
+package dupcode
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/setpill/noverify/src/php/parser/php7"
+)
+
+func addTestFile(t *testing.T, idx *Index, filename, code string) {
+	parser := php7.NewParser(strings.NewReader(code), filename)
+	parser.WithFreeFloating()
+	parser.Parse()
+	if errs := parser.GetErrors(); len(errs) != 0 {
+		t.Fatalf("%s: parse error: %v", filename, errs[0])
+	}
+	idx.AddFile(filename, parser.GetRootNode(), bytes.Split([]byte(code), []byte("\n")))
+}
+
+func groupsString(groups []*Group) string {
+	var parts []string
+	for _, g := range groups {
+		var fragments []string
+		for _, f := range g.Fragments {
+			fragments = append(fragments, fmt.Sprintf("%s:%d-%d", f.Filename, f.StartLine, f.EndLine))
+		}
+		parts = append(parts, "{"+strings.Join(fragments, " ")+"}")
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestClones(t *testing.T) {
+	idx := NewIndex(3, 0)
+	addTestFile(t, idx, "a.php", `<?php
+function f($a) {
+  $x = $a + 1;
+  $y = $x * 2;
+  echo "hello";
+  return $y;
+}
+
+function g($b) {
+  /* comments are ignored */
+  $p = $b + 5;
+  $q = $p * 3;
+  echo 'world';
+  return $q;
+}
+
+function h($b) {
+  $p = $b + 5;
+  $q = $p - 3;
+  echo 'world';
+  return $q;
+}
+`)
+	addTestFile(t, idx, "b.php", `<?php
+class C {
+  public function m($v) {
+    if ($v) {
+      $z = $v + 100;
+      $w = $z * 7;
+      echo 'x';
+    }
+  }
+}
+`)
+
+	want := `{a.php:3-6 a.php:11-14 b.php:5-7}`
+	if have := groupsString(idx.Groups()); have != want {
+		t.Errorf("groups mismatch:\nhave: %s\nwant: %s", have, want)
+	}
+}
+
+func TestClonesMerge(t *testing.T) {
+	idx := NewIndex(2, 0)
+	addTestFile(t, idx, "a.php", `<?php
+function f() {
+  $a = 1;
+  $a = 1;
+  $a = 1;
+  $a = 1;
+}
+`)
+	if have := groupsString(idx.Groups()); have != "" {
+		t.Errorf("expected overlapping windows to be merged, got %s", have)
+	}
+}
+
+func TestMinTokens(t *testing.T) {
+	idx := NewIndex(2, 20)
+	addTestFile(t, idx, "a.php", `<?php
+function f() {
+  $a = 1;
+  $b = 2;
+}
+function g() {
+  $a = 1;
+  $b = 2;
+}
+`)
+	if have := groupsString(idx.Groups()); have != "" {
+		t.Errorf("expected small fragments to be ignored, got %s", have)
+	}
+}
@@ -0,0 +1,571 @@
+package langsrv
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/setpill/noverify/src/lintdebug"
+	"github.com/setpill/noverify/src/meta"
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/node/expr"
+	"github.com/setpill/noverify/src/php/parser/node/name"
+	"github.com/setpill/noverify/src/php/parser/node/stmt"
+	"github.com/setpill/noverify/src/php/parser/position"
+	"github.com/setpill/noverify/src/php/parser/walker"
+	"github.com/setpill/noverify/src/solver"
+	"github.com/setpill/noverify/src/state"
+	"github.com/setpill/noverify/src/vscode"
+)
+
+func (s *Server) handleTextDocumentCodeAction(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	var params vscode.CodeActionParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	filename := strings.TrimPrefix(params.TextDocument.URI, "file://")
+	s.openMapMutex.Lock()
+	f, ok := s.openMap[filename]
+	s.openMapMutex.Unlock()
+
+	result := make([]vscode.CodeAction, 0)
+	switch {
+	case !ok:
+		lintdebug.Send("File is not opened, but code actions requested: %s", filename)
+	case s.metaInfo().IsIndexingComplete() && f.scopes != nil && params.Range.Start.Line < len(f.linesPositions):
+		result = append(result, s.findCodeActions(filename, &f, &params)...)
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  result,
+	})
+}
+
+func (s *Server) findCodeActions(filename string, f *openedFile, params *vscode.CodeActionParams) []vscode.CodeAction {
+	var result []vscode.CodeAction
+	add := func(title, kind string, diags []vscode.Diagnostic, edits ...vscode.TextEdit) {
+		result = append(result, vscode.CodeAction{
+			Title:       title,
+			Kind:        kind,
+			Diagnostics: diags,
+			Edit: &vscode.WorkspaceEdit{
+				Changes: map[string][]vscode.TextEdit{"file://" + filename: edits},
+			},
+		})
+	}
+
+	for _, diag := range params.Context.Diagnostics {
+		if title, edits := diagnosticFix(f, diag); len(edits) != 0 {
+			add(title, vscode.CodeActionQuickFix, []vscode.Diagnostic{diag}, edits...)
+		}
+	}
+
+	w := &codeActionWalker{
+		st:       meta.ClassParseState{Info: s.metaInfo()},
+		position: f.linesPositions[params.Range.Start.Line] + params.Range.Start.Character,
+		line:     params.Range.Start.Line + 1,
+	}
+	f.rootNode.Walk(w)
+
+	if w.unresolvedName != "" {
+		if classes := s.findClassesByShortName(w.unresolvedName); len(classes) == 1 {
+			add("Import class "+classes[0], vscode.CodeActionQuickFix, nil, w.importEdit(classes[0]))
+		}
+	}
+
+	if w.class != nil {
+		if missing := s.findMissingMethods(w.className); len(missing) != 0 {
+			add("Implement missing methods", vscode.CodeActionQuickFix, nil, s.missingMethodsEdit(f, w.class, w.className, missing))
+		}
+	}
+
+	if w.funcDecl != nil {
+		if fn, ok := w.funcInfo(); ok {
+			indent := lineIndent(f, w.funcDecl.GetPosition().StartLine)
+			pos := vscode.Position{Line: w.funcDecl.GetPosition().StartLine - 1}
+			add("Generate PHPDoc", vscode.CodeActionRefactor, nil, vscode.TextEdit{
+				Range:   vscode.Range{Start: pos, End: pos},
+				NewText: formatPhpdoc(s.funcPhpdoc(w.funcClass, &fn), indent),
+			})
+		}
+	}
+
+	return result
+}
+
+// diagnosticFix returns the edits that fix the diagnostic problem.
+func diagnosticFix(f *openedFile, diag vscode.Diagnostic) (title string, edits []vscode.TextEdit) {
+	if diag.Range.Start.Line >= len(f.linesPositions) {
+		return "", nil
+	}
+	offset := f.linesPositions[diag.Range.Start.Line] + diag.Range.Start.Character
+	if offset >= len(f.contents) {
+		return "", nil
+	}
+
+	switch diag.Code {
+	case "arraySyntax":
+		w := &arrayAtWalker{offset: offset}
+		f.rootNode.Walk(w)
+		if w.found == nil {
+			return "", nil
+		}
+		pos := w.found.Position
+		src := f.contents[pos.StartPos-1 : pos.EndPos]
+		lparen := strings.IndexByte(src, '(')
+		if lparen < 0 || !strings.HasSuffix(src, ")") {
+			return "", nil
+		}
+		return "Use short array syntax", []vscode.TextEdit{
+			offsetsEdit(f, offset, offset+lparen+1, "["),
+			offsetsEdit(f, pos.EndPos-1, pos.EndPos, "]"),
+		}
+
+	case "keywordCase":
+		end := offset
+		for end < len(f.contents) && isKeywordChar(f.contents[end]) {
+			end++
+		}
+		keyword := f.contents[offset:end]
+		if keyword == "" || keyword == strings.ToLower(keyword) {
+			return "", nil
+		}
+		return "Replace with " + strings.ToLower(keyword), []vscode.TextEdit{
+			offsetsEdit(f, offset, end, strings.ToLower(keyword)),
+		}
+	}
+
+	return "", nil
+}
+
+func isKeywordChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_'
+}
+
+// offsetsEdit replaces the contents between 0-based offsets with the text.
+func offsetsEdit(f *openedFile, start, end int, text string) vscode.TextEdit {
+	return vscode.TextEdit{
+		Range: vscode.Range{
+			Start: offsetToPosition(f.linesPositions, start),
+			End:   offsetToPosition(f.linesPositions, end),
+		},
+		NewText: text,
+	}
+}
+
+// lineIndent returns the leading whitespace of the 1-based line.
+func lineIndent(f *openedFile, line int) string {
+	if line < 1 || line > len(f.linesPositions) {
+		return ""
+	}
+	start := f.linesPositions[line-1]
+	end := start
+	for end < len(f.contents) && (f.contents[end] == ' ' || f.contents[end] == '\t') {
+		end++
+	}
+	return f.contents[start:end]
+}
+
+// arrayAtWalker finds the old style array that starts at the offset.
+type arrayAtWalker struct {
+	offset int
+	found  *expr.Array
+}
+
+// EnterNode is invoked at every node in hierarchy
+func (d *arrayAtWalker) EnterNode(w walker.Walkable) bool {
+	if d.found != nil {
+		return false
+	}
+	if arr, ok := w.(*expr.Array); ok && !arr.ShortSyntax && arr.Position != nil && arr.Position.StartPos-1 == d.offset {
+		d.found = arr
+	}
+	return d.found == nil
+}
+
+// LeaveNode is invoked after node process
+func (d *arrayAtWalker) LeaveNode(w walker.Walkable) {}
+
+// codeActionWalker collects the context of the cursor position.
+type codeActionWalker struct {
+	st meta.ClassParseState
+
+	position int
+	line     int
+
+	// unresolvedName is a class name under the cursor that can't be resolved.
+	unresolvedName string
+	lastUse        *position.Position
+	namespace      *position.Position
+
+	// class is the innermost class declaration around the cursor.
+	class     *stmt.Class
+	className string
+
+	// funcDecl is a function or method without phpdoc
+	// which header is on the cursor line.
+	funcDecl  node.Node
+	funcClass string
+
+	skip map[node.Node]bool
+}
+
+// EnterNode is invoked at every node in hierarchy
+func (d *codeActionWalker) EnterNode(w walker.Walkable) bool {
+	state.EnterNode(&d.st, w)
+
+	if d.skip == nil {
+		d.skip = make(map[node.Node]bool)
+	}
+
+	switch n := w.(type) {
+	case *stmt.Namespace:
+		if n.Position.StartPos-1 <= d.position {
+			d.namespace = n.Position
+			d.lastUse = nil
+		}
+		d.skip[n.NamespaceName] = true
+	case *stmt.UseList:
+		if n.Position.StartPos-1 <= d.position {
+			d.lastUse = n.Position
+		}
+		return false
+	case *stmt.GroupUse:
+		if n.Position.StartPos-1 <= d.position {
+			d.lastUse = n.Position
+		}
+		return false
+	case *stmt.Class:
+		if n.ClassName != nil && d.contains(n.Position) && !isAbstractClass(n) {
+			d.class = n
+			d.className = d.st.CurrentClass
+		}
+	case *stmt.Function:
+		if n.PhpDocComment == "" && n.FunctionName.Position.StartLine == d.line {
+			d.funcDecl = n
+		}
+	case *stmt.ClassMethod:
+		if n.PhpDocComment == "" && n.MethodName.Position.StartLine == d.line {
+			d.funcDecl = n
+			d.funcClass = d.st.CurrentClass
+		}
+	case *expr.FunctionCall:
+		d.skip[n.Function] = true
+	case *expr.ConstFetch:
+		d.skip[n.Constant] = true
+	case *name.Name:
+		if d.skip[n] || len(n.Parts) != 1 || !d.contains(n.Position) {
+			return false
+		}
+		shortName := meta.NameToString(n)
+		switch strings.ToLower(shortName) {
+		case "self", "static", "parent":
+			return false
+		}
+		className, ok := solver.GetClassName(&d.st, n)
+		if !ok {
+			return false
+		}
+		if _, ok := d.st.MetaInfo().GetClassOrTrait(className); !ok {
+			d.unresolvedName = shortName
+		}
+		return false
+	}
+
+	return true
+}
+
+// LeaveNode is invoked after node process
+func (d *codeActionWalker) LeaveNode(w walker.Walkable) {
+	state.LeaveNode(&d.st, w)
+}
+
+func (d *codeActionWalker) contains(pos *position.Position) bool {
+	return pos != nil && d.position >= pos.StartPos-1 && d.position <= pos.EndPos
+}
+
+func (d *codeActionWalker) funcInfo() (meta.FuncInfo, bool) {
+	switch n := d.funcDecl.(type) {
+	case *stmt.Function:
+		nameStr := n.FunctionName.Value
+		if d.st.Namespace != "" {
+			nameStr = d.st.Namespace + `\` + nameStr
+		} else {
+			nameStr = `\` + nameStr
+		}
+		return d.st.MetaInfo().GetFunction(nameStr)
+	case *stmt.ClassMethod:
+		class, ok := d.st.MetaInfo().GetClassOrTrait(d.funcClass)
+		if !ok {
+			return meta.FuncInfo{}, false
+		}
+		fn, ok := class.Methods[n.MethodName.Value]
+		return fn, ok
+	}
+	return meta.FuncInfo{}, false
+}
+
+// importEdit returns the edit that adds the use statement for the className.
+// The statement is added after the last use statement or after the namespace.
+func (d *codeActionWalker) importEdit(className string) vscode.TextEdit {
+	text := "use " + strings.TrimPrefix(className, `\`) + ";\n"
+
+	var line int
+	switch {
+	case d.lastUse != nil:
+		line = d.lastUse.EndLine
+	case d.namespace != nil:
+		line = d.namespace.StartLine
+		text = "\n" + text
+	default:
+		// Right after the "<?php" line.
+		line = 1
+		text = "\n" + text
+	}
+
+	pos := vscode.Position{Line: line}
+	return vscode.TextEdit{
+		Range:   vscode.Range{Start: pos, End: pos},
+		NewText: text,
+	}
+}
+
+func isAbstractClass(n *stmt.Class) bool {
+	for _, m := range n.Modifiers {
+		if strings.EqualFold(m.Value, "abstract") {
+			return true
+		}
+	}
+	return false
+}
+
+// findClassesByShortName returns all classes and traits with the specified name.
+func (s *Server) findClassesByShortName(shortName string) []string {
+	var res []string
+	add := func(className string, _ meta.ClassInfo) {
+		if strings.EqualFold(baseSymbolName(className), shortName) {
+			res = append(res, className)
+		}
+	}
+	s.metaInfo().IterateClasses(add)
+	s.metaInfo().IterateTraits(add)
+	sort.Strings(res)
+	return res
+}
+
+type missingMethod struct {
+	name      string
+	className string
+	info      meta.FuncInfo
+}
+
+// findMissingMethods returns abstract and interface methods
+// that are not implemented by the class.
+func (s *Server) findMissingMethods(className string) []missingMethod {
+	var res []missingMethod
+	seen := make(map[string]bool)
+	visited := map[string]bool{className: true}
+
+	queue := []string{className}
+	for len(queue) != 0 {
+		class, ok := s.metaInfo().GetClassOrTrait(queue[0])
+		ancestor := queue[0]
+		queue = queue[1:]
+		if !ok {
+			continue
+		}
+
+		var methods []missingMethod
+		for methodName, fn := range class.Methods {
+			if !fn.IsAbstract() || seen[methodName] {
+				continue
+			}
+			seen[methodName] = true
+			if impl, _, ok := solver.FindMethod(s.metaInfo(), className, methodName); ok && !impl.IsAbstract() {
+				continue
+			}
+			methods = append(methods, missingMethod{name: methodName, className: ancestor, info: fn})
+		}
+		sort.Slice(methods, func(i, j int) bool {
+			return methods[i].info.Pos.Line < methods[j].info.Pos.Line
+		})
+		res = append(res, methods...)
+
+		parents := append([]string{class.Parent}, class.ParentInterfaces...)
+		ifaces := make([]string, 0, len(class.Interfaces))
+		for iface := range class.Interfaces {
+			ifaces = append(ifaces, iface)
+		}
+		sort.Strings(ifaces)
+		for _, parent := range append(parents, ifaces...) {
+			if parent != "" && !visited[parent] {
+				visited[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+
+	return res
+}
+
+// missingMethodsEdit returns the edit that inserts missing methods
+// stubs before the class closing brace.
+func (s *Server) missingMethodsEdit(f *openedFile, class *stmt.Class, className string, methods []missingMethod) vscode.TextEdit {
+	indent := lineIndent(f, class.Position.StartLine) + "    "
+	if len(class.Stmts) != 0 {
+		indent = lineIndent(f, class.Stmts[0].GetPosition().StartLine)
+	}
+
+	var buf strings.Builder
+	for i, m := range methods {
+		if i != 0 || len(class.Stmts) != 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(formatPhpdoc(s.funcPhpdoc(className, &m.info), indent))
+		buf.WriteString(indent + s.methodStubSignature(m.name, m.className, &m.info) + "\n")
+		buf.WriteString(indent + "{\n")
+		buf.WriteString(indent + "}\n")
+	}
+
+	// Class position ends right after the closing brace.
+	end := class.Position.EndPos - 1
+	lineStart := f.linesPositions[class.Position.EndLine-1]
+	if lineStart <= end && strings.TrimSpace(f.contents[lineStart:end]) == "" {
+		return offsetsEdit(f, lineStart, lineStart, buf.String())
+	}
+	return offsetsEdit(f, end, end, "\n"+buf.String()+lineIndent(f, class.Position.StartLine))
+}
+
+// methodStubSignature returns the method header, like "public function f($x): int".
+//
+// Parameter type hints are omitted as it's permitted to widen parameter types,
+// the return type hint is only added if it's declared in the parent method.
+func (s *Server) methodStubSignature(methodName, className string, fn *meta.FuncInfo) string {
+	var buf strings.Builder
+	buf.WriteString(fn.AccessLevel.String() + " ")
+	if fn.IsStatic() {
+		buf.WriteString("static ")
+	}
+	buf.WriteString("function " + methodName + "(")
+	for i, p := range fn.Params {
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+		if p.IsRef {
+			buf.WriteString("&")
+		}
+		if p.IsVariadic {
+			buf.WriteString("...")
+		}
+		buf.WriteString("$" + p.Name)
+		switch {
+		case p.Default != "":
+			buf.WriteString(" = " + p.Default)
+		case !p.IsVariadic && i >= fn.MinParamsCnt:
+			buf.WriteString(" = null")
+		}
+	}
+	buf.WriteString(")")
+
+	if fn.Flags&meta.FuncReturnHint != 0 {
+		if hint := typeHint(resolveTypesSafe(s.metaInfo(), className, fn.Typ, make(map[string]struct{}))); hint != "" {
+			buf.WriteString(": " + hint)
+		}
+	}
+	return buf.String()
+}
+
+var typeHintKeywords = map[string]bool{
+	"int":      true,
+	"float":    true,
+	"string":   true,
+	"bool":     true,
+	"array":    true,
+	"callable": true,
+	"iterable": true,
+	"object":   true,
+	"void":     true,
+}
+
+// typeHint converts the types into the type hint.
+// Returns an empty string if the types can't be expressed as a type hint.
+func typeHint(types map[string]struct{}) string {
+	nullable := false
+	var typ string
+	for t := range types {
+		if t == "null" {
+			nullable = true
+			continue
+		}
+		if typ != "" {
+			return ""
+		}
+		typ = t
+	}
+
+	switch {
+	case strings.HasSuffix(typ, "[]"):
+		typ = "array"
+	case typ == "true" || typ == "false":
+		typ = "bool"
+	}
+	if !strings.HasPrefix(typ, `\`) && !typeHintKeywords[typ] {
+		return ""
+	}
+
+	if nullable {
+		if typ == "void" {
+			return ""
+		}
+		return "?" + typ
+	}
+	return typ
+}
+
+// funcPhpdoc returns the phpdoc lines with the function params and return types.
+// className is used to resolve the types like static.
+func (s *Server) funcPhpdoc(className string, fn *meta.FuncInfo) []string {
+	typeString := func(typ meta.TypesMap, variadic bool) string {
+		types := resolveTypesSafe(s.metaInfo(), className, typ, make(map[string]struct{}))
+		if variadic {
+			// Variadic params types are wrapped into arrays.
+			elemTypes := make(map[string]struct{}, len(types))
+			for t := range types {
+				elemTypes[strings.TrimSuffix(t, "[]")] = struct{}{}
+			}
+			types = elemTypes
+		}
+		if len(types) == 0 {
+			return "mixed"
+		}
+		return meta.NewTypesMapFromMap(types).String()
+	}
+
+	lines := make([]string, 0, len(fn.Params)+1)
+	for _, p := range fn.Params {
+		param := "$" + p.Name
+		if p.IsVariadic {
+			param = "..." + param
+		}
+		lines = append(lines, "@param "+typeString(p.Typ, p.IsVariadic)+" "+param)
+	}
+	lines = append(lines, "@return "+typeString(fn.Typ, false))
+	return lines
+}
+
+// formatPhpdoc formats the phpdoc comment, every line is prefixed with indent.
+func formatPhpdoc(lines []string, indent string) string {
+	var buf strings.Builder
+	buf.WriteString(indent + "/**\n")
+	for _, l := range lines {
+		buf.WriteString(indent + " * " + l + "\n")
+	}
+	buf.WriteString(indent + " */\n")
+	return buf.String()
+}
@@ -0,0 +1,211 @@
+package langsrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/setpill/noverify/src/lintdebug"
+	"github.com/setpill/noverify/src/meta"
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/node/expr"
+	"github.com/setpill/noverify/src/php/parser/node/stmt"
+	"github.com/setpill/noverify/src/php/parser/position"
+	"github.com/setpill/noverify/src/php/parser/walker"
+	"github.com/setpill/noverify/src/state"
+	"github.com/setpill/noverify/src/vscode"
+)
+
+// showReferencesCommand is the code lens command. Its arguments are the document URI,
+// the lens position and the locations, clients are expected to show them as references.
+const showReferencesCommand = "noverify.showReferences"
+
+// Code lens kinds.
+const (
+	lensReferences      = "references"
+	lensImplementations = "implementations"
+)
+
+// codeLensData identifies the code lens symbol, it's resolved by codeLens/resolve.
+type codeLensData struct {
+	Kind string `json:"kind"`
+	URI  string `json:"uri"`
+
+	// ClassName is set for both classes and methods.
+	ClassName string `json:"class"`
+
+	// Method is set for methods only.
+	Method string `json:"method,omitempty"`
+	Static bool   `json:"static,omitempty"`
+}
+
+func (s *Server) handleTextDocumentCodeLens(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	var params vscode.CodeLensParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	filename := strings.TrimPrefix(params.TextDocument.URI, "file://")
+	s.openMapMutex.Lock()
+	f, ok := s.openMap[filename]
+	s.openMapMutex.Unlock()
+
+	result := make([]vscode.CodeLens, 0)
+	switch {
+	case !ok:
+		lintdebug.Send("File is not opened, but code lens requested: %s", filename)
+	case s.metaInfo().IsIndexingComplete():
+		w := &codeLensWalker{st: meta.ClassParseState{Info: s.metaInfo()}, uri: params.TextDocument.URI, linesPositions: f.linesPositions}
+		f.rootNode.Walk(w)
+		result = append(result, w.result...)
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  result,
+	})
+}
+
+func (s *Server) handleCodeLensResolve(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	var lens vscode.CodeLens
+	if err := json.Unmarshal([]byte(req.Params), &lens); err != nil {
+		return err
+	}
+	var data codeLensData
+	if err := json.Unmarshal(lens.Data, &data); err != nil {
+		return err
+	}
+
+	locations := s.findCodeLensLocations(&data)
+	noun := "reference"
+	if data.Kind == lensImplementations {
+		noun = "implementation"
+	}
+	title := fmt.Sprintf("%d %ss", len(locations), noun)
+	if len(locations) == 1 {
+		title = "1 " + noun
+	}
+
+	lens.Command = &vscode.Command{
+		Title:     title,
+		Command:   showReferencesCommand,
+		Arguments: []interface{}{data.URI, lens.Range.Start, locations},
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  lens,
+	})
+}
+
+// findCodeLensLocations returns the code lens symbol references or implementations.
+func (s *Server) findCodeLensLocations(data *codeLensData) []vscode.Location {
+	var locations []vscode.Location
+
+	switch {
+	case data.Kind == lensImplementations && data.Method == "":
+		locations = s.findImplementations(&renameTarget{kind: renameClass, fullName: data.ClassName})
+	case data.Kind == lensImplementations:
+		locations = s.findImplementations(&renameTarget{kind: renameMethod, className: data.ClassName, name: data.Method})
+	case data.Method == "":
+		locations = s.findClassReferences(data.ClassName)
+	case data.Static:
+		locations = s.findStaticMethodReferences(data.ClassName, data.Method)
+	default:
+		locations = s.findMethodReferences(data.ClassName, data.Method)
+	}
+
+	if locations == nil {
+		locations = make([]vscode.Location, 0)
+	}
+	return locations
+}
+
+// codeLensWalker adds the references code lens to classes and methods,
+// interfaces, abstract classes and their methods also get the implementations one.
+type codeLensWalker struct {
+	st meta.ClassParseState
+
+	uri            string
+	linesPositions []int
+
+	// abstract is true inside interfaces and abstract classes.
+	abstract bool
+
+	result []vscode.CodeLens
+}
+
+// EnterNode is invoked at every node in hierarchy
+func (d *codeLensWalker) EnterNode(w walker.Walkable) bool {
+	n := w.(node.Node)
+
+	switch n := n.(type) {
+	case *stmt.Class:
+		// Anonymous classes can't be referenced.
+		if n.ClassName == nil {
+			return false
+		}
+	case *stmt.Function, *expr.Closure:
+		return false
+	}
+
+	state.EnterNode(&d.st, n)
+
+	switch n := n.(type) {
+	case *stmt.Class:
+		d.abstract = isAbstractClass(n)
+		d.addClass(n.ClassName.Position)
+	case *stmt.Interface:
+		d.abstract = true
+		d.addClass(n.InterfaceName.Position)
+	case *stmt.Trait:
+		d.abstract = false
+		d.addClass(n.TraitName.Position)
+	case *stmt.ClassMethod:
+		data := codeLensData{URI: d.uri, ClassName: d.st.CurrentClass, Method: n.MethodName.Value}
+		for _, m := range n.Modifiers {
+			if strings.EqualFold(m.Value, "static") {
+				data.Static = true
+			}
+		}
+		d.add(n.MethodName.Position, lensReferences, data)
+		if d.abstract {
+			d.add(n.MethodName.Position, lensImplementations, data)
+		}
+	}
+
+	return true
+}
+
+// LeaveNode is invoked after node process
+func (d *codeLensWalker) LeaveNode(w walker.Walkable) {
+	state.LeaveNode(&d.st, w.(node.Node))
+}
+
+func (d *codeLensWalker) addClass(pos *position.Position) {
+	data := codeLensData{URI: d.uri, ClassName: d.st.CurrentClass}
+	d.add(pos, lensReferences, data)
+	if d.abstract {
+		d.add(pos, lensImplementations, data)
+	}
+}
+
+func (d *codeLensWalker) add(pos *position.Position, kind string, data codeLensData) {
+	data.Kind = kind
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	d.result = append(d.result, vscode.CodeLens{
+		Range: posToRange(d.linesPositions, pos),
+		Data:  buf,
+	})
+}
@@ -1,10 +1,16 @@
 package langsrv
 
 import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
 	"github.com/setpill/noverify/src/meta"
 	"github.com/setpill/noverify/src/php/parser/node"
 	"github.com/setpill/noverify/src/php/parser/walker"
 	"github.com/setpill/noverify/src/state"
+	"github.com/setpill/noverify/src/vscode"
 )
 
 type completionWalker struct {
@@ -50,3 +56,308 @@ func (d *completionWalker) LeaveNode(w walker.Walkable) {
 
 	d.foundScope = sc
 }
+
+var phpKeywords = []string{
+	"abstract", "array", "as", "break", "callable", "case", "catch", "class", "clone", "const",
+	"continue", "declare", "default", "do", "echo", "else", "elseif", "empty", "enddeclare",
+	"endfor", "endforeach", "endif", "endswitch", "endwhile", "extends", "false", "final",
+	"finally", "for", "foreach", "function", "global", "goto", "if", "implements", "include",
+	"include_once", "instanceof", "insteadof", "interface", "isset", "list", "namespace", "new",
+	"null", "print", "private", "protected", "public", "require", "require_once", "return",
+	"static", "switch", "throw", "trait", "true", "try", "unset", "use", "var", "while", "yield",
+}
+
+// typeHintCompletions are the builtin types that can be used in type hints.
+var typeHintCompletions = []string{
+	"array", "bool", "callable", "float", "int", "iterable", "object", "self", "string", "void",
+}
+
+// phpdocTypes are the builtin types that can be used in phpdoc.
+var phpdocTypes = []string{
+	"$this", "array", "bool", "callable", "false", "float", "int", "iterable", "mixed",
+	"null", "object", "resource", "self", "static", "string", "true", "void",
+}
+
+var phpdocTags = []string{
+	"@deprecated", "@inheritdoc", "@method", "@param", "@property", "@property-read",
+	"@property-write", "@return", "@see", "@throws", "@var",
+}
+
+// Class name completion kinds.
+const (
+	completeClasses = 1 << iota
+	completeInterfaces
+	completeTraits
+)
+
+var (
+	identRegex = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+	phpdocTypeRegex = regexp.MustCompile(`@(param|return|var|throws|property|property-read|property-write|method)\s+(\S*\|)?\??$`)
+
+	newRegex        = regexp.MustCompile(`\bnew\s+$`)
+	extendsRegex    = regexp.MustCompile(`\bextends\s+([\w\\]+\s*,\s*)*$`)
+	implementsRegex = regexp.MustCompile(`\bimplements\s+([\w\\]+\s*,\s*)*$`)
+	instanceofRegex = regexp.MustCompile(`\binstanceof\s+$`)
+	catchRegex      = regexp.MustCompile(`\bcatch\s*\(\s*([\w\\]+\s*\|\s*)*$`)
+	useRegex        = regexp.MustCompile(`^\s*use\s+$`)
+	paramTypeRegex  = regexp.MustCompile(`\bfunction\b[^(]*\(([^)]*,)?\s*\??$`)
+	returnTypeRegex = regexp.MustCompile(`\bfunction\b.*\)\s*:\s*\??$`)
+)
+
+// inDocComment reports whether the offset is inside the /** */ comment.
+func inDocComment(contents string, offset int) bool {
+	if offset > len(contents) {
+		offset = len(contents)
+	}
+	start := strings.LastIndex(contents[:offset], "/**")
+	return start >= 0 && !strings.Contains(contents[start:offset], "*/")
+}
+
+// classCompletionKinds returns the kinds of classes that can be used
+// after the text before the cursor, like "new " or "implements ".
+func classCompletionKinds(before string, st *meta.ClassParseState) (kinds int, ok bool) {
+	switch {
+	case newRegex.MatchString(before):
+		return completeClasses, true
+	case implementsRegex.MatchString(before):
+		return completeInterfaces, true
+	case extendsRegex.MatchString(before):
+		if strings.Contains(before, "interface") {
+			return completeInterfaces, true
+		}
+		return completeClasses, true
+	case instanceofRegex.MatchString(before), catchRegex.MatchString(before):
+		return completeClasses | completeInterfaces, true
+	case useRegex.MatchString(before):
+		if st.CurrentClass != "" {
+			return completeTraits, true
+		}
+		return completeClasses | completeInterfaces | completeTraits, true
+	case paramTypeRegex.MatchString(before), returnTypeRegex.MatchString(before):
+		return completeClasses | completeInterfaces, true
+	}
+	return 0, false
+}
+
+// classCompletion completes class names that start with the prefix.
+//
+// Classes from other namespaces are inserted by their short names
+// with the use statement added, unless the short name is already taken.
+type classCompletion struct {
+	st     *meta.ClassParseState
+	prefix string
+
+	// wordRange is the range of the prefix, it's replaced by the class name.
+	wordRange vscode.Range
+
+	// imports adds the use statements, classes are inserted by the full names if it's nil.
+	imports *codeActionWalker
+}
+
+func (c *classCompletion) items(kinds int) []vscode.CompletionItem {
+	var result []vscode.CompletionItem
+
+	add := func(className string, kind int) {
+		if item, ok := c.item(className, kind); ok {
+			result = append(result, item)
+		}
+	}
+
+	if kinds&(completeClasses|completeInterfaces) != 0 {
+		c.st.MetaInfo().IterateClasses(func(className string, class meta.ClassInfo) {
+			switch {
+			case class.IsInterface() && kinds&completeInterfaces != 0:
+				add(className, vscode.CompletionKindInterface)
+			case !class.IsInterface() && kinds&completeClasses != 0:
+				add(className, vscode.CompletionKindClass)
+			}
+		})
+	}
+	if kinds&completeTraits != 0 {
+		c.st.MetaInfo().IterateTraits(func(className string, _ meta.ClassInfo) {
+			add(className, vscode.CompletionKindClass)
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Label != result[j].Label {
+			return result[i].Label < result[j].Label
+		}
+		return result[i].Detail < result[j].Detail
+	})
+	return result
+}
+
+func (c *classCompletion) item(className string, kind int) (vscode.CompletionItem, bool) {
+	fqn := strings.TrimPrefix(className, `\`)
+	shortName := baseSymbolName(className)
+
+	item := vscode.CompletionItem{
+		Label:  shortName,
+		Kind:   kind,
+		Detail: fqn,
+	}
+
+	var text string
+	switch {
+	case strings.HasPrefix(c.prefix, `\`):
+		if !hasPrefixFold(className, c.prefix) {
+			return item, false
+		}
+		text = className
+	case strings.Contains(c.prefix, `\`) || c.imports == nil:
+		if !hasPrefixFold(fqn, c.prefix) {
+			return item, false
+		}
+		text = fqn
+		if c.imports != nil {
+			text = className
+		}
+	default:
+		if !hasPrefixFold(shortName, c.prefix) {
+			return item, false
+		}
+		text = c.shortNameText(className, shortName, &item)
+	}
+
+	item.FilterText = strings.TrimPrefix(text, `\`)
+	item.TextEdit = &vscode.TextEdit{Range: c.wordRange, NewText: text}
+	return item, true
+}
+
+// shortNameText returns the text that refers the class from the current namespace,
+// the use statement edit is added to the item if it's needed.
+func (c *classCompletion) shortNameText(className, shortName string, item *vscode.CompletionItem) string {
+	for alias, usedName := range c.st.Uses {
+		if strings.EqualFold(usedName, className) {
+			return alias
+		}
+	}
+
+	classNamespace := strings.TrimSuffix(className, `\`+shortName)
+	if strings.EqualFold(classNamespace, c.st.Namespace) {
+		return shortName
+	}
+
+	// The short name refers another class.
+	for alias := range c.st.Uses {
+		if strings.EqualFold(alias, shortName) {
+			return className
+		}
+	}
+	if _, ok := c.st.MetaInfo().GetClassOrTrait(c.st.Namespace + `\` + shortName); ok {
+		return className
+	}
+
+	item.AdditionalTextEdits = []vscode.TextEdit{c.imports.importEdit(className)}
+	return shortName
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// docCommentCompletionItems completes phpdoc tags and types.
+// lineBefore is the line text before the cursor.
+func docCommentCompletionItems(lineBefore string, line int, classes *classCompletion) []vscode.CompletionItem {
+	if idx := strings.LastIndexByte(lineBefore, '@'); idx >= 0 && isPhpdocTagName(lineBefore[idx+1:]) {
+		tagRange := vscode.Range{
+			Start: vscode.Position{Line: line, Character: idx},
+			End:   vscode.Position{Line: line, Character: len(lineBefore)},
+		}
+		return phpdocTagCompletionItems(lineBefore[idx+1:], tagRange)
+	}
+
+	before := strings.TrimSuffix(lineBefore, classes.prefix)
+	if !phpdocTypeRegex.MatchString(before) {
+		return nil
+	}
+	result := keywordCompletionItems(phpdocTypes, classes.prefix)
+	return append(result, classes.items(completeClasses|completeInterfaces)...)
+}
+
+func isPhpdocTagName(s string) bool {
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// keywordCompletionItems returns the keywords that start with the prefix.
+func keywordCompletionItems(keywords []string, prefix string) []vscode.CompletionItem {
+	var result []vscode.CompletionItem
+	for _, kw := range keywords {
+		if hasPrefixFold(kw, prefix) {
+			result = append(result, vscode.CompletionItem{
+				Label: kw,
+				Kind:  vscode.CompletionKindKeyword,
+			})
+		}
+	}
+	return result
+}
+
+// phpdocTagCompletionItems returns the phpdoc tags that start with the prefix,
+// tagRange is the range of the typed tag including "@".
+func phpdocTagCompletionItems(prefix string, tagRange vscode.Range) []vscode.CompletionItem {
+	var result []vscode.CompletionItem
+	for _, tag := range phpdocTags {
+		if hasPrefixFold(tag, "@"+prefix) {
+			result = append(result, vscode.CompletionItem{
+				Label:    tag,
+				Kind:     vscode.CompletionKindKeyword,
+				TextEdit: &vscode.TextEdit{Range: tagRange, NewText: tag},
+			})
+		}
+	}
+	return result
+}
+
+// funcCompletionItem returns the function or method completion item.
+// The call snippet is inserted if the client supports snippets.
+func (s *Server) funcCompletionItem(kind int, label, name string, fn *meta.FuncInfo) vscode.CompletionItem {
+	item := vscode.CompletionItem{
+		Kind:       kind,
+		Label:      label,
+		InsertText: name,
+	}
+	if label == name {
+		item.InsertText = ""
+	}
+	if fn == nil || !s.completionSnippets {
+		return item
+	}
+
+	item.InsertText = funcSnippet(name, fn)
+	item.InsertTextFormat = vscode.InsertTextFormatSnippet
+	return item
+}
+
+// funcSnippet returns the call snippet with placeholders for the function params,
+// like "f(${1:\$x}, ${2:...\$args})$0".
+func funcSnippet(name string, fn *meta.FuncInfo) string {
+	var b strings.Builder
+	b.WriteString(escapeSnippet(name))
+	b.WriteByte('(')
+	for i, p := range fn.Params {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		param := "$" + p.Name
+		if p.IsVariadic {
+			param = "..." + param
+		}
+		fmt.Fprintf(&b, "${%d:%s}", i+1, escapeSnippet(param))
+	}
+	b.WriteString(")$0")
+	return b.String()
+}
+
+var snippetReplacer = strings.NewReplacer(`\`, `\\`, `$`, `\$`, `}`, `\}`)
+
+func escapeSnippet(s string) string {
+	return snippetReplacer.Replace(s)
+}
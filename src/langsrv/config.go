@@ -0,0 +1,288 @@
+package langsrv
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/setpill/noverify/src/lintdebug"
+	"github.com/setpill/noverify/src/linter"
+	"github.com/setpill/noverify/src/rules"
+	"github.com/setpill/noverify/src/vscode"
+)
+
+// ruleFilesCheckInterval is how often the rule files are checked for changes.
+const ruleFilesCheckInterval = 2 * time.Second
+
+var severityByName = map[string]int{
+	"error":       vscode.Error,
+	"warning":     vscode.Warning,
+	"information": vscode.Information,
+	"hint":        vscode.Hint,
+}
+
+// initSettings remembers the command line settings and loads the stubs and rules.
+func (s *Server) initSettings() {
+	config := linter.GlobalConfig()
+	config.LangServer = true
+	config.DiagnosticFilter = s.filterDiagnostic
+
+	s.defaultStubsDir = config.StubsDir
+	s.defaultExcludeRegex = config.ExcludeRegex
+	s.defaultIsDiscardVar = config.IsDiscardVar
+
+	s.linter = linter.NewLinter(config)
+	s.loadedStubsDir = config.StubsDir
+	s.linter.InitStubs()
+
+	if err := s.loadRules(s.RuleFiles); err != nil {
+		log.Printf("Could not load rules: %s", err.Error())
+	}
+
+	go s.watchRuleFiles()
+}
+
+func (s *Server) handleWorkspaceDidChangeConfiguration(req *baseRequest) error {
+	var params vscode.DidChangeConfigurationParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	s.changingMutex.Lock()
+	err := s.applySettings(params.Settings.NoVerify)
+	s.changingMutex.Unlock()
+
+	if err != nil {
+		s.showError("Could not apply noverify settings: %s", err.Error())
+		return nil
+	}
+
+	s.relintAll()
+	return nil
+}
+
+// applySettings validates the settings and applies them all at once.
+// changingMutex must be held.
+func (s *Server) applySettings(settings vscode.Settings) error {
+	excludeRegex := s.defaultExcludeRegex
+	if settings.Exclude != "" {
+		re, err := regexp.Compile(settings.Exclude)
+		if err != nil {
+			return fmt.Errorf("exclude: %v", err)
+		}
+		excludeRegex = re
+	}
+
+	isDiscardVar := s.defaultIsDiscardVar
+	if settings.UnusedVarRegex != "" {
+		pred, err := linter.DiscardVarPredicate(settings.UnusedVarRegex)
+		if err != nil {
+			return fmt.Errorf("unusedVarRegex: %v", err)
+		}
+		isDiscardVar = pred
+	}
+
+	severity := make(map[string]int, len(settings.Severities))
+	for checkName, name := range settings.Severities {
+		level, ok := severityByName[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("severities: unknown severity %q for %s", name, checkName)
+		}
+		severity[checkName] = level
+	}
+
+	stubsDir := s.defaultStubsDir
+	if settings.StubsDir != "" {
+		st, err := os.Stat(settings.StubsDir)
+		if err != nil {
+			return fmt.Errorf("stubsDir: %v", err)
+		}
+		if !st.IsDir() {
+			return fmt.Errorf("stubsDir: %s is not a directory", settings.StubsDir)
+		}
+		stubsDir = settings.StubsDir
+	}
+
+	filenames := s.RuleFiles
+	if len(settings.Rules) != 0 {
+		filenames = settings.Rules
+	}
+	if err := s.loadRules(filenames); err != nil {
+		return err
+	}
+
+	s.updateConfig(func(config *linter.Config) {
+		config.ExcludeRegex = excludeRegex
+		config.IsDiscardVar = isDiscardVar
+		config.StubsDir = stubsDir
+	})
+	s.enabledChecks = stringsToSet(settings.EnabledChecks)
+	s.disabledChecks = stringsToSet(settings.DisabledChecks)
+	s.checkSeverity = severity
+
+	s.reloadStubs()
+
+	return nil
+}
+
+// reloadStubs loads the stubs and reindexes the workspace if the stubs directory is changed.
+// The stubs are reloaded by indexWorkspace if they are changed during the first indexing.
+// changingMutex must be held.
+func (s *Server) reloadStubs() {
+	config := s.linter.Config()
+	if config.StubsDir == s.loadedStubsDir || s.workspaceIndexing {
+		return
+	}
+	s.loadedStubsDir = config.StubsDir
+
+	lintdebug.Send("Loading stubs from %s", config.StubsDir)
+
+	// The index can't be cleared, so the new linter indexes everything from scratch.
+	s.linter = linter.NewLinter(config)
+	s.linter.InitStubs()
+
+	// The workspace is indexed after the stubs otherwise.
+	if !s.workspaceIndexed {
+		return
+	}
+
+	p := s.startProgress("Indexing")
+	s.linter.Index(linter.ReadFilenames(s.analysisFiles, config.ExcludeRegex))
+	p.end("")
+
+	s.buildSubtypesIndex()
+}
+
+// updateConfig changes the linter config with the update func.
+// changingMutex must be held.
+func (s *Server) updateConfig(update func(config *linter.Config)) {
+	config := s.linter.Config()
+	update(config)
+	s.linter.SetConfig(config)
+}
+
+// relintAll analyzes the opened documents again, as well as
+// all workspace files if workspace diagnostics are enabled.
+func (s *Server) relintAll() {
+	s.reanalyzeDocuments()
+	if s.workspaceDiagnostics {
+		go s.lintWorkspace()
+	}
+}
+
+// loadRules parses the rules files and replaces the current rules with them.
+// The current rules are kept if some of the files can't be parsed.
+// changingMutex must be held.
+func (s *Server) loadRules(filenames []string) error {
+	rset := rules.NewSet()
+	modTime := make(map[string]time.Time, len(filenames))
+	if len(filenames) != 0 {
+		var err error
+		rset, err = rules.ParseFiles(filenames)
+		if err != nil {
+			return fmt.Errorf("rules: %v", err)
+		}
+		for _, filename := range filenames {
+			if st, err := os.Stat(filename); err == nil {
+				modTime[filename] = st.ModTime()
+			}
+		}
+	}
+
+	s.updateConfig(func(config *linter.Config) {
+		config.Rules = rset
+	})
+	s.ruleChecks = stringsToSet(rset.AlwaysAllowed)
+
+	s.ruleFilesMutex.Lock()
+	s.ruleFiles = filenames
+	s.ruleFilesModTime = modTime
+	s.ruleFilesMutex.Unlock()
+
+	return nil
+}
+
+// watchRuleFiles reloads the rules once some of the rule files is changed.
+// It returns once the server is stopped.
+func (s *Server) watchRuleFiles() {
+	ticker := time.NewTicker(ruleFilesCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		s.ruleFilesMutex.Lock()
+		filenames := s.ruleFiles
+		changed := false
+		for _, filename := range filenames {
+			if st, err := os.Stat(filename); err == nil && !st.ModTime().Equal(s.ruleFilesModTime[filename]) {
+				s.ruleFilesModTime[filename] = st.ModTime()
+				changed = true
+			}
+		}
+		s.ruleFilesMutex.Unlock()
+
+		if !changed {
+			continue
+		}
+
+		lintdebug.Send("Reloading rules from %s", strings.Join(filenames, ", "))
+
+		s.changingMutex.Lock()
+		err := s.loadRules(filenames)
+		s.changingMutex.Unlock()
+
+		// The previous rules are kept until the files are changed again.
+		if err != nil {
+			s.showError("Could not reload rules: %s", err.Error())
+			continue
+		}
+
+		s.relintAll()
+	}
+}
+
+// filterDiagnostic applies the checks settings to the diagnostic.
+// changingMutex must be held.
+func (s *Server) filterDiagnostic(diag *vscode.Diagnostic) bool {
+	if len(s.enabledChecks) != 0 && !s.enabledChecks[diag.Code] && !s.ruleChecks[diag.Code] {
+		return false
+	}
+	if s.disabledChecks[diag.Code] {
+		return false
+	}
+	if severity, ok := s.checkSeverity[diag.Code]; ok {
+		diag.Severity = severity
+	}
+	return true
+}
+
+// showError shows the error message to the user.
+func (s *Server) showError(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	lintdebug.Send("%s", msg)
+	s.writeMessage(&methodCall{
+		JSONRPC: "2.0",
+		Method:  "window/showMessage",
+		Params: map[string]interface{}{
+			"type":    1, // Error
+			"message": msg,
+		},
+	})
+}
+
+func stringsToSet(list []string) map[string]bool {
+	set := make(map[string]bool, len(list))
+	for _, s := range list {
+		set[strings.TrimSpace(s)] = true
+	}
+	return set
+}
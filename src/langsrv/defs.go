@@ -2,12 +2,20 @@ package langsrv
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/setpill/noverify/src/lintdebug"
 	"github.com/setpill/noverify/src/meta"
+	"github.com/setpill/noverify/src/php/parser/freefloating"
 	"github.com/setpill/noverify/src/php/parser/node"
 	"github.com/setpill/noverify/src/php/parser/node/expr"
+	"github.com/setpill/noverify/src/php/parser/node/expr/binary"
 	"github.com/setpill/noverify/src/php/parser/node/name"
+	"github.com/setpill/noverify/src/php/parser/node/scalar"
+	"github.com/setpill/noverify/src/php/parser/node/stmt"
+	"github.com/setpill/noverify/src/php/parser/position"
 	"github.com/setpill/noverify/src/php/parser/walker"
 	"github.com/setpill/noverify/src/solver"
 	"github.com/setpill/noverify/src/state"
@@ -17,11 +25,18 @@ import (
 type definitionWalker struct {
 	st meta.ClassParseState
 
-	position int
-	scopes   map[node.Node]*meta.Scope
+	filename       string
+	linesPositions []int
+	position       int
+	// roots are the workspace directories, the includes are resolved relative to them.
+	roots   []string
+	scopes  map[node.Node]*meta.Scope
+	varDefs map[node.Node]struct{}
+	root    node.Node
 
 	result      []vscode.Location
 	foundScopes []*meta.Scope
+	funcs       []node.Node
 }
 
 func safeExprType(sc *meta.Scope, cs *meta.ClassParseState, n node.Node) (res meta.TypesMap) {
@@ -44,9 +59,36 @@ func (d *definitionWalker) EnterNode(w walker.Walkable) bool {
 		d.foundScopes = append(d.foundScopes, sc)
 	}
 
+	switch n.(type) {
+	case *stmt.Function, *stmt.ClassMethod, *expr.Closure:
+		d.funcs = append(d.funcs, n)
+	}
+
 	state.EnterNode(&d.st, n)
 
+	if ff := n.GetFreeFloating(); ff != nil {
+		for _, list := range *ff {
+			for _, s := range list {
+				if s.StringType == freefloating.CommentType && strings.HasPrefix(s.Value, "/**") {
+					d.handlePhpdoc(s)
+				}
+			}
+		}
+	}
+
 	switch n := w.(type) {
+	case *expr.Include:
+		d.handleInclude(n.Expr)
+	case *expr.IncludeOnce:
+		d.handleInclude(n.Expr)
+	case *expr.Require:
+		d.handleInclude(n.Expr)
+	case *expr.RequireOnce:
+		d.handleInclude(n.Expr)
+	case *node.SimpleVar:
+		if d.contains(n.Position) {
+			d.handleVariable(n)
+		}
 	case *expr.FunctionCall:
 		pos := n.Function.GetPosition()
 
@@ -61,13 +103,13 @@ func (d *definitionWalker) EnterNode(w walker.Walkable) bool {
 		switch nm := n.Function.(type) {
 		case *name.Name:
 			nameStr = meta.NameToString(nm)
-			fun, ok = meta.Info.GetFunction(d.st.Namespace + `\` + nameStr)
+			fun, ok = d.st.MetaInfo().GetFunction(d.st.Namespace + `\` + nameStr)
 			if !ok && d.st.Namespace != "" {
-				fun, ok = meta.Info.GetFunction(`\` + nameStr)
+				fun, ok = d.st.MetaInfo().GetFunction(`\` + nameStr)
 			}
 		case *name.FullyQualified:
 			nameStr = meta.FullyQualifiedToString(nm)
-			fun, ok = meta.Info.GetFunction(nameStr)
+			fun, ok = d.st.MetaInfo().GetFunction(nameStr)
 		}
 
 		if ok {
@@ -102,7 +144,7 @@ func (d *definitionWalker) EnterNode(w walker.Walkable) bool {
 			return true
 		}
 
-		fun, _, ok := solver.FindMethod(className, id.Value)
+		fun, _, ok := solver.FindMethod(d.st.MetaInfo(), className, id.Value)
 		if ok {
 			d.result = append(d.result, vscode.Location{
 				URI: "file://" + fun.Pos.Filename,
@@ -138,7 +180,7 @@ func (d *definitionWalker) EnterNode(w walker.Walkable) bool {
 		types := safeExprType(foundScope, &d.st, n.Variable)
 
 		types.Iterate(func(t string) {
-			fun, _, ok := solver.FindMethod(t, id.Value)
+			fun, _, ok := solver.FindMethod(d.st.MetaInfo(), t, id.Value)
 			if !ok {
 				lintdebug.Send("Could not find method for %s::%s", t, id.Value)
 				return
@@ -178,7 +220,7 @@ func (d *definitionWalker) EnterNode(w walker.Walkable) bool {
 		types := safeExprType(foundScope, &d.st, n.Variable)
 
 		types.Iterate(func(t string) {
-			prop, _, ok := solver.FindProperty(t, id.Value)
+			prop, _, ok := solver.FindProperty(d.st.MetaInfo(), t, id.Value)
 			if !ok {
 				lintdebug.Send("Could not find property for %s->%s", t, id.Value)
 				return
@@ -226,7 +268,7 @@ func (d *definitionWalker) EnterNode(w walker.Walkable) bool {
 			return false
 		}
 
-		if c, _, ok := solver.FindConstant(className, constName.Value); ok {
+		if c, _, ok := solver.FindConstant(d.st.MetaInfo(), className, constName.Value); ok {
 			d.result = append(d.result, vscode.Location{
 				URI: "file://" + c.Pos.Filename,
 				Range: vscode.Range{
@@ -248,7 +290,7 @@ func (d *definitionWalker) EnterNode(w walker.Walkable) bool {
 			return true
 		}
 
-		c, ok := meta.Info.GetClassOrTrait(className)
+		c, ok := d.st.MetaInfo().GetClassOrTrait(className)
 
 		if !ok {
 			return true
@@ -272,7 +314,7 @@ func (d *definitionWalker) EnterNode(w walker.Walkable) bool {
 			return true
 		}
 
-		c, ok := meta.Info.GetClassOrTrait(className)
+		c, ok := d.st.MetaInfo().GetClassOrTrait(className)
 
 		if !ok {
 			return true
@@ -301,5 +343,152 @@ func (d *definitionWalker) LeaveNode(w walker.Walkable) {
 		}
 	}
 
+	switch n.(type) {
+	case *stmt.Function, *stmt.ClassMethod, *expr.Closure:
+		d.funcs = d.funcs[:len(d.funcs)-1]
+	}
+
 	state.LeaveNode(&d.st, n)
 }
+
+func (d *definitionWalker) contains(pos *position.Position) bool {
+	return pos != nil && d.position >= pos.StartPos-1 && d.position <= pos.EndPos
+}
+
+// handlePhpdoc resolves the class name under the cursor inside the phpdoc types.
+func (d *definitionWalker) handlePhpdoc(s freefloating.String) {
+	if s.Position == nil || !d.contains(s.Position) {
+		return
+	}
+	// Comment position uses the same convention as nodes: StartPos is 1-based.
+	offset := s.Position.StartPos - 1
+
+	for _, m := range phpdocTypeRegexp.FindAllStringSubmatchIndex(s.Value, -1) {
+		typ := s.Value[m[2]:m[3]]
+		for _, idx := range phpdocClassNameRegexp.FindAllStringIndex(typ, -1) {
+			start, end := offset+m[2]+idx[0], offset+m[2]+idx[1]
+			if d.position < start || d.position > end {
+				continue
+			}
+
+			nm := typ[idx[0]:idx[1]]
+			className := resolvePhpdocClassName(&d.st, nm)
+			switch strings.ToLower(nm) {
+			case "self", "static", "$this":
+				className = d.st.CurrentClass
+			}
+
+			if c, ok := d.st.MetaInfo().GetClassOrTrait(className); ok {
+				d.result = append(d.result, posToLocation(c.Pos))
+			}
+			return
+		}
+	}
+}
+
+// handleInclude resolves the included file path if it can be evaluated statically.
+func (d *definitionWalker) handleInclude(e node.Node) {
+	if !d.contains(e.GetPosition()) {
+		return
+	}
+
+	path, ok := evalIncludePath(d.filename, e)
+	if !ok {
+		return
+	}
+
+	candidates := []string{path}
+	if !filepath.IsAbs(path) {
+		// PHP resolves relative paths using the include_path and the working
+		// directory, the file directory and the workspace roots are used instead.
+		candidates = []string{filepath.Join(filepath.Dir(d.filename), path)}
+		for _, root := range d.roots {
+			candidates = append(candidates, filepath.Join(root, path))
+		}
+	}
+
+	for _, filename := range candidates {
+		if st, err := os.Stat(filename); err == nil && !st.IsDir() {
+			d.result = append(d.result, vscode.Location{URI: "file://" + filepath.Clean(filename)})
+			return
+		}
+	}
+}
+
+// evalIncludePath evaluates the constant include path expression, like __DIR__ . '/x.php'.
+func evalIncludePath(filename string, e node.Node) (string, bool) {
+	switch e := e.(type) {
+	case *scalar.String:
+		if strings.HasPrefix(e.Value, `"`) && strings.ContainsAny(e.Value, `\$`) {
+			return "", false
+		}
+		if len(e.Value) < 2 {
+			return "", false
+		}
+		return e.Value[1 : len(e.Value)-1], true
+	case *scalar.MagicConstant:
+		switch strings.ToUpper(e.Value) {
+		case "__DIR__":
+			return filepath.Dir(filename), true
+		case "__FILE__":
+			return filename, true
+		}
+	case *binary.Concat:
+		left, ok := evalIncludePath(filename, e.Left)
+		if !ok {
+			return "", false
+		}
+		right, ok := evalIncludePath(filename, e.Right)
+		if !ok {
+			return "", false
+		}
+		return left + right, true
+	case *expr.FunctionCall:
+		// dirname(__FILE__) was used before __DIR__ is introduced.
+		nm, ok := e.Function.(*name.Name)
+		if !ok || !strings.EqualFold(meta.NameToString(nm), "dirname") || e.ArgumentList == nil || len(e.ArgumentList.Arguments) != 1 {
+			return "", false
+		}
+		arg, ok := e.ArgumentList.Arguments[0].(*node.Argument)
+		if !ok {
+			return "", false
+		}
+		path, ok := evalIncludePath(filename, arg.Expr)
+		if !ok {
+			return "", false
+		}
+		return filepath.Dir(path), true
+	}
+	return "", false
+}
+
+// handleVariable finds the local variable definitions: parameters
+// and assignments that define the variable in the current scope.
+func (d *definitionWalker) handleVariable(v *node.SimpleVar) {
+	if v.Name == "this" || isSuperGlobal(v.Name) {
+		return
+	}
+
+	root := varScope(d.funcs, v.Name)
+	if root == nil {
+		root = d.root
+	}
+	w := &varRenameWalker{root: root, varName: v.Name}
+	root.Walk(w)
+
+	defs := make(map[*node.SimpleVar]bool, len(d.varDefs))
+	for n := range d.varDefs {
+		switch n := n.(type) {
+		case *node.SimpleVar:
+			defs[n] = true
+		case *stmt.StaticVar:
+			defs[n.Variable] = true
+		}
+	}
+
+	for i, found := range w.vars {
+		if defs[found] {
+			d.result = append(d.result, refLocation(d.filename, d.linesPositions, w.found[i]))
+		}
+	}
+}
@@ -0,0 +1,277 @@
+package langsrv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/setpill/noverify/src/vscode"
+)
+
+// analysisDelay is a delay before the changed document analysis.
+// Every change restarts the delay, so the document
+// is analyzed once the user stops typing.
+const analysisDelay = 250 * time.Millisecond
+
+// document holds the latest contents of the opened document as seen by the editor.
+//
+// Documents are analyzed asynchronously, the analysis results
+// are stored in openMap.
+type document struct {
+	contents string
+	version  int
+
+	// pending is true until the current version is analyzed.
+	pending bool
+
+	timer  *time.Timer
+	cancel context.CancelFunc
+}
+
+func (s *Server) openDocument(filename, contents string, version int) {
+	s.documentsMutex.Lock()
+	defer s.documentsMutex.Unlock()
+
+	if doc, ok := s.documents[filename]; ok {
+		doc.stop()
+	}
+	doc := &document{contents: contents, version: version}
+	s.documents[filename] = doc
+	s.scheduleAnalysisLocked(filename, doc, 0)
+}
+
+// changeDocument applies the editor changes to the document.
+//
+// The changes are applied to a copy of the contents, so the document
+// is updated only if the whole batch applies. Otherwise the document
+// contents no longer match the editor ones, so the document is dropped:
+// the next didOpen or a full contents change resyncs it.
+func (s *Server) changeDocument(filename string, version int, changes []vscode.ContentChange) error {
+	s.documentsMutex.Lock()
+	defer s.documentsMutex.Unlock()
+
+	// Changes before the last full contents change don't matter.
+	full := -1
+	for i, ch := range changes {
+		if ch.Range == nil {
+			full = i
+		}
+	}
+
+	doc, ok := s.documents[filename]
+	if !ok && full < 0 {
+		return fmt.Errorf("document is not opened: %s", filename)
+	}
+
+	var contents string
+	if ok {
+		contents = doc.contents
+	}
+	if full >= 0 {
+		changes = changes[full:]
+	}
+	for _, ch := range changes {
+		var err error
+		contents, err = applyContentChange(contents, ch)
+		if err != nil {
+			if ok {
+				doc.stop()
+				delete(s.documents, filename)
+			}
+			return fmt.Errorf("%v (document is dropped until it's reopened or fully changed)", err)
+		}
+	}
+
+	if !ok {
+		doc = &document{}
+		s.documents[filename] = doc
+	}
+	doc.contents = contents
+	doc.version = version
+	s.scheduleAnalysisLocked(filename, doc, analysisDelay)
+	return nil
+}
+
+func (s *Server) closeDocument(filename string) {
+	s.documentsMutex.Lock()
+	if doc, ok := s.documents[filename]; ok {
+		doc.stop()
+		delete(s.documents, filename)
+	}
+	s.documentsMutex.Unlock()
+
+	s.closeFile(filename)
+
+	// The document may have unsaved changes, so the file
+	// is indexed and linted again using its contents on disk.
+	if s.workspaceDiagnostics && s.metaInfo().IsIndexingComplete() {
+		go s.externalChanges([]vscode.FileEvent{{URI: "file://" + filename, Type: vscode.Changed}})
+	}
+}
+
+// isDocumentOpened reports whether the document is opened in the editor.
+func (s *Server) isDocumentOpened(filename string) bool {
+	s.documentsMutex.Lock()
+	defer s.documentsMutex.Unlock()
+
+	_, ok := s.documents[filename]
+	return ok
+}
+
+// documentContents returns the latest contents of the opened document.
+// The contents may be not analyzed yet, so the handlers that only
+// need the text, like formatting, use it instead of the openMap.
+func (s *Server) documentContents(filename string) (string, bool) {
+	s.documentsMutex.Lock()
+	defer s.documentsMutex.Unlock()
+
+	doc, ok := s.documents[filename]
+	if !ok {
+		return "", false
+	}
+	return doc.contents, true
+}
+
+// reanalyzeDocument schedules the document analysis if it's opened.
+func (s *Server) reanalyzeDocument(filename string) {
+	s.documentsMutex.Lock()
+	defer s.documentsMutex.Unlock()
+
+	if doc, ok := s.documents[filename]; ok {
+		s.scheduleAnalysisLocked(filename, doc, 0)
+	}
+}
+
+// reanalyzeDocuments schedules all opened documents analysis.
+func (s *Server) reanalyzeDocuments() {
+	s.documentsMutex.Lock()
+	defer s.documentsMutex.Unlock()
+
+	for filename, doc := range s.documents {
+		s.scheduleAnalysisLocked(filename, doc, 0)
+	}
+}
+
+// syncDocument analyzes the document right away if it has pending changes,
+// so the requests are handled using the latest document contents.
+func (s *Server) syncDocument(filename string) {
+	s.documentsMutex.Lock()
+	doc, ok := s.documents[filename]
+	if !ok || !doc.pending {
+		s.documentsMutex.Unlock()
+		return
+	}
+	doc.stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	doc.cancel = cancel
+	version := doc.version
+	s.documentsMutex.Unlock()
+
+	s.analyzeDocument(ctx, filename, version)
+}
+
+// stop cancels the scheduled and running document analysis.
+func (doc *document) stop() {
+	if doc.timer != nil {
+		doc.timer.Stop()
+	}
+	if doc.cancel != nil {
+		doc.cancel()
+	}
+}
+
+// scheduleAnalysisLocked cancels the running document analysis
+// and starts the new one after the delay.
+// documentsMutex must be held.
+func (s *Server) scheduleAnalysisLocked(filename string, doc *document, delay time.Duration) {
+	doc.stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	doc.cancel = cancel
+	doc.pending = true
+	version := doc.version
+	doc.timer = time.AfterFunc(delay, func() {
+		s.analyzeDocument(ctx, filename, version)
+	})
+}
+
+func (s *Server) analyzeDocument(ctx context.Context, filename string, version int) {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	s.documentsMutex.Lock()
+	doc, ok := s.documents[filename]
+	ok = ok && doc.version == version
+	var contents string
+	if ok {
+		contents = doc.contents
+	}
+	s.documentsMutex.Unlock()
+	if !ok {
+		return
+	}
+
+	if s.metaInfo().IsIndexingComplete() {
+		s.changeFileNonLocked(ctx, filename, contents, version)
+	} else {
+		// just parse file, do not fully analyze it as indexing is not yet done
+		s.parseFileNonLocked(filename, contents, version)
+	}
+
+	if ctx.Err() == nil {
+		s.documentsMutex.Lock()
+		if doc.version == version {
+			doc.pending = false
+		}
+		s.documentsMutex.Unlock()
+	}
+}
+
+// applyContentChange applies the editor change to the document contents.
+func applyContentChange(contents string, ch vscode.ContentChange) (string, error) {
+	if ch.Range == nil {
+		return ch.Text, nil
+	}
+
+	start, ok := positionToOffset(contents, ch.Range.Start)
+	if !ok {
+		return "", errors.New("change start is out of range")
+	}
+	end, ok := positionToOffset(contents, ch.Range.End)
+	if !ok || end < start {
+		return "", errors.New("change end is out of range")
+	}
+
+	return contents[:start] + ch.Text + contents[end:], nil
+}
+
+// positionToOffset converts the LSP position into the contents byte offset.
+// LSP positions count characters in UTF-16 code units.
+func positionToOffset(contents string, pos vscode.Position) (int, bool) {
+	offset := 0
+	for line := 0; line < pos.Line; line++ {
+		idx := strings.IndexByte(contents[offset:], '\n')
+		if idx < 0 {
+			return 0, false
+		}
+		offset += idx + 1
+	}
+
+	units := 0
+	for i, r := range contents[offset:] {
+		if units >= pos.Character || r == '\n' {
+			return offset + i, true
+		}
+		if r >= 0x10000 {
+			units += 2
+		} else {
+			units++
+		}
+	}
+	return len(contents), true
+}
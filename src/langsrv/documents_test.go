@@ -0,0 +1,91 @@
+package langsrv
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/setpill/noverify/src/vscode"
+)
+
+func TestChangeDocument(t *testing.T) {
+	const filename = "/change-document-test.php"
+
+	s := NewServer(strings.NewReader(""), ioutil.Discard)
+
+	rangeChange := func(startLine, startChar, endLine, endChar int, text string) vscode.ContentChange {
+		return vscode.ContentChange{
+			Range: &vscode.Range{
+				Start: vscode.Position{Line: startLine, Character: startChar},
+				End:   vscode.Position{Line: endLine, Character: endChar},
+			},
+			Text: text,
+		}
+	}
+	dropDocument := func() {
+		s.documentsMutex.Lock()
+		if doc, ok := s.documents[filename]; ok {
+			doc.stop()
+			delete(s.documents, filename)
+		}
+		s.documentsMutex.Unlock()
+	}
+	defer dropDocument()
+
+	// The document is not analyzed in the test, so it's added directly.
+	s.documentsMutex.Lock()
+	s.documents[filename] = &document{contents: "<?php\necho 1;\n", version: 1}
+	s.documentsMutex.Unlock()
+
+	err := s.changeDocument(filename, 2, []vscode.ContentChange{
+		rangeChange(1, 5, 1, 6, "2"),
+		rangeChange(1, 7, 1, 7, " echo 3;"),
+	})
+	dropAnalysis(s, filename)
+	if err != nil {
+		t.Fatalf("valid changes: %v", err)
+	}
+	if contents, _ := s.documentContents(filename); contents != "<?php\necho 2; echo 3;\n" {
+		t.Errorf("valid changes: unexpected contents %q", contents)
+	}
+
+	err = s.changeDocument(filename, 3, []vscode.ContentChange{
+		rangeChange(1, 0, 1, 0, "// "),
+		rangeChange(10, 0, 10, 0, "echo 4;"),
+	})
+	dropAnalysis(s, filename)
+	if err == nil {
+		t.Fatalf("invalid changes: expected an error")
+	}
+	if s.isDocumentOpened(filename) {
+		t.Errorf("invalid changes: document is not dropped")
+	}
+
+	err = s.changeDocument(filename, 4, []vscode.ContentChange{rangeChange(0, 0, 0, 0, "x")})
+	if err == nil {
+		t.Errorf("range change of the dropped document: expected an error")
+	}
+
+	err = s.changeDocument(filename, 5, []vscode.ContentChange{
+		rangeChange(10, 0, 10, 0, "ignored"),
+		{Text: "<?php\necho 5;\n"},
+		rangeChange(1, 5, 1, 6, "6"),
+	})
+	dropAnalysis(s, filename)
+	if err != nil {
+		t.Fatalf("full change: %v", err)
+	}
+	if contents, _ := s.documentContents(filename); contents != "<?php\necho 6;\n" {
+		t.Errorf("full change: unexpected contents %q", contents)
+	}
+}
+
+// dropAnalysis cancels the document analysis that is scheduled by the changes.
+func dropAnalysis(s *Server, filename string) {
+	s.documentsMutex.Lock()
+	defer s.documentsMutex.Unlock()
+
+	if doc, ok := s.documents[filename]; ok {
+		doc.stop()
+	}
+}
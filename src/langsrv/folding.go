@@ -0,0 +1,235 @@
+package langsrv
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/setpill/noverify/src/lintdebug"
+	"github.com/setpill/noverify/src/php/parser/freefloating"
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/node/expr"
+	"github.com/setpill/noverify/src/php/parser/node/stmt"
+	"github.com/setpill/noverify/src/php/parser/position"
+	"github.com/setpill/noverify/src/php/parser/walker"
+	"github.com/setpill/noverify/src/vscode"
+)
+
+func (s *Server) handleTextDocumentFoldingRange(req *baseRequest) error {
+	var params vscode.FoldingRangeParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	filename := strings.TrimPrefix(params.TextDocument.URI, "file://")
+	s.openMapMutex.Lock()
+	f, ok := s.openMap[filename]
+	s.openMapMutex.Unlock()
+
+	result := make([]vscode.FoldingRange, 0)
+	if ok {
+		w := &foldingRangesWalker{}
+		f.rootNode.Walk(w)
+		result = append(result, w.ranges()...)
+	} else {
+		lintdebug.Send("File is not opened, but folding ranges requested: %s", filename)
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  result,
+	})
+}
+
+// foldingRangesWalker collects classes, functions, control blocks,
+// multiline comments and imports folding ranges.
+type foldingRangesWalker struct {
+	result []vscode.FoldingRange
+}
+
+// EnterNode is invoked at every node in hierarchy
+func (d *foldingRangesWalker) EnterNode(w walker.Walkable) bool {
+	n := w.(node.Node)
+
+	if ff := n.GetFreeFloating(); ff != nil {
+		for _, list := range *ff {
+			for _, s := range list {
+				if s.StringType == freefloating.CommentType && strings.HasPrefix(s.Value, "/*") && s.Position != nil {
+					d.add(s.Position.StartLine-1, s.Position.EndLine-1, vscode.FoldingRangeComment)
+				}
+			}
+		}
+	}
+
+	switch n := n.(type) {
+	case *node.Root:
+		d.addImports(n.Stmts)
+	case *stmt.Namespace:
+		d.addImports(n.Stmts)
+	case *stmt.Class, *stmt.Interface, *stmt.Trait, *stmt.Function, *stmt.ClassMethod, *expr.Closure,
+		*stmt.StmtList, *stmt.Switch, *stmt.Catch, *stmt.Finally:
+		// The closing brace line is left visible.
+		d.addNode(n, -1)
+	case *stmt.Case, *stmt.Default:
+		d.addNode(n, 0)
+	case *stmt.Try:
+		// Catch and finally blocks are folded separately.
+		end := n.Position.EndLine - 1
+		if len(n.Catches) != 0 {
+			end = n.Catches[0].GetPosition().StartLine - 1
+		} else if n.Finally != nil {
+			end = n.Finally.GetPosition().StartLine - 1
+		}
+		d.add(n.Position.StartLine-1, end-1, "")
+	case *stmt.GroupUse:
+		d.addNode(n, -1)
+	}
+
+	return true
+}
+
+// LeaveNode is invoked after node process
+func (d *foldingRangesWalker) LeaveNode(w walker.Walkable) {}
+
+// addNode adds the node lines range, endDelta is added to the last line.
+func (d *foldingRangesWalker) addNode(n node.Node, endDelta int) {
+	pos := n.GetPosition()
+	if pos == nil {
+		return
+	}
+	d.add(pos.StartLine-1, pos.EndLine-1+endDelta, "")
+}
+
+// addImports adds the consecutive use statements ranges.
+func (d *foldingRangesWalker) addImports(stmts []node.Node) {
+	start, end := -1, -1
+	for _, s := range stmts {
+		switch s.(type) {
+		case *stmt.UseList, *stmt.GroupUse:
+			pos := s.GetPosition()
+			if start < 0 {
+				start = pos.StartLine - 1
+			}
+			end = pos.EndLine - 1
+			continue
+		}
+		d.add(start, end, vscode.FoldingRangeImports)
+		start, end = -1, -1
+	}
+	d.add(start, end, vscode.FoldingRangeImports)
+}
+
+func (d *foldingRangesWalker) add(startLine, endLine int, kind string) {
+	if startLine < 0 || endLine <= startLine {
+		return
+	}
+	d.result = append(d.result, vscode.FoldingRange{StartLine: startLine, EndLine: endLine, Kind: kind})
+}
+
+// ranges returns the ranges sorted by the start line.
+// Clients use only one range per line, so the largest one is kept.
+func (d *foldingRangesWalker) ranges() []vscode.FoldingRange {
+	sort.SliceStable(d.result, func(i, j int) bool {
+		a, b := d.result[i], d.result[j]
+		if a.StartLine != b.StartLine {
+			return a.StartLine < b.StartLine
+		}
+		return a.EndLine > b.EndLine
+	})
+
+	res := d.result[:0]
+	for i, r := range d.result {
+		if i == 0 || r.StartLine != d.result[i-1].StartLine {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+func (s *Server) handleTextDocumentSelectionRange(req *baseRequest) error {
+	var params vscode.SelectionRangeParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	filename := strings.TrimPrefix(params.TextDocument.URI, "file://")
+	s.openMapMutex.Lock()
+	f, ok := s.openMap[filename]
+	s.openMapMutex.Unlock()
+
+	if !ok {
+		lintdebug.Send("File is not opened, but selection ranges requested: %s", filename)
+	}
+
+	result := make([]vscode.SelectionRange, 0, len(params.Positions))
+	for _, pos := range params.Positions {
+		r := vscode.SelectionRange{Range: vscode.Range{Start: pos, End: pos}}
+		if ok && pos.Line < len(f.linesPositions) {
+			w := &selectionRangeWalker{position: f.linesPositions[pos.Line] + pos.Character}
+			f.rootNode.Walk(w)
+			r = selectionRangeChain(f.linesPositions, w.found, r)
+		}
+		result = append(result, r)
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  result,
+	})
+}
+
+// selectionRangeChain converts the node positions, from the outermost
+// to the innermost one, into the nested selection ranges.
+// The def range is returned if there are no positions.
+func selectionRangeChain(linesPositions []int, found []*position.Position, def vscode.SelectionRange) vscode.SelectionRange {
+	var res *vscode.SelectionRange
+	for _, pos := range found {
+		r := posToRange(linesPositions, pos)
+		// Nodes like expression statements often have the same range as their children.
+		if res != nil && res.Range == r {
+			continue
+		}
+		res = &vscode.SelectionRange{Range: r, Parent: res}
+	}
+	if res == nil {
+		return def
+	}
+	return *res
+}
+
+// selectionRangeWalker finds the nodes that contain the position.
+type selectionRangeWalker struct {
+	position int
+
+	// found contains the node positions from the outermost to the innermost one.
+	found []*position.Position
+
+	// done is set once the innermost node is left, so the next sibling
+	// that starts right at the position is not added.
+	done bool
+}
+
+// EnterNode is invoked at every node in hierarchy
+func (d *selectionRangeWalker) EnterNode(w walker.Walkable) bool {
+	if d.done {
+		return false
+	}
+	pos := w.(node.Node).GetPosition()
+	if pos == nil {
+		return true
+	}
+	if d.position < pos.StartPos-1 || d.position > pos.EndPos {
+		return false
+	}
+	d.found = append(d.found, pos)
+	return true
+}
+
+// LeaveNode is invoked after node process
+func (d *selectionRangeWalker) LeaveNode(w walker.Walkable) {
+	if len(d.found) != 0 && w.(node.Node).GetPosition() == d.found[len(d.found)-1] {
+		d.done = true
+	}
+}
@@ -0,0 +1,95 @@
+package langsrv
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/setpill/noverify/src/lintdebug"
+	"github.com/setpill/noverify/src/phpfmt"
+	"github.com/setpill/noverify/src/vscode"
+)
+
+func (s *Server) handleTextDocumentFormatting(req *baseRequest) error {
+	result := []vscode.TextEdit{}
+
+	defer func() {
+		s.writeMessage(&response{
+			JSONRPC: req.JSONRPC,
+			ID:      req.ID,
+			Result:  result,
+		})
+	}()
+
+	var params vscode.DocumentFormattingParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	filename := strings.TrimPrefix(params.TextDocument.URI, "file://")
+	contents, ok := s.documentContents(filename)
+	if !ok {
+		return nil
+	}
+
+	formatted, err := phpfmt.Format(filename, []byte(contents))
+	if err != nil {
+		lintdebug.Send("Could not format %s: %s", filename, err.Error())
+		return nil
+	}
+
+	result = convertEdits(phpfmt.Edits([]byte(contents), formatted))
+	return nil
+}
+
+func (s *Server) handleTextDocumentRangeFormatting(req *baseRequest) error {
+	result := []vscode.TextEdit{}
+
+	defer func() {
+		s.writeMessage(&response{
+			JSONRPC: req.JSONRPC,
+			ID:      req.ID,
+			Result:  result,
+		})
+	}()
+
+	var params vscode.DocumentRangeFormattingParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	filename := strings.TrimPrefix(params.TextDocument.URI, "file://")
+	contents, ok := s.documentContents(filename)
+	if !ok {
+		return nil
+	}
+
+	endLine := params.Range.End.Line
+	if params.Range.End.Character == 0 && endLine > params.Range.Start.Line {
+		// Selection ends at the beginning of the line, so the line itself is not selected.
+		endLine--
+	}
+
+	edits, err := phpfmt.FormatRange(filename, []byte(contents), params.Range.Start.Line, endLine)
+	if err != nil {
+		lintdebug.Send("Could not format %s: %s", filename, err.Error())
+		return nil
+	}
+
+	result = convertEdits(edits)
+	return nil
+}
+
+// convertEdits converts line-based formatter edits to the LSP text edits.
+func convertEdits(edits []phpfmt.Edit) []vscode.TextEdit {
+	res := make([]vscode.TextEdit, 0, len(edits))
+	for _, e := range edits {
+		res = append(res, vscode.TextEdit{
+			Range: vscode.Range{
+				Start: vscode.Position{Line: e.StartLine},
+				End:   vscode.Position{Line: e.EndLine},
+			},
+			NewText: e.NewText,
+		})
+	}
+	return res
+}
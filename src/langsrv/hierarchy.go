@@ -0,0 +1,500 @@
+package langsrv
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/setpill/noverify/src/lintdebug"
+	"github.com/setpill/noverify/src/linter"
+	"github.com/setpill/noverify/src/meta"
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/php7"
+	"github.com/setpill/noverify/src/solver"
+	"github.com/setpill/noverify/src/vscode"
+)
+
+// buildSubtypesIndex builds subtypesIndex from scratch.
+// changingMutex must be held.
+func (s *Server) buildSubtypesIndex() {
+	s.subtypesIndex = make(map[string]map[string]struct{})
+	s.metaInfo().IterateClasses(func(className string, class meta.ClassInfo) {
+		for _, supertype := range directSupertypes(class) {
+			s.addSubtype(supertype, className)
+		}
+	})
+}
+
+// updateSubtypesIndex replaces file classes in subtypesIndex.
+// changingMutex must be held.
+func (s *Server) updateSubtypesIndex(oldClasses, newClasses meta.ClassesMap) {
+	if s.subtypesIndex == nil {
+		return
+	}
+
+	for className, class := range oldClasses {
+		for _, supertype := range directSupertypes(class) {
+			delete(s.subtypesIndex[supertype], className)
+		}
+	}
+	for className, class := range newClasses {
+		for _, supertype := range directSupertypes(class) {
+			s.addSubtype(supertype, className)
+		}
+	}
+}
+
+func (s *Server) addSubtype(className, subtype string) {
+	m, ok := s.subtypesIndex[className]
+	if !ok {
+		m = make(map[string]struct{})
+		s.subtypesIndex[className] = m
+	}
+	m[subtype] = struct{}{}
+}
+
+// directSupertypes returns the class parent and the interfaces
+// that the class implements or the interface extends.
+func directSupertypes(class meta.ClassInfo) []string {
+	var res []string
+	if class.Parent != "" {
+		res = append(res, class.Parent)
+	}
+	res = append(res, class.ParentInterfaces...)
+
+	ifaces := make([]string, 0, len(class.Interfaces))
+	for iface := range class.Interfaces {
+		ifaces = append(ifaces, iface)
+	}
+	sort.Strings(ifaces)
+
+	return append(res, ifaces...)
+}
+
+// directSubtypes returns sorted direct subtypes of the class or interface.
+func (s *Server) directSubtypes(className string) []string {
+	if s.subtypesIndex == nil {
+		s.buildSubtypesIndex()
+	}
+
+	res := make([]string, 0, len(s.subtypesIndex[className]))
+	for subtype := range s.subtypesIndex[className] {
+		res = append(res, subtype)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// allSubtypes returns direct and indirect subtypes of the class or interface.
+func (s *Server) allSubtypes(className string) []string {
+	var res []string
+	visited := map[string]bool{className: true}
+
+	queue := []string{className}
+	for len(queue) != 0 {
+		subtypes := s.directSubtypes(queue[0])
+		queue = queue[1:]
+		for _, subtype := range subtypes {
+			if !visited[subtype] {
+				visited[subtype] = true
+				res = append(res, subtype)
+				queue = append(queue, subtype)
+			}
+		}
+	}
+
+	return res
+}
+
+func (s *Server) handleTextDocumentImplementation(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	var params vscode.ImplementationParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	result := make([]vscode.Location, 0)
+	if _, _, target, err := s.findRenameTarget(params.TextDocument.URI, params.Position); err == nil {
+		result = append(result, s.findImplementations(target)...)
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  result,
+	})
+}
+
+// findImplementations returns classes that implement the interface or extend the class
+// and methods that implement or override the method.
+func (s *Server) findImplementations(t *renameTarget) []vscode.Location {
+	var res []vscode.Location
+
+	switch t.kind {
+	case renameClass:
+		for _, className := range s.allSubtypes(t.fullName) {
+			class, ok := s.metaInfo().GetClass(className)
+			if ok && !class.IsInterface() {
+				res = append(res, posToLocation(class.Pos))
+			}
+		}
+	case renameMethod:
+		// Subtypes can inherit the same implementation.
+		seen := make(map[string]bool)
+		for _, className := range s.allSubtypes(t.className) {
+			fn, implClassName, ok := solver.FindMethod(s.metaInfo(), className, t.name)
+			if !ok || fn.IsAbstract() || implClassName == t.className || seen[implClassName] {
+				continue
+			}
+			seen[implClassName] = true
+			res = append(res, posToLocation(fn.Pos))
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].URI != res[j].URI {
+			return res[i].URI < res[j].URI
+		}
+		return res[i].Range.Start.Line < res[j].Range.Start.Line
+	})
+
+	return res
+}
+
+// hierarchySymbol identifies call and type hierarchy items.
+// It's passed to the client as the item data.
+type hierarchySymbol struct {
+	// ClassName is set for classes and methods.
+	ClassName string `json:"class,omitempty"`
+
+	// Name is a method name or a fully qualified function name.
+	Name string `json:"name,omitempty"`
+
+	// Filename is set for the top-level code of the file.
+	Filename string `json:"file,omitempty"`
+}
+
+// hierarchyCall is a function or method call found by findCalls.
+type hierarchyCall struct {
+	caller hierarchySymbol
+	callee hierarchySymbol
+
+	// rng is the called name range.
+	rng vscode.Range
+}
+
+func (s *Server) handleTextDocumentPrepareCallHierarchy(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	var params vscode.CallHierarchyPrepareParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	var result []vscode.CallHierarchyItem
+	if _, _, target, err := s.findRenameTarget(params.TextDocument.URI, params.Position); err == nil {
+		var sym hierarchySymbol
+		switch target.kind {
+		case renameFunction:
+			sym = hierarchySymbol{Name: target.fullName}
+		case renameMethod:
+			sym = hierarchySymbol{ClassName: target.className, Name: target.name}
+		}
+		if item, ok := s.callHierarchyItem(sym); ok {
+			result = append(result, item)
+		}
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  result,
+	})
+}
+
+func (s *Server) handleCallHierarchyIncomingCalls(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	var params vscode.CallHierarchyCallsParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	result := make([]vscode.CallHierarchyIncomingCall, 0)
+	var sym hierarchySymbol
+	if err := json.Unmarshal(params.Item.Data, &sym); err == nil && sym.Name != "" && s.metaInfo().IsIndexingComplete() {
+		result = append(result, s.findIncomingCalls(sym)...)
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  result,
+	})
+}
+
+func (s *Server) handleCallHierarchyOutgoingCalls(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	var params vscode.CallHierarchyCallsParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	result := make([]vscode.CallHierarchyOutgoingCall, 0)
+	var sym hierarchySymbol
+	if err := json.Unmarshal(params.Item.Data, &sym); err == nil && s.metaInfo().IsIndexingComplete() {
+		result = append(result, s.findOutgoingCalls(sym)...)
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  result,
+	})
+}
+
+// findIncomingCalls returns callee calls grouped by the callers.
+func (s *Server) findIncomingCalls(callee hierarchySymbol) []vscode.CallHierarchyIncomingCall {
+	var (
+		mu      sync.Mutex
+		callers = make(map[hierarchySymbol][]vscode.Range)
+	)
+
+	s.findReferences(baseSymbolName(callee.Name), func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
+		calls := s.findCalls(filename, rootNode, contents, parser)
+		mu.Lock()
+		for _, c := range calls {
+			if c.callee == callee {
+				callers[c.caller] = append(callers[c.caller], c.rng)
+			}
+		}
+		mu.Unlock()
+		return nil
+	})
+
+	var res []vscode.CallHierarchyIncomingCall
+	for caller, ranges := range callers {
+		if item, ok := s.callHierarchyItem(caller); ok {
+			res = append(res, vscode.CallHierarchyIncomingCall{From: item, FromRanges: ranges})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return lessCallHierarchyItem(res[i].From, res[j].From)
+	})
+
+	return res
+}
+
+// findOutgoingCalls returns calls made by the caller grouped by the callees.
+func (s *Server) findOutgoingCalls(caller hierarchySymbol) []vscode.CallHierarchyOutgoingCall {
+	filename := caller.Filename
+	if filename == "" {
+		pos, _, ok := s.hierarchySymbolPosition(caller)
+		if !ok {
+			return nil
+		}
+		filename = pos.Filename
+	}
+
+	contents, err := readFile(s.linter.Config().SrcInput, s.copyOpenMap(), filename)
+	if err != nil {
+		lintdebug.Send("Could not read %s: %s", filename, err.Error())
+		return nil
+	}
+
+	waiter := linter.BeforeParse(len(contents), filename)
+	defer waiter.Finish()
+
+	parser := php7.NewParser(bytes.NewReader(contents), filename)
+	parser.WithFreeFloating()
+	parser.Parse()
+
+	rootNode := parser.GetRootNode()
+	if rootNode == nil {
+		return nil
+	}
+
+	var callees []hierarchySymbol
+	ranges := make(map[hierarchySymbol][]vscode.Range)
+	for _, c := range s.findCalls(filename, rootNode, contents, parser) {
+		if c.caller != caller {
+			continue
+		}
+		if _, ok := ranges[c.callee]; !ok {
+			callees = append(callees, c.callee)
+		}
+		ranges[c.callee] = append(ranges[c.callee], c.rng)
+	}
+
+	var res []vscode.CallHierarchyOutgoingCall
+	for _, callee := range callees {
+		if item, ok := s.callHierarchyItem(callee); ok {
+			res = append(res, vscode.CallHierarchyOutgoingCall{To: item, FromRanges: ranges[callee]})
+		}
+	}
+
+	return res
+}
+
+// hierarchySymbolPosition returns the function or method declaration position.
+func (s *Server) hierarchySymbolPosition(sym hierarchySymbol) (pos meta.ElementPosition, kind int, ok bool) {
+	if sym.ClassName == "" {
+		fn, ok := s.metaInfo().GetFunction(sym.Name)
+		return fn.Pos, vscode.SymbolKindFunction, ok
+	}
+
+	class, ok := s.metaInfo().GetClassOrTrait(sym.ClassName)
+	if !ok {
+		return pos, 0, false
+	}
+	fn, ok := class.Methods[sym.Name]
+	if sym.Name == "__construct" {
+		return fn.Pos, vscode.SymbolKindConstructor, ok
+	}
+	return fn.Pos, vscode.SymbolKindMethod, ok
+}
+
+func (s *Server) callHierarchyItem(sym hierarchySymbol) (vscode.CallHierarchyItem, bool) {
+	var item vscode.CallHierarchyItem
+
+	data, err := json.Marshal(sym)
+	if err != nil {
+		return item, false
+	}
+	item.Data = data
+
+	if sym.Filename != "" {
+		item.Name = filepath.Base(sym.Filename)
+		item.Kind = vscode.SymbolKindFile
+		item.URI = "file://" + sym.Filename
+		return item, true
+	}
+
+	pos, kind, ok := s.hierarchySymbolPosition(sym)
+	if !ok || pos.Filename == "" {
+		return item, false
+	}
+	loc := posToLocation(pos)
+
+	item.Kind = kind
+	item.URI = loc.URI
+	item.Range = loc.Range
+	item.SelectionRange = loc.Range
+	if sym.ClassName != "" {
+		item.Name = sym.Name
+		item.Detail = strings.TrimPrefix(sym.ClassName, `\`)
+	} else {
+		item.Name = baseSymbolName(sym.Name)
+		item.Detail = symbolNamespace(sym.Name)
+	}
+
+	return item, true
+}
+
+func lessCallHierarchyItem(a, b vscode.CallHierarchyItem) bool {
+	if a.URI != b.URI {
+		return a.URI < b.URI
+	}
+	return a.Range.Start.Line < b.Range.Start.Line
+}
+
+func (s *Server) handleTextDocumentPrepareTypeHierarchy(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	var params vscode.TypeHierarchyPrepareParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	var result []vscode.TypeHierarchyItem
+	if _, _, target, err := s.findRenameTarget(params.TextDocument.URI, params.Position); err == nil && target.kind == renameClass {
+		if item, ok := s.typeHierarchyItem(target.fullName); ok {
+			result = append(result, item)
+		}
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  result,
+	})
+}
+
+func (s *Server) handleTypeHierarchySupertypes(req *baseRequest) error {
+	return s.handleTypeHierarchy(req, func(className string) []string {
+		class, ok := s.metaInfo().GetClassOrTrait(className)
+		if !ok {
+			return nil
+		}
+		return directSupertypes(class)
+	})
+}
+
+func (s *Server) handleTypeHierarchySubtypes(req *baseRequest) error {
+	return s.handleTypeHierarchy(req, s.directSubtypes)
+}
+
+// handleTypeHierarchy responds with the items for classes returned by the related func.
+func (s *Server) handleTypeHierarchy(req *baseRequest, related func(className string) []string) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	var params vscode.TypeHierarchyParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	result := make([]vscode.TypeHierarchyItem, 0)
+	var sym hierarchySymbol
+	if err := json.Unmarshal(params.Item.Data, &sym); err == nil && sym.ClassName != "" && s.metaInfo().IsIndexingComplete() {
+		for _, className := range related(sym.ClassName) {
+			if item, ok := s.typeHierarchyItem(className); ok {
+				result = append(result, item)
+			}
+		}
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  result,
+	})
+}
+
+func (s *Server) typeHierarchyItem(className string) (vscode.TypeHierarchyItem, bool) {
+	var item vscode.TypeHierarchyItem
+
+	class, ok := s.metaInfo().GetClassOrTrait(className)
+	if !ok || class.Pos.Filename == "" {
+		return item, false
+	}
+
+	data, err := json.Marshal(hierarchySymbol{ClassName: className})
+	if err != nil {
+		return item, false
+	}
+	loc := posToLocation(class.Pos)
+
+	item.Name = baseSymbolName(className)
+	item.Kind = vscode.SymbolKindClass
+	if class.IsInterface() {
+		item.Kind = vscode.SymbolKindInterface
+	}
+	item.Detail = symbolNamespace(className)
+	item.URI = loc.URI
+	item.Range = loc.Range
+	item.SelectionRange = loc.Range
+	item.Data = data
+
+	return item, true
+}
@@ -0,0 +1,161 @@
+package langsrv
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/node/expr"
+	"github.com/setpill/noverify/src/php/parser/node/expr/assign"
+	"github.com/setpill/noverify/src/php/parser/node/stmt"
+	"github.com/setpill/noverify/src/php/parser/walker"
+	"github.com/setpill/noverify/src/vscode"
+)
+
+func (s *Server) handleTextDocumentDocumentHighlight(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	var params vscode.DocumentHighlightParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	result := make([]vscode.DocumentHighlight, 0)
+	if filename, f, target, err := s.findRenameTarget(params.TextDocument.URI, params.Position); err == nil {
+		result = append(result, s.findDocumentHighlights(filename, f, target)...)
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  result,
+	})
+}
+
+// findDocumentHighlights returns the target occurrences inside the file.
+// Variable assignments and symbol declarations are marked as writes.
+func (s *Server) findDocumentHighlights(filename string, f openedFile, t *renameTarget) []vscode.DocumentHighlight {
+	var res []vscode.DocumentHighlight
+
+	if t.kind == renameVariable {
+		root := t.scope
+		if root == nil {
+			root = f.rootNode
+		}
+		v := &varRenameWalker{root: root, varName: t.name}
+		root.Walk(v)
+		writes := &varWritesWalker{root: root, ends: make(map[int]bool)}
+		root.Walk(writes)
+
+		for _, pos := range v.found {
+			kind := vscode.DocumentHighlightRead
+			if writes.ends[pos.EndPos] {
+				kind = vscode.DocumentHighlightWrite
+			}
+			res = append(res, vscode.DocumentHighlight{Range: posToRange(f.linesPositions, pos), Kind: kind})
+		}
+	} else {
+		contents := []byte(f.contents)
+		for _, l := range s.findTargetUsages(filename, f.rootNode, contents, nil, t) {
+			res = append(res, vscode.DocumentHighlight{Range: l.Range, Kind: vscode.DocumentHighlightRead})
+		}
+		for _, l := range s.findTargetDeclarations(filename, f.rootNode, contents, t) {
+			res = append(res, vscode.DocumentHighlight{Range: l.Range, Kind: vscode.DocumentHighlightWrite})
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		a, b := res[i].Range.Start, res[j].Range.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Character < b.Character
+	})
+
+	// The same occurrence can be found twice, like static method calls
+	// that are also found as instance method calls.
+	dedup := res[:0]
+	for i, h := range res {
+		if i == 0 || h.Range != res[i-1].Range {
+			dedup = append(dedup, h)
+		}
+	}
+	return dedup
+}
+
+// varWritesWalker finds the variables that are assigned inside the function.
+// Nested functions and classes are skipped in the same way as in varRenameWalker.
+type varWritesWalker struct {
+	root node.Node
+
+	// ends contains end positions of the assigned variables.
+	ends map[int]bool
+}
+
+// EnterNode is invoked at every node in hierarchy
+func (d *varWritesWalker) EnterNode(w walker.Walkable) bool {
+	if w == d.root {
+		return true
+	}
+
+	switch n := w.(type) {
+	case *stmt.Function, *stmt.ClassMethod, *stmt.Class, *stmt.Interface, *stmt.Trait:
+		return false
+	case *node.Parameter:
+		d.add(n.Variable)
+	case *stmt.Foreach:
+		d.add(n.Key)
+		d.add(n.Variable)
+	case *assign.Assign:
+		d.add(n.Variable)
+	case *assign.Reference:
+		d.add(n.Variable)
+	case *assign.BitwiseAnd:
+		d.add(n.Variable)
+	case *assign.BitwiseOr:
+		d.add(n.Variable)
+	case *assign.BitwiseXor:
+		d.add(n.Variable)
+	case *assign.Concat:
+		d.add(n.Variable)
+	case *assign.Div:
+		d.add(n.Variable)
+	case *assign.Minus:
+		d.add(n.Variable)
+	case *assign.Mod:
+		d.add(n.Variable)
+	case *assign.Mul:
+		d.add(n.Variable)
+	case *assign.Plus:
+		d.add(n.Variable)
+	case *assign.Pow:
+		d.add(n.Variable)
+	case *assign.ShiftLeft:
+		d.add(n.Variable)
+	case *assign.ShiftRight:
+		d.add(n.Variable)
+	case *expr.PreInc:
+		d.add(n.Variable)
+	case *expr.PreDec:
+		d.add(n.Variable)
+	case *expr.PostInc:
+		d.add(n.Variable)
+	case *expr.PostDec:
+		d.add(n.Variable)
+	}
+
+	return true
+}
+
+// LeaveNode is invoked after node process
+func (d *varWritesWalker) LeaveNode(w walker.Walkable) {}
+
+func (d *varWritesWalker) add(n node.Node) {
+	if ref, ok := n.(*expr.Reference); ok {
+		n = ref.Variable
+	}
+	if v, ok := n.(*node.SimpleVar); ok && v != nil && v.Position != nil {
+		d.ends[v.Position.EndPos] = true
+	}
+}
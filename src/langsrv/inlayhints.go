@@ -0,0 +1,246 @@
+package langsrv
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/setpill/noverify/src/lintdebug"
+	"github.com/setpill/noverify/src/meta"
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/node/expr"
+	"github.com/setpill/noverify/src/php/parser/node/expr/assign"
+	"github.com/setpill/noverify/src/php/parser/node/stmt"
+	"github.com/setpill/noverify/src/php/parser/walker"
+	"github.com/setpill/noverify/src/solver"
+	"github.com/setpill/noverify/src/state"
+	"github.com/setpill/noverify/src/vscode"
+)
+
+func (s *Server) handleTextDocumentInlayHint(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	var params vscode.InlayHintParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	filename := strings.TrimPrefix(params.TextDocument.URI, "file://")
+	s.openMapMutex.Lock()
+	f, ok := s.openMap[filename]
+	s.openMapMutex.Unlock()
+
+	result := make([]vscode.InlayHint, 0)
+	switch {
+	case !ok:
+		lintdebug.Send("File is not opened, but inlay hints requested: %s", filename)
+	case s.metaInfo().IsIndexingComplete() && f.scopes != nil:
+		w := &inlayHintsWalker{
+			st:             meta.ClassParseState{Info: s.metaInfo()},
+			contents:       f.contents,
+			linesPositions: f.linesPositions,
+			scopes:         f.scopes,
+			start:          rangeOffset(f.linesPositions, len(f.contents), params.Range.Start),
+			end:            rangeOffset(f.linesPositions, len(f.contents), params.Range.End),
+		}
+		f.rootNode.Walk(w)
+		result = append(result, w.result...)
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  result,
+	})
+}
+
+// rangeOffset converts the range position into the contents offset.
+// Positions after the last line are converted to the contents end.
+func rangeOffset(linesPositions []int, contentsLen int, pos vscode.Position) int {
+	if pos.Line >= len(linesPositions) {
+		return contentsLen
+	}
+	return linesPositions[pos.Line] + pos.Character
+}
+
+// inlayHintsWalker collects inferred types of assigned variables,
+// parameter names at call sites and inferred return types
+// of functions without declared return types.
+type inlayHintsWalker struct {
+	st meta.ClassParseState
+
+	contents       string
+	linesPositions []int
+	scopes         map[node.Node]*meta.Scope
+
+	// start and end limit the hints to the requested range.
+	start int
+	end   int
+
+	foundScopes []*meta.Scope
+
+	result []vscode.InlayHint
+}
+
+// EnterNode is invoked at every node in hierarchy
+func (d *inlayHintsWalker) EnterNode(w walker.Walkable) bool {
+	n := w.(node.Node)
+
+	if sc, ok := d.scopes[n]; ok {
+		d.foundScopes = append(d.foundScopes, sc)
+	}
+
+	state.EnterNode(&d.st, n)
+
+	switch n := n.(type) {
+	case *assign.Assign:
+		v, ok := n.Variable.(*node.SimpleVar)
+		if !ok {
+			break
+		}
+		// Type of the new expression is obvious.
+		if _, ok := n.Expression.(*expr.New); ok {
+			break
+		}
+		d.addTypeHint(v.Position.EndPos, safeExprType(d.scope(), &d.st, n.Expression))
+	case *expr.FunctionCall:
+		if fn, _, ok := getFunction(&d.st, n); ok {
+			d.addParamHints(&fn, n.ArgumentList)
+		}
+	case *expr.MethodCall:
+		id, ok := n.Method.(*node.Identifier)
+		if !ok {
+			break
+		}
+		var fn meta.FuncInfo
+		found := safeExprType(d.scope(), &d.st, n.Variable).Find(func(typ string) bool {
+			fn, _, ok = solver.FindMethod(d.st.MetaInfo(), typ, id.Value)
+			return ok
+		})
+		if found {
+			d.addParamHints(&fn, n.ArgumentList)
+		}
+	case *expr.StaticCall:
+		id, ok := n.Call.(*node.Identifier)
+		if !ok {
+			break
+		}
+		if _, fn, ok := findClassMethod(&d.st, n.Class, id.Value); ok {
+			d.addParamHints(&fn, n.ArgumentList)
+		}
+	case *expr.New:
+		if _, fn, ok := findClassMethod(&d.st, n.Class, "__construct"); ok {
+			d.addParamHints(&fn, n.ArgumentList)
+		}
+	case *stmt.Function:
+		if n.ReturnType != nil || hasReturnTag(n.PhpDocComment) {
+			break
+		}
+		if fn, ok := d.st.MetaInfo().GetFunction(d.st.Namespace + `\` + n.FunctionName.Value); ok {
+			d.addReturnTypeHint(n.FunctionName, n.Params, &fn)
+		}
+	case *stmt.ClassMethod:
+		if n.ReturnType != nil || hasReturnTag(n.PhpDocComment) || n.MethodName.Value == "__construct" {
+			break
+		}
+		class, ok := d.st.MetaInfo().GetClassOrTrait(d.st.CurrentClass)
+		if !ok {
+			break
+		}
+		if fn, ok := class.Methods[n.MethodName.Value]; ok && !fn.IsAbstract() {
+			d.addReturnTypeHint(n.MethodName, n.Params, &fn)
+		}
+	}
+
+	return true
+}
+
+// LeaveNode is invoked after node process
+func (d *inlayHintsWalker) LeaveNode(w walker.Walkable) {
+	n := w.(node.Node)
+
+	if _, ok := d.scopes[n]; ok && len(d.foundScopes) > 0 {
+		d.foundScopes = d.foundScopes[:len(d.foundScopes)-1]
+	}
+
+	state.LeaveNode(&d.st, n)
+}
+
+func (d *inlayHintsWalker) scope() *meta.Scope {
+	if len(d.foundScopes) == 0 {
+		return meta.NewScope()
+	}
+	return d.foundScopes[len(d.foundScopes)-1]
+}
+
+func (d *inlayHintsWalker) add(offset int, hint vscode.InlayHint) {
+	if offset < d.start || offset > d.end {
+		return
+	}
+	hint.Position = offsetToPosition(d.linesPositions, offset)
+	d.result = append(d.result, hint)
+}
+
+func (d *inlayHintsWalker) addTypeHint(offset int, typ meta.TypesMap) {
+	typeString := meta.NewTypesMapFromMap(resolveTypesSafe(d.st.MetaInfo(), d.st.CurrentClass, typ, make(map[string]struct{}))).String()
+	if typeString == "" || typeString == "mixed" {
+		return
+	}
+	d.add(offset, vscode.InlayHint{
+		Label: ": " + typeString,
+		Kind:  vscode.InlayHintKindType,
+	})
+}
+
+func (d *inlayHintsWalker) addParamHints(fn *meta.FuncInfo, args *node.ArgumentList) {
+	if args == nil {
+		return
+	}
+
+	for i, arg := range args.Arguments {
+		a, ok := arg.(*node.Argument)
+		// Unpacked arguments can be passed to several parameters.
+		if !ok || a.Variadic || i >= len(fn.Params) {
+			return
+		}
+
+		p := fn.Params[i]
+		if v, ok := a.Expr.(*node.SimpleVar); ok && v.Name == p.Name {
+			continue
+		}
+
+		label := p.Name + ":"
+		if p.IsVariadic {
+			label = "..." + label
+		}
+		d.add(a.Position.StartPos-1, vscode.InlayHint{
+			Label:        label,
+			Kind:         vscode.InlayHintKindParameter,
+			PaddingRight: true,
+		})
+
+		if p.IsVariadic {
+			return
+		}
+	}
+}
+
+// addReturnTypeHint adds the hint after the closing parenthesis of the function parameters.
+func (d *inlayHintsWalker) addReturnTypeHint(funcName *node.Identifier, params []node.Node, fn *meta.FuncInfo) {
+	from := funcName.Position.EndPos
+	if len(params) != 0 {
+		from = params[len(params)-1].GetPosition().EndPos
+	}
+	if from > len(d.contents) {
+		return
+	}
+	idx := strings.IndexByte(d.contents[from:], ')')
+	if idx < 0 {
+		return
+	}
+	d.addTypeHint(from+idx+1, fn.Typ)
+}
+
+func hasReturnTag(phpDoc string) bool {
+	return strings.Contains(phpDoc, "@return")
+}
@@ -3,15 +3,18 @@ package langsrv
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"regexp"
 	dbg "runtime/debug"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/setpill/noverify/src/lintdebug"
@@ -43,25 +46,42 @@ type response struct {
 
 type methodCall struct {
 	JSONRPC string      `json:"jsonrpc"`
+	ID      *int        `json:"id,omitempty"` // only set for the requests to the client
 	Method  string      `json:"method"`
 	Params  interface{} `json:"params"`
 }
 
-func (response) IMessage()   {}
-func (methodCall) IMessage() {}
+const (
+	// requestCancelled is an error code for the cancelled requests.
+	requestCancelled = -32800
 
-var (
-	respMutex sync.Mutex
-	connWr    io.Writer
+	// requestFailed is an error code for the requests
+	// that are valid, but can't be completed.
+	requestFailed = -32803
 )
 
-// RegisterDebug starts listening for debug events
-func RegisterDebug() {
-	lintdebug.Register(writeLog)
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      *int          `json:"id"`
+	Error   responseError `json:"error"`
+}
+
+func (response) IMessage()      {}
+func (errorResponse) IMessage() {}
+func (methodCall) IMessage()    {}
+
+// RegisterDebug starts sending debug events to the client log.
+func (s *Server) RegisterDebug() {
+	lintdebug.Register(s.writeLog)
 }
 
-func writeLog(msg string) {
-	writeMessage(&methodCall{
+func (s *Server) writeLog(msg string) {
+	s.writeMessage(&methodCall{
 		JSONRPC: "2.0",
 		Method:  "window/logMessage",
 		Params: map[string]interface{}{
@@ -71,11 +91,11 @@ func writeLog(msg string) {
 	})
 }
 
-func writeMessage(message interface{ IMessage() }) error {
-	respMutex.Lock()
-	defer respMutex.Unlock()
+func (s *Server) writeMessage(message interface{ IMessage() }) error {
+	s.respMutex.Lock()
+	defer s.respMutex.Unlock()
 
-	_, err := connWr.Write([]byte("Content-Type: application/vscode-jsonrpc; charset=utf8\r\n"))
+	_, err := s.wr.Write([]byte("Content-Type: application/vscode-jsonrpc; charset=utf8\r\n"))
 	if err != nil {
 		return err
 	}
@@ -85,16 +105,19 @@ func writeMessage(message interface{ IMessage() }) error {
 		return err
 	}
 
-	_, err = fmt.Fprintf(connWr, "Content-Length: %d\r\n\r\n", len(data))
+	_, err = fmt.Fprintf(s.wr, "Content-Length: %d\r\n\r\n", len(data))
 	if err != nil {
 		return err
 	}
 
-	_, err = connWr.Write(data)
+	_, err = s.wr.Write(data)
 	return err
 }
 
-func handleMessage(buf []byte) error {
+// handleMessage handles the documents synchronization, the requests
+// cancellation and the client responses right away, other messages
+// are queued to be handled by handleRequests in the order they arrive.
+func (s *Server) handleMessage(buf []byte) error {
 	defer func() {
 		if r := recover(); r != nil {
 			lintdebug.Send("Panic occurred: %s, trace: %s", r, dbg.Stack())
@@ -108,26 +131,131 @@ func handleMessage(buf []byte) error {
 	}
 
 	switch req.Method {
-	case "initialize":
-		return handleInitialize(&req)
+	case "":
+		if req.ID != nil {
+			return s.handleClientResponse(*req.ID, buf)
+		}
 	case "textDocument/didOpen":
-		return handleTextDocumentDidOpen(&req)
+		return s.handleTextDocumentDidOpen(&req)
 	case "textDocument/didChange":
-		return handleTextDocumentDidChange(&req)
+		return s.handleTextDocumentDidChange(&req)
+	case "textDocument/didClose":
+		return s.handleTextDocumentDidClose(&req)
+	case "$/cancelRequest":
+		return s.handleCancelRequest(&req)
+	}
+
+	if req.ID != nil {
+		s.pendingRequestsMutex.Lock()
+		s.pendingRequests[*req.ID] = false
+		s.pendingRequestsMutex.Unlock()
+	}
+	s.requestsQueue <- &req
+	return nil
+}
+
+func (s *Server) handleRequests() {
+	for req := range s.requestsQueue {
+		if err := s.handleRequest(req); err != nil {
+			log.Fatalf("Could not write message: %s", err.Error())
+		}
+	}
+}
+
+func (s *Server) handleRequest(req *baseRequest) error {
+	defer func() {
+		if r := recover(); r != nil {
+			lintdebug.Send("Panic occurred: %s, trace: %s", r, dbg.Stack())
+		}
+	}()
+
+	if req.ID != nil {
+		s.pendingRequestsMutex.Lock()
+		cancelled := s.pendingRequests[*req.ID]
+		delete(s.pendingRequests, *req.ID)
+		s.pendingRequestsMutex.Unlock()
+
+		if cancelled {
+			return s.writeMessage(&errorResponse{
+				JSONRPC: req.JSONRPC,
+				ID:      req.ID,
+				Error: responseError{
+					Code:    requestCancelled,
+					Message: "request cancelled",
+				},
+			})
+		}
+	}
+
+	// Document requests use the latest document contents.
+	var docParams struct {
+		TextDocument struct {
+			URI string `json:"uri"`
+		} `json:"textDocument"`
+	}
+	if err := json.Unmarshal([]byte(req.Params), &docParams); err == nil && strings.HasPrefix(docParams.TextDocument.URI, "file://") {
+		s.syncDocument(strings.TrimPrefix(docParams.TextDocument.URI, "file://"))
+	}
+
+	switch req.Method {
+	case "initialize":
+		return s.handleInitialize(req)
 	case "textDocument/definition":
-		return handleTextDocumentDefinition(&req)
+		return s.handleTextDocumentDefinition(req)
 	case "textDocument/references":
-		return handleTextDocumentReferences(&req)
-	case "textDocument/didClose":
-		return handleTextDocumentDidClose(&req)
+		return s.handleTextDocumentReferences(req)
 	case "textDocument/completion":
-		return handleTextDocumentCompletion(&req)
+		return s.handleTextDocumentCompletion(req)
 	case "textDocument/hover":
-		return handleTextDocumentHover(&req)
+		return s.handleTextDocumentHover(req)
 	case "textDocument/documentSymbol":
-		return handleTextDocumentSymbol(&req)
+		return s.handleTextDocumentSymbol(req)
+	case "textDocument/signatureHelp":
+		return s.handleTextDocumentSignatureHelp(req)
+	case "textDocument/prepareRename":
+		return s.handleTextDocumentPrepareRename(req)
+	case "textDocument/rename":
+		return s.handleTextDocumentRename(req)
+	case "textDocument/codeAction":
+		return s.handleTextDocumentCodeAction(req)
+	case "textDocument/implementation":
+		return s.handleTextDocumentImplementation(req)
+	case "textDocument/prepareCallHierarchy":
+		return s.handleTextDocumentPrepareCallHierarchy(req)
+	case "callHierarchy/incomingCalls":
+		return s.handleCallHierarchyIncomingCalls(req)
+	case "callHierarchy/outgoingCalls":
+		return s.handleCallHierarchyOutgoingCalls(req)
+	case "textDocument/prepareTypeHierarchy":
+		return s.handleTextDocumentPrepareTypeHierarchy(req)
+	case "typeHierarchy/supertypes":
+		return s.handleTypeHierarchySupertypes(req)
+	case "typeHierarchy/subtypes":
+		return s.handleTypeHierarchySubtypes(req)
+	case "textDocument/inlayHint":
+		return s.handleTextDocumentInlayHint(req)
+	case "textDocument/documentHighlight":
+		return s.handleTextDocumentDocumentHighlight(req)
+	case "textDocument/foldingRange":
+		return s.handleTextDocumentFoldingRange(req)
+	case "textDocument/selectionRange":
+		return s.handleTextDocumentSelectionRange(req)
+	case "textDocument/codeLens":
+		return s.handleTextDocumentCodeLens(req)
+	case "codeLens/resolve":
+		return s.handleCodeLensResolve(req)
+	case "textDocument/semanticTokens/full":
+		return s.handleTextDocumentSemanticTokensFull(req)
+	case "workspace/symbol":
+		return s.handleWorkspaceSymbol(req)
+	case "textDocument/formatting":
+		return s.handleTextDocumentFormatting(req)
+	case "textDocument/rangeFormatting":
+		return s.handleTextDocumentRangeFormatting(req)
 	case "workspace/didChangeWatchedFiles":
-		return handleChangeWatchedFiles(&req)
+		return s.handleChangeWatchedFiles(req)
+	case "workspace/didChangeConfiguration":
+		return s.handleWorkspaceDidChangeConfiguration(req)
 	default:
 		lintdebug.Send("Got %s, data: %s", req.Method, req.Params)
 	}
@@ -136,14 +264,14 @@ func handleMessage(buf []byte) error {
 		return nil
 	}
 
-	return writeMessage(&response{
+	return s.writeMessage(&response{
 		JSONRPC: req.JSONRPC,
 		ID:      req.ID,
 		Result:  map[string]interface{}{},
 	})
 }
 
-func handleInitialize(req *baseRequest) error {
+func (s *Server) handleInitialize(req *baseRequest) error {
 	var params vscode.InitializeParams
 	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
 		return err
@@ -151,57 +279,108 @@ func handleInitialize(req *baseRequest) error {
 
 	lintdebug.Send("Root dir: %s", params.RootPath)
 
-	go func() {
-		linter.AnalysisFiles = []string{params.RootPath}
-
-		linter.ParseFilenames(linter.ReadFilenames(linter.AnalysisFiles, linter.ExcludeRegex))
+	s.workDoneProgress = params.Capabilities.Window.WorkDoneProgress
+	s.completionSnippets = params.Capabilities.TextDocument.Completion.CompletionItem.SnippetSupport
+	s.workspaceDiagnostics = params.InitializationOptions.WorkspaceDiagnostics
 
-		meta.SetIndexingComplete(true)
-
-		// fully analyze all opened files
-		// other files are not analyzed fully at all
-		openMapMutex.Lock()
-		for filename, op := range openMap {
-			go openFile(filename, op.contents)
-		}
-		openMapMutex.Unlock()
-	}()
+	s.changingMutex.Lock()
+	err := s.applySettings(params.InitializationOptions.Settings)
+	s.changingMutex.Unlock()
+	if err != nil {
+		s.showError("Could not apply noverify settings: %s", err.Error())
+	}
 
-	return writeMessage(&response{
+	err = s.writeMessage(&response{
 		JSONRPC: req.JSONRPC,
 		ID:      req.ID,
 		Result: map[string]interface{}{
 			"capabilities": map[string]interface{}{
-				"codeActionProvider":               nil,
-				"codeLensProvider":                 nil,
-				"textDocumentSync":                 1, // FULL
+				"codeActionProvider": map[string]interface{}{
+					"codeActionKinds": []string{vscode.CodeActionQuickFix, vscode.CodeActionRefactor},
+				},
+				"codeLensProvider": map[string]interface{}{
+					"resolveProvider": true,
+				},
+				"textDocumentSync":                 2, // INCREMENTAL
 				"documentSymbolProvider":           true,
 				"workspaceSymbolProvider":          true,
 				"definitionProvider":               true,
 				"dependenciesProvider":             nil,
-				"documentFormattingProvider":       nil,
-				"documentHighlightProvider":        nil,
+				"documentFormattingProvider":       true,
+				"documentHighlightProvider":        true,
+				"foldingRangeProvider":             true,
+				"selectionRangeProvider":           true,
 				"documentOnTypeFormattingProvider": nil,
-				"documentRangeFormattingProvider":  nil,
+				"documentRangeFormattingProvider":  true,
 				"referencesProvider":               true,
+				"implementationProvider":           true,
+				"callHierarchyProvider":            true,
+				"typeHierarchyProvider":            true,
+				"inlayHintProvider":                true,
 				"hoverProvider":                    true,
 				"completionProvider": map[string]interface{}{
 					"resolveProvider":   true,
 					"triggerCharacters": []string{"$", ">", "\\"},
 				},
-				"renameProvider": nil,
+				"renameProvider": map[string]interface{}{
+					"prepareProvider": true,
+				},
 				"signatureHelpProvider": map[string]interface{}{
 					"triggerCharacters": []string{"(", ","},
 				},
+				"semanticTokensProvider": map[string]interface{}{
+					"legend": map[string]interface{}{
+						"tokenTypes":     semanticTokenTypes,
+						"tokenModifiers": semanticTokenModifiers,
+					},
+					"full": true,
+				},
 				"xworkspaceReferencesProvider": true,
 				"xdefinitionProvider":          true,
 				"xdependenciesProvider":        true,
 			},
 		},
 	})
+
+	// The client doesn't expect server requests, like the progress
+	// creation, until the initialize response is sent.
+	go s.indexWorkspace(params.RootPath)
+
+	return err
+}
+
+// indexWorkspace indexes the workspace files and then analyzes
+// the opened ones or all of them if workspace diagnostics are enabled.
+func (s *Server) indexWorkspace(rootPath string) {
+	s.changingMutex.Lock()
+	s.analysisFiles = []string{rootPath}
+	s.workspaceIndexing = true
+	// The linter is not replaced until the indexing is complete.
+	l := s.linter
+	s.changingMutex.Unlock()
+
+	p := s.startProgress("Indexing")
+	l.Index(linter.ReadFilenames([]string{rootPath}, l.Config().ExcludeRegex))
+	p.end("")
+
+	s.changingMutex.Lock()
+	s.workspaceIndexing = false
+	s.workspaceIndexed = true
+	// The settings may be changed during indexing.
+	s.reloadStubs()
+	s.buildSubtypesIndex()
+	s.changingMutex.Unlock()
+
+	// fully analyze all opened files
+	// other files are only analyzed in workspace diagnostics mode
+	s.reanalyzeDocuments()
+
+	if s.workspaceDiagnostics {
+		s.lintWorkspace()
+	}
 }
 
-func handleTextDocumentDidOpen(req *baseRequest) error {
+func (s *Server) handleTextDocumentDidOpen(req *baseRequest) error {
 	var params vscode.TextDocumentDidOpenParams
 	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
 		return err
@@ -211,13 +390,13 @@ func handleTextDocumentDidOpen(req *baseRequest) error {
 	lintdebug.Send("Open text document %s", uri)
 
 	if strings.HasPrefix(uri, "file://") {
-		openFile(strings.TrimPrefix(uri, "file://"), params.TextDocument.Text)
+		s.openDocument(strings.TrimPrefix(uri, "file://"), params.TextDocument.Text, params.TextDocument.Version)
 	}
 
 	return nil
 }
 
-func handleTextDocumentDidClose(req *baseRequest) error {
+func (s *Server) handleTextDocumentDidClose(req *baseRequest) error {
 	var params vscode.TextDocumentDidOpenParams
 	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
 		return err
@@ -227,28 +406,42 @@ func handleTextDocumentDidClose(req *baseRequest) error {
 	lintdebug.Send("Close text document %s", uri)
 
 	if strings.HasPrefix(uri, "file://") {
-		closeFile(strings.TrimPrefix(uri, "file://"))
+		s.closeDocument(strings.TrimPrefix(uri, "file://"))
 	}
 
 	return nil
 }
 
-func handleTextDocumentDidChange(req *baseRequest) error {
+func (s *Server) handleTextDocumentDidChange(req *baseRequest) error {
 	var params vscode.TextDocumentDidChangeParams
 	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
 		return err
 	}
 
-	if len(params.ContentChanges) != 1 {
-		lintdebug.Send("Unexpected number of content changes: %d", len(params.ContentChanges))
-		return nil
-	}
-
 	uri := params.TextDocument.URI
 
 	if strings.HasPrefix(uri, "file://") {
-		changeFile(strings.TrimPrefix(uri, "file://"), params.ContentChanges[0].Text)
+		err := s.changeDocument(strings.TrimPrefix(uri, "file://"), params.TextDocument.Version, params.ContentChanges)
+		if err != nil {
+			lintdebug.Send("Could not apply changes to %s: %s", uri, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) handleCancelRequest(req *baseRequest) error {
+	var params vscode.CancelParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	// Only queued requests can be cancelled.
+	s.pendingRequestsMutex.Lock()
+	if _, ok := s.pendingRequests[params.ID]; ok {
+		s.pendingRequests[params.ID] = true
 	}
+	s.pendingRequestsMutex.Unlock()
 
 	return nil
 }
@@ -260,7 +453,7 @@ func baseSymbolName(s string) string {
 	return s
 }
 
-func handleTextDocumentSymbol(req *baseRequest) error {
+func (s *Server) handleTextDocumentSymbol(req *baseRequest) error {
 	var params vscode.TextDocumentDidOpenParams
 	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
 		return err
@@ -268,14 +461,14 @@ func handleTextDocumentSymbol(req *baseRequest) error {
 
 	// TODO: make it actually safe
 
-	meta.OnIndexingComplete(func() {
+	s.metaInfo().OnIndexingComplete(func() {
 		uri := params.TextDocument.URI
 
 		var result []vscode.SymbolInformation
 
 		if strings.HasPrefix(uri, "file://") {
 			filename := strings.TrimPrefix(uri, "file://")
-			res := meta.Info.GetMetaForFile(filename)
+			res := s.metaInfo().GetMetaForFile(filename)
 
 			for className, classInfo := range res.Classes {
 				result = append(result, vscode.SymbolInformation{
@@ -326,7 +519,7 @@ func handleTextDocumentSymbol(req *baseRequest) error {
 			}
 		}
 
-		writeMessage(&response{
+		s.writeMessage(&response{
 			JSONRPC: req.JSONRPC,
 			ID:      req.ID,
 			Result:  result,
@@ -347,9 +540,9 @@ func posToLocation(pos meta.ElementPosition) vscode.Location {
 	}
 }
 
-func handleTextDocumentDefinition(req *baseRequest) error {
-	changingMutex.Lock()
-	defer changingMutex.Unlock()
+func (s *Server) handleTextDocumentDefinition(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
 
 	var params vscode.DefinitionParams
 	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
@@ -357,9 +550,9 @@ func handleTextDocumentDefinition(req *baseRequest) error {
 	}
 
 	filename := strings.TrimPrefix(params.TextDocument.URI, "file://")
-	openMapMutex.Lock()
-	f, ok := openMap[filename]
-	openMapMutex.Unlock()
+	s.openMapMutex.Lock()
+	f, ok := s.openMap[filename]
+	s.openMapMutex.Unlock()
 
 	if !ok {
 		lintdebug.Send("File is not opened, but definition requested: %s", filename)
@@ -370,8 +563,14 @@ func handleTextDocumentDefinition(req *baseRequest) error {
 
 	if params.Position.Line < len(f.linesPositions) {
 		w := &definitionWalker{
-			position: f.linesPositions[params.Position.Line] + params.Position.Character,
-			scopes:   f.scopes,
+			st:             meta.ClassParseState{Info: s.metaInfo()},
+			filename:       filename,
+			linesPositions: f.linesPositions,
+			position:       f.linesPositions[params.Position.Line] + params.Position.Character,
+			roots:          s.analysisFiles,
+			scopes:         f.scopes,
+			varDefs:        f.varDefs,
+			root:           f.rootNode,
 		}
 		f.rootNode.Walk(w)
 		if len(w.result) > 0 {
@@ -379,16 +578,16 @@ func handleTextDocumentDefinition(req *baseRequest) error {
 		}
 	}
 
-	return writeMessage(&response{
+	return s.writeMessage(&response{
 		JSONRPC: req.JSONRPC,
 		ID:      req.ID,
 		Result:  result,
 	})
 }
 
-func handleTextDocumentReferences(req *baseRequest) error {
-	changingMutex.Lock()
-	defer changingMutex.Unlock()
+func (s *Server) handleTextDocumentReferences(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
 
 	var params vscode.ReferencesParams
 	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
@@ -396,9 +595,9 @@ func handleTextDocumentReferences(req *baseRequest) error {
 	}
 
 	filename := strings.TrimPrefix(params.TextDocument.URI, "file://")
-	openMapMutex.Lock()
-	f, ok := openMap[filename]
-	openMapMutex.Unlock()
+	s.openMapMutex.Lock()
+	f, ok := s.openMap[filename]
+	s.openMapMutex.Unlock()
 
 	if !ok {
 		lintdebug.Send("File is not opened, but references requested: %s", filename)
@@ -409,6 +608,8 @@ func handleTextDocumentReferences(req *baseRequest) error {
 
 	if params.Position.Line < len(f.linesPositions) {
 		w := &referencesWalker{
+			st:       meta.ClassParseState{Info: s.metaInfo()},
+			server:   s,
 			position: f.linesPositions[params.Position.Line] + params.Position.Character,
 		}
 		f.rootNode.Walk(w)
@@ -417,14 +618,14 @@ func handleTextDocumentReferences(req *baseRequest) error {
 		}
 	}
 
-	return writeMessage(&response{
+	return s.writeMessage(&response{
 		JSONRPC: req.JSONRPC,
 		ID:      req.ID,
 		Result:  result,
 	})
 }
 
-func resolveTypesSafe(curStaticClass string, m meta.TypesMap, visitedMap map[string]struct{}) (res map[string]struct{}) {
+func resolveTypesSafe(info *meta.Index, curStaticClass string, m meta.TypesMap, visitedMap map[string]struct{}) (res map[string]struct{}) {
 	defer func() {
 		if r := recover(); r != nil {
 			res = make(map[string]struct{})
@@ -433,18 +634,18 @@ func resolveTypesSafe(curStaticClass string, m meta.TypesMap, visitedMap map[str
 		}
 	}()
 
-	res = solver.ResolveTypes(curStaticClass, m, visitedMap)
+	res = solver.ResolveTypes(info, curStaticClass, m, visitedMap)
 	return
 }
 
-func handleTextDocumentHover(req *baseRequest) error {
-	changingMutex.Lock()
-	defer changingMutex.Unlock()
+func (s *Server) handleTextDocumentHover(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
 
 	var contents string
 
 	defer func() {
-		writeMessage(&response{
+		s.writeMessage(&response{
 			JSONRPC: req.JSONRPC,
 			ID:      req.ID,
 			Result: map[string]interface{}{
@@ -459,9 +660,9 @@ func handleTextDocumentHover(req *baseRequest) error {
 	}
 
 	filename := strings.TrimPrefix(params.TextDocument.URI, "file://")
-	openMapMutex.Lock()
-	f, ok := openMap[filename]
-	openMapMutex.Unlock()
+	s.openMapMutex.Lock()
+	f, ok := s.openMap[filename]
+	s.openMapMutex.Unlock()
 
 	if !ok {
 		return nil
@@ -483,6 +684,7 @@ func handleTextDocumentHover(req *baseRequest) error {
 	}
 
 	compl := &completionWalker{
+		st:       meta.ClassParseState{Info: s.metaInfo()},
 		position: f.linesPositions[params.Position.Line] + params.Position.Character,
 		scopes:   f.scopes,
 	}
@@ -494,6 +696,7 @@ func handleTextDocumentHover(req *baseRequest) error {
 	}
 
 	hover := &hoverWalker{
+		st:       meta.ClassParseState{Info: s.metaInfo()},
 		position: compl.position,
 	}
 
@@ -503,21 +706,21 @@ func handleTextDocumentHover(req *baseRequest) error {
 		return nil
 	}
 
-	contents = getHoverForNode(hover.n, compl.foundScope, &hover.st)
+	contents = s.getHoverForNode(hover.n, compl.foundScope, &hover.st)
 
 	return nil
 }
 
-func getHoverForNode(n node.Node, sc *meta.Scope, cs *meta.ClassParseState) string {
+func (s *Server) getHoverForNode(n node.Node, sc *meta.Scope, cs *meta.ClassParseState) string {
 	switch n := n.(type) {
 	case *node.SimpleVar:
 		return getHoverForVariable(n, sc, cs)
 	case *expr.FunctionCall:
-		return getHoverForFunctionCall(n, sc, cs)
+		return s.getHoverForFunctionCall(n, sc, cs)
 	case *expr.MethodCall:
-		return getHoverForMethodCall(n, sc, cs)
+		return s.getHoverForMethodCall(n, sc, cs)
 	case *expr.StaticCall:
-		return getHoverForStaticCall(n, sc, cs)
+		return s.getHoverForStaticCall(n, sc, cs)
 	}
 
 	return ""
@@ -525,31 +728,35 @@ func getHoverForNode(n node.Node, sc *meta.Scope, cs *meta.ClassParseState) stri
 
 func getHoverForVariable(v *node.SimpleVar, sc *meta.Scope, cs *meta.ClassParseState) string {
 	typ, _ := sc.GetVarNameType(v.Name)
-	newM := meta.NewTypesMapFromMap(resolveTypesSafe(cs.CurrentClass, typ, make(map[string]struct{})))
+	newM := meta.NewTypesMapFromMap(resolveTypesSafe(cs.MetaInfo(), cs.CurrentClass, typ, make(map[string]struct{})))
 	return newM.String() + " $" + v.Name
 }
 
-func getHoverForFunctionCall(n *expr.FunctionCall, sc *meta.Scope, cs *meta.ClassParseState) string {
+func (s *Server) getHoverForFunctionCall(n *expr.FunctionCall, sc *meta.Scope, cs *meta.ClassParseState) string {
 	var fun meta.FuncInfo
 	var ok bool
-	var nameStr string
+	var fqName string
 
 	switch nm := n.Function.(type) {
 	case *name.Name:
-		nameStr = meta.NameToString(nm)
-		fun, ok = meta.Info.GetFunction(cs.Namespace + `\` + nameStr)
+		fqName = cs.Namespace + `\` + meta.NameToString(nm)
+		fun, ok = cs.MetaInfo().GetFunction(fqName)
 		if !ok && cs.Namespace != "" {
-			fun, ok = meta.Info.GetFunction(`\` + nameStr)
+			fqName = `\` + meta.NameToString(nm)
+			fun, ok = cs.MetaInfo().GetFunction(fqName)
 		}
 	case *name.FullyQualified:
-		nameStr = meta.FullyQualifiedToString(nm)
-		fun, ok = meta.Info.GetFunction(nameStr)
+		fqName = meta.FullyQualifiedToString(nm)
+		fun, ok = cs.MetaInfo().GetFunction(fqName)
+	}
+	if !ok {
+		return ""
 	}
 
-	return linter.FlagsToString(fun.ExitFlags)
+	return s.getHoverForFunc(fqName, cs.CurrentClass, &fun)
 }
 
-func getHoverForMethodCall(n *expr.MethodCall, sc *meta.Scope, cs *meta.ClassParseState) string {
+func (s *Server) getHoverForMethodCall(n *expr.MethodCall, sc *meta.Scope, cs *meta.ClassParseState) string {
 	id, ok := n.Method.(*node.Identifier)
 	if !ok {
 		return ""
@@ -558,15 +765,19 @@ func getHoverForMethodCall(n *expr.MethodCall, sc *meta.Scope, cs *meta.ClassPar
 	types := safeExprType(sc, cs, n.Variable)
 
 	var fun meta.FuncInfo
-	types.Find(func(t string) bool {
-		fun, _, ok = solver.FindMethod(t, id.Value)
+	var implClassName string
+	found := types.Find(func(t string) bool {
+		fun, implClassName, ok = solver.FindMethod(cs.MetaInfo(), t, id.Value)
 		return ok
 	})
+	if !found {
+		return ""
+	}
 
-	return linter.FlagsToString(fun.ExitFlags)
+	return s.getHoverForFunc(implClassName+"->"+id.Value, implClassName, &fun)
 }
 
-func getHoverForStaticCall(n *expr.StaticCall, sc *meta.Scope, cs *meta.ClassParseState) string {
+func (s *Server) getHoverForStaticCall(n *expr.StaticCall, sc *meta.Scope, cs *meta.ClassParseState) string {
 	id, ok := n.Call.(*node.Identifier)
 	if !ok {
 		return ""
@@ -577,17 +788,26 @@ func getHoverForStaticCall(n *expr.StaticCall, sc *meta.Scope, cs *meta.ClassPar
 		return ""
 	}
 
-	fun, _, ok := solver.FindMethod(className, id.Value)
+	fun, implClassName, ok := solver.FindMethod(cs.MetaInfo(), className, id.Value)
 	if !ok {
 		return ""
 	}
 
-	return linter.FlagsToString(fun.ExitFlags)
+	return s.getHoverForFunc(implClassName+"::"+id.Value, className, &fun)
+}
+
+// getHoverForFunc returns the function signature followed by the deprecation note, if any.
+func (s *Server) getHoverForFunc(label, className string, fn *meta.FuncInfo) string {
+	contents := s.funcSignature(label, className, fn).Label
+	if fn.Doc.Deprecated {
+		contents += "\n\n@deprecated " + fn.Doc.DeprecationNote
+	}
+	return contents
 }
 
-func handleTextDocumentCompletion(req *baseRequest) error {
-	changingMutex.Lock()
-	defer changingMutex.Unlock()
+func (s *Server) handleTextDocumentCompletion(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
 
 	start := time.Now()
 	defer func() { lintdebug.Send("Completion took %s", time.Since(start)) }()
@@ -598,9 +818,9 @@ func handleTextDocumentCompletion(req *baseRequest) error {
 	}
 
 	filename := strings.TrimPrefix(params.TextDocument.URI, "file://")
-	openMapMutex.Lock()
-	f, ok := openMap[filename]
-	openMapMutex.Unlock()
+	s.openMapMutex.Lock()
+	f, ok := s.openMap[filename]
+	s.openMapMutex.Unlock()
 
 	if !ok {
 		lintdebug.Send("File is not opened, but completion requested: %s", filename)
@@ -628,6 +848,7 @@ func handleTextDocumentCompletion(req *baseRequest) error {
 	position = f.linesPositions[params.Position.Line] + params.Position.Character
 
 	compl := &completionWalker{
+		st:       meta.ClassParseState{Info: s.metaInfo()},
 		position: position,
 		scopes:   f.scopes,
 	}
@@ -652,13 +873,37 @@ func handleTextDocumentCompletion(req *baseRequest) error {
 
 	lintdebug.Send("Ch str: %s, have scope: %v", chStr, compl.foundScope != nil)
 
+	wordStart := chPos + 1 - len(chStr)
+	before := string(ln[:wordStart])
+	classes := &classCompletion{
+		st:     &compl.st,
+		prefix: chStr,
+		wordRange: vscode.Range{
+			Start: vscode.Position{Line: lnPos, Character: wordStart},
+			End:   vscode.Position{Line: lnPos, Character: chPos + 1},
+		},
+		imports: &codeActionWalker{st: meta.ClassParseState{Info: s.metaInfo()}, position: position, line: lnPos + 1},
+	}
+	f.rootNode.Walk(classes.imports)
+
 	var result []vscode.CompletionItem
 
-	if compl.foundScope != nil && strings.HasPrefix(chStr, "$") {
+	if inDocComment(f.contents, position) {
+		result = docCommentCompletionItems(string(ln[:chPos+1]), lnPos, classes)
+	} else if kinds, ok := classCompletionKinds(before, &compl.st); ok {
+		// The use statements contain fully qualified names.
+		if useRegex.MatchString(before) && compl.st.CurrentClass == "" {
+			classes.imports = nil
+		}
+		if paramTypeRegex.MatchString(before) || returnTypeRegex.MatchString(before) {
+			result = keywordCompletionItems(typeHintCompletions, chStr)
+		}
+		result = append(result, classes.items(kinds)...)
+	} else if compl.foundScope != nil && strings.HasPrefix(chStr, "$") {
 		lintdebug.Send("Var str: %s", chStr)
 
 		if strings.HasSuffix(chStr, "->") {
-			result = append(result, getMethodCompletionItems(&compl.st, chStr, compl.foundScope)...)
+			result = append(result, s.getMethodCompletionItems(&compl.st, chStr, compl.foundScope)...)
 		} else {
 			compl.foundScope.Iterate(func(varName string, typ meta.TypesMap, alwaysDefined bool) {
 				result = append(result, vscode.CompletionItem{
@@ -677,9 +922,9 @@ func handleTextDocumentCompletion(req *baseRequest) error {
 
 		wg.Add(1)
 		go func() {
-			funcStr := `\` + chStr
+			funcStr := `\` + strings.TrimPrefix(chStr, `\`)
 
-			funcs = meta.Info.FindFunctions(funcStr)
+			funcs = s.metaInfo().FindFunctions(funcStr)
 			sort.Strings(funcs)
 
 			wg.Done()
@@ -690,7 +935,7 @@ func handleTextDocumentCompletion(req *baseRequest) error {
 			go func() {
 				funcStr := compl.st.Namespace + `\` + chStr
 
-				funcsNs = meta.Info.FindFunctions(funcStr)
+				funcsNs = s.metaInfo().FindFunctions(funcStr)
 				sort.Strings(funcsNs)
 
 				wg.Done()
@@ -699,9 +944,9 @@ func handleTextDocumentCompletion(req *baseRequest) error {
 
 		wg.Add(1)
 		go func() {
-			constStr := `\` + chStr
+			constStr := `\` + strings.TrimPrefix(chStr, `\`)
 
-			constants = meta.Info.FindConstants(constStr)
+			constants = s.metaInfo().FindConstants(constStr)
 			sort.Strings(constants)
 
 			wg.Done()
@@ -712,7 +957,7 @@ func handleTextDocumentCompletion(req *baseRequest) error {
 			go func() {
 				constStr := compl.st.Namespace + `\` + chStr
 
-				constantsNs = meta.Info.FindConstants(constStr)
+				constantsNs = s.metaInfo().FindConstants(constStr)
 				sort.Strings(constantsNs)
 
 				wg.Done()
@@ -722,19 +967,13 @@ func handleTextDocumentCompletion(req *baseRequest) error {
 		wg.Wait()
 
 		for _, f := range funcsNs {
-			result = append(result, vscode.CompletionItem{
-				Kind:       vscode.CompletionKindFunction,
-				Label:      f,
-				InsertText: strings.TrimPrefix(f, `\`),
-			})
+			fn, _ := s.metaInfo().GetFunction(f)
+			result = append(result, s.funcCompletionItem(vscode.CompletionKindFunction, f, strings.TrimPrefix(f, `\`), &fn))
 		}
 
 		for _, f := range funcs {
-			result = append(result, vscode.CompletionItem{
-				Kind:       vscode.CompletionKindFunction,
-				Label:      f,
-				InsertText: strings.TrimPrefix(f, `\`),
-			})
+			fn, _ := s.metaInfo().GetFunction(f)
+			result = append(result, s.funcCompletionItem(vscode.CompletionKindFunction, f, strings.TrimPrefix(f, `\`), &fn))
 		}
 
 		for _, f := range constantsNs {
@@ -752,9 +991,13 @@ func handleTextDocumentCompletion(req *baseRequest) error {
 				InsertText: strings.TrimPrefix(f, `\`),
 			})
 		}
+
+		if identRegex.MatchString(chStr) {
+			result = append(result, keywordCompletionItems(phpKeywords, chStr)...)
+		}
 	}
 
-	return writeMessage(&response{
+	return s.writeMessage(&response{
 		JSONRPC: req.JSONRPC,
 		ID:      req.ID,
 		Result: map[string]interface{}{
@@ -764,9 +1007,9 @@ func handleTextDocumentCompletion(req *baseRequest) error {
 	})
 }
 
-func getMethods(className string) (res []string) {
+func (s *Server) getMethods(className string) (res []string) {
 	for {
-		class, ok := meta.Info.GetClass(className)
+		class, ok := s.metaInfo().GetClass(className)
 		if !ok {
 			return res
 		}
@@ -782,9 +1025,9 @@ func getMethods(className string) (res []string) {
 	}
 }
 
-func getInstanceProperties(className string) (res []string) {
+func (s *Server) getInstanceProperties(className string) (res []string) {
 	for {
-		class, ok := meta.Info.GetClass(className)
+		class, ok := s.metaInfo().GetClass(className)
 		if !ok {
 			return res
 		}
@@ -802,7 +1045,7 @@ func getInstanceProperties(className string) (res []string) {
 	}
 }
 
-func getMethodCompletionItems(st *meta.ClassParseState, str string, sc *meta.Scope) (result []vscode.CompletionItem) {
+func (s *Server) getMethodCompletionItems(st *meta.ClassParseState, str string, sc *meta.Scope) (result []vscode.CompletionItem) {
 	strTemp := "<?php " + strings.TrimSuffix(str, "->") + ";"
 	parser := php7.NewParser(strings.NewReader(strTemp), "temp")
 	parser.Parse()
@@ -818,26 +1061,26 @@ func getMethodCompletionItems(st *meta.ClassParseState, str string, sc *meta.Sco
 		return nil
 	}
 
-	s, ok := stmtLst[0].(*stmt.Expression)
+	exprStmt, ok := stmtLst[0].(*stmt.Expression)
 	if !ok {
 		return nil
 	}
 
 	var methodList []string
 	var propList []string
-	methodDedup := map[string]struct{}{}
+	methodDedup := map[string]meta.FuncInfo{}
 	propDedup := map[string]struct{}{}
 
-	safeExprType(sc, st, s.Expr).Iterate(func(t string) {
-		for _, m := range getMethods(t) {
+	safeExprType(sc, st, exprStmt.Expr).Iterate(func(t string) {
+		for _, m := range s.getMethods(t) {
 			if _, ok := methodDedup[m]; ok {
 				continue
 			}
 			methodList = append(methodList, m)
-			methodDedup[m] = struct{}{}
+			methodDedup[m], _, _ = solver.FindMethod(s.metaInfo(), t, m)
 		}
 
-		for _, m := range getInstanceProperties(t) {
+		for _, m := range s.getInstanceProperties(t) {
 			if _, ok := propDedup[m]; ok {
 				continue
 			}
@@ -857,62 +1100,230 @@ func getMethodCompletionItems(st *meta.ClassParseState, str string, sc *meta.Sco
 	}
 
 	for _, m := range methodList {
-		result = append(result, vscode.CompletionItem{
-			Kind:  vscode.CompletionKindMethod,
-			Label: m,
-		})
+		fn := methodDedup[m]
+		result = append(result, s.funcCompletionItem(vscode.CompletionKindMethod, m, m, &fn))
 	}
 
 	return result
 }
 
-func handleChangeWatchedFiles(req *baseRequest) error {
+func (s *Server) handleChangeWatchedFiles(req *baseRequest) error {
 	var params vscode.DidChangeWatchedFilesParams
 	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
 		return err
 	}
 
-	externalChanges(params.Changes)
+	s.externalChanges(params.Changes)
 
 	return nil
 }
 
+// Server is the language server that talks JSON-RPC over the reader and the writer.
+//
+// The server state, like the opened documents and the client settings, is kept
+// in the server, the workspace is analyzed by the server linter.
+type Server struct {
+	// RuleFiles are the dynamic rules files from the command line.
+	// They are used unless the client settings specify other rules files.
+	RuleFiles []string
+
+	rd *bufio.Reader
+
+	respMutex sync.Mutex
+	wr        io.Writer
+
+	// served is set once Serve is called, the server can't be served twice.
+	served int32
+	// done is closed once Serve returns, it stops the background goroutines.
+	done chan struct{}
+
+	// requestsQueue contains the messages that are handled by handleRequests.
+	requestsQueue chan *baseRequest
+
+	// pendingRequests maps queued requests ids to their cancellation flag.
+	pendingRequestsMutex sync.Mutex
+	pendingRequests      map[int]bool
+
+	// Client capabilities.
+	// workDoneProgress is true if the client supports server initiated progress.
+	// completionSnippets is true if the client supports snippets in completion items.
+	// workspaceDiagnostics is true if diagnostics are published for all
+	// workspace files, not only for the opened ones.
+	workDoneProgress     bool
+	completionSnippets   bool
+	workspaceDiagnostics bool
+
+	clientCallsMutex sync.Mutex
+	lastClientCallID int
+	// clientCalls maps the ids of requests sent to the client to the response channels.
+	clientCalls map[int]chan error
+
+	progressMutex  sync.Mutex
+	lastProgressID int
+
+	// documents are the documents opened in the editor.
+	documentsMutex sync.Mutex
+	documents      map[string]*document
+
+	// openMap contains the analysis results of the opened documents.
+	openMapMutex sync.Mutex
+	openMap      map[string]openedFile
+
+	// changingMutex serializes the index changes and the analysis.
+	changingMutex sync.Mutex
+
+	// Command line values of the settings that can be changed by the client.
+	defaultStubsDir     string
+	defaultExcludeRegex *regexp.Regexp
+	defaultIsDiscardVar func(string) bool
+
+	// The checks settings, changingMutex must be held.
+	enabledChecks  map[string]bool
+	disabledChecks map[string]bool
+	checkSeverity  map[string]int
+
+	// ruleChecks contains names of the unnamed rules, they are always enabled.
+	// changingMutex must be held.
+	ruleChecks map[string]bool
+
+	// loadedStubsDir is the directory of the currently loaded stubs.
+	// changingMutex must be held.
+	loadedStubsDir string
+
+	// linter analyzes the workspace files, it's replaced once the stubs are changed.
+	// changingMutex must be held to access it.
+	linter *linter.Linter
+
+	// analysisFiles are the workspace directories.
+	// changingMutex must be held to access it.
+	analysisFiles []string
+
+	// workspaceIndexing is true while the workspace is indexed for the first time,
+	// workspaceIndexed is true after that. changingMutex must be held.
+	workspaceIndexing bool
+	workspaceIndexed  bool
+
+	ruleFilesMutex sync.Mutex
+	// ruleFiles are the loaded rule files.
+	ruleFiles []string
+	// ruleFilesModTime maps the loaded rule files to their modification times.
+	ruleFilesModTime map[string]time.Time
+
+	// subtypesIndex maps class and interface names to their direct subtypes:
+	// classes that extend or implement them and interfaces that extend them.
+	//
+	// It's built once the indexing is complete and then updated on file changes,
+	// so subtypes lookups don't need to iterate over all classes.
+	// changingMutex must be held to access it.
+	subtypesIndex map[string]map[string]struct{}
+
+	depsMutex sync.Mutex
+	// fileClassDeps maps filenames to the lowercase names of classes they depend on.
+	fileClassDeps map[string]map[string]struct{}
+	// classDependents maps lowercase class names to the filenames that depend on them.
+	classDependents map[string]map[string]struct{}
+
+	pendingMutex sync.Mutex
+	// pendingFiles contains the files that are scheduled to be linted.
+	pendingFiles map[string]struct{}
+	pendingTimer *time.Timer
+
+	// lintFilesMutex makes sure the scheduled files are linted by one goroutine at a time.
+	lintFilesMutex sync.Mutex
+}
+
+// NewServer returns the server that reads requests from r and writes responses to w.
+func NewServer(r io.Reader, w io.Writer) *Server {
+	return &Server{
+		rd:               bufio.NewReader(r),
+		wr:               w,
+		done:             make(chan struct{}),
+		requestsQueue:    make(chan *baseRequest, 64),
+		pendingRequests:  make(map[int]bool),
+		clientCalls:      make(map[int]chan error),
+		documents:        make(map[string]*document),
+		openMap:          make(map[string]openedFile),
+		ruleFilesModTime: make(map[string]time.Time),
+		fileClassDeps:    make(map[string]map[string]struct{}),
+		classDependents:  make(map[string]map[string]struct{}),
+		pendingFiles:     make(map[string]struct{}),
+	}
+}
+
 // Start starts Microsoft LSP server with stdin/stdout I/O.
-func Start() {
-	rd := bufio.NewReader(os.Stdin)
-	connWr = os.Stdout
+// Debug messages are sent to the client log.
+func Start(ruleFiles []string) {
+	s := NewServer(os.Stdin, os.Stdout)
+	s.RuleFiles = ruleFiles
+	s.RegisterDebug()
+	if err := s.Serve(); err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+}
+
+// Serve loads the stubs and the rules and then handles the messages
+// until the reader is closed. It returns nil once there are no more messages.
+// A server can be served only once.
+func (s *Server) Serve() error {
+	if !atomic.CompareAndSwapInt32(&s.served, 0, 1) {
+		return errors.New("the server is already served")
+	}
+	defer close(s.done)
+
+	s.initSettings()
 
-	linter.InitStubs()
+	go s.handleRequests()
+	defer close(s.requestsQueue)
 
 	for {
-		ln, err := rd.ReadString('\n')
+		buf, err := s.readMessage()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
-			log.Fatalf("Could not read: %s", err.Error())
+			return err
 		}
 
-		if !strings.HasPrefix(ln, "Content-Length: ") {
-			log.Fatalf("Wrong line: expected 'Content-Length:', got '%s'", ln)
+		if err := s.handleMessage(buf); err != nil {
+			return fmt.Errorf("Could not write message: %s", err.Error())
 		}
+	}
+}
 
-		length, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(ln, "Content-Length: ")))
-		if err != nil {
-			log.Fatalf("Could not parse content length: %s", err.Error())
-		}
+// readMessage reads the next message contents, the Content-Length header must go first.
+func (s *Server) readMessage() ([]byte, error) {
+	ln, err := s.rd.ReadString('\n')
+	if err == io.EOF && ln == "" {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not read: %s", err.Error())
+	}
 
-		// should be empty line
-		rd.ReadString('\n')
+	if !strings.HasPrefix(ln, "Content-Length: ") {
+		return nil, fmt.Errorf("Wrong line: expected 'Content-Length:', got '%s'", ln)
+	}
 
-		if length > maxLength {
-			log.Fatalf("Length too high: %d, max: %d", length, maxLength)
-		}
+	length, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(ln, "Content-Length: ")))
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse content length: %s", err.Error())
+	}
 
-		buf := make([]byte, length)
-		if _, err = io.ReadFull(rd, buf); err != nil {
-			log.Fatalf("Could not read message: %s", err.Error())
-		}
+	// should be empty line
+	s.rd.ReadString('\n')
 
-		if err := handleMessage(buf); err != nil {
-			log.Fatalf("Could not write message: %s", err.Error())
-		}
+	if length > maxLength {
+		return nil, fmt.Errorf("Length too high: %d, max: %d", length, maxLength)
 	}
+
+	buf := make([]byte, length)
+	if _, err = io.ReadFull(s.rd, buf); err != nil {
+		return nil, fmt.Errorf("Could not read message: %s", err.Error())
+	}
+	return buf, nil
+}
+
+// metaInfo returns the index of the current linter.
+func (s *Server) metaInfo() *meta.Index {
+	return s.linter.MetaInfo()
 }
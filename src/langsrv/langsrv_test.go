@@ -0,0 +1,440 @@
+package langsrv
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/setpill/noverify/src/linter"
+)
+
+// responseTimeout is how long the test client waits for responses and diagnostics.
+const responseTimeout = 10 * time.Second
+
+// scriptStep is a single step of the test script.
+// Exactly one of Open, Close, Request, Notify and Diagnostics must be set.
+//
+// Strings in the script may contain ${root}, it's replaced
+// with the workspace directory absolute path.
+type scriptStep struct {
+	// Open opens the workspace file, the path is relative to the workspace.
+	Open string `json:"open"`
+
+	// Close closes the opened workspace file.
+	Close string `json:"close"`
+
+	// Request is a method to call with Params, the response must match Result.
+	// Objects in Result match if they have the same values for the listed keys.
+	// Arrays must have the same length, unless Contains is set, then every
+	// expected element must match some of the returned ones.
+	Request  string          `json:"request"`
+	Params   json.RawMessage `json:"params"`
+	Result   json.RawMessage `json:"result"`
+	Contains bool            `json:"contains"`
+
+	// Notify is a notification to send with Params, like workspace/didChangeConfiguration.
+	Notify string `json:"notify"`
+
+	// Diagnostics is the workspace file whose last published diagnostics must match Expect.
+	// Diagnostics are published asynchronously, so they are awaited.
+	Diagnostics string          `json:"diagnostics"`
+	Expect      json.RawMessage `json:"expect"`
+}
+
+// testClient is the language server client that runs scripts against the in-process server.
+type testClient struct {
+	root string
+	wr   io.Writer
+
+	mu          sync.Mutex
+	lastID      int
+	responses   map[int]chan json.RawMessage
+	diagnostics map[string]json.RawMessage
+	opened      map[string]bool
+}
+
+var (
+	testClientOnce sync.Once
+	testClientInst *testClient
+	testClientErr  error
+)
+
+// getTestClient starts the server that indexes testdata/workspace.
+// Workspace diagnostics are enabled, so diagnostics are published for all workspace files.
+// Indexing takes a while, so the server is shared by all tests.
+func getTestClient(t *testing.T) *testClient {
+	testClientOnce.Do(func() {
+		testClientInst, testClientErr = startTestClient()
+	})
+	if testClientErr != nil {
+		t.Fatalf("could not start server: %v", testClientErr)
+	}
+	return testClientInst
+}
+
+func startTestClient() (*testClient, error) {
+	root, err := filepath.Abs(filepath.Join("testdata", "workspace"))
+	if err != nil {
+		return nil, err
+	}
+
+	linter.LangServer = true
+	linter.PHPExtensions = []string{"php"}
+	linter.MaxFileSize = 20 * 1024 * 1024
+	linter.StubsDir = filepath.Join("testdata", "stubs")
+	go linter.MemoryLimiterThread()
+
+	serverRd, clientWr := io.Pipe()
+	clientRd, serverWr := io.Pipe()
+
+	c := &testClient{
+		root:        root,
+		wr:          clientWr,
+		responses:   make(map[int]chan json.RawMessage),
+		diagnostics: make(map[string]json.RawMessage),
+		opened:      make(map[string]bool),
+	}
+	go c.readMessages(bufio.NewReader(clientRd))
+
+	srv := NewServer(serverRd, serverWr)
+	go func() {
+		if err := srv.Serve(); err != nil {
+			panic(err)
+		}
+	}()
+
+	params := map[string]interface{}{
+		"rootPath":              root,
+		"capabilities":          map[string]interface{}{},
+		"initializationOptions": map[string]interface{}{"workspaceDiagnostics": true},
+	}
+	if _, err := c.call("initialize", params); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(responseTimeout)
+	for {
+		srv.changingMutex.Lock()
+		indexed := srv.workspaceIndexed
+		srv.changingMutex.Unlock()
+		if indexed {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("workspace is not indexed in %s", responseTimeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	return c, nil
+}
+
+// readMessages reads the server messages. Responses are sent to the waiting calls,
+// the last published diagnostics are remembered and server requests are answered with null.
+func (c *testClient) readMessages(rd *bufio.Reader) {
+	for {
+		length := 0
+		for {
+			ln, err := rd.ReadString('\n')
+			if err != nil {
+				return
+			}
+			ln = strings.TrimSpace(ln)
+			if ln == "" {
+				break
+			}
+			if strings.HasPrefix(ln, "Content-Length: ") {
+				length, _ = strconv.Atoi(strings.TrimPrefix(ln, "Content-Length: "))
+			}
+		}
+
+		buf := make([]byte, length)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return
+		}
+
+		var msg struct {
+			ID     *int            `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  json.RawMessage `json:"error"`
+		}
+		if err := json.Unmarshal(buf, &msg); err != nil {
+			continue
+		}
+
+		switch {
+		case msg.Method == "textDocument/publishDiagnostics":
+			var params struct {
+				URI         string          `json:"uri"`
+				Diagnostics json.RawMessage `json:"diagnostics"`
+			}
+			if err := json.Unmarshal(msg.Params, &params); err == nil {
+				c.mu.Lock()
+				c.diagnostics[params.URI] = params.Diagnostics
+				c.mu.Unlock()
+			}
+		case msg.Method != "" && msg.ID != nil:
+			c.write(map[string]interface{}{"jsonrpc": "2.0", "id": *msg.ID, "result": nil})
+		case msg.Method == "" && msg.ID != nil:
+			c.mu.Lock()
+			ch := c.responses[*msg.ID]
+			delete(c.responses, *msg.ID)
+			c.mu.Unlock()
+			if ch == nil {
+				continue
+			}
+			if msg.Error != nil {
+				ch <- msg.Error
+			} else {
+				ch <- msg.Result
+			}
+		}
+	}
+}
+
+func (c *testClient) write(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = fmt.Fprintf(c.wr, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return err
+}
+
+func (c *testClient) notify(method string, params interface{}) error {
+	return c.write(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// call sends the request and returns its result.
+func (c *testClient) call(method string, params interface{}) (json.RawMessage, error) {
+	ch := make(chan json.RawMessage, 1)
+
+	c.mu.Lock()
+	c.lastID++
+	id := c.lastID
+	c.responses[id] = ch
+	c.mu.Unlock()
+
+	err := c.write(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case res := <-ch:
+		return res, nil
+	case <-time.After(responseTimeout):
+		return nil, fmt.Errorf("no response to %s in %s", method, responseTimeout)
+	}
+}
+
+func (c *testClient) uri(filename string) string {
+	return "file://" + filepath.Join(c.root, filename)
+}
+
+// runScript runs the script steps, the opened files are closed at the end.
+func (c *testClient) runScript(t *testing.T, filename string) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("could not read script: %v", err)
+	}
+	data = []byte(strings.Replace(string(data), "${root}", c.root, -1))
+
+	var steps []scriptStep
+	if err := json.Unmarshal(data, &steps); err != nil {
+		t.Fatalf("could not parse script: %v", err)
+	}
+
+	defer func() {
+		for name := range c.opened {
+			c.closeFile(t, name)
+		}
+	}()
+
+	for i, step := range steps {
+		switch {
+		case step.Open != "":
+			c.openFile(t, step.Open)
+		case step.Close != "":
+			c.closeFile(t, step.Close)
+		case step.Request != "":
+			res, err := c.call(step.Request, step.Params)
+			if err != nil {
+				t.Fatalf("step %d: %v", i, err)
+			}
+			if err := matchJSON(step.Result, res, step.Contains); err != nil {
+				t.Errorf("step %d: %s: %v\nresult: %s", i, step.Request, err, res)
+			}
+		case step.Notify != "":
+			if err := c.notify(step.Notify, step.Params); err != nil {
+				t.Fatalf("step %d: %v", i, err)
+			}
+		case step.Diagnostics != "":
+			c.checkDiagnostics(t, i, step)
+		default:
+			t.Fatalf("step %d: unknown step", i)
+		}
+	}
+}
+
+func (c *testClient) openFile(t *testing.T, name string) {
+	contents, err := ioutil.ReadFile(filepath.Join(c.root, name))
+	if err != nil {
+		t.Fatalf("could not open %s: %v", name, err)
+	}
+
+	// The diagnostics published before the file is opened are not checked.
+	c.mu.Lock()
+	delete(c.diagnostics, c.uri(name))
+	c.mu.Unlock()
+
+	err = c.notify("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{
+			"uri":        c.uri(name),
+			"languageId": "php",
+			"version":    1,
+			"text":       string(contents),
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not open %s: %v", name, err)
+	}
+	c.opened[name] = true
+}
+
+func (c *testClient) closeFile(t *testing.T, name string) {
+	err := c.notify("textDocument/didClose", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": c.uri(name)},
+	})
+	if err != nil {
+		t.Fatalf("could not close %s: %v", name, err)
+	}
+	delete(c.opened, name)
+}
+
+// checkDiagnostics waits until the file diagnostics match the expected ones.
+func (c *testClient) checkDiagnostics(t *testing.T, i int, step scriptStep) {
+	uri := c.uri(step.Diagnostics)
+	deadline := time.Now().Add(responseTimeout)
+
+	for {
+		c.mu.Lock()
+		diag, ok := c.diagnostics[uri]
+		c.mu.Unlock()
+
+		var err error
+		if !ok {
+			err = fmt.Errorf("no diagnostics are published")
+		} else {
+			err = matchJSON(step.Expect, diag, false)
+		}
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("step %d: diagnostics for %s: %v\ndiagnostics: %s", i, step.Diagnostics, err, diag)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// matchJSON reports whether the actual value matches the expected one.
+func matchJSON(expected, actual json.RawMessage, contains bool) error {
+	var want, have interface{}
+	if len(expected) != 0 {
+		if err := json.Unmarshal(expected, &want); err != nil {
+			return fmt.Errorf("bad expected value: %v", err)
+		}
+	}
+	if len(actual) != 0 {
+		if err := json.Unmarshal(actual, &have); err != nil {
+			return fmt.Errorf("bad actual value: %v", err)
+		}
+	}
+	return matchValue("", want, have, contains)
+}
+
+func matchValue(path string, want, have interface{}, contains bool) error {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		have, ok := have.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %v", path, have)
+		}
+		for key, v := range want {
+			if err := matchValue(path+"."+key, v, have[key], contains); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case []interface{}:
+		have, ok := have.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %v", path, have)
+		}
+		if !contains {
+			if len(want) != len(have) {
+				return fmt.Errorf("%s: expected %d elements, got %d", path, len(want), len(have))
+			}
+			for i := range want {
+				if err := matchValue(fmt.Sprintf("%s[%d]", path, i), want[i], have[i], contains); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		for i, v := range want {
+			found := false
+			for _, h := range have {
+				if matchValue("", v, h, contains) == nil {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("%s: no element matches [%d]", path, i)
+			}
+		}
+		return nil
+	}
+
+	if !reflect.DeepEqual(want, have) {
+		return fmt.Errorf("%s: expected %v, got %v", path, want, have)
+	}
+	return nil
+}
+
+func TestScripts(t *testing.T) {
+	c := getTestClient(t)
+
+	scripts, err := filepath.Glob(filepath.Join("testdata", "scripts", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scripts) == 0 {
+		t.Fatal("no scripts found")
+	}
+
+	for _, filename := range scripts {
+		name := strings.TrimSuffix(filepath.Base(filename), ".json")
+		t.Run(name, func(t *testing.T) {
+			c.runScript(t, filename)
+		})
+	}
+}
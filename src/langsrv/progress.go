@@ -0,0 +1,148 @@
+package langsrv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/setpill/noverify/src/lintdebug"
+	"github.com/setpill/noverify/src/vscode"
+)
+
+// clientCallTimeout is the maximum time to wait for the client response.
+const clientCallTimeout = 10 * time.Second
+
+// callClient sends the request to the client and waits for the response.
+// It must not be called from handleMessage since the response is read there.
+func (s *Server) callClient(method string, params interface{}) error {
+	s.clientCallsMutex.Lock()
+	s.lastClientCallID++
+	id := s.lastClientCallID
+	ch := make(chan error, 1)
+	s.clientCalls[id] = ch
+	s.clientCallsMutex.Unlock()
+
+	defer func() {
+		s.clientCallsMutex.Lock()
+		delete(s.clientCalls, id)
+		s.clientCallsMutex.Unlock()
+	}()
+
+	err := s.writeMessage(&methodCall{
+		JSONRPC: "2.0",
+		ID:      &id,
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case err := <-ch:
+		return err
+	case <-time.After(clientCallTimeout):
+		return fmt.Errorf("%s: no response in %s", method, clientCallTimeout)
+	}
+}
+
+// handleClientResponse passes the client response to the waiting callClient.
+func (s *Server) handleClientResponse(id int, buf []byte) error {
+	var resp struct {
+		Error *responseError `json:"error"`
+	}
+	if err := json.Unmarshal(buf, &resp); err != nil {
+		return err
+	}
+
+	s.clientCallsMutex.Lock()
+	ch, ok := s.clientCalls[id]
+	s.clientCallsMutex.Unlock()
+
+	if !ok {
+		lintdebug.Send("Got response for unknown request %d", id)
+		return nil
+	}
+	if resp.Error != nil {
+		ch <- errors.New(resp.Error.Message)
+	} else {
+		ch <- nil
+	}
+	return nil
+}
+
+// progress is a work done progress shown by the client.
+// All methods are no-op for the nil progress, so it can be used
+// even if the client doesn't support progress reporting.
+type progress struct {
+	server *Server
+	token  string
+
+	// percentage is the last reported percentage.
+	percentage int
+}
+
+// startProgress creates the progress with the given title.
+// It returns nil if the client doesn't support progress reporting.
+func (s *Server) startProgress(title string) *progress {
+	if !s.workDoneProgress {
+		return nil
+	}
+
+	s.progressMutex.Lock()
+	s.lastProgressID++
+	token := fmt.Sprintf("noverify-%d", s.lastProgressID)
+	s.progressMutex.Unlock()
+
+	err := s.callClient("window/workDoneProgress/create", &vscode.WorkDoneProgressCreateParams{Token: token})
+	if err != nil {
+		lintdebug.Send("Could not create progress: %s", err.Error())
+		return nil
+	}
+
+	p := &progress{server: s, token: token}
+	percentage := 0
+	p.send(&vscode.WorkDoneProgressBegin{
+		Kind:       "begin",
+		Title:      title,
+		Percentage: &percentage,
+	})
+	return p
+}
+
+// report updates the progress message and percentage.
+// Updates that don't change the percentage are not sent to avoid flooding the client.
+func (p *progress) report(message string, percentage int) {
+	if p == nil || percentage == p.percentage {
+		return
+	}
+	p.percentage = percentage
+	p.send(&vscode.WorkDoneProgressReport{
+		Kind:       "report",
+		Message:    message,
+		Percentage: &percentage,
+	})
+}
+
+// end finishes the progress.
+func (p *progress) end(message string) {
+	if p == nil {
+		return
+	}
+	p.send(&vscode.WorkDoneProgressEnd{
+		Kind:    "end",
+		Message: message,
+	})
+}
+
+func (p *progress) send(value interface{}) {
+	p.server.writeMessage(&methodCall{
+		JSONRPC: "2.0",
+		Method:  "$/progress",
+		Params: &vscode.ProgressParams{
+			Token: p.token,
+			Value: value,
+		},
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"sync"
 
+	"github.com/setpill/noverify/src/inputs"
 	"github.com/setpill/noverify/src/lintdebug"
 	"github.com/setpill/noverify/src/linter"
 	"github.com/setpill/noverify/src/meta"
@@ -20,7 +21,8 @@ import (
 )
 
 type referencesWalker struct {
-	st meta.ClassParseState
+	server *Server
+	st     meta.ClassParseState
 
 	position int
 	scopes   map[node.Node]*meta.Scope
@@ -35,21 +37,21 @@ func getFunction(st *meta.ClassParseState, n *expr.FunctionCall) (fun meta.FuncI
 		nameStr = meta.NameToString(nm)
 		tryStr := st.Namespace + `\` + nameStr
 
-		fun, ok = meta.Info.GetFunction(tryStr)
+		fun, ok = st.MetaInfo().GetFunction(tryStr)
 		if ok {
 			return fun, tryStr, true
 		}
 
 		if !ok && st.Namespace != "" {
 			tryStr := `\` + nameStr
-			fun, ok = meta.Info.GetFunction(`\` + nameStr)
+			fun, ok = st.MetaInfo().GetFunction(`\` + nameStr)
 			if ok {
 				return fun, tryStr, true
 			}
 		}
 	case *name.FullyQualified:
 		nameStr = meta.FullyQualifiedToString(nm)
-		fun, ok = meta.Info.GetFunction(nameStr)
+		fun, ok = st.MetaInfo().GetFunction(nameStr)
 	}
 
 	return fun, nameStr, ok
@@ -74,7 +76,7 @@ func (d *referencesWalker) EnterNode(w walker.Walkable) bool {
 
 		_, nameStr, ok := getFunction(&d.st, n)
 		if ok {
-			d.result = findFunctionReferences(nameStr)
+			d.result = d.server.findFunctionReferences(nameStr)
 		}
 	case *expr.StaticCall:
 		if pos := n.Call.GetPosition(); d.position > pos.EndPos || d.position < pos.StartPos {
@@ -92,16 +94,16 @@ func (d *referencesWalker) EnterNode(w walker.Walkable) bool {
 			return true
 		}
 
-		_, realClassName, ok := solver.FindMethod(className, id.Value)
+		_, realClassName, ok := solver.FindMethod(d.st.MetaInfo(), className, id.Value)
 		if ok {
-			d.result = findStaticMethodReferences(realClassName, id.Value)
+			d.result = d.server.findStaticMethodReferences(realClassName, id.Value)
 		}
 	case *stmt.Function:
 		if pos := n.FunctionName.GetPosition(); d.position > pos.EndPos || d.position < pos.StartPos {
 			return true
 		}
 
-		d.result = findFunctionReferences(d.st.Namespace + `\` + n.FunctionName.Value)
+		d.result = d.server.findFunctionReferences(d.st.Namespace + `\` + n.FunctionName.Value)
 	case *stmt.ClassMethod:
 		if pos := n.MethodName.GetPosition(); d.position > pos.EndPos || d.position < pos.StartPos {
 			return true
@@ -116,25 +118,25 @@ func (d *referencesWalker) EnterNode(w walker.Walkable) bool {
 		}
 
 		if isStatic {
-			d.result = findStaticMethodReferences(d.st.CurrentClass, n.MethodName.Value)
+			d.result = d.server.findStaticMethodReferences(d.st.CurrentClass, n.MethodName.Value)
 		} else {
-			d.result = findMethodReferences(d.st.CurrentClass, n.MethodName.Value)
+			d.result = d.server.findMethodReferences(d.st.CurrentClass, n.MethodName.Value)
 		}
 	case *stmt.Property:
 		if pos := n.GetPosition(); d.position > pos.EndPos || d.position < pos.StartPos {
 			return true
 		}
 
-		d.result = findPropertyReferences(d.st.CurrentClass, n.Variable.Name)
+		d.result = d.server.findPropertyReferences(d.st.CurrentClass, n.Variable.Name)
 	case *stmt.Constant:
 		if pos := n.ConstantName.GetPosition(); d.position > pos.EndPos || d.position < pos.StartPos {
 			return true
 		}
 
 		if d.st.CurrentClass == "" {
-			d.result = findConstantsReferences(d.st.Namespace + `\` + n.ConstantName.Value)
+			d.result = d.server.findConstantsReferences(d.st.Namespace + `\` + n.ConstantName.Value)
 		} else {
-			d.result = findClassConstantsReferences(d.st.CurrentClass, n.ConstantName.Value)
+			d.result = d.server.findClassConstantsReferences(d.st.CurrentClass, n.ConstantName.Value)
 		}
 	}
 
@@ -156,45 +158,82 @@ func (d *referencesWalker) LeaveNode(w walker.Walkable) {
 }
 
 // copyOpenMap returns map[filename]contents
-func copyOpenMap() map[string]string {
-	openMapMutex.Lock()
-	res := make(map[string]string, len(openMap))
-	for filename, info := range openMap {
+func (s *Server) copyOpenMap() map[string]string {
+	s.openMapMutex.Lock()
+	res := make(map[string]string, len(s.openMap))
+	for filename, info := range s.openMap {
 		res[filename] = info.contents
 	}
-	openMapMutex.Unlock()
+	s.openMapMutex.Unlock()
 
 	return res
 }
 
-func readFile(openMapCopy map[string]string, filename string) (contents []byte, err error) {
+func readFile(input inputs.SourceInput, openMapCopy map[string]string, filename string) (contents []byte, err error) {
 	if cont, ok := openMapCopy[filename]; ok {
 		return []byte(cont), nil
 	}
 
-	return getFileContents(filename)
+	return getFileContents(input, filename)
 }
 
-// Very simple computation for now, it needs to be improved for refactoring purposes :)
-func refPosition(filename string, pos *position.Position) vscode.Location {
-	endLine := pos.EndLine - 1
-	if pos.StartLine == pos.EndLine {
-		endLine++
+// refLocation returns the exact pos location inside the file.
+// linesPositions contain file lines start offsets.
+func refLocation(filename string, linesPositions []int, pos *position.Position) vscode.Location {
+	return vscode.Location{
+		URI:   "file://" + filename,
+		Range: posToRange(linesPositions, pos),
 	}
+}
 
-	return vscode.Location{
-		URI: "file://" + filename,
-		Range: vscode.Range{
-			Start: vscode.Position{Line: pos.StartLine - 1},
-			End:   vscode.Position{Line: endLine},
-		},
+// posToRange converts node position into the LSP range.
+func posToRange(linesPositions []int, pos *position.Position) vscode.Range {
+	var r vscode.Range
+	r.Start.Line = pos.StartLine - 1
+	r.End.Line = pos.EndLine - 1
+	if pos.StartLine >= 1 && pos.StartLine <= len(linesPositions) {
+		r.Start.Character = pos.StartPos - 1 - linesPositions[pos.StartLine-1]
+	}
+	if pos.EndLine >= 1 && pos.EndLine <= len(linesPositions) {
+		r.End.Character = pos.EndPos - linesPositions[pos.EndLine-1]
+	}
+	return r
+}
+
+// getLinesPositions returns start offsets of all contents lines.
+func getLinesPositions(contents []byte) []int {
+	res := []int{0}
+	for i, ch := range contents {
+		if ch == '\n' {
+			res = append(res, i+1)
+		}
+	}
+	return res
+}
+
+// namePosition returns the position of the last name part,
+// so only the name itself is matched without the namespace.
+func namePosition(n node.Node) *position.Position {
+	var parts []node.Node
+	switch n := n.(type) {
+	case *name.Name:
+		parts = n.Parts
+	case *name.FullyQualified:
+		parts = n.Parts
+	case *name.Relative:
+		parts = n.Parts
+	}
+	if len(parts) != 0 {
+		return parts[len(parts)-1].GetPosition()
 	}
+	return n.GetPosition()
 }
 
 type parseFn func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location
 
-func findReferences(substr string, parse parseFn) []vscode.Location {
-	cb := linter.ReadFilenames(linter.AnalysisFiles, nil)
+func (s *Server) findReferences(substr string, parse parseFn) []vscode.Location {
+	config := s.linter.Config()
+	cb := linter.ReadFilenames(s.analysisFiles, nil)
 	ch := make(chan linter.FileInfo)
 	go func() {
 		cb(ch)
@@ -209,19 +248,20 @@ func findReferences(substr string, parse parseFn) []vscode.Location {
 		wg          sync.WaitGroup
 	)
 
-	openMapCopy := copyOpenMap()
+	openMapCopy := s.copyOpenMap()
 
-	for i := 0; i < linter.MaxConcurrency; i++ {
+	for i := 0; i < config.MaxConcurrency; i++ {
 		wg.Add(1)
 		go func() {
 			for fi := range ch {
-				contents, err := readFile(openMapCopy, fi.Filename)
+				contents, err := readFile(config.SrcInput, openMapCopy, fi.Filename)
 				if err == nil && bytes.Contains(contents, substrBytes) {
 					func() {
 						waiter := linter.BeforeParse(len(contents), fi.Filename)
 						defer waiter.Finish()
 
 						parser := php7.NewParser(bytes.NewReader(contents), fi.Filename)
+						parser.WithFreeFloating()
 						parser.Parse()
 
 						rootNode := parser.GetRootNode()
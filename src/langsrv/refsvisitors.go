@@ -9,119 +9,158 @@ import (
 	"github.com/setpill/noverify/src/php/parser/node/expr"
 	"github.com/setpill/noverify/src/php/parser/node/expr/assign"
 	"github.com/setpill/noverify/src/php/parser/php7"
+	"github.com/setpill/noverify/src/php/parser/position"
 	"github.com/setpill/noverify/src/php/parser/walker"
 	"github.com/setpill/noverify/src/solver"
 	"github.com/setpill/noverify/src/state"
 	"github.com/setpill/noverify/src/vscode"
 )
 
-func findFunctionReferences(funcName string) []vscode.Location {
+func (s *Server) findFunctionReferences(funcName string) []vscode.Location {
 	substr := funcName
 	if idx := strings.LastIndexByte(funcName, '\\'); idx >= 0 {
 		substr = funcName[idx+1:]
 	}
 
-	return findReferences(substr, func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
+	return s.findReferences(substr, func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
 		v := &funcCallVisitor{
-			funcName: funcName,
-			filename: filename,
+			st:             meta.ClassParseState{Info: s.metaInfo()},
+			funcName:       funcName,
+			filename:       filename,
+			linesPositions: getLinesPositions(contents),
 		}
 		rootNode.Walk(v)
 		return v.found
 	})
 }
 
-func findStaticMethodReferences(className string, methodName string) []vscode.Location {
-	return findReferences(methodName, func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
+func (s *Server) findStaticMethodReferences(className string, methodName string) []vscode.Location {
+	return s.findReferences(methodName, func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
 		v := &staticMethodCallVisitor{
-			className:  className,
-			methodName: methodName,
-			filename:   filename,
+			st:             meta.ClassParseState{Info: s.metaInfo()},
+			className:      className,
+			methodName:     methodName,
+			filename:       filename,
+			linesPositions: getLinesPositions(contents),
 		}
 		rootNode.Walk(v)
 		return v.found
 	})
 }
 
-func findConstantsReferences(constName string) []vscode.Location {
-	return findReferences(constName, func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
+func (s *Server) findConstantsReferences(constName string) []vscode.Location {
+	return s.findReferences(constName, func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
 		v := &constVisitor{
-			constName: constName,
-			filename:  filename,
+			st:             meta.ClassParseState{Info: s.metaInfo()},
+			constName:      constName,
+			filename:       filename,
+			linesPositions: getLinesPositions(contents),
 		}
 		rootNode.Walk(v)
 		return v.found
 	})
 }
 
-func findClassConstantsReferences(className string, constName string) []vscode.Location {
-	return findReferences(constName, func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
+func (s *Server) findClassConstantsReferences(className string, constName string) []vscode.Location {
+	return s.findReferences(constName, func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
 		v := &classConstVisitor{
-			className: className,
-			constName: constName,
-			filename:  filename,
+			st:             meta.ClassParseState{Info: s.metaInfo()},
+			className:      className,
+			constName:      constName,
+			filename:       filename,
+			linesPositions: getLinesPositions(contents),
 		}
 		rootNode.Walk(v)
 		return v.found
 	})
 }
 
-func findMethodReferences(className string, methodName string) []vscode.Location {
-	return findReferences(methodName, func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
-		var found []vscode.Location
+func (s *Server) findClassReferences(className string) []vscode.Location {
+	shortName := baseSymbolName(className)
+	return s.findReferences(shortName, func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
+		v := &classRefsVisitor{
+			st:             meta.ClassParseState{Info: s.metaInfo()},
+			className:      className,
+			shortName:      shortName,
+			filename:       filename,
+			linesPositions: getLinesPositions(contents),
+		}
+		rootNode.Walk(v)
+		return v.found
+	})
+}
 
-		rootWalker := linter.NewWalkerForReferencesSearcher(
-			filename,
-			func(ctx *linter.BlockContext) linter.BlockChecker {
-				return &blockMethodCallVisitor{
-					ctx:        ctx,
-					className:  className,
-					methodName: methodName,
-					filename:   filename,
-					addFound:   func(f vscode.Location) { found = append(found, f) },
-				}
-			},
-		)
+func (s *Server) findMethodReferences(className string, methodName string) []vscode.Location {
+	return s.findReferences(methodName, func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
+		return s.findMethodCalls(filename, rootNode, contents, parser, className, methodName)
+	})
+}
 
-		rootWalker.InitFromParser(contents, parser)
+// findMethodCalls returns className::methodName instance method calls locations inside the file.
+func (s *Server) findMethodCalls(filename string, rootNode node.Node, contents []byte, parser *php7.Parser, className, methodName string) []vscode.Location {
+	var found []vscode.Location
+	linesPositions := getLinesPositions(contents)
+
+	rootWalker := s.linter.NewWalkerForReferencesSearcher(
+		filename,
+		func(ctx *linter.BlockContext) linter.BlockChecker {
+			return &blockMethodCallVisitor{
+				ctx:            ctx,
+				className:      className,
+				methodName:     methodName,
+				filename:       filename,
+				linesPositions: linesPositions,
+				addFound:       func(f vscode.Location) { found = append(found, f) },
+			}
+		},
+	)
 
-		rootNode.Walk(rootWalker)
-		linter.AnalyzeFileRootLevel(rootNode, rootWalker)
+	rootWalker.InitFromParser(contents, parser)
 
-		return found
-	})
+	rootNode.Walk(rootWalker)
+	linter.AnalyzeFileRootLevel(rootNode, rootWalker)
+
+	return found
 }
 
-func findPropertyReferences(className string, propName string) []vscode.Location {
-	return findReferences(propName, func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
-		var found []vscode.Location
+func (s *Server) findPropertyReferences(className string, propName string) []vscode.Location {
+	return s.findReferences(propName, func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
+		return s.findPropertyFetches(filename, rootNode, contents, parser, className, propName)
+	})
+}
 
-		rootWalker := linter.NewWalkerForReferencesSearcher(
-			filename,
-			func(ctx *linter.BlockContext) linter.BlockChecker {
-				return &blockPropertyVisitor{
-					ctx:       ctx,
-					className: className,
-					propName:  propName,
-					filename:  filename,
-					addFound:  func(f vscode.Location) { found = append(found, f) },
-				}
-			},
-		)
+// findPropertyFetches returns className->propName property fetches locations inside the file.
+func (s *Server) findPropertyFetches(filename string, rootNode node.Node, contents []byte, parser *php7.Parser, className, propName string) []vscode.Location {
+	var found []vscode.Location
+	linesPositions := getLinesPositions(contents)
+
+	rootWalker := s.linter.NewWalkerForReferencesSearcher(
+		filename,
+		func(ctx *linter.BlockContext) linter.BlockChecker {
+			return &blockPropertyVisitor{
+				ctx:            ctx,
+				className:      className,
+				propName:       propName,
+				filename:       filename,
+				linesPositions: linesPositions,
+				addFound:       func(f vscode.Location) { found = append(found, f) },
+			}
+		},
+	)
 
-		rootWalker.InitFromParser(contents, parser)
+	rootWalker.InitFromParser(contents, parser)
 
-		rootNode.Walk(rootWalker)
-		linter.AnalyzeFileRootLevel(rootNode, rootWalker)
+	rootNode.Walk(rootWalker)
+	linter.AnalyzeFileRootLevel(rootNode, rootWalker)
 
-		return found
-	})
+	return found
 }
 
 type funcCallVisitor struct {
-	st       meta.ClassParseState
-	funcName string
-	filename string
+	st             meta.ClassParseState
+	funcName       string
+	filename       string
+	linesPositions []int
 
 	found []vscode.Location
 }
@@ -138,8 +177,8 @@ func (d *funcCallVisitor) EnterNode(w walker.Walkable) bool {
 	case *expr.FunctionCall:
 		_, nameStr, ok := getFunction(&d.st, n)
 		if ok && nameStr == d.funcName {
-			if pos := n.GetPosition(); pos != nil {
-				d.found = append(d.found, refPosition(d.filename, pos))
+			if pos := namePosition(n.Function); pos != nil {
+				d.found = append(d.found, refLocation(d.filename, d.linesPositions, pos))
 			}
 		}
 	}
@@ -154,9 +193,10 @@ func (d *funcCallVisitor) LeaveNode(w walker.Walkable) {
 
 type staticMethodCallVisitor struct {
 	// params
-	className  string
-	methodName string
-	filename   string
+	className      string
+	methodName     string
+	filename       string
+	linesPositions []int
 
 	// output
 	found []vscode.Location
@@ -183,11 +223,11 @@ func (d *staticMethodCallVisitor) EnterNode(w walker.Walkable) bool {
 		if !ok {
 			return true
 		}
-		_, realClassName, ok := solver.FindMethod(className, id.Value)
+		_, realClassName, ok := solver.FindMethod(d.st.MetaInfo(), className, id.Value)
 
 		if ok && realClassName == d.className && id.Value == d.methodName {
-			if pos := n.GetPosition(); pos != nil {
-				d.found = append(d.found, refPosition(d.filename, pos))
+			if pos := id.GetPosition(); pos != nil {
+				d.found = append(d.found, refLocation(d.filename, d.linesPositions, pos))
 			}
 		}
 	}
@@ -202,8 +242,9 @@ func (d *staticMethodCallVisitor) LeaveNode(w walker.Walkable) {
 
 type constVisitor struct {
 	// params
-	constName string
-	filename  string
+	constName      string
+	filename       string
+	linesPositions []int
 
 	// output
 	found []vscode.Location
@@ -225,8 +266,8 @@ func (d *constVisitor) EnterNode(w walker.Walkable) bool {
 		constName, _, ok := solver.GetConstant(&d.st, n.Constant)
 
 		if ok && constName == d.constName {
-			if pos := n.GetPosition(); pos != nil {
-				d.found = append(d.found, refPosition(d.filename, pos))
+			if pos := namePosition(n.Constant); pos != nil {
+				d.found = append(d.found, refLocation(d.filename, d.linesPositions, pos))
 			}
 		}
 	}
@@ -241,9 +282,10 @@ func (d *constVisitor) LeaveNode(w walker.Walkable) {
 
 type classConstVisitor struct {
 	// params
-	className string
-	constName string
-	filename  string
+	className      string
+	constName      string
+	filename       string
+	linesPositions []int
 
 	// output
 	found []vscode.Location
@@ -272,11 +314,11 @@ func (d *classConstVisitor) EnterNode(w walker.Walkable) bool {
 			return true
 		}
 
-		_, implClassName, ok := solver.FindConstant(className, constName.Value)
+		_, implClassName, ok := solver.FindConstant(d.st.MetaInfo(), className, constName.Value)
 
 		if ok && constName.Value == d.constName && implClassName == d.className {
-			if pos := n.GetPosition(); pos != nil {
-				d.found = append(d.found, refPosition(d.filename, pos))
+			if pos := constName.GetPosition(); pos != nil {
+				d.found = append(d.found, refLocation(d.filename, d.linesPositions, pos))
 			}
 		}
 	}
@@ -295,7 +337,8 @@ type blockMethodCallVisitor struct {
 	className  string
 	methodName string
 
-	filename string
+	filename       string
+	linesPositions []int
 
 	addFound func(f vscode.Location)
 }
@@ -318,11 +361,11 @@ func (d *blockMethodCallVisitor) BeforeEnterNode(w walker.Walkable) {
 		exprType := solver.ExprType(d.ctx.Scope(), d.ctx.ClassParseState(), n.Variable)
 
 		exprType.Iterate(func(typ string) {
-			_, realClassName, ok := solver.FindMethod(typ, methodName)
+			_, realClassName, ok := solver.FindMethod(d.ctx.ClassParseState().MetaInfo(), typ, methodName)
 
 			if ok && realClassName == d.className {
-				if pos := n.GetPosition(); pos != nil {
-					d.addFound(refPosition(d.filename, pos))
+				if pos := n.Method.GetPosition(); pos != nil {
+					d.addFound(refLocation(d.filename, d.linesPositions, pos))
 				}
 			}
 		})
@@ -339,7 +382,8 @@ type blockPropertyVisitor struct {
 	className string
 	propName  string
 
-	filename string
+	filename       string
+	linesPositions []int
 
 	addFound func(f vscode.Location)
 }
@@ -368,11 +412,11 @@ func (d *blockPropertyVisitor) handlePropertyFetch(n *expr.PropertyFetch) {
 
 	exprType := solver.ExprType(d.ctx.Scope(), d.ctx.ClassParseState(), n.Variable)
 	exprType.Iterate(func(className string) {
-		_, realClassName, ok := solver.FindProperty(className, id.Value)
+		_, realClassName, ok := solver.FindProperty(d.ctx.ClassParseState().MetaInfo(), className, id.Value)
 
 		if ok && realClassName == d.className {
-			if pos := n.GetPosition(); pos != nil {
-				d.addFound(refPosition(d.filename, pos))
+			if pos := id.GetPosition(); pos != nil {
+				d.addFound(refLocation(d.filename, d.linesPositions, pos))
 			}
 		}
 	})
@@ -381,3 +425,103 @@ func (d *blockPropertyVisitor) handlePropertyFetch(n *expr.PropertyFetch) {
 func (d *blockPropertyVisitor) AfterEnterNode(w walker.Walkable)  {}
 func (d *blockPropertyVisitor) BeforeLeaveNode(w walker.Walkable) {}
 func (d *blockPropertyVisitor) AfterLeaveNode(w walker.Walkable)  {}
+
+// findCalls returns all resolved function and method calls inside the file.
+func (s *Server) findCalls(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []hierarchyCall {
+	var found []hierarchyCall
+	linesPositions := getLinesPositions(contents)
+
+	rootWalker := s.linter.NewWalkerForReferencesSearcher(
+		filename,
+		func(ctx *linter.BlockContext) linter.BlockChecker {
+			return &blockCallVisitor{
+				ctx:            ctx,
+				filename:       filename,
+				linesPositions: linesPositions,
+				addFound:       func(c hierarchyCall) { found = append(found, c) },
+			}
+		},
+	)
+
+	rootWalker.InitFromParser(contents, parser)
+
+	rootNode.Walk(rootWalker)
+	linter.AnalyzeFileRootLevel(rootNode, rootWalker)
+
+	return found
+}
+
+type blockCallVisitor struct {
+	ctx *linter.BlockContext
+
+	filename       string
+	linesPositions []int
+
+	addFound func(c hierarchyCall)
+}
+
+func (d *blockCallVisitor) BeforeEnterNode(w walker.Walkable) {
+	st := d.ctx.ClassParseState()
+
+	switch n := w.(type) {
+	case *expr.FunctionCall:
+		_, nameStr, ok := getFunction(st, n)
+		if ok {
+			d.add(hierarchySymbol{Name: nameStr}, namePosition(n.Function))
+		}
+	case *expr.StaticCall:
+		id, ok := n.Call.(*node.Identifier)
+		if !ok {
+			return
+		}
+		className, ok := solver.GetClassName(st, n.Class)
+		if !ok {
+			return
+		}
+		_, realClassName, ok := solver.FindMethod(d.ctx.ClassParseState().MetaInfo(), className, id.Value)
+		if ok {
+			d.add(hierarchySymbol{ClassName: realClassName, Name: id.Value}, id.Position)
+		}
+	case *expr.MethodCall:
+		id, ok := n.Method.(*node.Identifier)
+		if !ok {
+			return
+		}
+
+		// Different types can share the same method implementation.
+		added := make(map[string]bool)
+		solver.ExprType(d.ctx.Scope(), st, n.Variable).Iterate(func(typ string) {
+			_, realClassName, ok := solver.FindMethod(d.ctx.ClassParseState().MetaInfo(), typ, id.Value)
+			if ok && !added[realClassName] {
+				added[realClassName] = true
+				d.add(hierarchySymbol{ClassName: realClassName, Name: id.Value}, id.Position)
+			}
+		})
+	}
+}
+
+func (d *blockCallVisitor) add(callee hierarchySymbol, pos *position.Position) {
+	if pos == nil {
+		return
+	}
+
+	st := d.ctx.ClassParseState()
+	caller := hierarchySymbol{Filename: d.filename}
+	switch {
+	case st.CurrentFunction == "":
+	case st.CurrentClass != "":
+		caller = hierarchySymbol{ClassName: st.CurrentClass, Name: st.CurrentFunction}
+	default:
+		caller = hierarchySymbol{Name: st.Namespace + `\` + st.CurrentFunction}
+	}
+
+	d.addFound(hierarchyCall{
+		caller: caller,
+		callee: callee,
+		rng:    posToRange(d.linesPositions, pos),
+	})
+}
+
+func (d *blockCallVisitor) AfterEnterNode(w walker.Walkable)  {}
+func (d *blockCallVisitor) BeforeLeaveNode(w walker.Walkable) {}
+func (d *blockCallVisitor) AfterLeaveNode(w walker.Walkable)  {}
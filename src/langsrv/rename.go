@@ -0,0 +1,1014 @@
+package langsrv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/setpill/noverify/src/lintdebug"
+	"github.com/setpill/noverify/src/meta"
+	"github.com/setpill/noverify/src/php/parser/freefloating"
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/node/expr"
+	"github.com/setpill/noverify/src/php/parser/node/name"
+	"github.com/setpill/noverify/src/php/parser/node/stmt"
+	"github.com/setpill/noverify/src/php/parser/php7"
+	"github.com/setpill/noverify/src/php/parser/position"
+	"github.com/setpill/noverify/src/php/parser/walker"
+	"github.com/setpill/noverify/src/solver"
+	"github.com/setpill/noverify/src/state"
+	"github.com/setpill/noverify/src/vscode"
+)
+
+type renameKind int
+
+const (
+	renameVariable renameKind = iota
+	renameFunction
+	renameMethod
+	renameProperty
+	renameClassConstant
+	renameClass
+)
+
+// renameTarget describes the symbol that is being renamed.
+type renameTarget struct {
+	kind renameKind
+
+	// name is a symbol name without namespace and "$" prefix.
+	name string
+
+	// fullName is a fully qualified function or class name.
+	fullName string
+
+	// className is a method, property or class constant owner.
+	className string
+
+	// pos is the symbol name position under the cursor.
+	pos *position.Position
+
+	// scope is a function, method or closure that owns the variable.
+	// It's nil for the global scope variables.
+	scope node.Node
+}
+
+var identifierRegexp = regexp.MustCompile(`^[\pL_][\pL\pN_]*$`)
+
+func (s *Server) handleTextDocumentPrepareRename(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	var params vscode.PrepareRenameParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	_, f, target, err := s.findRenameTarget(params.TextDocument.URI, params.Position)
+	if err != nil {
+		return s.writeRenameError(req, err)
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result: map[string]interface{}{
+			"range":       posToRange(f.linesPositions, target.pos),
+			"placeholder": target.name,
+		},
+	})
+}
+
+func (s *Server) handleTextDocumentRename(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	var params vscode.RenameParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	filename, f, target, err := s.findRenameTarget(params.TextDocument.URI, params.Position)
+	if err != nil {
+		return s.writeRenameError(req, err)
+	}
+
+	newName := params.NewName
+	if target.kind == renameVariable || target.kind == renameProperty {
+		newName = strings.TrimPrefix(newName, "$")
+	}
+	if !identifierRegexp.MatchString(newName) {
+		return s.writeRenameError(req, fmt.Errorf("%q is not a valid name", params.NewName))
+	}
+
+	result := vscode.WorkspaceEdit{Changes: make(map[string][]vscode.TextEdit)}
+	if newName != target.name {
+		if err := s.checkRenameConflicts(f, target, newName); err != nil {
+			return s.writeRenameError(req, err)
+		}
+		result.Changes = renameEdits(s.findRenameLocations(filename, f, target), newName)
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  result,
+	})
+}
+
+func (s *Server) writeRenameError(req *baseRequest, err error) error {
+	return s.writeMessage(&errorResponse{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Error: responseError{
+			Code:    requestFailed,
+			Message: err.Error(),
+		},
+	})
+}
+
+// findRenameTarget returns the symbol under the cursor or the reason why it can't be renamed.
+func (s *Server) findRenameTarget(uri string, pos vscode.Position) (filename string, f openedFile, t *renameTarget, err error) {
+	filename = strings.TrimPrefix(uri, "file://")
+	s.openMapMutex.Lock()
+	f, ok := s.openMap[filename]
+	s.openMapMutex.Unlock()
+
+	if !ok {
+		lintdebug.Send("File is not opened, but rename requested: %s", filename)
+		return filename, f, nil, errors.New("file is not opened")
+	}
+	if !s.metaInfo().IsIndexingComplete() || f.scopes == nil {
+		return filename, f, nil, errors.New("indexing is not complete yet")
+	}
+	if pos.Line >= len(f.linesPositions) {
+		return filename, f, nil, errors.New("position is out of range")
+	}
+
+	w := &renameTargetWalker{
+		st:       meta.ClassParseState{Info: s.metaInfo()},
+		position: f.linesPositions[pos.Line] + pos.Character,
+		scopes:   f.scopes,
+	}
+	f.rootNode.Walk(w)
+	if w.err != nil {
+		return filename, f, nil, w.err
+	}
+	if w.target == nil {
+		return filename, f, nil, errors.New("no symbol to rename at the cursor")
+	}
+	return filename, f, w.target, nil
+}
+
+// renameTargetWalker finds the symbol under the cursor.
+type renameTargetWalker struct {
+	st meta.ClassParseState
+
+	position int
+	scopes   map[node.Node]*meta.Scope
+
+	foundScopes []*meta.Scope
+	funcs       []node.Node
+
+	target *renameTarget
+	err    error
+}
+
+// EnterNode is invoked at every node in hierarchy
+func (d *renameTargetWalker) EnterNode(w walker.Walkable) bool {
+	if d.target != nil || d.err != nil {
+		return false
+	}
+
+	n := w.(node.Node)
+	if sc, ok := d.scopes[n]; ok {
+		d.foundScopes = append(d.foundScopes, sc)
+	}
+	switch n.(type) {
+	case *stmt.Function, *stmt.ClassMethod, *expr.Closure:
+		d.funcs = append(d.funcs, n)
+	}
+
+	state.EnterNode(&d.st, n)
+
+	d.handleNode(n)
+
+	return d.target == nil && d.err == nil
+}
+
+// LeaveNode is invoked after node process
+func (d *renameTargetWalker) LeaveNode(w walker.Walkable) {
+	if d.target != nil || d.err != nil {
+		return
+	}
+
+	n := w.(node.Node)
+	if _, ok := d.scopes[n]; ok && len(d.foundScopes) > 0 {
+		d.foundScopes = d.foundScopes[:len(d.foundScopes)-1]
+	}
+	switch n.(type) {
+	case *stmt.Function, *stmt.ClassMethod, *expr.Closure:
+		d.funcs = d.funcs[:len(d.funcs)-1]
+	}
+
+	state.LeaveNode(&d.st, n)
+}
+
+func (d *renameTargetWalker) contains(pos *position.Position) bool {
+	return pos != nil && d.position >= pos.StartPos-1 && d.position <= pos.EndPos
+}
+
+func (d *renameTargetWalker) scope() *meta.Scope {
+	if len(d.foundScopes) == 0 {
+		return meta.NewScope()
+	}
+	return d.foundScopes[len(d.foundScopes)-1]
+}
+
+func (d *renameTargetWalker) handleNode(n node.Node) {
+	switch n := n.(type) {
+	case *stmt.Function:
+		if d.contains(n.FunctionName.Position) {
+			d.target = &renameTarget{
+				kind:     renameFunction,
+				name:     n.FunctionName.Value,
+				fullName: d.st.Namespace + `\` + n.FunctionName.Value,
+				pos:      n.FunctionName.Position,
+			}
+		}
+	case *stmt.ClassMethod:
+		if d.contains(n.MethodName.Position) {
+			d.setMethodTarget(d.st.CurrentClass, n.MethodName)
+		}
+	case *expr.FunctionCall:
+		if !d.contains(n.Function.GetPosition()) {
+			return
+		}
+		_, nameStr, ok := getFunction(&d.st, n)
+		if !ok {
+			d.err = errors.New("can't resolve the called function")
+			return
+		}
+		d.target = &renameTarget{
+			kind:     renameFunction,
+			name:     baseSymbolName(nameStr),
+			fullName: nameStr,
+			pos:      namePosition(n.Function),
+		}
+	case *expr.MethodCall:
+		if !d.contains(n.Method.GetPosition()) {
+			return
+		}
+		id, ok := n.Method.(*node.Identifier)
+		if !ok {
+			d.err = errors.New("dynamic method calls can't be renamed")
+			return
+		}
+		var className string
+		safeExprType(d.scope(), &d.st, n.Variable).Find(func(typ string) bool {
+			_, className, ok = solver.FindMethod(d.st.MetaInfo(), typ, id.Value)
+			return ok
+		})
+		if className == "" {
+			d.err = errors.New("can't resolve the called method")
+			return
+		}
+		d.setMethodTarget(className, id)
+	case *expr.StaticCall:
+		if !d.contains(n.Call.GetPosition()) {
+			return
+		}
+		id, ok := n.Call.(*node.Identifier)
+		if !ok {
+			d.err = errors.New("dynamic method calls can't be renamed")
+			return
+		}
+		className, ok := solver.GetClassName(&d.st, n.Class)
+		if ok {
+			_, className, ok = solver.FindMethod(d.st.MetaInfo(), className, id.Value)
+		}
+		if !ok {
+			d.err = errors.New("can't resolve the called method")
+			return
+		}
+		d.setMethodTarget(className, id)
+	case *expr.PropertyFetch:
+		if !d.contains(n.Property.GetPosition()) {
+			return
+		}
+		id, ok := n.Property.(*node.Identifier)
+		if !ok {
+			d.err = errors.New("dynamic property fetches can't be renamed")
+			return
+		}
+		var className string
+		safeExprType(d.scope(), &d.st, n.Variable).Find(func(typ string) bool {
+			_, className, ok = solver.FindProperty(d.st.MetaInfo(), typ, id.Value)
+			return ok
+		})
+		if className == "" {
+			d.err = errors.New("can't resolve the property")
+			return
+		}
+		d.target = &renameTarget{
+			kind:      renameProperty,
+			name:      id.Value,
+			className: className,
+			pos:       id.Position,
+		}
+	case *expr.StaticPropertyFetch:
+		if d.contains(n.Property.GetPosition()) {
+			d.err = errors.New("static properties renaming is not supported")
+		}
+	case *stmt.PropertyList:
+		for _, m := range n.Modifiers {
+			if strings.EqualFold(m.Value, "static") {
+				if d.contains(n.Position) {
+					d.err = errors.New("static properties renaming is not supported")
+				}
+				return
+			}
+		}
+		for _, p := range n.Properties {
+			p, ok := p.(*stmt.Property)
+			if !ok || !d.contains(p.Variable.Position) {
+				continue
+			}
+			d.target = &renameTarget{
+				kind:      renameProperty,
+				name:      p.Variable.Name,
+				className: d.st.CurrentClass,
+				pos:       varNamePosition(p.Variable),
+			}
+		}
+	case *expr.ClassConstFetch:
+		if !d.contains(n.ConstantName.Position) {
+			return
+		}
+		if strings.EqualFold(n.ConstantName.Value, "class") {
+			d.err = errors.New("::class can't be renamed")
+			return
+		}
+		className, ok := solver.GetClassName(&d.st, n.Class)
+		if ok {
+			_, className, ok = solver.FindConstant(d.st.MetaInfo(), className, n.ConstantName.Value)
+		}
+		if !ok {
+			d.err = errors.New("can't resolve the class constant")
+			return
+		}
+		d.target = &renameTarget{
+			kind:      renameClassConstant,
+			name:      n.ConstantName.Value,
+			className: className,
+			pos:       n.ConstantName.Position,
+		}
+	case *stmt.ClassConstList:
+		for _, c := range n.Consts {
+			c, ok := c.(*stmt.Constant)
+			if !ok || !d.contains(c.ConstantName.Position) {
+				continue
+			}
+			d.target = &renameTarget{
+				kind:      renameClassConstant,
+				name:      c.ConstantName.Value,
+				className: d.st.CurrentClass,
+				pos:       c.ConstantName.Position,
+			}
+		}
+	case *stmt.Class:
+		if n.ClassName != nil && d.contains(n.ClassName.Position) {
+			d.setClassTarget(d.st.CurrentClass, n.ClassName.Position)
+		}
+	case *stmt.Interface:
+		if d.contains(n.InterfaceName.Position) {
+			d.setClassTarget(d.st.CurrentClass, n.InterfaceName.Position)
+		}
+	case *stmt.Trait:
+		if d.contains(n.TraitName.Position) {
+			d.setClassTarget(d.st.CurrentClass, n.TraitName.Position)
+		}
+	case *stmt.UseList:
+		if !d.contains(n.Position) {
+			return
+		}
+		if n.UseType != nil {
+			d.err = errors.New("only class imports can be renamed")
+			return
+		}
+		for _, u := range n.Uses {
+			u, ok := u.(*stmt.Use)
+			if !ok {
+				continue
+			}
+			if nm, ok := u.Use.(*name.Name); ok && d.contains(nm.Position) {
+				d.setClassTarget(`\`+meta.NameToString(nm), namePosition(nm))
+				return
+			}
+		}
+		d.err = errors.New("import aliases can't be renamed")
+	case *stmt.GroupUse:
+		if d.contains(n.Position) {
+			d.err = errors.New("group imports renaming is not supported")
+		}
+	case *stmt.Namespace:
+		if n.NamespaceName != nil && d.contains(n.NamespaceName.GetPosition()) {
+			d.err = errors.New("namespaces renaming is not supported")
+		}
+	case *expr.ConstFetch:
+		if d.contains(n.Position) {
+			d.err = errors.New("constants renaming is not supported")
+		}
+	case *name.Name, *name.FullyQualified:
+		if !d.contains(n.GetPosition()) {
+			return
+		}
+		if nm, ok := n.(*name.Name); ok && len(nm.Parts) == 1 {
+			switch strings.ToLower(meta.NameToString(nm)) {
+			case "self", "static", "parent":
+				d.err = errors.New("self, static and parent can't be renamed")
+				return
+			}
+		}
+		className, ok := solver.GetClassName(&d.st, n)
+		if !ok {
+			return
+		}
+		d.setClassTarget(className, namePosition(n))
+	case *node.SimpleVar:
+		if d.contains(n.Position) {
+			d.setVariableTarget(n)
+		}
+	}
+}
+
+func (d *renameTargetWalker) setMethodTarget(className string, id *node.Identifier) {
+	if strings.HasPrefix(id.Value, "__") {
+		d.err = errors.New("magic methods can't be renamed")
+		return
+	}
+	d.target = &renameTarget{
+		kind:      renameMethod,
+		name:      id.Value,
+		className: className,
+		pos:       id.Position,
+	}
+}
+
+func (d *renameTargetWalker) setClassTarget(className string, pos *position.Position) {
+	if _, ok := d.st.MetaInfo().GetClassOrTrait(className); !ok {
+		d.err = fmt.Errorf("can't find class %s", className)
+		return
+	}
+	d.target = &renameTarget{
+		kind:     renameClass,
+		name:     baseSymbolName(className),
+		fullName: className,
+		pos:      pos,
+	}
+}
+
+func (d *renameTargetWalker) setVariableTarget(v *node.SimpleVar) {
+	if v.Name == "this" {
+		d.err = errors.New("$this can't be renamed")
+		return
+	}
+	if isSuperGlobal(v.Name) {
+		d.err = fmt.Errorf("superglobal $%s can't be renamed", v.Name)
+		return
+	}
+
+	d.target = &renameTarget{
+		kind:  renameVariable,
+		name:  v.Name,
+		pos:   varNamePosition(v),
+		scope: varScope(d.funcs, v.Name),
+	}
+}
+
+// varScope returns the function, method or closure that owns the variable,
+// funcs are the enclosing functions from the outermost to the innermost one.
+// It returns nil for the global scope variables.
+func varScope(funcs []node.Node, varName string) node.Node {
+	// Variables that are imported by the closure
+	// belong to the enclosing function.
+	for i := len(funcs) - 1; i >= 0; i-- {
+		if c, ok := funcs[i].(*expr.Closure); ok && closureUsesVar(c, varName) {
+			continue
+		}
+		return funcs[i]
+	}
+	return nil
+}
+
+func isSuperGlobal(name string) bool {
+	switch name {
+	case "GLOBALS", "_SERVER", "_GET", "_POST", "_FILES", "_COOKIE", "_SESSION", "_REQUEST", "_ENV":
+		return true
+	}
+	return false
+}
+
+// varNamePosition returns the variable name position without "$".
+func varNamePosition(v *node.SimpleVar) *position.Position {
+	pos := v.Position
+	if pos == nil || pos.EndPos-pos.StartPos != len(v.Name) {
+		return pos
+	}
+	return &position.Position{
+		StartLine: pos.StartLine,
+		EndLine:   pos.EndLine,
+		StartPos:  pos.StartPos + 1,
+		EndPos:    pos.EndPos,
+	}
+}
+
+func closureUsesVar(c *expr.Closure, varName string) bool {
+	if c.ClosureUse == nil {
+		return false
+	}
+	for _, u := range c.ClosureUse.Uses {
+		if ref, ok := u.(*expr.Reference); ok {
+			u = ref.Variable
+		}
+		if v, ok := u.(*node.SimpleVar); ok && v.Name == varName {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRenameConflicts returns an error if the target can't be renamed
+// because of the symbol with the same name or the inheritance.
+func (s *Server) checkRenameConflicts(f openedFile, t *renameTarget, newName string) error {
+	switch t.kind {
+	case renameVariable:
+		root := t.scope
+		if root == nil {
+			root = f.rootNode
+		}
+		v := &varRenameWalker{root: root, varName: newName}
+		root.Walk(v)
+		if len(v.found) != 0 {
+			return fmt.Errorf("variable $%s already exists", newName)
+		}
+	case renameFunction:
+		if _, ok := s.metaInfo().GetFunction(symbolPrefix(t.fullName) + newName); ok {
+			return fmt.Errorf("function %s already exists", newName)
+		}
+	case renameMethod:
+		if _, implClassName, ok := solver.FindMethod(s.metaInfo(), t.className, newName); ok {
+			return fmt.Errorf("method %s::%s already exists", implClassName, newName)
+		}
+		if subclass := s.findSubclassWithMethod(t.className, newName); subclass != "" {
+			return fmt.Errorf("method %s::%s already exists", subclass, newName)
+		}
+		return s.checkMethodInheritance(t.className, t.name)
+	case renameProperty:
+		if _, implClassName, ok := solver.FindProperty(s.metaInfo(), t.className, newName); ok {
+			return fmt.Errorf("property %s::$%s already exists", implClassName, newName)
+		}
+	case renameClassConstant:
+		if _, implClassName, ok := solver.FindConstant(s.metaInfo(), t.className, newName); ok {
+			return fmt.Errorf("constant %s::%s already exists", implClassName, newName)
+		}
+	case renameClass:
+		newFullName := symbolPrefix(t.fullName) + newName
+		if _, ok := s.metaInfo().GetClassOrTrait(newFullName); ok {
+			return fmt.Errorf("class %s already exists", newFullName)
+		}
+	}
+	return nil
+}
+
+// symbolPrefix returns the fully qualified name without the last part.
+func symbolPrefix(fullName string) string {
+	return fullName[:strings.LastIndexByte(fullName, '\\')+1]
+}
+
+// checkMethodInheritance returns an error if the method overrides
+// or is overridden by another method, as renaming it would break the inheritance.
+func (s *Server) checkMethodInheritance(className, methodName string) error {
+	class, ok := s.metaInfo().GetClassOrTrait(className)
+	if !ok {
+		return nil
+	}
+
+	var parents []string
+	if class.Parent != "" {
+		parents = append(parents, class.Parent)
+	}
+	parents = append(parents, class.ParentInterfaces...)
+	for iface := range class.Interfaces {
+		parents = append(parents, iface)
+	}
+	for _, parent := range parents {
+		if _, implClassName, ok := solver.FindMethod(s.metaInfo(), parent, methodName); ok {
+			return fmt.Errorf("method overrides %s::%s", implClassName, methodName)
+		}
+	}
+
+	if overriddenIn := s.findSubclassWithMethod(className, methodName); overriddenIn != "" {
+		return fmt.Errorf("method is overridden in %s", overriddenIn)
+	}
+	return nil
+}
+
+// findSubclassWithMethod returns the first (in lexical order) class or trait
+// that is a subclass of className and declares the method.
+// It returns an empty string if there is no such class.
+func (s *Server) findSubclassWithMethod(className, methodName string) string {
+	var found string
+	check := func(name string, c meta.ClassInfo) {
+		if _, ok := c.Methods[methodName]; !ok || name == className {
+			return
+		}
+		if (found == "" || name < found) && s.isSubclass(name, c, className) {
+			found = name
+		}
+	}
+	s.metaInfo().IterateClasses(check)
+	s.metaInfo().IterateTraits(check)
+	return found
+}
+
+// isSubclass reports whether the class extends, implements or uses baseName.
+func (s *Server) isSubclass(className string, class meta.ClassInfo, baseName string) bool {
+	if _, ok := class.Traits[baseName]; ok {
+		return true
+	}
+	for _, iface := range class.ParentInterfaces {
+		if iface == baseName {
+			return true
+		}
+	}
+
+	visited := make(map[string]struct{})
+	for parent := class.Parent; parent != ""; {
+		if parent == baseName {
+			return true
+		}
+		if _, ok := visited[parent]; ok {
+			break
+		}
+		visited[parent] = struct{}{}
+		c, ok := s.metaInfo().GetClass(parent)
+		if !ok {
+			break
+		}
+		parent = c.Parent
+	}
+
+	return solver.Implements(s.metaInfo(), className, baseName)
+}
+
+// findRenameLocations returns all target name occurrences.
+func (s *Server) findRenameLocations(filename string, f openedFile, t *renameTarget) []vscode.Location {
+	if t.kind == renameVariable {
+		root := t.scope
+		if root == nil {
+			root = f.rootNode
+		}
+		v := &varRenameWalker{root: root, varName: t.name}
+		root.Walk(v)
+
+		res := make([]vscode.Location, 0, len(v.found))
+		for _, pos := range v.found {
+			res = append(res, refLocation(filename, f.linesPositions, pos))
+		}
+		return res
+	}
+
+	return s.findReferences(t.name, func(filename string, rootNode node.Node, contents []byte, parser *php7.Parser) []vscode.Location {
+		found := s.findTargetUsages(filename, rootNode, contents, parser, t)
+		return append(found, s.findTargetDeclarations(filename, rootNode, contents, t)...)
+	})
+}
+
+// findTargetUsages returns the target usages inside the file, declarations are not included.
+// Variables are not supported as they are searched inside their scope only.
+func (s *Server) findTargetUsages(filename string, rootNode node.Node, contents []byte, parser *php7.Parser, t *renameTarget) []vscode.Location {
+	linesPositions := getLinesPositions(contents)
+
+	switch t.kind {
+	case renameFunction:
+		v := &funcCallVisitor{st: meta.ClassParseState{Info: s.metaInfo()}, funcName: t.fullName, filename: filename, linesPositions: linesPositions}
+		rootNode.Walk(v)
+		return v.found
+	case renameMethod:
+		found := s.findMethodCalls(filename, rootNode, contents, parser, t.className, t.name)
+		v := &staticMethodCallVisitor{st: meta.ClassParseState{Info: s.metaInfo()}, className: t.className, methodName: t.name, filename: filename, linesPositions: linesPositions}
+		rootNode.Walk(v)
+		return append(found, v.found...)
+	case renameProperty:
+		return s.findPropertyFetches(filename, rootNode, contents, parser, t.className, t.name)
+	case renameClassConstant:
+		v := &classConstVisitor{st: meta.ClassParseState{Info: s.metaInfo()}, className: t.className, constName: t.name, filename: filename, linesPositions: linesPositions}
+		rootNode.Walk(v)
+		return v.found
+	case renameClass:
+		v := &classRefsVisitor{st: meta.ClassParseState{Info: s.metaInfo()}, className: t.fullName, shortName: t.name, filename: filename, linesPositions: linesPositions}
+		rootNode.Walk(v)
+		return v.found
+	}
+	return nil
+}
+
+// findTargetDeclarations returns the target declaration locations inside the file.
+func (s *Server) findTargetDeclarations(filename string, rootNode node.Node, contents []byte, t *renameTarget) []vscode.Location {
+	d := &renameDeclVisitor{st: meta.ClassParseState{Info: s.metaInfo()}, target: t, filename: filename, linesPositions: getLinesPositions(contents)}
+	rootNode.Walk(d)
+	return d.found
+}
+
+// renameEdits converts the locations into the workspace edits.
+func renameEdits(locations []vscode.Location, newName string) map[string][]vscode.TextEdit {
+	res := make(map[string][]vscode.TextEdit)
+	seen := make(map[vscode.Location]bool, len(locations))
+	for _, l := range locations {
+		if seen[l] {
+			continue
+		}
+		seen[l] = true
+		res[l.URI] = append(res[l.URI], vscode.TextEdit{Range: l.Range, NewText: newName})
+	}
+
+	for _, edits := range res {
+		sort.Slice(edits, func(i, j int) bool {
+			a, b := edits[i].Range.Start, edits[j].Range.Start
+			if a.Line != b.Line {
+				return a.Line < b.Line
+			}
+			return a.Character < b.Character
+		})
+	}
+	return res
+}
+
+// varRenameWalker finds the variable occurrences inside the function.
+// Nested functions and classes are skipped, closures are only
+// visited if they import the variable.
+type varRenameWalker struct {
+	root    node.Node
+	varName string
+
+	found []*position.Position
+
+	// vars contains the found variable nodes, in the same order as found.
+	vars []*node.SimpleVar
+}
+
+// EnterNode is invoked at every node in hierarchy
+func (d *varRenameWalker) EnterNode(w walker.Walkable) bool {
+	if w == d.root {
+		return true
+	}
+
+	switch n := w.(type) {
+	case *stmt.Function, *stmt.ClassMethod, *stmt.Class, *stmt.Interface, *stmt.Trait:
+		return false
+	case *expr.Closure:
+		return closureUsesVar(n, d.varName)
+	case *expr.StaticPropertyFetch:
+		n.Class.Walk(d)
+		return false
+	case *node.SimpleVar:
+		if n.Name == d.varName {
+			d.found = append(d.found, varNamePosition(n))
+			d.vars = append(d.vars, n)
+		}
+	}
+
+	return true
+}
+
+// LeaveNode is invoked after node process
+func (d *varRenameWalker) LeaveNode(w walker.Walkable) {}
+
+// renameDeclVisitor finds the target declaration.
+type renameDeclVisitor struct {
+	target         *renameTarget
+	filename       string
+	linesPositions []int
+
+	found []vscode.Location
+
+	st meta.ClassParseState
+}
+
+// EnterNode is invoked at every node in hierarchy
+func (d *renameDeclVisitor) EnterNode(w walker.Walkable) bool {
+	state.EnterNode(&d.st, w)
+
+	t := d.target
+	var pos *position.Position
+
+	switch n := w.(type) {
+	case *stmt.Function:
+		if t.kind == renameFunction && d.st.Namespace+`\`+n.FunctionName.Value == t.fullName {
+			pos = n.FunctionName.Position
+		}
+	case *stmt.ClassMethod:
+		if t.kind == renameMethod && d.st.CurrentClass == t.className && n.MethodName.Value == t.name {
+			pos = n.MethodName.Position
+		}
+	case *stmt.PropertyList:
+		if t.kind != renameProperty || d.st.CurrentClass != t.className {
+			break
+		}
+		for _, p := range n.Properties {
+			if p, ok := p.(*stmt.Property); ok && p.Variable.Name == t.name {
+				pos = varNamePosition(p.Variable)
+			}
+		}
+	case *stmt.ClassConstList:
+		if t.kind != renameClassConstant || d.st.CurrentClass != t.className {
+			break
+		}
+		for _, c := range n.Consts {
+			if c, ok := c.(*stmt.Constant); ok && c.ConstantName.Value == t.name {
+				pos = c.ConstantName.Position
+			}
+		}
+	case *stmt.Class:
+		if t.kind == renameClass && n.ClassName != nil && d.st.CurrentClass == t.fullName {
+			pos = n.ClassName.Position
+		}
+	case *stmt.Interface:
+		if t.kind == renameClass && d.st.CurrentClass == t.fullName {
+			pos = n.InterfaceName.Position
+		}
+	case *stmt.Trait:
+		if t.kind == renameClass && d.st.CurrentClass == t.fullName {
+			pos = n.TraitName.Position
+		}
+	}
+
+	if pos != nil {
+		d.found = append(d.found, refLocation(d.filename, d.linesPositions, pos))
+	}
+	return true
+}
+
+// LeaveNode is invoked after node process
+func (d *renameDeclVisitor) LeaveNode(w walker.Walkable) {
+	state.LeaveNode(&d.st, w)
+}
+
+var (
+	phpdocTypeRegexp      = regexp.MustCompile(`@(?:param|return|var|throws|property(?:-read|-write)?|method|mixin)\s+(?:static\s+)?([^\s$]+)`)
+	phpdocClassNameRegexp = regexp.MustCompile(`\\?[\pL_][\pL\pN_]*(?:\\[\pL_][\pL\pN_]*)*`)
+)
+
+// classRefsVisitor finds the class name references, including
+// imports and phpdoc types.
+type classRefsVisitor struct {
+	// params
+	className      string
+	shortName      string
+	filename       string
+	linesPositions []int
+
+	// output
+	found []vscode.Location
+
+	// state
+	st   meta.ClassParseState
+	skip map[node.Node]bool
+}
+
+// EnterNode is invoked at every node in hierarchy
+func (d *classRefsVisitor) EnterNode(w walker.Walkable) bool {
+	state.EnterNode(&d.st, w)
+
+	if d.skip == nil {
+		d.skip = make(map[node.Node]bool)
+	}
+
+	n := w.(node.Node)
+	if ff := n.GetFreeFloating(); ff != nil {
+		for _, list := range *ff {
+			for _, s := range list {
+				if s.StringType == freefloating.CommentType && strings.HasPrefix(s.Value, "/**") {
+					d.handlePhpdoc(s)
+				}
+			}
+		}
+	}
+
+	switch n := n.(type) {
+	case *stmt.Namespace:
+		d.skip[n.NamespaceName] = true
+	case *stmt.GroupUse:
+		return false
+	case *stmt.UseList:
+		for _, u := range n.Uses {
+			u, ok := u.(*stmt.Use)
+			if !ok {
+				continue
+			}
+			d.skip[u.Use] = true
+			nm, ok := u.Use.(*name.Name)
+			if ok && n.UseType == nil && `\`+meta.NameToString(nm) == d.className {
+				d.addPos(namePosition(nm))
+			}
+		}
+	case *expr.FunctionCall:
+		d.skip[n.Function] = true
+	case *expr.ConstFetch:
+		d.skip[n.Constant] = true
+	case *name.Name, *name.FullyQualified:
+		if d.skip[n] {
+			return false
+		}
+		if nm, ok := n.(*name.Name); ok && len(nm.Parts) == 1 {
+			part := meta.NameToString(nm)
+			switch strings.ToLower(part) {
+			case "self", "static", "parent":
+				return false
+			}
+			if _, ok := d.st.Uses[part]; ok && part != d.shortName {
+				// The class is imported with an alias.
+				return false
+			}
+		}
+		if className, ok := solver.GetClassName(&d.st, n); ok && className == d.className {
+			d.addPos(namePosition(n))
+		}
+		return false
+	}
+
+	return true
+}
+
+// LeaveNode is invoked after node process
+func (d *classRefsVisitor) LeaveNode(w walker.Walkable) {
+	state.LeaveNode(&d.st, w)
+}
+
+func (d *classRefsVisitor) addPos(pos *position.Position) {
+	if pos != nil {
+		d.found = append(d.found, refLocation(d.filename, d.linesPositions, pos))
+	}
+}
+
+func (d *classRefsVisitor) handlePhpdoc(s freefloating.String) {
+	if s.Position == nil {
+		return
+	}
+	// Comment position uses the same convention as nodes: StartPos is 1-based.
+	offset := s.Position.StartPos - 1
+
+	for _, m := range phpdocTypeRegexp.FindAllStringSubmatchIndex(s.Value, -1) {
+		typ := s.Value[m[2]:m[3]]
+		for _, idx := range phpdocClassNameRegexp.FindAllStringIndex(typ, -1) {
+			nm := typ[idx[0]:idx[1]]
+			if !strings.Contains(nm, `\`) {
+				if _, ok := d.st.Uses[nm]; ok && nm != d.shortName {
+					continue
+				}
+			}
+			if resolvePhpdocClassName(&d.st, nm) != d.className {
+				continue
+			}
+
+			end := offset + m[2] + idx[1]
+			start := end - len(d.shortName)
+			d.found = append(d.found, vscode.Location{
+				URI: "file://" + d.filename,
+				Range: vscode.Range{
+					Start: offsetToPosition(d.linesPositions, start),
+					End:   offsetToPosition(d.linesPositions, end),
+				},
+			})
+		}
+	}
+}
+
+// resolvePhpdocClassName resolves the phpdoc class name in the same way as solver.GetClassName.
+func resolvePhpdocClassName(st *meta.ClassParseState, nm string) string {
+	if strings.HasPrefix(nm, `\`) {
+		return nm
+	}
+	first, rest := nm, ""
+	if idx := strings.IndexByte(nm, '\\'); idx >= 0 {
+		first, rest = nm[:idx], nm[idx:]
+	}
+	if alias, ok := st.Uses[first]; ok {
+		return alias + rest
+	}
+	return st.Namespace + `\` + nm
+}
+
+// offsetToPosition converts the 0-based file offset into the LSP position.
+func offsetToPosition(linesPositions []int, offset int) vscode.Position {
+	line := sort.Search(len(linesPositions), func(i int) bool {
+		return linesPositions[i] > offset
+	}) - 1
+	if line < 0 {
+		line = 0
+	}
+	return vscode.Position{Line: line, Character: offset - linesPositions[line]}
+}
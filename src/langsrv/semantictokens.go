@@ -0,0 +1,351 @@
+package langsrv
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/setpill/noverify/src/lintdebug"
+	"github.com/setpill/noverify/src/meta"
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/node/expr"
+	"github.com/setpill/noverify/src/php/parser/node/name"
+	"github.com/setpill/noverify/src/php/parser/node/stmt"
+	"github.com/setpill/noverify/src/php/parser/position"
+	"github.com/setpill/noverify/src/php/parser/walker"
+	"github.com/setpill/noverify/src/solver"
+	"github.com/setpill/noverify/src/state"
+	"github.com/setpill/noverify/src/vscode"
+)
+
+// Semantic token types, the order matches semanticTokenTypes.
+const (
+	tokenClass = iota
+	tokenInterface
+	tokenMethod
+	tokenFunction
+	tokenProperty
+	tokenParameter
+	tokenVariable
+)
+
+// Semantic token modifiers, the order matches semanticTokenModifiers.
+const (
+	tokenModStatic = 1 << iota
+	tokenModDeprecated
+	tokenModReadonly
+)
+
+// semanticTokenTypes is the legend for token types.
+// Constants are reported as readonly variables.
+var semanticTokenTypes = []string{"class", "interface", "method", "function", "property", "parameter", "variable"}
+
+// semanticTokenModifiers is the legend for token modifiers.
+var semanticTokenModifiers = []string{"static", "deprecated", "readonly"}
+
+func (s *Server) handleTextDocumentSemanticTokensFull(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	var params vscode.SemanticTokensParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	filename := strings.TrimPrefix(params.TextDocument.URI, "file://")
+	s.openMapMutex.Lock()
+	f, ok := s.openMap[filename]
+	s.openMapMutex.Unlock()
+
+	result := vscode.SemanticTokens{Data: make([]int, 0)}
+	switch {
+	case !ok:
+		lintdebug.Send("File is not opened, but semantic tokens requested: %s", filename)
+	case s.metaInfo().IsIndexingComplete() && f.scopes != nil:
+		w := &semanticTokensWalker{
+			st:      meta.ClassParseState{Info: s.metaInfo()},
+			scopes:  f.scopes,
+			handled: make(map[node.Node]bool),
+		}
+		f.rootNode.Walk(w)
+		result.Data = encodeSemanticTokens(f.linesPositions, w.tokens)
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  result,
+	})
+}
+
+type semanticToken struct {
+	pos       *position.Position
+	typ       int
+	modifiers int
+}
+
+// encodeSemanticTokens encodes tokens relatively to the previous ones, as LSP requires.
+func encodeSemanticTokens(linesPositions []int, tokens []semanticToken) []int {
+	sort.SliceStable(tokens, func(i, j int) bool {
+		return tokens[i].pos.StartPos < tokens[j].pos.StartPos
+	})
+
+	data := make([]int, 0, len(tokens)*5)
+	prevLine, prevChar, prevStart := 0, 0, -1
+	for _, t := range tokens {
+		r := posToRange(linesPositions, t.pos)
+		if t.pos.StartPos == prevStart || r.Start.Line != r.End.Line {
+			continue
+		}
+
+		char := r.Start.Character
+		if r.Start.Line == prevLine {
+			char -= prevChar
+		}
+		data = append(data, r.Start.Line-prevLine, char, r.End.Character-r.Start.Character, t.typ, t.modifiers)
+		prevLine, prevChar, prevStart = r.Start.Line, r.Start.Character, t.pos.StartPos
+	}
+
+	return data
+}
+
+// semanticTokensWalker classifies the file identifiers.
+type semanticTokensWalker struct {
+	st meta.ClassParseState
+
+	scopes      map[node.Node]*meta.Scope
+	foundScopes []*meta.Scope
+
+	// params contains parameter names of the enclosing functions.
+	params []map[string]bool
+
+	// handled contains nodes that are already classified by their parents.
+	handled map[node.Node]bool
+
+	tokens []semanticToken
+}
+
+// EnterNode is invoked at every node in hierarchy
+func (d *semanticTokensWalker) EnterNode(w walker.Walkable) bool {
+	n := w.(node.Node)
+
+	if sc, ok := d.scopes[n]; ok {
+		d.foundScopes = append(d.foundScopes, sc)
+	}
+
+	state.EnterNode(&d.st, n)
+
+	switch n := n.(type) {
+	case *stmt.Function, *stmt.ClassMethod, *expr.Closure:
+		d.params = append(d.params, funcParamNames(n))
+	}
+
+	if !d.handled[n] {
+		d.handleNode(n)
+	}
+
+	return true
+}
+
+// LeaveNode is invoked after node process
+func (d *semanticTokensWalker) LeaveNode(w walker.Walkable) {
+	n := w.(node.Node)
+
+	if _, ok := d.scopes[n]; ok && len(d.foundScopes) > 0 {
+		d.foundScopes = d.foundScopes[:len(d.foundScopes)-1]
+	}
+	switch n.(type) {
+	case *stmt.Function, *stmt.ClassMethod, *expr.Closure:
+		d.params = d.params[:len(d.params)-1]
+	}
+
+	state.LeaveNode(&d.st, n)
+}
+
+func (d *semanticTokensWalker) scope() *meta.Scope {
+	if len(d.foundScopes) == 0 {
+		return meta.NewScope()
+	}
+	return d.foundScopes[len(d.foundScopes)-1]
+}
+
+func (d *semanticTokensWalker) add(n node.Node, pos *position.Position, typ, modifiers int) {
+	if n != nil {
+		d.handled[n] = true
+	}
+	if pos != nil {
+		d.tokens = append(d.tokens, semanticToken{pos: pos, typ: typ, modifiers: modifiers})
+	}
+}
+
+func (d *semanticTokensWalker) handleNode(n node.Node) {
+	switch n := n.(type) {
+	case *stmt.Class:
+		if n.ClassName != nil {
+			d.add(n.ClassName, n.ClassName.Position, tokenClass, 0)
+		}
+	case *stmt.Interface:
+		d.add(n.InterfaceName, n.InterfaceName.Position, tokenInterface, 0)
+	case *stmt.Trait:
+		d.add(n.TraitName, n.TraitName.Position, tokenClass, 0)
+	case *stmt.Function:
+		fn, _ := d.st.MetaInfo().GetFunction(d.st.Namespace + `\` + n.FunctionName.Value)
+		d.add(n.FunctionName, n.FunctionName.Position, tokenFunction, funcModifiers(&fn))
+	case *stmt.ClassMethod:
+		var modifiers int
+		if class, ok := d.st.MetaInfo().GetClassOrTrait(d.st.CurrentClass); ok {
+			fn := class.Methods[n.MethodName.Value]
+			modifiers = funcModifiers(&fn)
+		}
+		d.add(n.MethodName, n.MethodName.Position, tokenMethod, modifiers)
+	case *node.Parameter:
+		d.add(n.Variable, n.Variable.Position, tokenParameter, 0)
+	case *stmt.PropertyList:
+		modifiers := 0
+		for _, m := range n.Modifiers {
+			if strings.EqualFold(m.Value, "static") {
+				modifiers = tokenModStatic
+			}
+		}
+		for _, p := range n.Properties {
+			if p, ok := p.(*stmt.Property); ok {
+				d.add(p.Variable, p.Variable.Position, tokenProperty, modifiers)
+			}
+		}
+	case *stmt.Constant:
+		d.add(n.ConstantName, n.ConstantName.Position, tokenVariable, tokenModReadonly)
+	case *stmt.Namespace:
+		if n.NamespaceName != nil {
+			d.handled[n.NamespaceName] = true
+		}
+	case *stmt.GroupUse:
+		if n.Prefix != nil {
+			d.handled[n.Prefix] = true
+		}
+	case *stmt.UseList:
+		if n.UseType != nil {
+			return
+		}
+		for _, u := range n.Uses {
+			u, ok := u.(*stmt.Use)
+			if !ok {
+				continue
+			}
+			if nm, ok := u.Use.(*name.Name); ok {
+				d.addClass(nm, `\`+meta.NameToString(nm))
+			}
+		}
+	case *expr.FunctionCall:
+		d.handled[n.Function] = true
+		if fn, _, ok := getFunction(&d.st, n); ok {
+			d.add(n.Function, namePosition(n.Function), tokenFunction, funcModifiers(&fn))
+		}
+	case *expr.ConstFetch:
+		d.handled[n.Constant] = true
+		switch strings.ToLower(strings.TrimPrefix(meta.NameNodeToString(n.Constant), `\`)) {
+		case "true", "false", "null":
+			return
+		}
+		if _, _, ok := solver.GetConstant(&d.st, n.Constant); ok {
+			d.add(n.Constant, namePosition(n.Constant), tokenVariable, tokenModReadonly)
+		}
+	case *expr.MethodCall:
+		id, ok := n.Method.(*node.Identifier)
+		if !ok {
+			return
+		}
+		var fn meta.FuncInfo
+		safeExprType(d.scope(), &d.st, n.Variable).Find(func(typ string) bool {
+			fn, _, ok = solver.FindMethod(d.st.MetaInfo(), typ, id.Value)
+			return ok
+		})
+		d.add(id, id.Position, tokenMethod, funcModifiers(&fn))
+	case *expr.StaticCall:
+		id, ok := n.Call.(*node.Identifier)
+		if !ok {
+			return
+		}
+		modifiers := tokenModStatic
+		if _, fn, ok := findClassMethod(&d.st, n.Class, id.Value); ok {
+			modifiers = funcModifiers(&fn)
+		}
+		d.add(id, id.Position, tokenMethod, modifiers)
+	case *expr.PropertyFetch:
+		if id, ok := n.Property.(*node.Identifier); ok {
+			d.add(id, id.Position, tokenProperty, 0)
+		}
+	case *expr.StaticPropertyFetch:
+		if v, ok := n.Property.(*node.SimpleVar); ok {
+			d.add(v, v.Position, tokenProperty, tokenModStatic)
+		}
+	case *expr.ClassConstFetch:
+		if !strings.EqualFold(n.ConstantName.Value, "class") {
+			d.add(n.ConstantName, n.ConstantName.Position, tokenVariable, tokenModReadonly)
+		}
+	case *name.Name, *name.FullyQualified, *name.Relative:
+		if nm, ok := n.(*name.Name); ok && len(nm.Parts) == 1 {
+			switch strings.ToLower(meta.NameToString(nm)) {
+			case "self", "static", "parent":
+				return
+			}
+		}
+		if className, ok := solver.GetClassName(&d.st, n); ok {
+			d.addClass(n, className)
+		}
+	case *node.SimpleVar:
+		if n.Name == "this" {
+			return
+		}
+		if len(d.params) != 0 && d.params[len(d.params)-1][n.Name] {
+			d.add(n, n.Position, tokenParameter, 0)
+		} else {
+			d.add(n, n.Position, tokenVariable, 0)
+		}
+	}
+}
+
+// addClass adds the class name token if the class is known.
+func (d *semanticTokensWalker) addClass(n node.Node, className string) {
+	d.handled[n] = true
+	class, ok := d.st.MetaInfo().GetClassOrTrait(className)
+	if !ok {
+		return
+	}
+	typ := tokenClass
+	if class.IsInterface() {
+		typ = tokenInterface
+	}
+	d.add(n, namePosition(n), typ, 0)
+}
+
+func funcModifiers(fn *meta.FuncInfo) int {
+	var modifiers int
+	if fn.IsStatic() {
+		modifiers |= tokenModStatic
+	}
+	if fn.Doc.Deprecated {
+		modifiers |= tokenModDeprecated
+	}
+	return modifiers
+}
+
+// funcParamNames returns the function, method or closure parameter names.
+func funcParamNames(n node.Node) map[string]bool {
+	var params []node.Node
+	switch n := n.(type) {
+	case *stmt.Function:
+		params = n.Params
+	case *stmt.ClassMethod:
+		params = n.Params
+	case *expr.Closure:
+		params = n.Params
+	}
+
+	res := make(map[string]bool, len(params))
+	for _, p := range params {
+		if p, ok := p.(*node.Parameter); ok {
+			res[p.Variable.Name] = true
+		}
+	}
+	return res
+}
@@ -0,0 +1,309 @@
+package langsrv
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/setpill/noverify/src/lintdebug"
+	"github.com/setpill/noverify/src/meta"
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/node/expr"
+	"github.com/setpill/noverify/src/php/parser/node/name"
+	"github.com/setpill/noverify/src/php/parser/node/stmt"
+	"github.com/setpill/noverify/src/php/parser/php7"
+	"github.com/setpill/noverify/src/solver"
+	"github.com/setpill/noverify/src/vscode"
+)
+
+func (s *Server) handleTextDocumentSignatureHelp(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	var params vscode.SignatureHelpParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	var result *vscode.SignatureHelp
+	defer func() {
+		s.writeMessage(&response{
+			JSONRPC: req.JSONRPC,
+			ID:      req.ID,
+			Result:  result,
+		})
+	}()
+
+	filename := strings.TrimPrefix(params.TextDocument.URI, "file://")
+	s.openMapMutex.Lock()
+	f, ok := s.openMap[filename]
+	s.openMapMutex.Unlock()
+
+	if !ok {
+		lintdebug.Send("File is not opened, but signature help requested: %s", filename)
+		return nil
+	}
+
+	if params.Position.Line >= len(f.linesPositions) {
+		lintdebug.Send("Line out of range for file %s: %d", filename, params.Position.Line)
+		return nil
+	}
+	position := f.linesPositions[params.Position.Line] + params.Position.Character
+	if position > len(f.contents) {
+		return nil
+	}
+
+	// The code is usually incomplete while the call arguments
+	// are being typed, so the call is found by the text before the cursor.
+	callee, activeParam, ok := findCallContext(f.contents[:position])
+	if !ok {
+		return nil
+	}
+
+	compl := &completionWalker{
+		st:       meta.ClassParseState{Info: s.metaInfo()},
+		position: position,
+		scopes:   f.scopes,
+	}
+	f.rootNode.Walk(compl)
+	sc := compl.foundScope
+	if sc == nil {
+		sc = meta.NewScope()
+	}
+
+	label, fn, ok := resolveCallee(callee, sc, &compl.st)
+	if !ok {
+		return nil
+	}
+
+	sig := s.funcSignature(label, compl.st.CurrentClass, &fn)
+	if len(sig.Parameters) != 0 && activeParam >= len(sig.Parameters) {
+		// Extra arguments are probably passed to the variadic parameter.
+		activeParam = len(sig.Parameters) - 1
+	}
+	result = &vscode.SignatureHelp{
+		Signatures:      []vscode.SignatureInformation{sig},
+		ActiveParameter: activeParam,
+	}
+	return nil
+}
+
+// findCallContext finds the innermost unclosed call in the text before the cursor.
+// Returns the callee source code, like "foo", "$x->method" or "new Foo",
+// and the index of the argument that is being typed.
+func findCallContext(text string) (callee string, argIndex int, ok bool) {
+	depth := 0
+	i := len(text) - 1
+	for ; i >= 0; i-- {
+		switch c := text[i]; c {
+		case '\'', '"':
+			i = skipStringBackward(text, i)
+		case ')', ']', '}':
+			depth++
+		case '(', '[', '{':
+			if depth == 0 {
+				if c != '(' {
+					return "", 0, false
+				}
+				callee = calleeBefore(text[:i])
+				return callee, argIndex, callee != ""
+			}
+			depth--
+		case ',':
+			if depth == 0 {
+				argIndex++
+			}
+		case ';':
+			if depth == 0 {
+				return "", 0, false
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// skipStringBackward returns the position of the quote
+// that opens the string literal that is closed at text[end].
+func skipStringBackward(text string, end int) int {
+	quote := text[end]
+	for i := end - 1; i >= 0; i-- {
+		if text[i] != quote {
+			continue
+		}
+		escapes := 0
+		for j := i - 1; j >= 0 && text[j] == '\\'; j-- {
+			escapes++
+		}
+		if escapes%2 == 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+// calleeBefore returns the call expression source that ends right before "(".
+func calleeBefore(text string) string {
+	end := len(strings.TrimRight(text, " \t\r\n"))
+	i := end - 1
+loop:
+	for i >= 0 {
+		c := text[i]
+		switch {
+		case isCalleeChar(c):
+			i--
+		case c == '>' && i > 0 && text[i-1] == '-':
+			i -= 2
+		case c == ':' && i > 0 && text[i-1] == ':':
+			i -= 2
+		case c == ')':
+			// Method chains like $x->foo()->bar(.
+			depth := 0
+			for ; i >= 0; i-- {
+				if text[i] == ')' {
+					depth++
+				} else if text[i] == '(' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			if i < 0 {
+				break loop
+			}
+			i--
+		default:
+			break loop
+		}
+	}
+
+	callee := text[i+1 : end]
+	if callee == "" {
+		return ""
+	}
+	before := strings.TrimRight(text[:i+1], " \t\r\n")
+	if len(before) < i+1 && strings.HasSuffix(strings.ToLower(before), "new") {
+		if len(before) == 3 || !isCalleeChar(before[len(before)-4]) {
+			callee = "new " + callee
+		}
+	}
+	return callee
+}
+
+func isCalleeChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '$' || c == '\\' || c >= 0x80
+}
+
+// resolveCallee finds the function or method that is called by the callee expression.
+func resolveCallee(callee string, sc *meta.Scope, st *meta.ClassParseState) (label string, fn meta.FuncInfo, ok bool) {
+	code := "<?php " + callee + "();"
+	parser := php7.NewParser(strings.NewReader(code), "temp")
+	parser.Parse()
+
+	root := parser.GetRootNode()
+	if root == nil || len(root.Stmts) == 0 {
+		return "", fn, false
+	}
+	s, ok := root.Stmts[0].(*stmt.Expression)
+	if !ok {
+		return "", fn, false
+	}
+
+	switch e := s.Expr.(type) {
+	case *expr.FunctionCall:
+		switch nm := e.Function.(type) {
+		case *name.Name:
+			label = meta.NameToString(nm)
+			fn, ok = st.MetaInfo().GetFunction(st.Namespace + `\` + label)
+			if !ok && st.Namespace != "" {
+				fn, ok = st.MetaInfo().GetFunction(`\` + label)
+			}
+		case *name.FullyQualified:
+			label = meta.FullyQualifiedToString(nm)
+			fn, ok = st.MetaInfo().GetFunction(label)
+		}
+		return label, fn, ok
+
+	case *expr.MethodCall:
+		id, ok := e.Method.(*node.Identifier)
+		if !ok {
+			return "", fn, false
+		}
+		var className string
+		safeExprType(sc, st, e.Variable).Find(func(t string) bool {
+			fn, className, ok = solver.FindMethod(st.MetaInfo(), t, id.Value)
+			return ok
+		})
+		return className + "::" + id.Value, fn, ok
+
+	case *expr.StaticCall:
+		id, ok := e.Call.(*node.Identifier)
+		if !ok {
+			return "", fn, false
+		}
+		return findClassMethod(st, e.Class, id.Value)
+
+	case *expr.New:
+		return findClassMethod(st, e.Class, "__construct")
+	}
+
+	return "", fn, false
+}
+
+func findClassMethod(st *meta.ClassParseState, classNode node.Node, methodName string) (label string, fn meta.FuncInfo, ok bool) {
+	className, ok := solver.GetClassName(st, classNode)
+	if !ok {
+		return "", fn, false
+	}
+	fn, implClassName, ok := solver.FindMethod(st.MetaInfo(), className, methodName)
+	if !ok {
+		return "", fn, false
+	}
+	return implClassName + "::" + methodName, fn, true
+}
+
+// funcSignature builds a signature label like "foo(int $x, string $y = 'a'): bool".
+// className is used to resolve the types like static.
+func (s *Server) funcSignature(label, className string, fn *meta.FuncInfo) vscode.SignatureInformation {
+	typeString := func(typ meta.TypesMap) string {
+		return meta.NewTypesMapFromMap(resolveTypesSafe(s.metaInfo(), className, typ, make(map[string]struct{}))).String()
+	}
+
+	sig := vscode.SignatureInformation{
+		Parameters: make([]vscode.ParameterInformation, 0, len(fn.Params)),
+	}
+
+	var buf strings.Builder
+	buf.WriteString(label)
+	buf.WriteString("(")
+	for i, p := range fn.Params {
+		if i != 0 {
+			buf.WriteString(", ")
+		}
+
+		var param strings.Builder
+		if !p.Typ.IsEmpty() {
+			param.WriteString(typeString(p.Typ))
+			param.WriteString(" ")
+		}
+		if p.IsRef {
+			param.WriteString("&")
+		}
+		param.WriteString("$" + p.Name)
+		if p.Default != "" {
+			param.WriteString(" = " + p.Default)
+		} else if i >= fn.MinParamsCnt {
+			param.WriteString(" = ?")
+		}
+
+		sig.Parameters = append(sig.Parameters, vscode.ParameterInformation{Label: param.String()})
+		buf.WriteString(param.String())
+	}
+	buf.WriteString(")")
+	if !fn.Typ.IsEmpty() {
+		buf.WriteString(": " + typeString(fn.Typ))
+	}
+
+	sig.Label = buf.String()
+	return sig
+}
@@ -1,6 +1,7 @@
 package langsrv
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -8,10 +9,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/setpill/noverify/src/inputs"
 	"github.com/setpill/noverify/src/lintdebug"
 	"github.com/setpill/noverify/src/linter"
 	"github.com/setpill/noverify/src/meta"
 	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/walker"
 	"github.com/setpill/noverify/src/vscode"
 )
 
@@ -21,81 +24,113 @@ type openedFile struct {
 	scopes         map[node.Node]*meta.Scope
 	lines          [][]byte
 	linesPositions []int
-}
-
-var (
-	openMapMutex sync.Mutex
-	openMap      = make(map[string]openedFile)
-
-	changingMutex sync.Mutex
-)
 
-func openFile(filename, contents string) {
-	changingMutex.Lock()
-	defer changingMutex.Unlock()
+	// varDefs contains the local variables definitions.
+	varDefs map[node.Node]struct{}
 
-	if meta.IsIndexingComplete() {
-		changeFileNonLocked(filename, contents)
-		return
-	}
+	// version is the analyzed document version.
+	version int
+}
 
-	// just parse file, do not fully analyze it as indexing is not yet done
-	rootNode, _, err := linter.ParseContents(filename, []byte(contents), nil)
+// parseFileNonLocked parses the file without the full analysis,
+// it's used while indexing is not yet done.
+func (s *Server) parseFileNonLocked(filename, contents string, version int) {
+	rootNode, _, err := s.linter.ParseContents(filename, []byte(contents), nil)
 	if err != nil {
 		log.Printf("Could not parse %s: %s", filename, err.Error())
 		lintdebug.Send("Could not parse %s: %s", filename, err.Error())
 		return
 	}
 
-	openMapMutex.Lock()
-	openMap[filename] = openedFile{rootNode: rootNode, contents: contents}
-	openMapMutex.Unlock()
+	s.openMapMutex.Lock()
+	s.openMap[filename] = openedFile{rootNode: rootNode, contents: contents, version: version}
+	s.openMapMutex.Unlock()
 }
 
-// Handle changed contents of a file in the editor
-func changeFile(filename, contents string) {
-	changingMutex.Lock()
-	defer changingMutex.Unlock()
-
-	changeFileNonLocked(filename, contents)
-}
-
-func changeFileNonLocked(filename, contents string) {
-	if !meta.IsIndexingComplete() {
+// changeFileNonLocked parses the file, updates the index for it
+// and then generates diagnostics based on the new index.
+//
+// The analysis is stopped if ctx is cancelled, results of the
+// cancelled analysis are discarded.
+func (s *Server) changeFileNonLocked(ctx context.Context, filename, contents string, version int) {
+	if !s.metaInfo().IsIndexingComplete() {
 		return
 	}
 
-	// parse file, update index for it, and then generate diagnostics based on new index
-	meta.SetIndexingComplete(false)
+	s.metaInfo().SetIndexingComplete(false)
 
-	rootNode, w, err := linter.ParseContents(filename, []byte(contents), nil)
+	rootNode, w, err := s.linter.ParseContents(filename, []byte(contents), nil)
 	if err != nil {
+		s.metaInfo().SetIndexingComplete(true)
 		log.Printf("Could not parse %s: %s", filename, err.Error())
 		lintdebug.Send("Could not parse %s: %s", filename, err.Error())
 		return
 	}
+	if ctx.Err() != nil {
+		s.metaInfo().SetIndexingComplete(true)
+		return
+	}
 
+	oldMeta := s.metaInfo().GetMetaForFile(filename)
 	w.UpdateMetaInfo()
+	newMeta := s.metaInfo().GetMetaForFile(filename)
+	s.updateSubtypesIndex(oldMeta.Classes, newMeta.Classes)
+	if s.workspaceDiagnostics {
+		s.scheduleDependents(changedClasses(oldMeta, newMeta))
+	}
 
-	meta.SetIndexingComplete(true)
+	s.metaInfo().SetIndexingComplete(true)
 
 	newWalker := linter.NewWalkerForLangServer(w)
 
 	newWalker.InitCustom()
-	rootNode.Walk(newWalker)
+	rootNode.Walk(&cancelableWalker{ctx: ctx, w: newWalker})
+	if ctx.Err() != nil {
+		return
+	}
 	linter.AnalyzeFileRootLevel(rootNode, newWalker)
 
-	openMapMutex.Lock()
-	f := openedFile{rootNode, contents, w.Scopes, w.Lines, w.LinesPositions}
-	openMap[filename] = f
-	openMapMutex.Unlock()
+	s.openMapMutex.Lock()
+	f := openedFile{
+		rootNode:       rootNode,
+		contents:       contents,
+		scopes:         w.Scopes,
+		lines:          w.Lines,
+		linesPositions: w.LinesPositions,
+		varDefs:        newWalker.VarDefs,
+		version:        version,
+	}
+	s.openMap[filename] = f
+	s.openMapMutex.Unlock()
 
-	flushReports(filename, newWalker)
+	if s.workspaceDiagnostics {
+		s.setFileDeps(filename, newWalker.ClassDeps)
+	}
+	s.flushReports(filename, version, newWalker)
+}
+
+// cancelableWalker stops the walk once ctx is cancelled.
+type cancelableWalker struct {
+	ctx context.Context
+	w   walker.Visitor
+}
+
+// EnterNode is invoked at every node in hierarchy
+func (c *cancelableWalker) EnterNode(w walker.Walkable) bool {
+	if c.ctx.Err() != nil {
+		return false
+	}
+	return c.w.EnterNode(w)
+}
+
+// LeaveNode is invoked after node process
+func (c *cancelableWalker) LeaveNode(w walker.Walkable) {
+	c.w.LeaveNode(w)
 }
 
 // parse creations and changes of files concurrently
 // changingMutex must be held
-func concurrentParseChanges(changes []vscode.FileEvent) {
+func (s *Server) concurrentParseChanges(changes []vscode.FileEvent) {
 	filenamesCh := make(chan string)
 
 	go func() {
@@ -110,11 +145,11 @@ func concurrentParseChanges(changes []vscode.FileEvent) {
 
 	var wg sync.WaitGroup
 
-	for i := 0; i < linter.MaxConcurrency; i++ {
+	for i := 0; i < s.linter.Config().MaxConcurrency; i++ {
 		wg.Add(1)
 		go func() {
 			for filename := range filenamesCh {
-				err := linter.IndexFile(filename, nil)
+				err := s.linter.IndexFile(filename, nil)
 				if err != nil {
 					lintdebug.Send("Could not parse %s: %s", filename, err.Error())
 				}
@@ -125,48 +160,62 @@ func concurrentParseChanges(changes []vscode.FileEvent) {
 	wg.Wait()
 }
 
-func externalChanges(changes []vscode.FileEvent) {
-	changingMutex.Lock()
+func (s *Server) externalChanges(changes []vscode.FileEvent) {
+	s.changingMutex.Lock()
 
 	start := time.Now()
 	lintdebug.Send("Started processing external changes %+v", changes)
 
-	meta.SetIndexingComplete(false)
+	s.metaInfo().SetIndexingComplete(false)
+
+	oldMeta := make(map[string]meta.PerFile, len(changes))
+	if s.workspaceDiagnostics {
+		for _, ev := range changes {
+			filename := strings.TrimPrefix(ev.URI, "file://")
+			oldMeta[filename] = s.metaInfo().GetMetaForFile(filename)
+		}
+	}
 
-	meta.Info.Lock()
+	s.metaInfo().Lock()
 	for _, ev := range changes {
 		switch ev.Type {
 		case vscode.Deleted:
-			meta.Info.DeleteMetaForFileNonLocked(strings.TrimPrefix(ev.URI, "file://"))
+			s.metaInfo().DeleteMetaForFileNonLocked(strings.TrimPrefix(ev.URI, "file://"))
 		}
 	}
-	meta.Info.Unlock()
+	s.metaInfo().Unlock()
 
-	concurrentParseChanges(changes)
+	s.concurrentParseChanges(changes)
+	s.buildSubtypesIndex()
 
-	changingMutex.Unlock()
-	meta.SetIndexingComplete(true)
+	var changed []string
+	for filename, old := range oldMeta {
+		changed = append(changed, changedClasses(old, s.metaInfo().GetMetaForFile(filename))...)
+	}
+
+	s.metaInfo().SetIndexingComplete(true)
+	s.changingMutex.Unlock()
+
+	if s.workspaceDiagnostics {
+		var filenames []string
+		for _, ev := range changes {
+			filename := strings.TrimPrefix(ev.URI, "file://")
+			switch ev.Type {
+			case vscode.Created, vscode.Changed:
+				filenames = append(filenames, filename)
+			case vscode.Deleted:
+				s.removeWorkspaceFile(filename)
+			}
+		}
+		s.scheduleWorkspaceFiles(filenames)
+		s.scheduleDependents(changed)
+	}
 
 	// update currently opened files if needed
 	for _, ev := range changes {
-		filename := strings.TrimPrefix(ev.URI, "file://")
 		switch ev.Type {
 		case vscode.Created, vscode.Changed:
-			openMapMutex.Lock()
-			_, ok := openMap[filename]
-			openMapMutex.Unlock()
-
-			if !ok {
-				break
-			}
-
-			contents, err := getFileContents(filename)
-			if err != nil {
-				lintdebug.Send("Could not read %s: %s", filename, err.Error())
-				break
-			}
-
-			changeFile(filename, string(contents))
+			s.reanalyzeDocument(strings.TrimPrefix(ev.URI, "file://"))
 		}
 	}
 
@@ -174,8 +223,8 @@ func externalChanges(changes []vscode.FileEvent) {
 }
 
 // getFileContents reads specified file and returns UTF-8 encoded bytes.
-func getFileContents(filename string) ([]byte, error) {
-	r, err := linter.SrcInput.NewReader(filename)
+func getFileContents(input inputs.SourceInput, filename string) ([]byte, error) {
+	r, err := input.NewReader(filename)
 	if err != nil {
 		return nil, fmt.Errorf("open input: %v", err)
 	}
@@ -186,24 +235,28 @@ func getFileContents(filename string) ([]byte, error) {
 	return contents, nil
 }
 
-func flushReports(filename string, d *linter.RootWalker) {
+func (s *Server) flushReports(filename string, version int, d *linter.RootWalker) {
 	diag := d.Diagnostics
+	if excludeRegex := s.linter.Config().ExcludeRegex; excludeRegex != nil && excludeRegex.MatchString(filename) {
+		diag = nil
+	}
 	if len(diag) == 0 && diag == nil {
 		diag = make([]vscode.Diagnostic, 0)
 	}
 
-	writeMessage(&methodCall{
+	s.writeMessage(&methodCall{
 		JSONRPC: "2.0",
 		Method:  "textDocument/publishDiagnostics",
 		Params: &vscode.PublishDiagnosticsParams{
 			URI:         "file://" + filename,
+			Version:     version,
 			Diagnostics: diag,
 		},
 	})
 }
 
-func closeFile(filename string) {
-	openMapMutex.Lock()
-	delete(openMap, filename)
-	openMapMutex.Unlock()
+func (s *Server) closeFile(filename string) {
+	s.openMapMutex.Lock()
+	delete(s.openMap, filename)
+	s.openMapMutex.Unlock()
 }
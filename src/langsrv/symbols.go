@@ -0,0 +1,163 @@
+package langsrv
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/setpill/noverify/src/meta"
+	"github.com/setpill/noverify/src/vscode"
+)
+
+// maxWorkspaceSymbols limits the workspace/symbol response size.
+const maxWorkspaceSymbols = 256
+
+func (s *Server) handleWorkspaceSymbol(req *baseRequest) error {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	var params vscode.WorkspaceSymbolParams
+	if err := json.Unmarshal([]byte(req.Params), &params); err != nil {
+		return err
+	}
+
+	result := make([]vscode.SymbolInformation, 0)
+	if s.metaInfo().IsIndexingComplete() {
+		result = append(result, s.findWorkspaceSymbols(params.Query)...)
+	}
+
+	return s.writeMessage(&response{
+		JSONRPC: req.JSONRPC,
+		ID:      req.ID,
+		Result:  result,
+	})
+}
+
+type scoredSymbol struct {
+	score int
+	sym   vscode.SymbolInformation
+}
+
+// findWorkspaceSymbols returns best query matches among all
+// classes, traits, functions, methods and constants.
+//
+// Symbol names are matched without namespace, unless
+// query contains a namespace separator.
+func (s *Server) findWorkspaceSymbols(query string) []vscode.SymbolInformation {
+	withNamespace := strings.Contains(query, `\`)
+	query = strings.TrimPrefix(query, `\`)
+
+	var found []scoredSymbol
+	add := func(fullName, name, container string, kind int, pos meta.ElementPosition) {
+		if pos.Filename == "" {
+			return
+		}
+		matched := name
+		if withNamespace {
+			matched = strings.TrimPrefix(fullName, `\`)
+		}
+		score, ok := fuzzyMatch(query, matched)
+		if !ok {
+			return
+		}
+		found = append(found, scoredSymbol{
+			score: score,
+			sym: vscode.SymbolInformation{
+				Name:          name,
+				Kind:          kind,
+				Location:      posToLocation(pos),
+				ContainerName: container,
+			},
+		})
+	}
+
+	addClass := func(className string, class meta.ClassInfo) {
+		add(className, baseSymbolName(className), symbolNamespace(className), vscode.SymbolKindClass, class.Pos)
+
+		for methodName, info := range class.Methods {
+			kind := vscode.SymbolKindMethod
+			if methodName == "__construct" {
+				kind = vscode.SymbolKindConstructor
+			}
+			add(className+"::"+methodName, methodName, strings.TrimPrefix(className, `\`), kind, info.Pos)
+		}
+		for constName, info := range class.Constants {
+			add(className+"::"+constName, constName, strings.TrimPrefix(className, `\`), vscode.SymbolKindConstant, info.Pos)
+		}
+	}
+	s.metaInfo().IterateClasses(addClass)
+	s.metaInfo().IterateTraits(addClass)
+
+	s.metaInfo().IterateFunctions(func(funcName string, fn meta.FuncInfo) {
+		add(funcName, baseSymbolName(funcName), symbolNamespace(funcName), vscode.SymbolKindFunction, fn.Pos)
+	})
+	s.metaInfo().IterateConstants(func(constName string, c meta.ConstantInfo) {
+		add(constName, baseSymbolName(constName), symbolNamespace(constName), vscode.SymbolKindConstant, c.Pos)
+	})
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].score != found[j].score {
+			return found[i].score > found[j].score
+		}
+		if found[i].sym.Name != found[j].sym.Name {
+			return found[i].sym.Name < found[j].sym.Name
+		}
+		return found[i].sym.ContainerName < found[j].sym.ContainerName
+	})
+	if len(found) > maxWorkspaceSymbols {
+		found = found[:maxWorkspaceSymbols]
+	}
+
+	result := make([]vscode.SymbolInformation, len(found))
+	for i, s := range found {
+		result[i] = s.sym
+	}
+	return result
+}
+
+// symbolNamespace returns a namespace part of the fully qualified name.
+func symbolNamespace(s string) string {
+	if idx := strings.LastIndexByte(s, '\\'); idx > 0 {
+		return s[1:idx]
+	}
+	return ""
+}
+
+// fuzzyMatch reports whether all query characters appear in s in the same order.
+// Characters are compared case-insensitively.
+//
+// Higher score means a better match: exact matches go first,
+// then prefix and substring matches, then subsequence matches
+// with most consecutive characters. Shorter names are preferred.
+func fuzzyMatch(query, s string) (score int, ok bool) {
+	q := strings.ToLower(query)
+	l := strings.ToLower(s)
+
+	switch {
+	case q == "":
+		return -len(l), true
+	case l == q:
+		return 3000, true
+	case strings.HasPrefix(l, q):
+		return 2000 - len(l), true
+	case strings.Contains(l, q):
+		return 1000 - len(l), true
+	}
+
+	j := 0
+	prev := -2
+	for i := 0; i < len(l) && j < len(q); i++ {
+		if l[i] != q[j] {
+			continue
+		}
+		if i == prev+1 {
+			score += 10
+		}
+		prev = i
+		j++
+	}
+	if j != len(q) {
+		return 0, false
+	}
+	return score - len(l), true
+}
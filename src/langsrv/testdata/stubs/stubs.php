@@ -0,0 +1,7 @@
+<?php
+
+/**
+ * @param string $string
+ * @return int
+ */
+function strlen($string) {}
@@ -0,0 +1,31 @@
+<?php
+
+namespace Actions;
+
+use Rename\Base;
+
+interface Walker {
+    public function walk($steps);
+}
+
+abstract class Animal {
+    /** @return string */
+    abstract public function sound();
+}
+
+class Dog extends Animal implements Walker {
+    public $legs = 4;
+}
+
+function sizes(Base $b, $n) {
+    $list = array(1, $b->size);
+    IF ($n) {
+        $list[] = $n;
+    }
+    return $list;
+}
+
+/** @return Base */
+function square() {
+    return new Square();
+}
@@ -0,0 +1,14 @@
+<?php
+
+namespace Complete;
+
+use App\Greeter;
+
+/**
+ * @param Circ $c
+ */
+function make($c) {
+    $s = new Squ();
+    $g = new Gree();
+    return [$s, $g, $c];
+}
@@ -0,0 +1,19 @@
+<?php
+
+namespace Defs;
+
+use App\Greeter;
+
+require_once __DIR__ . '/../greeter.php';
+include 'main.php';
+include dirname(__FILE__) . '/missing.php';
+
+/**
+ * @param \Rename\Square|null $s
+ * @return Greeter[]
+ */
+function makeList($s) {
+    /** @var Greeter $g */
+    $g = null;
+    return [$g, $s];
+}
@@ -0,0 +1,7 @@
+<?php
+
+namespace Deps;
+
+class Model {
+    public function save() {}
+}
@@ -0,0 +1,8 @@
+<?php
+
+namespace Deps;
+
+function store(Model $m) {
+    $m->save();
+    $m->load();
+}
@@ -0,0 +1,6 @@
+<?php
+
+function errors() {
+    echo $undefined;
+    return unknownFunction();
+}
@@ -0,0 +1,33 @@
+<?php
+
+namespace App;
+
+class Greeter {
+    /** @var string */
+    public $name = '';
+
+    /**
+     * @param string $name
+     */
+    public function __construct($name) {
+        $this->name = $name;
+    }
+
+    /** @return string */
+    public function greet() {
+        return "Hello, " . $this->name;
+    }
+
+    /** @return Greeter */
+    public static function create($name) {
+        return new Greeter($name);
+    }
+}
+
+/**
+ * @param string $s
+ * @return int
+ */
+function nameLength($s) {
+    return strlen($s);
+}
@@ -0,0 +1,26 @@
+<?php
+
+namespace Hierarchy;
+
+use Rename\Shape;
+use Rename\Square;
+
+class Circle implements Shape {
+    public function area() {
+        return 3 * $this->radius() * $this->radius();
+    }
+
+    private function radius() {
+        return 1;
+    }
+}
+
+class Cube extends Square {
+    public function area() {
+        return 6 * parent::area();
+    }
+}
+
+function total(Shape $a, Circle $c) {
+    return $a->area() + $c->area();
+}
@@ -0,0 +1,9 @@
+<?php
+
+use App\Greeter;
+
+function main() {
+    $g = Greeter::create("world");
+    echo $g->greet();
+    echo \App\nameLength($g->name);
+}
@@ -0,0 +1,44 @@
+<?php
+
+namespace Rename;
+
+interface Shape {
+    public function area();
+}
+
+class Base {
+    const SIDES = 0;
+
+    /** @var int */
+    public $size = 1;
+
+    public function __toString() {
+        return $this->describe();
+    }
+
+    public function describe() {
+        return "base";
+    }
+
+    public function scale($k) {
+        return $this->size * $k;
+    }
+
+    public function render() {
+        return "<" . $this->describe() . ">";
+    }
+}
+
+class Square extends Base implements Shape {
+    public function area() {
+        return $this->size * $this->size;
+    }
+
+    public function describe() {
+        return "square";
+    }
+
+    public function draw() {
+        return $this->render();
+    }
+}
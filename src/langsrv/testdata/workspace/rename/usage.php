@@ -0,0 +1,29 @@
+<?php
+
+namespace Rename\Usage;
+
+use Rename\Base;
+use Rename\Square;
+
+/**
+ * @param Base $b
+ * @return Square
+ */
+function grow(Base $b) {
+    $total = $b->scale(2) + $b->size + Base::SIDES;
+    $f = function ($k) use ($total) {
+        $total = $total * $k;
+        return $total;
+    };
+    $g = function () {
+        $total = 1;
+        return $total;
+    };
+    echo $f(2), $g();
+    return new Square();
+}
+
+function other() {
+    $total = 0;
+    return $total;
+}
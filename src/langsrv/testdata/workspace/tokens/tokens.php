@@ -0,0 +1,26 @@
+<?php
+
+namespace Tokens;
+
+class Point {
+    const ORIGIN = 0;
+
+    /** @var int */
+    public $x = 0;
+
+    public static function make($x) {
+        $p = new Point();
+        $p->x = $x;
+        return $p;
+    }
+}
+
+function distance(Point $a, $b) {
+    $d = $a->x . $b;
+    return strlen($d);
+}
+
+function main() {
+    $p = Point::make(Point::ORIGIN);
+    return distance($p, 2);
+}
@@ -0,0 +1,235 @@
+package langsrv
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/setpill/noverify/src/lintdebug"
+	"github.com/setpill/noverify/src/linter"
+	"github.com/setpill/noverify/src/meta"
+	"github.com/setpill/noverify/src/vscode"
+)
+
+// dependentsDelay is a delay before the dependent files are linted.
+// Every class change restarts the delay, so the files are linted
+// once the user stops typing.
+const dependentsDelay = time.Second
+
+// lintWorkspace lints all workspace files after indexing.
+func (s *Server) lintWorkspace() {
+	s.changingMutex.Lock()
+	readFiles := linter.ReadFilenames(s.analysisFiles, s.linter.Config().ExcludeRegex)
+	s.changingMutex.Unlock()
+
+	ch := make(chan linter.FileInfo)
+	go func() {
+		readFiles(ch)
+		close(ch)
+	}()
+
+	var filenames []string
+	for f := range ch {
+		filenames = append(filenames, f.Filename)
+	}
+
+	s.lintFilesMutex.Lock()
+	defer s.lintFilesMutex.Unlock()
+
+	start := time.Now()
+	s.lintFiles("Linting", filenames)
+	lintdebug.Send("Linted %d workspace files in %s", len(filenames), time.Since(start))
+}
+
+// lintFiles lints the files one by one, so other requests
+// can be handled between them.
+// lintFilesMutex must be held.
+func (s *Server) lintFiles(title string, filenames []string) {
+	p := s.startProgress(title)
+	for i, filename := range filenames {
+		s.lintWorkspaceFile(filename)
+		p.report(fmt.Sprintf("%d/%d files", i+1, len(filenames)), (i+1)*100/len(filenames))
+	}
+	p.end("")
+}
+
+// lintWorkspaceFile lints the file from disk and publishes its diagnostics.
+// Opened documents are skipped as they are analyzed separately.
+func (s *Server) lintWorkspaceFile(filename string) {
+	s.changingMutex.Lock()
+	defer s.changingMutex.Unlock()
+
+	if s.isDocumentOpened(filename) || !s.metaInfo().IsIndexingComplete() {
+		return
+	}
+
+	_, w, err := s.linter.ParseContents(filename, nil, nil)
+	if err != nil {
+		lintdebug.Send("Could not lint %s: %s", filename, err.Error())
+		return
+	}
+
+	s.setFileDeps(filename, w.ClassDeps)
+	s.flushReports(filename, 0, w)
+}
+
+// setFileDeps replaces the classes the file depends on.
+func (s *Server) setFileDeps(filename string, deps map[string]struct{}) {
+	s.depsMutex.Lock()
+	defer s.depsMutex.Unlock()
+
+	for className := range s.fileClassDeps[filename] {
+		delete(s.classDependents[className], filename)
+		if len(s.classDependents[className]) == 0 {
+			delete(s.classDependents, className)
+		}
+	}
+	delete(s.fileClassDeps, filename)
+
+	if len(deps) == 0 {
+		return
+	}
+
+	classes := make(map[string]struct{}, len(deps))
+	for className := range deps {
+		className = strings.ToLower(className)
+		classes[className] = struct{}{}
+		if s.classDependents[className] == nil {
+			s.classDependents[className] = make(map[string]struct{})
+		}
+		s.classDependents[className][filename] = struct{}{}
+	}
+	s.fileClassDeps[filename] = classes
+}
+
+// removeWorkspaceFile clears the deleted file diagnostics and dependencies.
+func (s *Server) removeWorkspaceFile(filename string) {
+	s.setFileDeps(filename, nil)
+
+	s.writeMessage(&methodCall{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params: &vscode.PublishDiagnosticsParams{
+			URI:         "file://" + filename,
+			Diagnostics: make([]vscode.Diagnostic, 0),
+		},
+	})
+}
+
+// scheduleDependents schedules linting of the files that depend on the classes.
+func (s *Server) scheduleDependents(classNames []string) {
+	var filenames []string
+
+	s.depsMutex.Lock()
+	for _, className := range classNames {
+		for filename := range s.classDependents[strings.ToLower(className)] {
+			filenames = append(filenames, filename)
+		}
+	}
+	s.depsMutex.Unlock()
+
+	s.scheduleWorkspaceFiles(filenames)
+}
+
+// scheduleWorkspaceFiles schedules linting of the files after dependentsDelay.
+// Files are linted in the background, opened documents are reanalyzed instead.
+func (s *Server) scheduleWorkspaceFiles(filenames []string) {
+	if len(filenames) == 0 {
+		return
+	}
+
+	s.pendingMutex.Lock()
+	defer s.pendingMutex.Unlock()
+
+	for _, filename := range filenames {
+		s.pendingFiles[filename] = struct{}{}
+	}
+	if s.pendingTimer != nil {
+		s.pendingTimer.Stop()
+	}
+	s.pendingTimer = time.AfterFunc(dependentsDelay, s.lintPendingFiles)
+}
+
+func (s *Server) lintPendingFiles() {
+	s.lintFilesMutex.Lock()
+	defer s.lintFilesMutex.Unlock()
+
+	s.pendingMutex.Lock()
+	filenames := make([]string, 0, len(s.pendingFiles))
+	for filename := range s.pendingFiles {
+		filenames = append(filenames, filename)
+	}
+	s.pendingFiles = make(map[string]struct{})
+	s.pendingMutex.Unlock()
+
+	if len(filenames) == 0 {
+		return
+	}
+	sort.Strings(filenames)
+
+	var closed []string
+	for _, filename := range filenames {
+		if s.isDocumentOpened(filename) {
+			s.reanalyzeDocument(filename)
+		} else {
+			closed = append(closed, filename)
+		}
+	}
+
+	s.lintFiles("Linting dependent files", closed)
+}
+
+// changedClasses returns names of the classes and traits that are added,
+// removed or changed. Positions are ignored, so moving the code around
+// doesn't affect the dependent files.
+func changedClasses(old, new meta.PerFile) []string {
+	var res []string
+	res = appendChangedClasses(res, old.Classes, new.Classes)
+	res = appendChangedClasses(res, old.Traits, new.Traits)
+	return res
+}
+
+func appendChangedClasses(res []string, old, new meta.ClassesMap) []string {
+	for className, class := range old {
+		newClass, ok := new[className]
+		if !ok || !reflect.DeepEqual(classWithoutPositions(class), classWithoutPositions(newClass)) {
+			res = append(res, className)
+		}
+	}
+	for className := range new {
+		if _, ok := old[className]; !ok {
+			res = append(res, className)
+		}
+	}
+	return res
+}
+
+// classWithoutPositions returns the class copy with all positions cleared.
+func classWithoutPositions(class meta.ClassInfo) meta.ClassInfo {
+	class.Pos = meta.ElementPosition{}
+
+	methods := make(meta.FunctionsMap, len(class.Methods))
+	for name, m := range class.Methods {
+		m.Pos = meta.ElementPosition{}
+		methods[name] = m
+	}
+	class.Methods = methods
+
+	properties := make(meta.PropertiesMap, len(class.Properties))
+	for name, p := range class.Properties {
+		p.Pos = meta.ElementPosition{}
+		properties[name] = p
+	}
+	class.Properties = properties
+
+	constants := make(meta.ConstantsMap, len(class.Constants))
+	for name, c := range class.Constants {
+		c.Pos = meta.ElementPosition{}
+		constants[name] = c
+	}
+	class.Constants = constants
+
+	return class
+}
@@ -0,0 +1,182 @@
+package layers
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Graph is a namespace dependency graph.
+//
+// It's safe to add edges from several goroutines concurrently.
+type Graph struct {
+	mu    sync.Mutex
+	edges map[string]map[string]int
+
+	// names maps the normalized namespaces to their first seen spelling,
+	// the edges are keyed by the normalized namespaces.
+	names map[string]string
+}
+
+// NewGraph returns a new empty dependency graph.
+func NewGraph() *Graph {
+	return &Graph{
+		edges: make(map[string]map[string]int),
+		names: make(map[string]string),
+	}
+}
+
+// AddEdge records a dependency of from namespace on the to namespace.
+// Namespaces are compared case-insensitively, like the layers do.
+// Self-dependencies are ignored.
+func (g *Graph) AddEdge(from, to string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	from = g.key(from)
+	to = g.key(to)
+	if from == to {
+		return
+	}
+
+	m := g.edges[from]
+	if m == nil {
+		m = make(map[string]int)
+		g.edges[from] = m
+	}
+	m[to]++
+}
+
+// key returns the normalized namespace and remembers its spelling.
+func (g *Graph) key(ns string) string {
+	key := strings.ToLower(normalizeNamespace(ns))
+	if _, ok := g.names[key]; !ok {
+		g.names[key] = normalizeNamespace(ns)
+	}
+	return key
+}
+
+// Edge is a single graph edge.
+type Edge struct {
+	From string
+	To   string
+
+	// Refs is a number of references that form this dependency.
+	Refs int
+}
+
+// Edges returns all graph edges sorted by (From, To).
+func (g *Graph) Edges() []Edge {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var res []Edge
+	for from, m := range g.edges {
+		for to, refs := range m {
+			res = append(res, Edge{From: g.names[from], To: g.names[to], Refs: refs})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].From != res[j].From {
+			return res[i].From < res[j].From
+		}
+		return res[i].To < res[j].To
+	})
+	return res
+}
+
+// Cycles returns all namespace dependency cycles.
+//
+// Every cycle is a strongly connected component of the graph
+// that contains more than one namespace. Namespaces inside
+// every cycle are sorted, so is the returned slice.
+func (g *Graph) Cycles() [][]string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Tarjan's strongly connected components algorithm.
+	var (
+		index   = make(map[string]int)
+		lowlink = make(map[string]int)
+		onStack = make(map[string]bool)
+		stack   []string
+		counter int
+		res     [][]string
+	)
+
+	var strongConnect func(v string)
+	strongConnect = func(v string) {
+		index[v] = counter
+		lowlink[v] = counter
+		counter++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range sortedTargets(g.edges[v]) {
+			if _, visited := index[w]; !visited {
+				strongConnect(w)
+				if lowlink[w] < lowlink[v] {
+					lowlink[v] = lowlink[w]
+				}
+			} else if onStack[w] && index[w] < lowlink[v] {
+				lowlink[v] = index[w]
+			}
+		}
+
+		if lowlink[v] != index[v] {
+			return
+		}
+		var component []string
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			component = append(component, g.names[w])
+			if w == v {
+				break
+			}
+		}
+		if len(component) > 1 {
+			sort.Strings(component)
+			res = append(res, component)
+		}
+	}
+
+	vertices := make([]string, 0, len(g.edges))
+	for v := range g.edges {
+		vertices = append(vertices, v)
+	}
+	sort.Strings(vertices)
+	for _, v := range vertices {
+		if _, visited := index[v]; !visited {
+			strongConnect(v)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i][0] < res[j][0]
+	})
+	return res
+}
+
+// Print writes a textual graph representation to w.
+// Every edge is printed on its own line, cycles are listed after them.
+func (g *Graph) Print(w io.Writer) {
+	for _, e := range g.Edges() {
+		fmt.Fprintf(w, "%s -> %s (%d refs)\n", e.From, e.To, e.Refs)
+	}
+	for _, c := range g.Cycles() {
+		fmt.Fprintf(w, "cycle: %v\n", c)
+	}
+}
+
+func sortedTargets(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
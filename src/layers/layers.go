@@ -0,0 +1,204 @@
+// Package layers implements architecture layer constraints.
+//
+// A layer is a named set of namespaces and/or file path globs.
+// Code that belongs to one layer may only reference symbols
+// from another layer if that dependency edge is explicitly allowed.
+package layers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Config is a parsed layers configuration.
+//
+// Config is read-only after it was created, so it can be
+// shared between the goroutines without extra synchronization.
+type Config struct {
+	Layers []*Layer
+
+	byName map[string]*Layer
+}
+
+// Layer describes a single architecture layer.
+type Layer struct {
+	// Name is a layer identifier that is used inside Allow lists.
+	Name string `json:"name"`
+
+	// Namespaces is a list of namespaces that belong to this layer.
+	// Sub-namespaces are included implicitly.
+	// Namespaces are case-insensitive, like in PHP.
+	Namespaces []string `json:"namespaces"`
+
+	// Paths is a list of file path globs that belong to this layer.
+	// `*` matches any sequence of non-separator chars, `**` matches everything.
+	// Patterns are matched against the path suffix, so "src/Domain/**"
+	// matches "/home/user/project/src/Domain/User.php".
+	Paths []string `json:"paths"`
+
+	// Allow is a list of layer names this layer may depend on.
+	// References to the symbols of the same layer are always allowed.
+	Allow []string `json:"allow"`
+
+	allow map[string]bool
+	paths []*regexp.Regexp
+
+	// namespaces are lowercased Namespaces.
+	namespaces []string
+}
+
+// configFile describes the config file schema.
+type configFile struct {
+	Layers []*Layer `json:"layers"`
+}
+
+// Parse reads JSON-encoded config from r.
+//
+// Only `layers` section is interpreted, all other sections are ignored.
+func Parse(r io.Reader) (*Config, error) {
+	var f configFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, err
+	}
+	return NewConfig(f.Layers)
+}
+
+// NewConfig validates layers definitions and returns a config that uses them.
+func NewConfig(list []*Layer) (*Config, error) {
+	c := &Config{
+		Layers: list,
+		byName: make(map[string]*Layer, len(list)),
+	}
+
+	for _, l := range list {
+		if l.Name == "" {
+			return nil, fmt.Errorf("layer without a name")
+		}
+		if _, ok := c.byName[l.Name]; ok {
+			return nil, fmt.Errorf("layer %s: duplicated definition", l.Name)
+		}
+		if len(l.Namespaces) == 0 && len(l.Paths) == 0 {
+			return nil, fmt.Errorf("layer %s: either namespaces or paths should be specified", l.Name)
+		}
+		c.byName[l.Name] = l
+
+		for i, ns := range l.Namespaces {
+			l.Namespaces[i] = normalizeNamespace(ns)
+			l.namespaces = append(l.namespaces, strings.ToLower(l.Namespaces[i]))
+		}
+		for _, p := range l.Paths {
+			re, err := compileGlob(p)
+			if err != nil {
+				return nil, fmt.Errorf("layer %s: path %q: %v", l.Name, p, err)
+			}
+			l.paths = append(l.paths, re)
+		}
+	}
+
+	for _, l := range list {
+		l.allow = make(map[string]bool, len(l.Allow))
+		for _, name := range l.Allow {
+			if _, ok := c.byName[name]; !ok {
+				return nil, fmt.Errorf("layer %s: allow: undefined layer %s", l.Name, name)
+			}
+			l.allow[name] = true
+		}
+	}
+
+	return c, nil
+}
+
+// Allows reports whether dependency from l to other is permitted.
+// Nil layers stand for the code that is not covered by any layer,
+// dependencies from and to such code are always permitted.
+func (l *Layer) Allows(other *Layer) bool {
+	if l == nil || other == nil || l == other {
+		return true
+	}
+	return l.allow[other.Name]
+}
+
+// Find returns a layer that a symbol or namespace (given by its fully
+// qualified name) belongs to. If the name is not covered by any namespace
+// prefix, filename is matched against layer path globs.
+// Namespaces are compared case-insensitively.
+//
+// When several namespaces match, the longest one wins.
+// Returns nil if nothing matched.
+func (c *Config) Find(fqn, filename string) *Layer {
+	fqn = strings.ToLower(normalizeNamespace(fqn))
+
+	var found *Layer
+	foundLen := 0
+	for _, l := range c.Layers {
+		for _, ns := range l.namespaces {
+			if len(ns) > foundLen && namespaceContains(ns, fqn) {
+				found = l
+				foundLen = len(ns)
+			}
+		}
+	}
+	if found != nil || filename == "" {
+		return found
+	}
+
+	for _, l := range c.Layers {
+		for _, re := range l.paths {
+			if re.MatchString(filename) {
+				return l
+			}
+		}
+	}
+	return nil
+}
+
+// namespaceContains reports whether name is ns itself or is nested into ns.
+func namespaceContains(ns, name string) bool {
+	if ns == `\` {
+		return true
+	}
+	return name == ns || strings.HasPrefix(name, ns+`\`)
+}
+
+// normalizeNamespace converts ns into `\A\B` form.
+func normalizeNamespace(ns string) string {
+	return `\` + strings.Trim(ns, `\`)
+}
+
+// NamespaceOf returns a namespace part of the fully qualified symbol name.
+// For `\A\B\C` it returns `\A\B`, for `\C` it returns `\`.
+func NamespaceOf(fqn string) string {
+	idx := strings.LastIndexByte(fqn, '\\')
+	if idx <= 0 {
+		return `\`
+	}
+	return fqn[:idx]
+}
+
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	pattern = strings.TrimPrefix(pattern, "./")
+
+	var buf strings.Builder
+	buf.WriteString(`(?:^|/)`)
+	for i := 0; i < len(pattern); i++ {
+		switch ch := pattern[i]; ch {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				buf.WriteString(`.*`)
+				i++
+			} else {
+				buf.WriteString(`[^/]*`)
+			}
+		case '?':
+			buf.WriteString(`[^/]`)
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	buf.WriteString(`$`)
+
+	return regexp.Compile(buf.String())
+}
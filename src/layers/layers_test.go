@@ -0,0 +1,105 @@
+package layers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	config, err := Parse(strings.NewReader(`{
+  "layers": [
+    {"name": "App", "namespaces": ["App"]},
+    {"name": "Domain", "namespaces": ["\\App\\Domain\\"]},
+    {"name": "Legacy", "paths": ["lib/**/*.php"]}
+  ]
+}`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	tests := []struct {
+		fqn      string
+		filename string
+		want     string
+	}{
+		{`\App\Foo`, "", "App"},
+		{`\App`, "", "App"},
+		{`\Application\Foo`, "", ""},
+		{`\App\Domain\User`, "", "Domain"},
+		{`\App\Domain`, "", "Domain"},
+		{`\App\DomainX\User`, "", "App"},
+		{`\app\domain\User`, "", "Domain"},
+		{`\APP\Foo`, "", "App"},
+		{`\Foo`, "/home/user/project/lib/a/b/Foo.php", "Legacy"},
+		{`\Foo`, "/home/user/project/mylib/Foo.php", ""},
+		{`\App\Foo`, "/home/user/project/lib/Foo.php", "App"},
+	}
+
+	for _, test := range tests {
+		have := ""
+		if l := config.Find(test.fqn, test.filename); l != nil {
+			have = l.Name
+		}
+		if have != test.want {
+			t.Errorf("Find(%q, %q): have %q, want %q", test.fqn, test.filename, have, test.want)
+		}
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{`{"layers": [{"namespaces": ["A"]}]}`, `layer without a name`},
+		{`{"layers": [{"name": "A"}]}`, `layer A: either namespaces or paths should be specified`},
+		{`{"layers": [{"name": "A", "namespaces": ["A"]}, {"name": "A", "namespaces": ["B"]}]}`, `layer A: duplicated definition`},
+		{`{"layers": [{"name": "A", "namespaces": ["A"], "allow": ["B"]}]}`, `layer A: allow: undefined layer B`},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(strings.NewReader(test.config))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("Parse(%s): have %v error, want %q", test.config, err, test.err)
+		}
+	}
+}
+
+func TestCycles(t *testing.T) {
+	g := NewGraph()
+	g.AddEdge(`\A`, `\B`)
+	g.AddEdge(`\B`, `\A`)
+	g.AddEdge(`\B`, `\C`)
+	g.AddEdge(`\C`, `\C`)
+	g.AddEdge(`\D`, `\E`)
+	g.AddEdge(`\E`, `\F`)
+	g.AddEdge(`\F`, `\D`)
+
+	want := [][]string{
+		{`\A`, `\B`},
+		{`\D`, `\E`, `\F`},
+	}
+	if have := g.Cycles(); !reflect.DeepEqual(have, want) {
+		t.Errorf("cycles mismatch:\nhave: %v\nwant: %v", have, want)
+	}
+}
+
+func TestGraphCase(t *testing.T) {
+	g := NewGraph()
+	g.AddEdge(`\App\Domain`, `\App\Infra`)
+	g.AddEdge(`\app\domain`, `\APP\INFRA`)
+	g.AddEdge(`\App\Infra`, `\app\domain`)
+	g.AddEdge(`\App\Domain`, `\app\domain`)
+
+	want := []Edge{
+		{From: `\App\Domain`, To: `\App\Infra`, Refs: 2},
+		{From: `\App\Infra`, To: `\App\Domain`, Refs: 1},
+	}
+	if have := g.Edges(); !reflect.DeepEqual(have, want) {
+		t.Errorf("edges mismatch:\nhave: %v\nwant: %v", have, want)
+	}
+	if have := g.Cycles(); !reflect.DeepEqual(have, [][]string{{`\App\Domain`, `\App\Infra`}}) {
+		t.Errorf("cycles mismatch: %v", have)
+	}
+}
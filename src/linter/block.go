@@ -54,6 +54,8 @@ type BlockWalker struct {
 
 	r *RootWalker
 
+	linter *Linter
+
 	custom []BlockChecker
 
 	ignoreFunctionBodies bool
@@ -73,6 +75,10 @@ type BlockWalker struct {
 	// shared state between all blocks
 	unusedVars   map[string][]node.Node
 	nonLocalVars map[string]struct{} // static, global and other vars that have complex control flow
+
+	// phpdocVars contains the variables that are declared by @var, but not yet assigned.
+	// Their first assignments are recorded as definitions, it's only used in language server mode.
+	phpdocVars map[string]struct{}
 }
 
 func (b *BlockWalker) addStatement(n node.Node) {
@@ -121,7 +127,7 @@ func (b *BlockWalker) reportDeadCode(n node.Node) {
 }
 
 func (b *BlockWalker) checkRedundantCastArray(e node.Node) {
-	if !meta.IsIndexingComplete() {
+	if !b.linter.info.IsIndexingComplete() {
 		return
 	}
 	typ := solver.ExprType(b.ctx.sc, b.r.st, e)
@@ -131,7 +137,7 @@ func (b *BlockWalker) checkRedundantCastArray(e node.Node) {
 }
 
 func (b *BlockWalker) checkRedundantCast(e node.Node, dstType string) {
-	if !meta.IsIndexingComplete() {
+	if !b.linter.info.IsIndexingComplete() {
 		return
 	}
 	typ := solver.ExprType(b.ctx.sc, b.r.st, e)
@@ -175,7 +181,7 @@ func (b *BlockWalker) EnterNode(w walker.Walkable) (res bool) {
 	if ffs := n.GetFreeFloating(); ffs != nil {
 		for _, cs := range *ffs {
 			for _, c := range cs {
-				b.parseComment(c)
+				b.parseComment(n, c)
 			}
 		}
 	}
@@ -324,6 +330,10 @@ func (b *BlockWalker) EnterNode(w walker.Walkable) (res bool) {
 	case *expr.New:
 		res = b.handleNew(s)
 		b.r.checkKeywordCase(s, "new")
+	case *expr.InstanceOf:
+		if b.linter.info.IsIndexingComplete() {
+			b.r.reportClassNameDependency(s.Class)
+		}
 	case *stmt.Unset:
 		res = b.handleUnset(s)
 	case *expr.Isset:
@@ -391,13 +401,13 @@ func (b *BlockWalker) EnterNode(w walker.Walkable) (res bool) {
 		c.AfterEnterNode(w)
 	}
 
-	if meta.IsIndexingComplete() && b.r.anyRset != nil {
+	if b.linter.info.IsIndexingComplete() && b.r.anyRset != nil {
 		// Note: no need to check localRset for nil.
 		kind := rules.CategorizeNode(n)
 		if kind != rules.KindNone {
-			b.r.runRules(n, b.ctx.sc, b.r.anyRset.RulesByKind[kind])
+			b.r.runRules(n, b.ctx, b.r.anyRset.RulesByKind[kind])
 			if !b.rootLevel {
-				b.r.runRules(n, b.ctx.sc, b.r.localRset.RulesByKind[kind])
+				b.r.runRules(n, b.ctx, b.r.localRset.RulesByKind[kind])
 			}
 		}
 	}
@@ -405,6 +415,22 @@ func (b *BlockWalker) EnterNode(w walker.Walkable) (res bool) {
 	return res
 }
 
+// runSeqRules runs statement sequence rules over the stmts block.
+//
+// It's called after the block is walked, so the variables
+// that are defined inside the block have their types inferred.
+func (b *BlockWalker) runSeqRules(stmts []node.Node) {
+	if !b.linter.info.IsIndexingComplete() || b.r.anyRset == nil || len(stmts) == 0 {
+		return
+	}
+	b.r.runSeqRules(stmts, b.ctx, b.r.anyRset.RulesByKind[rules.KindSequence])
+	if b.rootLevel {
+		b.r.runSeqRules(stmts, b.ctx, b.r.rootRset.RulesByKind[rules.KindSequence])
+	} else {
+		b.r.runSeqRules(stmts, b.ctx, b.r.localRset.RulesByKind[rules.KindSequence])
+	}
+}
+
 func (b *BlockWalker) handleFunction(fun *stmt.Function) bool {
 	if b.ignoreFunctionBodies {
 		return false
@@ -458,8 +484,11 @@ func (b *BlockWalker) addNonLocalVar(v node.Node) {
 
 // replaceVar must be used to track assignments to conrete var nodes if they are available
 func (b *BlockWalker) replaceVar(v node.Node, typ meta.TypesMap, reason string, alwaysDefined bool) {
-	b.ctx.sc.ReplaceVar(v, typ, reason, alwaysDefined)
 	sv, ok := v.(*node.SimpleVar)
+	if ok {
+		b.trackVarDef(v, sv.Name, reason)
+	}
+	b.ctx.sc.ReplaceVar(v, typ, reason, alwaysDefined)
 	if !ok {
 		return
 	}
@@ -491,22 +520,40 @@ func (b *BlockWalker) trackVarName(n node.Node, nm string) {
 	}
 }
 
+// trackVarDef records the variable definition if the variable is not yet defined in the current scope.
+// Variables that are added by isset and empty checks are not definitions.
+func (b *BlockWalker) trackVarDef(n node.Node, nm, reason string) {
+	if reason == "isset" || reason == "!empty" {
+		return
+	}
+	if _, ok := b.phpdocVars[nm]; ok {
+		delete(b.phpdocVars, nm)
+	} else if b.ctx.sc.MaybeHaveVarName(nm) {
+		return
+	}
+	b.r.addVarDef(n)
+}
+
 func (b *BlockWalker) addVarName(n node.Node, nm string, typ meta.TypesMap, reason string, alwaysDefined bool) {
+	b.trackVarDef(n, nm, reason)
 	b.ctx.sc.AddVarName(nm, typ, reason, alwaysDefined)
 	b.trackVarName(n, nm)
 }
 
 // addVar must be used to track assignments to conrete var nodes if they are available
 func (b *BlockWalker) addVar(v node.Node, typ meta.TypesMap, reason string, alwaysDefined bool) {
-	b.ctx.sc.AddVar(v, typ, reason, alwaysDefined)
 	sv, ok := v.(*node.SimpleVar)
+	if ok {
+		b.trackVarDef(v, sv.Name, reason)
+	}
+	b.ctx.sc.AddVar(v, typ, reason, alwaysDefined)
 	if !ok {
 		return
 	}
 	b.trackVarName(v, sv.Name)
 }
 
-func (b *BlockWalker) parseComment(c freefloating.String) {
+func (b *BlockWalker) parseComment(n node.Node, c freefloating.String) {
 	if c.StringType != freefloating.CommentType {
 		return
 	}
@@ -536,7 +583,17 @@ func (b *BlockWalker) parseComment(c freefloating.String) {
 		}
 
 		m := meta.NewTypesMap(b.r.normalizeType(typ))
-		b.ctx.sc.AddVarFromPHPDoc(strings.TrimPrefix(varName, "$"), m, "@var")
+		if b.linter.info.IsIndexingComplete() {
+			b.r.reportTypesDependency(n, m)
+		}
+		varName = strings.TrimPrefix(varName, "$")
+		if b.linter.config.LangServer && !b.ctx.sc.MaybeHaveVarName(varName) {
+			if b.phpdocVars == nil {
+				b.phpdocVars = make(map[string]struct{})
+			}
+			b.phpdocVars[varName] = struct{}{}
+		}
+		b.ctx.sc.AddVarFromPHPDoc(varName, m, "@var")
 	}
 }
 
@@ -648,6 +705,7 @@ func (b *BlockWalker) handleTry(s *stmt.Try) bool {
 				b.addStatement(s)
 			}
 			s.Finally.Walk(b)
+			b.runSeqRules(cc.Stmts)
 		})
 	}
 
@@ -666,11 +724,13 @@ func (b *BlockWalker) handleTry(s *stmt.Try) bool {
 	}
 
 	ctx := b.withNewContext(func() {
+		b.ctx.insideTry = true
 		for _, s := range s.Stmts {
 			b.addStatement(s)
 			s.Walk(b)
 			b.r.addScope(s, b.ctx.sc)
 		}
+		b.runSeqRules(s.Stmts)
 	})
 
 	ctx.sc.Iterate(func(varName string, typ meta.TypesMap, alwaysDefined bool) {
@@ -695,6 +755,7 @@ func (b *BlockWalker) handleCatch(s *stmt.Catch) bool {
 			continue
 		}
 		m = m.AppendString(typ)
+		b.r.reportDependency(t, depClass, typ)
 	}
 
 	b.handleVariableNode(s.Variable, m, "catch")
@@ -705,6 +766,7 @@ func (b *BlockWalker) handleCatch(s *stmt.Catch) bool {
 			stmt.Walk(b)
 		}
 	}
+	b.runSeqRules(s.Stmts)
 
 	return false
 }
@@ -730,7 +792,7 @@ func (b *BlockWalker) handleIssetDimFetch(e *expr.ArrayDimFetch) {
 }
 
 func (b *BlockWalker) checkArrayDimFetch(s *expr.ArrayDimFetch) {
-	if !meta.IsIndexingComplete() {
+	if !b.linter.info.IsIndexingComplete() {
 		return
 	}
 
@@ -746,7 +808,7 @@ func (b *BlockWalker) checkArrayDimFetch(s *expr.ArrayDimFetch) {
 		if len(t) > 0 && t[0] == '\\' && !strings.HasSuffix(t, "[]") {
 			maybeHaveClasses = true
 
-			if !haveArrayAccess && solver.Implements(t, `\ArrayAccess`) {
+			if !haveArrayAccess && solver.Implements(b.linter.info, t, `\ArrayAccess`) {
 				haveArrayAccess = true
 			}
 		}
@@ -816,13 +878,15 @@ func (b *BlockWalker) handleCallArgs(n node.Node, args []node.Node, fn meta.Func
 func (b *BlockWalker) handleFunctionCall(e *expr.FunctionCall) bool {
 	call := resolveFunctionCall(b.ctx.sc, b.r.st, b.ctx.customTypes, e)
 
-	if meta.IsIndexingComplete() {
+	if b.linter.info.IsIndexingComplete() {
 		if !call.canAnalyze {
 			return true
 		}
 
 		if !call.defined {
 			b.r.Report(e.Function, LevelError, "undefined", "Call to undefined function %s", meta.NameNodeToString(e.Function))
+		} else {
+			b.r.reportDependency(e.Function, depFunction, call.fqName)
 		}
 	}
 
@@ -901,7 +965,7 @@ func (b *BlockWalker) canAccess(className string, accessLevel meta.AccessLevel)
 				return true
 			}
 
-			class, ok := meta.Info.GetClass(parent)
+			class, ok := b.linter.info.GetClass(parent)
 			if !ok {
 				return false
 			}
@@ -918,7 +982,7 @@ func (b *BlockWalker) canAccess(className string, accessLevel meta.AccessLevel)
 }
 
 func (b *BlockWalker) handleMethodCall(e *expr.MethodCall) bool {
-	if !meta.IsIndexingComplete() {
+	if !b.linter.info.IsIndexingComplete() {
 		return true
 	}
 
@@ -941,8 +1005,8 @@ func (b *BlockWalker) handleMethodCall(e *expr.MethodCall) bool {
 	exprType := solver.ExprTypeCustom(b.ctx.sc, b.r.st, e.Variable, b.ctx.customTypes)
 
 	exprType.Find(func(typ string) bool {
-		fn, implClass, foundMethod = solver.FindMethod(typ, methodName)
-		magic = haveMagicMethod(typ, `__call`)
+		fn, implClass, foundMethod = solver.FindMethod(b.linter.info, typ, methodName)
+		magic = haveMagicMethod(b.linter.info, typ, `__call`)
 		return foundMethod || magic
 	})
 
@@ -980,7 +1044,7 @@ func (b *BlockWalker) handleMethodCall(e *expr.MethodCall) bool {
 }
 
 func (b *BlockWalker) handleStaticCall(e *expr.StaticCall) bool {
-	if !meta.IsIndexingComplete() {
+	if !b.linter.info.IsIndexingComplete() {
 		return true
 	}
 
@@ -997,13 +1061,14 @@ func (b *BlockWalker) handleStaticCall(e *expr.StaticCall) bool {
 	if !ok {
 		return true
 	}
+	b.r.reportDependency(e.Class, depClass, className)
 
-	fn, implClass, ok := solver.FindMethod(className, methodName)
+	fn, implClass, ok := solver.FindMethod(b.linter.info, className, methodName)
 
 	e.Class.Walk(b)
 	e.Call.Walk(b)
 
-	magic := haveMagicMethod(className, `__callStatic`)
+	magic := haveMagicMethod(b.linter.info, className, `__callStatic`)
 	if !ok && !magic && !b.r.st.IsTrait {
 		b.r.Report(e.Call, LevelError, "undefined", "Call to undefined method %s::%s()", className, methodName)
 	} else {
@@ -1043,7 +1108,7 @@ func (b *BlockWalker) handlePropertyFetch(e *expr.PropertyFetch) bool {
 	e.Variable.Walk(b)
 	e.Property.Walk(b)
 
-	if !meta.IsIndexingComplete() {
+	if !b.linter.info.IsIndexingComplete() {
 		return false
 	}
 
@@ -1059,8 +1124,8 @@ func (b *BlockWalker) handlePropertyFetch(e *expr.PropertyFetch) bool {
 
 	typ := solver.ExprTypeCustom(b.ctx.sc, b.r.st, e.Variable, b.ctx.customTypes)
 	typ.Find(func(className string) bool {
-		info, implClass, found = solver.FindProperty(className, id.Value)
-		magic = haveMagicMethod(className, `__get`)
+		info, implClass, found = solver.FindProperty(b.linter.info, className, id.Value)
+		magic = haveMagicMethod(b.linter.info, className, `__get`)
 		return found || magic
 	})
 
@@ -1078,7 +1143,7 @@ func (b *BlockWalker) handlePropertyFetch(e *expr.PropertyFetch) bool {
 func (b *BlockWalker) handleStaticPropertyFetch(e *expr.StaticPropertyFetch) bool {
 	e.Class.Walk(b)
 
-	if !meta.IsIndexingComplete() {
+	if !b.linter.info.IsIndexingComplete() {
 		return false
 	}
 
@@ -1093,8 +1158,9 @@ func (b *BlockWalker) handleStaticPropertyFetch(e *expr.StaticPropertyFetch) boo
 	if !ok {
 		return false
 	}
+	b.r.reportDependency(e.Class, depClass, className)
 
-	info, implClass, ok := solver.FindProperty(className, "$"+sv.Name)
+	info, implClass, ok := solver.FindProperty(b.linter.info, className, "$"+sv.Name)
 	if !ok && !b.r.st.IsTrait {
 		b.r.Report(e.Property, LevelError, "undefined", "Property %s::$%s does not exist", className, sv.Name)
 	}
@@ -1163,7 +1229,7 @@ func (b *BlockWalker) handleArrayItems(arr node.Node, items []*expr.ArrayItem) b
 }
 
 func (b *BlockWalker) handleClassConstFetch(e *expr.ClassConstFetch) bool {
-	if !meta.IsIndexingComplete() {
+	if !b.linter.info.IsIndexingComplete() {
 		return true
 	}
 
@@ -1176,8 +1242,9 @@ func (b *BlockWalker) handleClassConstFetch(e *expr.ClassConstFetch) bool {
 	if !ok {
 		return false
 	}
+	b.r.reportDependency(e.Class, depClass, className)
 
-	info, implClass, ok := solver.FindConstant(className, constName.Value)
+	info, implClass, ok := solver.FindConstant(b.linter.info, className, constName.Value)
 
 	e.Class.Walk(b)
 
@@ -1193,13 +1260,15 @@ func (b *BlockWalker) handleClassConstFetch(e *expr.ClassConstFetch) bool {
 }
 
 func (b *BlockWalker) handleConstFetch(e *expr.ConstFetch) bool {
-	if !meta.IsIndexingComplete() {
+	if !b.linter.info.IsIndexingComplete() {
 		return true
 	}
 
-	_, _, defined := solver.GetConstant(b.r.st, e.Constant)
+	constName, _, defined := solver.GetConstant(b.r.st, e.Constant)
 
-	if !defined {
+	if defined {
+		b.r.reportDependency(e.Constant, depConstant, constName)
+	} else {
 		// If it's builtin constant, give a more precise report message.
 		switch nm := meta.NameNodeToString(e.Constant); strings.ToLower(nm) {
 		case "null", "true", "false":
@@ -1223,7 +1292,7 @@ func (b *BlockWalker) handleNew(e *expr.New) bool {
 		return false
 	}
 
-	if !meta.IsIndexingComplete() {
+	if !b.linter.info.IsIndexingComplete() {
 		return true
 	}
 
@@ -1244,12 +1313,13 @@ func (b *BlockWalker) handleNew(e *expr.New) bool {
 		return true
 	}
 
-	if _, ok := meta.Info.GetClass(className); !ok {
+	if _, ok := b.linter.info.GetClass(className); !ok {
 		b.r.Report(e.Class, LevelError, "undefined", "Class not found %s", className)
 	}
+	b.r.reportDependency(e.Class, depClass, className)
 
 	// Check implicitly invoked constructor method arguments count.
-	ctor, _, ok := solver.FindMethod(className, "__construct")
+	ctor, _, ok := solver.FindMethod(b.linter.info, className, "__construct")
 	if !ok {
 		return true
 	}
@@ -1347,6 +1417,7 @@ func (b *BlockWalker) enterClosure(fun *expr.Closure, haveThis bool, thisType me
 
 	doc := b.r.parsePHPDoc(fun.PhpDocComment, fun.Params)
 	b.r.reportPhpdocErrors(fun, doc.errs)
+	b.r.reportReturnTypeDependency(fun, fun.ReturnType, doc.returnType)
 	phpDocParamTypes := doc.types
 
 	var closureUses []node.Node
@@ -1716,6 +1787,7 @@ func (b *BlockWalker) handleSwitch(s *stmt.Switch) bool {
 					s.Walk(b)
 				}
 			}
+			b.runSeqRules(list)
 
 			// allow to omit "break;" in the final statement
 			if idx != len(s.CaseList.Cases)-1 && b.ctx.exitFlags == 0 {
@@ -1861,7 +1933,7 @@ func (b *BlockWalker) ReportBitwiseOp(s node.Node, op string, rightOp string) {
 }
 
 func (b *BlockWalker) handleStmtExpression(s *stmt.Expression) {
-	if !meta.IsIndexingComplete() {
+	if !b.linter.info.IsIndexingComplete() {
 		return
 	}
 
@@ -1964,13 +2036,13 @@ func (b *BlockWalker) handleAssign(a *assign.Assign) bool {
 }
 
 func (b *BlockWalker) flushUnused() {
-	if !meta.IsIndexingComplete() {
+	if !b.linter.info.IsIndexingComplete() {
 		return
 	}
 
 	visitedMap := make(map[node.Node]struct{})
 	for name, nodes := range b.unusedVars {
-		if IsDiscardVar(name) {
+		if b.linter.config.IsDiscardVar(name) {
 			// blank identifier is a way to tell linter (and PHPStorm) that result is explicitly unused
 			continue
 		}
@@ -2014,6 +2086,13 @@ func (b *BlockWalker) LeaveNode(w walker.Walkable) {
 		c.BeforeLeaveNode(w)
 	}
 
+	switch s := w.(type) {
+	case *node.Root:
+		b.runSeqRules(s.Stmts)
+	case *stmt.StmtList:
+		b.runSeqRules(s.Stmts)
+	}
+
 	if b.ctx.exitFlags == 0 {
 		switch w.(type) {
 		case *stmt.Return:
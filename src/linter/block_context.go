@@ -23,7 +23,9 @@ type blockContext struct {
 	// insideLoop is true if any number of statements above there is enclosing loop.
 	// innermostLoop is not enough for this, since we can be inside switch while
 	// having for loop outside of that switch.
-	insideLoop  bool
+	insideLoop bool
+	// insideTry is true if there is an enclosing try block.
+	insideTry   bool
 	customTypes []solver.CustomType
 }
 
@@ -36,5 +38,6 @@ func copyBlockContext(ctx *blockContext) *blockContext {
 		customTypes:   append([]solver.CustomType{}, ctx.customTypes...),
 		innermostLoop: ctx.innermostLoop,
 		insideLoop:    ctx.insideLoop,
+		insideTry:     ctx.insideTry,
 	}
 }
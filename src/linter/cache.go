@@ -27,7 +27,10 @@ import (
 //     32 - replaced Static:bool with Flags:uint8 in meta.FuncInfo
 //     33 - support parsing of array<k,v> and list<type>
 //     34 - support parsing of ?ClassName as "ClassName|null"
-const cacheVersion = 34
+//     35 - added Default field to meta.FuncParam
+//     36 - added IsVariadic field to meta.FuncParam, FuncAbstract and FuncReturnHint flags
+//     37 - added Flags field to meta.ClassInfo, interfaces without methods are indexed
+const cacheVersion = 37
 
 var (
 	errWrongVersion = errors.New("Wrong cache version")
@@ -47,10 +50,15 @@ type fileMeta struct {
 
 // IndexFile parses the file and fills in the meta info. Can use cache.
 func IndexFile(filename string, contents []byte) error {
-	if CacheDir == "" {
-		_, w, err := ParseContents(filename, contents, nil)
+	return DefaultLinter().IndexFile(filename, contents)
+}
+
+// IndexFile parses the file and fills in the linter index. Can use cache.
+func (l *Linter) IndexFile(filename string, contents []byte) error {
+	if l.config.CacheDir == "" {
+		_, w, err := l.ParseContents(filename, contents, nil)
 		if w != nil {
-			updateMetaInfo(filename, &w.meta)
+			l.updateMetaInfo(filename, &w.meta)
 		}
 		return err
 	}
@@ -82,12 +90,12 @@ func IndexFile(filename string, contents []byte) error {
 		cacheFilenamePart = filename[0:1] + "_" + filename[2:]
 	}
 
-	cacheFile := filepath.Join(CacheDir, cacheFilenamePart+"."+contentsHash)
+	cacheFile := filepath.Join(l.config.CacheDir, cacheFilenamePart+"."+contentsHash)
 
 	start := time.Now()
 	fp, err := os.Open(cacheFile)
 	if err != nil {
-		_, w, err := ParseContents(filename, contents, nil)
+		_, w, err := l.ParseContents(filename, contents, nil)
 		if err != nil {
 			return err
 		}
@@ -96,11 +104,11 @@ func IndexFile(filename string, contents []byte) error {
 	}
 	defer fp.Close()
 
-	if err := restoreMetaFromCache(filename, fp); err != nil {
+	if err := l.restoreMetaFromCache(filename, fp); err != nil {
 		// do not really care about why exactly reading from cache failed
 		os.Remove(cacheFile)
 
-		_, w, err := ParseContents(filename, contents, nil)
+		_, w, err := l.ParseContents(filename, contents, nil)
 		if err != nil {
 			return err
 		}
@@ -158,13 +166,13 @@ func createMetaCacheFile(filename, cacheFile string, root *RootWalker) error {
 
 	// if using cache, this is the only proper place to update meta info:
 	// after all cache meta info was successfully written to disk
-	updateMetaInfo(filename, &root.meta)
+	root.linter.updateMetaInfo(filename, &root.meta)
 	return nil
 }
 
-func readMetaCache(r io.Reader, filename string, dst *fileMeta) error {
+func (l *Linter) readMetaCache(r io.Reader, filename string, dst *fileMeta) error {
 	bufrd := bufio.NewReader(r)
-	if err := readMetaCacheHeader(bufrd); err != nil {
+	if err := l.readMetaCacheHeader(bufrd); err != nil {
 		return err
 	}
 
@@ -172,41 +180,41 @@ func readMetaCache(r io.Reader, filename string, dst *fileMeta) error {
 	if err := dec.Decode(dst); err != nil {
 		return err
 	}
-	if err := customCachersDecode(filename, bufrd); err != nil {
+	if err := l.customCachersDecode(filename, bufrd); err != nil {
 		return err
 	}
 	return nil
 }
 
-func restoreMetaFromCache(filename string, rd io.Reader) error {
+func (l *Linter) restoreMetaFromCache(filename string, rd io.Reader) error {
 	var m fileMeta
-	if err := readMetaCache(rd, filename, &m); err != nil {
+	if err := l.readMetaCache(rd, filename, &m); err != nil {
 		return err
 	}
 
-	updateMetaInfo(filename, &m)
+	l.updateMetaInfo(filename, &m)
 	return nil
 }
 
-func updateMetaInfo(filename string, m *fileMeta) {
-	if meta.IsIndexingComplete() {
+func (l *Linter) updateMetaInfo(filename string, m *fileMeta) {
+	if l.info.IsIndexingComplete() {
 		panic("Trying to update meta info when not indexing")
 	}
 
-	meta.Info.Lock()
-	defer meta.Info.Unlock()
+	l.info.Lock()
+	defer l.info.Unlock()
 
-	meta.Info.DeleteMetaForFileNonLocked(filename)
+	l.info.DeleteMetaForFileNonLocked(filename)
 
-	meta.Info.AddFilenameNonLocked(filename)
-	meta.Info.AddClassesNonLocked(filename, m.Classes)
-	meta.Info.AddTraitsNonLocked(filename, m.Traits)
-	meta.Info.AddFunctionsNonLocked(filename, m.Functions)
-	meta.Info.AddConstantsNonLocked(filename, m.Constants)
-	meta.Info.AddFunctionsOverridesNonLocked(filename, m.FunctionOverrides)
+	l.info.AddFilenameNonLocked(filename)
+	l.info.AddClassesNonLocked(filename, m.Classes)
+	l.info.AddTraitsNonLocked(filename, m.Traits)
+	l.info.AddFunctionsNonLocked(filename, m.Functions)
+	l.info.AddConstantsNonLocked(filename, m.Constants)
+	l.info.AddFunctionsOverridesNonLocked(filename, m.FunctionOverrides)
 
 	if m.Scope != nil {
-		meta.Info.AddToGlobalScopeNonLocked(filename, m.Scope)
+		l.info.AddToGlobalScopeNonLocked(filename, m.Scope)
 	}
 }
 
@@ -216,7 +224,7 @@ func writeMetaCacheHeader(wr *bufio.Writer, root *RootWalker) error {
 	}
 
 	for i := range root.custom {
-		cacher := metaCachers[i]
+		cacher := root.linter.metaCachers[i]
 		if cacher == nil {
 			continue
 		}
@@ -237,7 +245,7 @@ func writeMetaCacheHeader(wr *bufio.Writer, root *RootWalker) error {
 
 func customCachersEncode(wr *bufio.Writer, root *RootWalker) error {
 	for i, c := range root.custom {
-		cacher := metaCachers[i]
+		cacher := root.linter.metaCachers[i]
 		if cacher == nil {
 			continue
 		}
@@ -249,7 +257,7 @@ func customCachersEncode(wr *bufio.Writer, root *RootWalker) error {
 	return nil
 }
 
-func readMetaCacheHeader(rd *bufio.Reader) error {
+func (l *Linter) readMetaCacheHeader(rd *bufio.Reader) error {
 	ver, err := rd.ReadByte()
 	if err != nil {
 		return err
@@ -260,7 +268,7 @@ func readMetaCacheHeader(rd *bufio.Reader) error {
 	}
 
 	var versionBuf [256]byte
-	for _, cacher := range metaCachers {
+	for _, cacher := range l.metaCachers {
 		if cacher == nil {
 			continue
 		}
@@ -282,8 +290,8 @@ func readMetaCacheHeader(rd *bufio.Reader) error {
 	return nil
 }
 
-func customCachersDecode(filename string, rd *bufio.Reader) error {
-	for _, cacher := range metaCachers {
+func (l *Linter) customCachersDecode(filename string, rd *bufio.Reader) error {
+	for _, cacher := range l.metaCachers {
 		if cacher == nil {
 			continue
 		}
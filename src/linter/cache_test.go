@@ -99,7 +99,7 @@ main();
 		//
 		// If cache encoding changes, there is a very high chance that
 		// encoded data lengh will change as well.
-		wantLen := 2804
+		wantLen := 2845
 		haveLen := buf.Len()
 		if haveLen != wantLen {
 			t.Errorf("cache len mismatch:\nhave: %d\nwant: %d", haveLen, wantLen)
@@ -108,7 +108,7 @@ main();
 		// 2. Check cache "strings" hash.
 		//
 		// It catches new fields in cached types, field renames and encoding of additional named attributes.
-		wantStrings := "ded0f69ce9bbe287f3bc00199198587cf00efc031f5d38d1ef456dd3af19fde16d52682644d293a752e35697acbabcfc191218fd271eff34a0f76911cd255221"
+		wantStrings := "ef14952d4d2c5c5a269487aec654bdbc1be7ae2f9d17c471040b65c0c4021beca6c5b41374b82d2a3fbf852a20a2035fd3554b2904d9cba78c1ce7d001663db2"
 		haveStrings := collectCacheStrings(buf.String())
 		if haveStrings != wantStrings {
 			t.Errorf("cache strings mismatch:\nhave: %q\nwant: %q", haveStrings, wantStrings)
@@ -119,7 +119,7 @@ main();
 		// If it fails, encoding and/or decoding is broken.
 		encodedMeta := &root.meta
 		decodedMeta := &fileMeta{}
-		if err := readMetaCache(bytes.NewReader(buf.Bytes()), "", decodedMeta); err != nil {
+		if err := root.linter.readMetaCache(bytes.NewReader(buf.Bytes()), "", decodedMeta); err != nil {
 			t.Errorf("decoding failed: %v", err)
 		} else {
 			// TODO: due to lots of important unexported fields,
@@ -5,8 +5,11 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/setpill/noverify/src/dupcode"
 	"github.com/setpill/noverify/src/inputs"
+	"github.com/setpill/noverify/src/layers"
 	"github.com/setpill/noverify/src/rules"
+	"github.com/setpill/noverify/src/vscode"
 )
 
 var (
@@ -26,6 +29,27 @@ var (
 	// Rules is a set of dynamically loaded linter diagnostics.
 	Rules = &rules.Set{}
 
+	// Layers is a set of architecture layer constraints.
+	// Nil value disables layers checking.
+	Layers *layers.Config
+
+	// DepsGraph collects namespace dependencies during the analysis.
+	// Nil value disables dependencies collection.
+	DepsGraph *layers.Graph
+
+	// DupCode collects statement sequences for the clones detection.
+	// Nil value disables clones detection.
+	DupCode *dupcode.Index
+
+	// ExternalCheckers is a list of running out-of-process checkers.
+	// Every analyzed file is sent to all of them.
+	ExternalCheckers []*ExternalChecker
+
+	// ExternalCheckerTimeout limits every request to the external checkers.
+	// A checker that doesn't respond in time is killed and is not used anymore.
+	// Zero value disables the limit.
+	ExternalCheckerTimeout = 30 * time.Second
+
 	// settings
 	StubsDir        string
 	Debug           bool
@@ -41,6 +65,11 @@ var (
 
 	IsDiscardVar = isUnderscore
 
+	// DiagnosticFilter is called for every diagnostic in language server mode.
+	// It may change the diagnostic severity or drop it by returning false.
+	// Nil value keeps all diagnostics.
+	DiagnosticFilter func(diag *vscode.Diagnostic) bool
+
 	ExcludeRegex *regexp.Regexp
 
 	// actually time.Duration
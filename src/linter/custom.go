@@ -8,6 +8,7 @@ import (
 	"github.com/setpill/noverify/src/linter/lintapi"
 	"github.com/setpill/noverify/src/meta"
 	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/node/expr"
 	"github.com/setpill/noverify/src/php/parser/walker"
 	"github.com/setpill/noverify/src/vscode"
 )
@@ -52,6 +53,11 @@ type CheckInfo struct {
 	// enabled by default or it should be included by allow-checks explicitly.
 	Default bool
 
+	// Severity is the level of the diagnostic reports, like LevelWarning.
+	// If a check reports with different levels, it's the most severe one.
+	// Zero value means that the severity is unknown.
+	Severity int
+
 	// Comment is a short summary of what this diagnostic does.
 	// A single descriptive sentence is a perfect format for it.
 	Comment string
@@ -193,6 +199,15 @@ func (ctx *BlockContext) Filename() string {
 	return ctx.w.r.filename
 }
 
+// FunctionCallName resolves a called function name.
+// Returns fully qualified function name and whether this function is defined.
+//
+// Experimental API.
+func (ctx *BlockContext) FunctionCallName(call *expr.FunctionCall) (fqName string, defined bool) {
+	res := resolveFunctionCall(ctx.w.ctx.sc, ctx.w.r.st, ctx.w.ctx.customTypes, call)
+	return res.fqName, res.defined
+}
+
 // BlockCheckerCreateFunc is a factory function for BlockChecker
 type BlockCheckerCreateFunc func(*BlockContext) BlockChecker
 
@@ -229,6 +244,17 @@ var severityNames = map[int]string{
 	LevelSyntax:      "SYNTAX ",
 }
 
+// PluginAPIVersion is a version of the custom checkers API:
+// CheckInfo, BlockChecker, RootChecker, contexts and registration functions.
+// It's incremented every time this API changes incompatibly.
+//
+// Go plugins that are loaded with -plugins flag export it
+// as NoVerifyAPIVersion variable, so the loader can reject
+// the plugins built against another API version.
+//
+// Version 2 added CheckInfo.Severity and BlockContext.FunctionCallName.
+const PluginAPIVersion = 2
+
 var (
 	customBlockLinters []BlockCheckerCreateFunc
 	customRootLinters  []RootCheckerCreateFunc
@@ -254,20 +280,25 @@ func RegisterRootChecker(c RootCheckerCreateFunc) {
 func RegisterRootCheckerWithCacher(cacher MetaCacher, c RootCheckerCreateFunc) {
 	customRootLinters = append(customRootLinters, c)
 	if cacher != nil {
-		// Validate cacher version string.
-		ver := cacher.Version()
-		if len(ver) > 256 {
-			panic(fmt.Sprintf("register cacher %q: can't handle strings longer that 256 bytes", ver))
-		}
-		for _, cacher := range metaCachers {
-			if cacher.Version() == ver {
-				panic(fmt.Sprintf("register cacher %q: already registered", ver))
-			}
-		}
+		validateCacher(metaCachers, cacher)
 	}
 	metaCachers = append(metaCachers, cacher)
 }
 
+// validateCacher panics if the cacher version string is invalid
+// or it's the same as some of the registered cachers have.
+func validateCacher(registered []MetaCacher, cacher MetaCacher) {
+	ver := cacher.Version()
+	if len(ver) > 256 {
+		panic(fmt.Sprintf("register cacher %q: can't handle strings longer that 256 bytes", ver))
+	}
+	for _, c := range registered {
+		if c != nil && c.Version() == ver {
+			panic(fmt.Sprintf("register cacher %q: already registered", ver))
+		}
+	}
+}
+
 // DeclareCheck declares a check described by an info.
 // It's a good practice to declare *all* provided checks.
 //
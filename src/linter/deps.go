@@ -0,0 +1,199 @@
+package linter
+
+import (
+	"strings"
+
+	"github.com/setpill/noverify/src/layers"
+	"github.com/setpill/noverify/src/meta"
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/node/name"
+	"github.com/setpill/noverify/src/php/parser/node/stmt"
+	"github.com/setpill/noverify/src/solver"
+)
+
+// depKind describes what kind of symbol is referenced.
+type depKind int
+
+const (
+	depClass depKind = iota
+	depFunction
+	depConstant
+)
+
+func (k depKind) String() string {
+	switch k {
+	case depClass:
+		return "class"
+	case depFunction:
+		return "function"
+	case depConstant:
+		return "constant"
+	}
+	return "symbol"
+}
+
+// reportDependency is called for every resolved symbol reference.
+// fqn is a fully qualified symbol name, like `\NS\Foo`.
+//
+// It's a no-op unless Layers or DepsGraph are set or the language server is running.
+func (d *RootWalker) reportDependency(n node.Node, kind depKind, fqn string) {
+	if d.linter.config.Layers == nil && d.linter.config.DepsGraph == nil && !d.linter.config.LangServer {
+		return
+	}
+	if !d.linter.info.IsIndexingComplete() || fqn == "" || fqn[0] != '\\' {
+		return
+	}
+
+	if d.linter.config.LangServer && kind == depClass {
+		if d.ClassDeps == nil {
+			d.ClassDeps = make(map[string]struct{})
+		}
+		d.ClassDeps[fqn] = struct{}{}
+	}
+	if d.linter.config.Layers == nil && d.linter.config.DepsGraph == nil {
+		return
+	}
+
+	srcNamespace := d.st.Namespace
+	if srcNamespace == "" {
+		srcNamespace = `\`
+	}
+
+	if d.linter.config.DepsGraph != nil {
+		d.linter.config.DepsGraph.AddEdge(srcNamespace, layers.NamespaceOf(fqn))
+	}
+
+	if d.linter.config.Layers == nil {
+		return
+	}
+
+	src := d.st.CurrentClass
+	if src == "" {
+		src = srcNamespace
+	}
+	from := d.linter.config.Layers.Find(src, d.filename)
+	if from == nil {
+		return
+	}
+	to := d.linter.config.Layers.Find(fqn, symbolFilename(d.linter.info, kind, fqn))
+	if from.Allows(to) {
+		return
+	}
+
+	d.Report(n, LevelWarning, "layers", "%s %s from layer %s is not allowed to be used in layer %s",
+		kind, fqn, to.Name, from.Name)
+}
+
+// reportClassNameDependency resolves classNode and reports a class dependency for it.
+func (d *RootWalker) reportClassNameDependency(classNode node.Node) {
+	className, ok := solver.GetClassName(d.st, classNode)
+	if !ok {
+		return
+	}
+	d.reportDependency(classNode, depClass, className)
+}
+
+// reportTypeHintDependency reports class dependencies for a type hint node.
+func (d *RootWalker) reportTypeHintDependency(n node.Node) {
+	if nn, ok := n.(*node.Nullable); ok {
+		n = nn.Expr
+	}
+	switch n.(type) {
+	case *node.Identifier, nil:
+		// Builtin type, like "int" or "array".
+		return
+	}
+	d.reportClassNameDependency(n)
+}
+
+// reportTypesDependency reports class dependencies for every class
+// mentioned in typ. Used for the phpdoc-based types.
+func (d *RootWalker) reportTypesDependency(n node.Node, typ meta.TypesMap) {
+	typ.Iterate(func(t string) {
+		for len(t) > 0 && t[0] == meta.WArrayOf {
+			t = meta.UnwrapArrayOf(t)
+		}
+		if len(t) > 0 && t[0] == '\\' {
+			d.reportDependency(n, depClass, t)
+		}
+	})
+}
+
+// symbolFilename returns a name of the file that defines the symbol.
+// Empty string is returned for unknown symbols.
+func symbolFilename(info *meta.Index, kind depKind, fqn string) string {
+	switch kind {
+	case depClass:
+		if class, ok := info.GetClassOrTrait(fqn); ok {
+			return class.Pos.Filename
+		}
+	case depFunction:
+		if fn, ok := info.GetFunction(fqn); ok {
+			return fn.Pos.Filename
+		}
+	case depConstant:
+		if c, ok := info.GetConstant(fqn); ok {
+			return c.Pos.Filename
+		}
+	}
+	return ""
+}
+
+// reportReturnTypeDependency reports class dependencies for a function return type.
+// Type hint has a priority over the phpdoc @return type.
+func (d *RootWalker) reportReturnTypeDependency(n, typeHint node.Node, phpdocType meta.TypesMap) {
+	if typeHint != nil {
+		d.reportTypeHintDependency(typeHint)
+		return
+	}
+	d.reportTypesDependency(n, phpdocType)
+}
+
+// enterUseList reports dependencies that are introduced by the use statements.
+func (d *RootWalker) enterUseList(list *stmt.UseList) {
+	kind := useKind(list.UseType, depClass)
+	for _, u := range list.Uses {
+		u, ok := u.(*stmt.Use)
+		if !ok {
+			continue
+		}
+		if nm, ok := u.Use.(*name.Name); ok {
+			d.reportDependency(u, kind, `\`+meta.NameToString(nm))
+		}
+	}
+}
+
+// enterGroupUse reports dependencies that are introduced by the group use
+// statements, like `use A\{B, C}`. Every use inside the group
+// may have its own type, like `use A\{B, function c}`.
+func (d *RootWalker) enterGroupUse(group *stmt.GroupUse) {
+	prefix, ok := group.Prefix.(*name.Name)
+	if !ok {
+		return
+	}
+	groupKind := useKind(group.UseType, depClass)
+	for _, u := range group.UseList {
+		u, ok := u.(*stmt.Use)
+		if !ok {
+			continue
+		}
+		if nm, ok := u.Use.(*name.Name); ok {
+			kind := useKind(u.UseType, groupKind)
+			d.reportDependency(u, kind, `\`+meta.NameToString(prefix)+`\`+meta.NameToString(nm))
+		}
+	}
+}
+
+// useKind returns a kind of the symbols that are imported by the use statement
+// with the useType, like `function` in `use function A\f`.
+func useKind(useType node.Node, defaultKind depKind) depKind {
+	if id, ok := useType.(*node.Identifier); ok && id != nil {
+		switch strings.ToLower(id.Value) {
+		case "function":
+			return depFunction
+		case "const":
+			return depConstant
+		}
+	}
+	return defaultKind
+}
@@ -0,0 +1,45 @@
+package linter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DupCodeReports returns dupCode reports for all clones collected by DupCode.
+//
+// Should be called after all files were analyzed.
+// Every clone fragment is reported once, the first other
+// fragment of the same clones group is mentioned in the message.
+func DupCodeReports() []*Report {
+	return DefaultLinter().DupCodeReports()
+}
+
+// DupCodeReports returns dupCode reports for all clones collected by the linter DupCode.
+func (l *Linter) DupCodeReports() []*Report {
+	if l.config.DupCode == nil {
+		return nil
+	}
+
+	var reports []*Report
+	for _, g := range l.config.DupCode.Groups() {
+		for i, f := range g.Fragments {
+			other := g.Fragments[0]
+			if i == 0 {
+				other = g.Fragments[1]
+			}
+			startChar := len(f.StartLineText) - len(strings.TrimLeft(f.StartLineText, " \t"))
+			reports = append(reports, &Report{
+				checkName: "dupCode",
+				startLn:   f.StartLineText,
+				startChar: startChar,
+				startLine: f.StartLine,
+				endChar:   len(f.StartLineText),
+				level:     LevelDoNotReject,
+				filename:  f.Filename,
+				msg: fmt.Sprintf("Duplicated code: %d statements (lines %d-%d) are similar to %s:%d (%d clones in total)",
+					f.Statements, f.StartLine, f.EndLine, other.Filename, other.StartLine, len(g.Fragments)),
+			})
+		}
+	}
+	return reports
+}
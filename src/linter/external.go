@@ -0,0 +1,479 @@
+package linter
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/setpill/noverify/src/meta"
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/position"
+	"github.com/setpill/noverify/src/solver"
+)
+
+// ExternalProtocolVersion is a version of the external checkers protocol.
+// It's sent to every checker inside the "initialize" request params.
+const ExternalProtocolVersion = 1
+
+// ExternalChecker is a running out-of-process checker.
+//
+// noverify talks to the checker process over its stdin and stdout
+// using JSON messages, see docs/external-checkers.md for the protocol description.
+//
+// Requests are serialized, so a checker handles one file at a time.
+// Every request is limited by ExternalCheckerTimeout that is set when the checker is started.
+type ExternalChecker struct {
+	command string
+	timeout time.Duration
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	enc    *json.Encoder
+	dec    *json.Decoder
+	nextID int
+
+	// err is a first protocol error.
+	// Broken checkers are not used anymore.
+	err error
+
+	// info is the index of the file that is being checked,
+	// the checker meta requests are served with it.
+	info *meta.Index
+}
+
+type externalRequest struct {
+	ID     int         `json:"id,omitempty"`
+	Method string      `json:"method"`
+	Params interface{} `json:"params,omitempty"`
+}
+
+type externalResponse struct {
+	ID     int         `json:"id"`
+	Result interface{} `json:"result"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// externalMessage is a message that is sent by the checker:
+// either a response to the noverify request or a checker request.
+type externalMessage struct {
+	ID     int             `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  string          `json:"error"`
+}
+
+type externalInitParams struct {
+	Version int `json:"version"`
+}
+
+type externalInitResult struct {
+	Checks []struct {
+		Name     string `json:"name"`
+		Default  bool   `json:"default"`
+		Severity string `json:"severity"`
+		Comment  string `json:"comment"`
+	} `json:"checks"`
+}
+
+type externalCheckParams struct {
+	Filename string        `json:"filename"`
+	AST      *externalNode `json:"ast"`
+}
+
+type externalCheckResult struct {
+	Reports []externalReport `json:"reports"`
+}
+
+// externalReport is a checker diagnostic.
+// It has the same shape as the Report JSON encoding.
+type externalReport struct {
+	CheckName string `json:"check_name"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+	Line      int    `json:"line"`
+	EndLine   int    `json:"end_line"`
+	StartChar int    `json:"start_char"`
+	EndChar   int    `json:"end_char"`
+}
+
+type externalMetaParams struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// StartExternalChecker runs a checker command and performs the protocol handshake.
+//
+// Command is split into the program name and arguments by whitespace.
+// Checks that are declared by the checker are registered with DeclareCheck.
+func StartExternalChecker(command string) (*ExternalChecker, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	c := &ExternalChecker{
+		command: command,
+		timeout: ExternalCheckerTimeout,
+		cmd:     cmd,
+		stdin:   stdin,
+		enc:     json.NewEncoder(stdin),
+		dec:     json.NewDecoder(bufio.NewReader(stdout)),
+	}
+
+	var res externalInitResult
+	if err := c.call("initialize", externalInitParams{Version: ExternalProtocolVersion}, &res); err != nil {
+		c.err = err
+		c.Close()
+		return nil, fmt.Errorf("initialize: %v", err)
+	}
+	for _, check := range res.Checks {
+		if _, ok := checksInfoRegistry[check.Name]; ok || check.Name == "" {
+			c.Close()
+			return nil, fmt.Errorf("initialize: can't declare %q check", check.Name)
+		}
+		DeclareCheck(CheckInfo{
+			Name:     check.Name,
+			Default:  check.Default,
+			Severity: externalSeverityLevel(check.Severity),
+			Comment:  check.Comment,
+		})
+	}
+
+	return c, nil
+}
+
+// CloseExternalCheckers stops all ExternalCheckers.
+func CloseExternalCheckers() {
+	for _, c := range ExternalCheckers {
+		c.Close()
+	}
+}
+
+// Close sends the "shutdown" notification and waits for the checker process to exit.
+// Broken checkers may be stuck in the middle of a request, so they're killed instead.
+func (c *ExternalChecker) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stdin == nil {
+		return nil
+	}
+	if c.err == nil {
+		c.enc.Encode(externalRequest{Method: "shutdown"})
+	} else {
+		c.cmd.Process.Kill()
+	}
+	c.stdin.Close()
+	c.stdin = nil
+	return c.cmd.Wait()
+}
+
+// call sends a request and waits for its result.
+// Checker requests that are received in the meantime are served.
+//
+// If the result is not received in c.timeout, the checker process is killed,
+// so the pending read or write fails and the error is returned.
+func (c *ExternalChecker) call(method string, params, result interface{}) error {
+	var timer *time.Timer
+	if c.timeout > 0 {
+		timer = time.AfterFunc(c.timeout, func() { c.cmd.Process.Kill() })
+		defer timer.Stop()
+	}
+	timedOut := func(err error) error {
+		if timer != nil && !timer.Stop() {
+			return fmt.Errorf("%s request timed out after %s, checker process is killed", method, c.timeout)
+		}
+		return err
+	}
+
+	c.nextID++
+	id := c.nextID
+	if err := c.enc.Encode(externalRequest{ID: id, Method: method, Params: params}); err != nil {
+		return timedOut(err)
+	}
+
+	for {
+		var msg externalMessage
+		if err := c.dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				err = errors.New("checker exited unexpectedly")
+			}
+			return timedOut(err)
+		}
+		if msg.Method != "" {
+			if err := c.serve(&msg); err != nil {
+				return timedOut(err)
+			}
+			continue
+		}
+		if msg.ID != id {
+			return fmt.Errorf("unexpected response id %d, expected %d", msg.ID, id)
+		}
+		if msg.Error != "" {
+			return errors.New(msg.Error)
+		}
+		return json.Unmarshal(msg.Result, result)
+	}
+}
+
+// serve answers a checker request.
+func (c *ExternalChecker) serve(msg *externalMessage) error {
+	resp := externalResponse{ID: msg.ID}
+	switch msg.Method {
+	case "meta":
+		var params externalMetaParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			resp.Error = err.Error()
+			break
+		}
+		if c.info == nil {
+			resp.Error = "meta requests are only served during the check"
+			break
+		}
+		result, err := externalMetaLookup(c.info, params)
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		resp.Result = result
+	default:
+		resp.Error = fmt.Sprintf("unknown method %q", msg.Method)
+	}
+	return c.enc.Encode(resp)
+}
+
+// check sends the file AST to the checker and returns its reports.
+func (c *ExternalChecker) check(info *meta.Index, filename string, ast *externalNode) ([]externalReport, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.info = info
+	defer func() { c.info = nil }()
+
+	if c.err != nil || c.stdin == nil {
+		return nil, nil
+	}
+
+	var res externalCheckResult
+	if err := c.call("check", externalCheckParams{Filename: filename, AST: ast}, &res); err != nil {
+		c.err = err
+		return nil, err
+	}
+	return res.Reports, nil
+}
+
+// runExternalCheckers runs all ExternalCheckers for the analyzed file
+// and adds their diagnostics to the file reports.
+func runExternalCheckers(w *RootWalker, rootNode node.Node) {
+	checkers := w.linter.config.ExternalCheckers
+	if len(checkers) == 0 {
+		return
+	}
+
+	ast := encodeExternalAST(w, rootNode)
+	for _, c := range checkers {
+		reports, err := c.check(w.linter.info, w.filename, ast)
+		if err != nil {
+			log.Printf("external checker %q: %v (checker is disabled)", c.command, err)
+			continue
+		}
+		for _, r := range reports {
+			w.reportExternal(r)
+		}
+	}
+}
+
+// reportExternal converts the checker diagnostic into the file report.
+func (d *RootWalker) reportExternal(r externalReport) {
+	pos := position.Position{StartLine: r.Line, EndLine: r.EndLine}
+	if pos.EndLine == 0 {
+		pos.EndLine = pos.StartLine
+	}
+	if pos.StartLine >= 1 && pos.StartLine <= len(d.LinesPositions) {
+		pos.StartPos = d.LinesPositions[pos.StartLine-1] + r.StartChar + 1
+	}
+	if pos.EndLine >= 1 && pos.EndLine <= len(d.LinesPositions) && r.EndChar != 0 {
+		pos.EndPos = d.LinesPositions[pos.EndLine-1] + r.EndChar
+	}
+
+	d.reportPos(pos, externalSeverityLevel(r.Severity), r.CheckName, "%s", r.Message)
+}
+
+// externalSeverityLevel maps a severity name to the report level.
+// Unknown severities are reported as warnings.
+func externalSeverityLevel(severity string) int {
+	for level, name := range severityNames {
+		if strings.EqualFold(strings.TrimSpace(name), severity) {
+			return level
+		}
+	}
+	return LevelWarning
+}
+
+type externalClass struct {
+	Name             string                      `json:"name"`
+	Parent           string                      `json:"parent,omitempty"`
+	Interfaces       []string                    `json:"interfaces,omitempty"`
+	ParentInterfaces []string                    `json:"parent_interfaces,omitempty"`
+	Traits           []string                    `json:"traits,omitempty"`
+	Methods          map[string]*externalFunc    `json:"methods"`
+	Properties       map[string]externalProperty `json:"properties"`
+	Constants        map[string]externalConstant `json:"constants"`
+}
+
+type externalFunc struct {
+	Name       string          `json:"name"`
+	Params     []externalParam `json:"params"`
+	MinParams  int             `json:"min_params"`
+	ReturnType string          `json:"return_type"`
+	Access     string          `json:"access"`
+	Static     bool            `json:"static"`
+	Pure       bool            `json:"pure"`
+	Deprecated bool            `json:"deprecated"`
+}
+
+type externalParam struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	IsRef bool   `json:"is_ref"`
+}
+
+type externalProperty struct {
+	Type   string `json:"type"`
+	Access string `json:"access"`
+}
+
+type externalConstant struct {
+	Name   string `json:"name,omitempty"`
+	Type   string `json:"type"`
+	Access string `json:"access,omitempty"`
+}
+
+// externalMetaLookup finds a class, function or constant
+// by its fully qualified name. Returns nil if nothing is found.
+func externalMetaLookup(info *meta.Index, params externalMetaParams) (interface{}, error) {
+	name := params.Name
+	if !strings.HasPrefix(name, `\`) {
+		name = `\` + name
+	}
+
+	switch params.Kind {
+	case "class":
+		class, ok := info.GetClassOrTrait(name)
+		if !ok {
+			return nil, nil
+		}
+		return newExternalClass(info, name, &class), nil
+	case "function":
+		fn, ok := info.GetFunction(name)
+		if !ok {
+			return nil, nil
+		}
+		return newExternalFunc(info, name, "", &fn), nil
+	case "constant":
+		c, ok := info.GetConstant(name)
+		if !ok {
+			return nil, nil
+		}
+		return externalConstant{Name: name, Type: externalTypeString(info, "", c.Typ)}, nil
+	default:
+		return nil, fmt.Errorf("unknown meta kind %q", params.Kind)
+	}
+}
+
+func newExternalClass(info *meta.Index, name string, class *meta.ClassInfo) *externalClass {
+	res := &externalClass{
+		Name:             name,
+		Parent:           class.Parent,
+		Interfaces:       sortedKeys(class.Interfaces),
+		ParentInterfaces: class.ParentInterfaces,
+		Traits:           sortedKeys(class.Traits),
+		Methods:          make(map[string]*externalFunc, len(class.Methods)),
+		Properties:       make(map[string]externalProperty, len(class.Properties)),
+		Constants:        make(map[string]externalConstant, len(class.Constants)),
+	}
+	for methodName, fn := range class.Methods {
+		fn := fn
+		res.Methods[methodName] = newExternalFunc(info, methodName, name, &fn)
+	}
+	for propName, p := range class.Properties {
+		res.Properties[propName] = externalProperty{
+			Type:   externalTypeString(info, name, p.Typ),
+			Access: p.AccessLevel.String(),
+		}
+	}
+	for constName, c := range class.Constants {
+		res.Constants[constName] = externalConstant{
+			Type:   externalTypeString(info, name, c.Typ),
+			Access: c.AccessLevel.String(),
+		}
+	}
+	return res
+}
+
+func newExternalFunc(info *meta.Index, name, className string, fn *meta.FuncInfo) *externalFunc {
+	res := &externalFunc{
+		Name:       name,
+		Params:     make([]externalParam, 0, len(fn.Params)),
+		MinParams:  fn.MinParamsCnt,
+		ReturnType: externalTypeString(info, className, fn.Typ),
+		Access:     fn.AccessLevel.String(),
+		Static:     fn.IsStatic(),
+		Pure:       fn.IsPure(),
+		Deprecated: fn.Doc.Deprecated,
+	}
+	for _, p := range fn.Params {
+		res.Params = append(res.Params, externalParam{
+			Name:  p.Name,
+			Type:  externalTypeString(info, className, p.Typ),
+			IsRef: p.IsRef,
+		})
+	}
+	return res
+}
+
+// externalTypeString returns a resolved types string.
+// className is used to resolve static and $this types.
+func externalTypeString(info *meta.Index, className string, typ meta.TypesMap) string {
+	if typ.IsEmpty() {
+		return ""
+	}
+	resolved := solver.ResolveTypes(info, className, typ, make(map[string]struct{}))
+	return meta.NewTypesMapFromMap(resolved).String()
+}
+
+func sortedKeys(m map[string]struct{}) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,154 @@
+package linter
+
+import (
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/setpill/noverify/src/meta"
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/position"
+	"github.com/setpill/noverify/src/solver"
+	"github.com/setpill/noverify/src/state"
+)
+
+// externalNode is a JSON representation of the AST node
+// that is sent to the external checkers.
+type externalNode struct {
+	// Kind is a node type name, like "expr.FunctionCall" or "stmt.Echo".
+	Kind string       `json:"kind"`
+	Pos  *externalPos `json:"pos,omitempty"`
+
+	// Type is a resolved expression type, it's empty for statements
+	// and expressions with unknown type.
+	Type string `json:"type,omitempty"`
+
+	// Fields contain node children and attributes.
+	// Field names are node struct field names in lowerCamelCase.
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// externalPos uses the same line and column conventions as the reports.
+type externalPos struct {
+	StartLine int `json:"start_line"`
+	EndLine   int `json:"end_line"`
+	StartChar int `json:"start_char"`
+	EndChar   int `json:"end_char"`
+}
+
+var nodeType = reflect.TypeOf((*node.Node)(nil)).Elem()
+
+// externalASTEncoder converts the AST into externalNode tree.
+//
+// It maintains the class parse state and the current scope,
+// so expression types are resolved in the same way they're
+// resolved during the file analysis.
+type externalASTEncoder struct {
+	w      *RootWalker
+	st     *meta.ClassParseState
+	scopes []*meta.Scope
+}
+
+func encodeExternalAST(w *RootWalker, rootNode node.Node) *externalNode {
+	e := &externalASTEncoder{
+		w:  w,
+		st: &meta.ClassParseState{Info: w.linter.info},
+	}
+	sc := w.rootScope
+	if sc == nil {
+		sc = meta.NewScope()
+	}
+	e.scopes = append(e.scopes, sc)
+	return e.encodeNode(rootNode)
+}
+
+func (e *externalASTEncoder) encodeNode(n node.Node) *externalNode {
+	state.EnterNode(e.st, n)
+	defer state.LeaveNode(e.st, n)
+
+	if sc, ok := e.w.Scopes[n]; ok {
+		e.scopes = append(e.scopes, sc)
+		defer func() { e.scopes = e.scopes[:len(e.scopes)-1] }()
+	}
+
+	typ := reflect.TypeOf(n).Elem()
+	res := &externalNode{
+		Kind: path.Base(typ.PkgPath()) + "." + typ.Name(),
+	}
+	if pos := n.GetPosition(); pos != nil {
+		res.Pos = e.encodePos(pos)
+	}
+	if isExternalTypedNode(typ) {
+		sc := e.scopes[len(e.scopes)-1]
+		res.Type = externalTypeString(e.st.MetaInfo(), e.st.CurrentClass, solver.ExprType(sc, e.st, n))
+	}
+
+	v := reflect.ValueOf(n).Elem()
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.PkgPath != "" || f.Name == "FreeFloating" || f.Name == "Position" {
+			continue
+		}
+		if res.Fields == nil {
+			res.Fields = make(map[string]interface{})
+		}
+		name := strings.ToLower(f.Name[:1]) + f.Name[1:]
+		res.Fields[name] = e.encodeValue(v.Field(i))
+	}
+
+	return res
+}
+
+func (e *externalASTEncoder) encodeValue(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Type().Implements(nodeType) {
+			return e.encodeNode(v.Interface().(node.Node))
+		}
+		return e.encodeValue(v.Elem())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes())
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = e.encodeValue(v.Index(i))
+		}
+		return list
+	case reflect.String, reflect.Bool, reflect.Int, reflect.Int32, reflect.Int64, reflect.Float64:
+		return v.Interface()
+	default:
+		return nil
+	}
+}
+
+func (e *externalASTEncoder) encodePos(pos *position.Position) *externalPos {
+	_, startChar := e.w.parseStartPos(pos)
+	res := &externalPos{
+		StartLine: pos.StartLine,
+		EndLine:   pos.EndLine,
+		StartChar: startChar,
+	}
+	if pos.EndLine >= 1 && pos.EndLine <= len(e.w.LinesPositions) {
+		if p := e.w.LinesPositions[pos.EndLine-1]; pos.EndPos > p {
+			res.EndChar = pos.EndPos - p
+		}
+	}
+	return res
+}
+
+// isExternalTypedNode reports whether the node of type typ is an expression.
+func isExternalTypedNode(typ reflect.Type) bool {
+	pkg := typ.PkgPath()
+	switch {
+	case strings.HasSuffix(pkg, "/node/scalar"), strings.Contains(pkg, "/node/expr"):
+		return true
+	case strings.HasSuffix(pkg, "/node"):
+		return typ.Name() == "SimpleVar" || typ.Name() == "Var"
+	default:
+		return false
+	}
+}
@@ -1,6 +1,10 @@
 package linter
 
-import "github.com/setpill/noverify/src/lintdebug"
+import (
+	"sync/atomic"
+
+	"github.com/setpill/noverify/src/lintdebug"
+)
 
 // ParseWaiter waits to allow parsing of a file.
 type ParseWaiter struct {
@@ -15,11 +19,18 @@ type memoryRequest struct {
 var (
 	parseStartCh    = make(chan memoryRequest)
 	parseFinishedCh = make(chan int)
+
+	// memoryLimiterStarted is set once the memory limiter is running.
+	memoryLimiterStarted int32
 )
 
 // MemoryLimiterThread starts memory limiter goroutine that disallows to use parse files more than MaxFileSize
-// total bytes.
+// total bytes. Only the first call starts the limiter, the other ones return immediately.
 func MemoryLimiterThread() {
+	if !atomic.CompareAndSwapInt32(&memoryLimiterStarted, 0, 1) {
+		return
+	}
+
 	var used int
 
 	plusCh := parseStartCh
@@ -0,0 +1,268 @@
+package linter
+
+import (
+	"fmt"
+	"regexp"
+	"runtime"
+	"sync"
+
+	"github.com/setpill/noverify/src/dupcode"
+	"github.com/setpill/noverify/src/inputs"
+	"github.com/setpill/noverify/src/layers"
+	"github.com/setpill/noverify/src/meta"
+	"github.com/setpill/noverify/src/rules"
+	"github.com/setpill/noverify/src/vscode"
+)
+
+// Config is a Linter configuration.
+// Its fields have the same meaning as the package-level settings.
+//
+// The files are read with the package-level PHPExtensions,
+// Debug, MaxFileSize and DefaultEncoding apply to all linters as well.
+type Config struct {
+	// StubsDir is the phpstorm-stubs directory.
+	// The stubs are loaded from it unless they're loaded with LoadStubs.
+	// Empty value means that there are no stubs.
+	StubsDir string
+
+	// CacheDir is the index cache directory. Empty value disables caching.
+	CacheDir string
+
+	MaxConcurrency     int
+	CheckAutoGenerated bool
+	IsDiscardVar       func(string) bool
+
+	// ExcludeRegex matches the filenames that are not reported.
+	ExcludeRegex *regexp.Regexp
+
+	// SrcInput implements source code reading from files and buffers.
+	SrcInput inputs.SourceInput
+
+	// Rules is a set of dynamically loaded linter diagnostics.
+	Rules *rules.Set
+
+	// Layers, DepsGraph and DupCode are optional, see the package-level variables.
+	Layers    *layers.Config
+	DepsGraph *layers.Graph
+	DupCode   *dupcode.Index
+
+	// ExternalCheckers is a list of running out-of-process checkers.
+	ExternalCheckers []*ExternalChecker
+
+	// LangServer enables the language server mode.
+	LangServer bool
+
+	// DiagnosticFilter is called for every diagnostic in language server mode,
+	// see the package-level DiagnosticFilter.
+	DiagnosticFilter func(diag *vscode.Diagnostic) bool
+}
+
+// NewConfig returns a config with the default settings.
+func NewConfig() *Config {
+	return &Config{
+		MaxConcurrency: runtime.NumCPU(),
+		IsDiscardVar:   isUnderscore,
+		SrcInput:       inputs.NewDefaultSourceInput(),
+		Rules:          &rules.Set{},
+	}
+}
+
+// GlobalConfig returns a config with the current package-level settings.
+func GlobalConfig() *Config {
+	return &Config{
+		StubsDir:           StubsDir,
+		CacheDir:           CacheDir,
+		MaxConcurrency:     MaxConcurrency,
+		CheckAutoGenerated: CheckAutoGenerated,
+		IsDiscardVar:       IsDiscardVar,
+		ExcludeRegex:       ExcludeRegex,
+		SrcInput:           SrcInput,
+		Rules:              Rules,
+		Layers:             Layers,
+		DepsGraph:          DepsGraph,
+		DupCode:            DupCode,
+		ExternalCheckers:   ExternalCheckers,
+		LangServer:         LangServer,
+		DiagnosticFilter:   DiagnosticFilter,
+	}
+}
+
+// Linter analyzes a single project. Every linter has its own configuration,
+// meta info index and custom checkers, so several projects (or several
+// revisions of one project) can be analyzed in the same process,
+// including concurrently.
+//
+// LoadStubs, InitStubs, Index, Analyze and AnalyzeFile are safe for concurrent use.
+// The lower-level methods, like ParseContents and IndexFile, are intended for
+// the language server and the callers have to synchronize them with the others.
+//
+// The package-level functions, like ParseFilenames, work with a linter
+// that uses the package-level settings, meta.Info index and custom checkers.
+//
+// MemoryLimiterThread is started by NewLinter, MaxFileSize applies to all linters.
+type Linter struct {
+	config Config
+	info   *meta.Index
+
+	blockCheckers []BlockCheckerCreateFunc
+	rootCheckers  []RootCheckerCreateFunc
+	metaCachers   []MetaCacher
+
+	// mu serializes the index updates and the analysis.
+	mu          sync.Mutex
+	stubsLoaded bool
+}
+
+// NewLinter returns a linter with the config copy and empty index.
+// The custom checkers that are registered at this point, usually
+// by the plugins init functions, are used by the linter.
+func NewLinter(config *Config) *Linter {
+	go MemoryLimiterThread()
+
+	return &Linter{
+		config:        *config,
+		info:          meta.NewIndex(),
+		blockCheckers: append([]BlockCheckerCreateFunc(nil), customBlockLinters...),
+		rootCheckers:  append([]RootCheckerCreateFunc(nil), customRootLinters...),
+		metaCachers:   append([]MetaCacher(nil), metaCachers...),
+	}
+}
+
+// DefaultLinter returns a linter that uses the current package-level settings,
+// meta.Info index and custom checkers. It's used by the package-level functions.
+func DefaultLinter() *Linter {
+	return &Linter{
+		config:        *GlobalConfig(),
+		info:          meta.Info,
+		blockCheckers: customBlockLinters,
+		rootCheckers:  customRootLinters,
+		metaCachers:   metaCachers,
+	}
+}
+
+// Config returns a copy of the linter configuration.
+func (l *Linter) Config() *Config {
+	config := l.config
+	return &config
+}
+
+// SetConfig replaces the linter configuration, the index is kept.
+// The stubs are not reloaded if StubsDir is changed.
+// It must not be called during the analysis.
+func (l *Linter) SetConfig(config *Config) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.config = *config
+}
+
+// MetaInfo returns the linter index.
+func (l *Linter) MetaInfo() *meta.Index {
+	return l.info
+}
+
+// RegisterBlockChecker registers a custom block linter for this linter only.
+func (l *Linter) RegisterBlockChecker(c BlockCheckerCreateFunc) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.blockCheckers = append(l.blockCheckers, c)
+}
+
+// RegisterRootChecker registers a custom root linter for this linter only.
+func (l *Linter) RegisterRootChecker(c RootCheckerCreateFunc) {
+	l.RegisterRootCheckerWithCacher(nil, c)
+}
+
+// RegisterRootCheckerWithCacher registers a custom root linter for this linter only.
+// Specified cacher is used to save (and load) indexing phase results.
+func (l *Linter) RegisterRootCheckerWithCacher(cacher MetaCacher, c RootCheckerCreateFunc) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if cacher != nil {
+		validateCacher(l.metaCachers, cacher)
+	}
+	l.rootCheckers = append(l.rootCheckers, c)
+	l.metaCachers = append(l.metaCachers, cacher)
+}
+
+// LoadStubs parses the stubs, it's used instead of loading them from StubsDir.
+// It must be called before the other methods.
+func (l *Linter) LoadStubs(readStubs ReadCallback) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.stubsLoaded {
+		panic("linter stubs are already loaded")
+	}
+	l.ParseFilenames(readStubs)
+	l.info.InitStubs()
+	l.stubsLoaded = true
+}
+
+// InitStubs loads the stubs from StubsDir unless they're already loaded.
+// Index, Analyze and AnalyzeFile call it as well.
+func (l *Linter) InitStubs() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.initStubs()
+}
+
+// Index adds the files to the index or updates them if they're already indexed.
+// The index is used by the analysis, so all files that are referenced
+// by the analyzed ones should be indexed first.
+func (l *Linter) Index(readFiles ReadCallback) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.initStubs()
+	l.info.SetIndexingComplete(false)
+	l.ParseFilenames(readFiles)
+	l.info.SetIndexingComplete(true)
+}
+
+// Analyze analyzes the files and returns their reports.
+func (l *Linter) Analyze(readFiles ReadCallback) []*Report {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.initStubs()
+	l.info.SetIndexingComplete(true)
+	return l.ParseFilenames(readFiles)
+}
+
+// AnalyzeFile analyzes the file contents and returns its reports.
+// The file is read with SrcInput if contents is nil.
+// The file index is updated first, so the analysis uses its current declarations.
+func (l *Linter) AnalyzeFile(filename string, contents []byte) ([]*Report, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.initStubs()
+	l.info.SetIndexingComplete(false)
+	err := l.IndexFile(filename, contents)
+	l.info.SetIndexingComplete(true)
+	if err != nil {
+		return nil, fmt.Errorf("index %s: %v", filename, err)
+	}
+
+	_, w, err := l.ParseContents(filename, contents, nil)
+	if err != nil {
+		return nil, err
+	}
+	return w.GetReports(), nil
+}
+
+// initStubs loads the stubs from StubsDir unless they're already loaded.
+func (l *Linter) initStubs() {
+	if l.stubsLoaded {
+		return
+	}
+	if l.config.StubsDir != "" {
+		l.ParseFilenames(ReadFilenames([]string{l.config.StubsDir}, nil))
+	}
+	l.info.InitStubs()
+	l.stubsLoaded = true
+}
@@ -0,0 +1,193 @@
+package linter
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/setpill/noverify/src/dupcode"
+	"github.com/setpill/noverify/src/meta"
+)
+
+// readTestFiles returns a callback that reads the files from the filename to contents map.
+func readTestFiles(files map[string]string) ReadCallback {
+	return func(ch chan FileInfo) {
+		for filename, contents := range files {
+			ch <- FileInfo{Filename: filename, Contents: []byte(contents)}
+		}
+	}
+}
+
+func TestLinterInstances(t *testing.T) {
+	analyze := func(l *Linter, filename, code string) []string {
+		reports, err := l.AnalyzeFile(filename, []byte(code))
+		if err != nil {
+			t.Fatalf("analyze %s: %v", filename, err)
+		}
+		var msgs []string
+		for _, r := range reports {
+			if r.CheckName() == "undefined" {
+				msgs = append(msgs, r.msg)
+			}
+		}
+		return msgs
+	}
+
+	first := NewLinter(NewConfig())
+	second := NewLinter(NewConfig())
+
+	if msgs := analyze(first, "first/a.php", `<?php function f() {} f();`); len(msgs) != 0 {
+		t.Errorf("first/a.php: unexpected reports: %v", msgs)
+	}
+	if msgs := analyze(first, "first/b.php", `<?php f();`); len(msgs) != 0 {
+		t.Errorf("first/b.php: f is not found in the first linter index: %v", msgs)
+	}
+
+	msgs := analyze(second, "second/a.php", `<?php f();`)
+	if len(msgs) != 1 || !strings.Contains(msgs[0], "undefined function f") {
+		t.Errorf("second/a.php: f is found in the second linter index: %v", msgs)
+	}
+
+	if _, ok := meta.Info.GetFunction(`\f`); ok {
+		t.Errorf("linter index is leaked to the package-level meta info")
+	}
+}
+
+func TestLinterConcurrentProjects(t *testing.T) {
+	// Every project uses its own declarations and the declarations of the other one.
+	projects := []map[string]string{
+		{
+			"first/decl.php": `<?php function first() {}`,
+			"first/use.php":  `<?php first(); second();`,
+		},
+		{
+			"second/decl.php": `<?php function second() {}`,
+			"second/use.php":  `<?php first(); second();`,
+		},
+	}
+	want := []string{
+		"first/use.php: Call to undefined function second",
+		"second/use.php: Call to undefined function first",
+	}
+
+	const runs = 5
+	results := make([][]string, len(projects)*runs)
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			files := projects[i%len(projects)]
+			l := NewLinter(NewConfig())
+			l.Index(readTestFiles(files))
+			for _, r := range l.Analyze(readTestFiles(files)) {
+				if r.CheckName() == "undefined" {
+					results[i] = append(results[i], fmt.Sprintf("%s: %s", r.filename, r.msg))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, msgs := range results {
+		if len(msgs) != 1 || !strings.HasPrefix(msgs[0], want[i%len(projects)]) {
+			sort.Strings(msgs)
+			t.Errorf("run %d: unexpected reports:\n%s", i, strings.Join(msgs, "\n"))
+		}
+	}
+}
+
+func TestLinterCheckers(t *testing.T) {
+	l := NewLinter(NewConfig())
+	globalCheckers := len(customRootLinters)
+
+	var visited []string
+	l.RegisterRootChecker(func(ctx *RootContext) RootChecker {
+		visited = append(visited, ctx.Filename())
+		return RootCheckerDefaults{}
+	})
+
+	if len(customRootLinters) != globalCheckers {
+		t.Errorf("linter checker is registered globally")
+	}
+
+	if _, err := l.AnalyzeFile("checkers.php", []byte(`<?php echo 1;`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(visited) == 0 {
+		t.Errorf("linter checker is not called")
+	}
+}
+
+func TestLinterDupCode(t *testing.T) {
+	files := map[string]string{
+		"a.php": `<?php
+function f($a) {
+  $x = $a + 1;
+  $y = $x * 2;
+  echo "hello";
+  return $y;
+}
+
+function g($a) {
+  $x = $a + 1;
+  return $x;
+}
+`,
+		"b.php": `<?php
+function h($b) {
+  $p = $b + 1;
+  $q = $p * 2;
+  echo "world";
+  return $q;
+}
+
+function k($b) {
+  $p = $b + 1;
+  return $p;
+}
+`,
+	}
+
+	analyze := func(minStatements, minTokens int) []string {
+		config := NewConfig()
+		config.DupCode = dupcode.NewIndex(minStatements, minTokens)
+		l := NewLinter(config)
+		l.Index(readTestFiles(files))
+		for _, r := range l.Analyze(readTestFiles(files)) {
+			if r.CheckName() == "dupCode" {
+				t.Errorf("dupCode is reported during the analysis: %s", r.msg)
+			}
+		}
+
+		var msgs []string
+		for _, r := range l.DupCodeReports() {
+			if r.CheckName() != "dupCode" || r.level != LevelDoNotReject {
+				t.Errorf("unexpected report %s with level %d", r.CheckName(), r.level)
+			}
+			msgs = append(msgs, fmt.Sprintf("%s:%d: %s", r.filename, r.startLine, r.msg))
+		}
+		sort.Strings(msgs)
+		return msgs
+	}
+
+	// Only f and h bodies are clones, g and k have less statements.
+	want := []string{
+		"a.php:3: Duplicated code: 4 statements (lines 3-6) are similar to b.php:3 (2 clones in total)",
+		"b.php:3: Duplicated code: 4 statements (lines 3-6) are similar to a.php:3 (2 clones in total)",
+	}
+	if have := analyze(3, 0); !reflect.DeepEqual(have, want) {
+		t.Errorf("reports mismatch:\nhave: %q\nwant: %q", have, want)
+	}
+
+	if have := analyze(5, 0); len(have) != 0 {
+		t.Errorf("clones shorter than min statements are reported: %q", have)
+	}
+	if have := analyze(3, 1000); len(have) != 0 {
+		t.Errorf("clones smaller than min tokens are reported: %q", have)
+	}
+}
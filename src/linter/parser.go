@@ -72,6 +72,12 @@ type ReadCallback func(ch chan FileInfo)
 // ParseContents parses specified contents (or file) and returns *RootWalker.
 // Function does not update global meta.
 func ParseContents(filename string, contents []byte, lineRanges []git.LineRange) (rootNode node.Node, w *RootWalker, err error) {
+	return DefaultLinter().ParseContents(filename, contents, lineRanges)
+}
+
+// ParseContents parses specified contents (or file) and returns *RootWalker.
+// The linter index is not updated.
+func (l *Linter) ParseContents(filename string, contents []byte, lineRanges []git.LineRange) (rootNode node.Node, w *RootWalker, err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			s := fmt.Sprintf("Panic while parsing %s: %s\n\nStack trace: %s", filename, r, dbg.Stack())
@@ -84,9 +90,9 @@ func ParseContents(filename string, contents []byte, lineRanges []git.LineRange)
 
 	var rd inputs.ReadCloseSizer
 	if contents == nil {
-		rd, err = SrcInput.NewReader(filename)
+		rd, err = l.config.SrcInput.NewReader(filename)
 	} else {
-		rd, err = SrcInput.NewBytesReader(filename, contents)
+		rd, err = l.config.SrcInput.NewBytesReader(filename, contents)
 	}
 	if err != nil {
 		log.Panicf("open source input: %v", err)
@@ -108,7 +114,7 @@ func ParseContents(filename string, contents []byte, lineRanges []git.LineRange)
 
 	bufCopy := append(make([]byte, 0, b.Len()), b.Bytes()...)
 
-	return analyzeFile(filename, bufCopy, parser, lineRanges)
+	return l.analyzeFile(filename, bufCopy, parser, lineRanges)
 }
 
 func cloneRulesForFile(filename string, ruleSet *rules.ScopedSet) *rules.ScopedSet {
@@ -125,6 +131,12 @@ func cloneRulesForFile(filename string, ruleSet *rules.ScopedSet) *rules.ScopedS
 			}
 			ruleClone := rule
 			ruleClone.Matcher = rule.Matcher.Clone()
+			if len(rule.NotContains) != 0 {
+				ruleClone.NotContains = make([]rules.NestedPattern, len(rule.NotContains))
+				for j, p := range rule.NotContains {
+					ruleClone.NotContains[j] = rules.NestedPattern{Source: p.Source, Matcher: p.Matcher.Clone()}
+				}
+			}
 			res = append(res, ruleClone)
 		}
 		clone.RulesByKind[i] = res
@@ -132,7 +144,7 @@ func cloneRulesForFile(filename string, ruleSet *rules.ScopedSet) *rules.ScopedS
 	return &clone
 }
 
-func analyzeFile(filename string, contents []byte, parser *php7.Parser, lineRanges []git.LineRange) (*node.Root, *RootWalker, error) {
+func (l *Linter) analyzeFile(filename string, contents []byte, parser *php7.Parser, lineRanges []git.LineRange) (*node.Root, *RootWalker, error) {
 	start := time.Now()
 	rootNode := parser.GetRootNode()
 
@@ -142,24 +154,31 @@ func analyzeFile(filename string, contents []byte, parser *php7.Parser, lineRang
 	}
 
 	w := &RootWalker{
+		linter:     l,
 		filename:   filename,
 		lineRanges: lineRanges,
-		st:         &meta.ClassParseState{},
+		st:         &meta.ClassParseState{Info: l.info},
 
 		// We need to clone rules since phpgrep matchers
 		// contain mutable state that we don't want to share
 		// between goroutines.
-		anyRset:   cloneRulesForFile(filename, Rules.Any),
-		rootRset:  cloneRulesForFile(filename, Rules.Root),
-		localRset: cloneRulesForFile(filename, Rules.Local),
+		anyRset:   cloneRulesForFile(filename, l.config.Rules.Any),
+		rootRset:  cloneRulesForFile(filename, l.config.Rules.Root),
+		localRset: cloneRulesForFile(filename, l.config.Rules.Local),
 	}
 
 	w.InitFromParser(contents, parser)
 	w.InitCustom()
 
 	rootNode.Walk(w)
-	if meta.IsIndexingComplete() {
+	if l.info.IsIndexingComplete() {
 		AnalyzeFileRootLevel(rootNode, w)
+		if l.config.DupCode != nil && !(w.autoGenerated && !l.config.CheckAutoGenerated) {
+			l.config.DupCode.AddFile(filename, rootNode, w.Lines)
+		}
+		if !(w.autoGenerated && !l.config.CheckAutoGenerated) {
+			runExternalCheckers(w, rootNode)
+		}
 	}
 	for _, c := range w.custom {
 		c.AfterLeaveFile()
@@ -181,9 +200,11 @@ func AnalyzeFileRootLevel(rootNode node.Node, d *RootWalker) {
 	sc := meta.NewScope()
 	sc.AddVarName("argv", meta.NewTypesMap("string[]"), "predefined", true)
 	sc.AddVarName("argc", meta.NewTypesMap("int"), "predefined", true)
+	d.rootScope = sc
 	b := &BlockWalker{
 		ctx:                  &blockContext{sc: sc},
 		r:                    d,
+		linter:               d.linter,
 		unusedVars:           make(map[string][]node.Node),
 		nonLocalVars:         make(map[string]struct{}),
 		ignoreFunctionBodies: true,
@@ -310,11 +331,7 @@ func ReadFilesFromGit(repo, commitSHA1 string, ignoreRegex *regexp.Regexp) ReadC
 				idx++
 				if time.Since(start) >= 2*time.Second {
 					start = time.Now()
-					action := "Indexed"
-					if meta.IsIndexingComplete() {
-						action = "Analyzed"
-					}
-					log.Printf("%s %d files from git", action, idx)
+					log.Printf("Read %d files from git", idx)
 				}
 
 				if ignoreRegex != nil && ignoreRegex.MatchString(filename) {
@@ -436,19 +453,25 @@ func ReadFilesFromGitWithChanges(repo, commitSHA1 string, changes []git.Change)
 
 // ParseFilenames is used to do initial parsing of files.
 func ParseFilenames(readFileNamesFunc ReadCallback) []*Report {
+	return DefaultLinter().ParseFilenames(readFileNamesFunc)
+}
+
+// ParseFilenames indexes the files or analyzes them if the indexing is complete.
+func (l *Linter) ParseFilenames(readFileNamesFunc ReadCallback) []*Report {
 	start := time.Now()
 	defer func() {
 		lintdebug.Send("Processing time: %s", time.Since(start))
 
-		meta.Info.Lock()
-		defer meta.Info.Unlock()
+		l.info.Lock()
+		defer l.info.Unlock()
 
-		lintdebug.Send("Funcs: %d, consts: %d, files: %d", meta.Info.NumFunctions(), meta.Info.NumConstants(), meta.Info.NumFilesWithFunctions())
+		lintdebug.Send("Funcs: %d, consts: %d, files: %d", l.info.NumFunctions(), l.info.NumConstants(), l.info.NumFilesWithFunctions())
 	}()
 
-	needReports := meta.IsIndexingComplete()
+	needReports := l.info.IsIndexingComplete()
+	maxConcurrency := l.config.MaxConcurrency
 
-	lintdebug.Send("Parsing using %d cores", MaxConcurrency)
+	lintdebug.Send("Parsing using %d cores", maxConcurrency)
 
 	filenamesCh := make(chan FileInfo, 512)
 
@@ -458,14 +481,14 @@ func ParseFilenames(readFileNamesFunc ReadCallback) []*Report {
 	}()
 
 	var wg sync.WaitGroup
-	reportsCh := make(chan []*Report, MaxConcurrency)
+	reportsCh := make(chan []*Report, maxConcurrency)
 
-	for i := 0; i < MaxConcurrency; i++ {
+	for i := 0; i < maxConcurrency; i++ {
 		wg.Add(1)
 		go func() {
 			var rep []*Report
 			for f := range filenamesCh {
-				rep = append(rep, doParseFile(f, needReports)...)
+				rep = append(rep, l.doParseFile(f, needReports)...)
 			}
 			reportsCh <- rep
 			wg.Done()
@@ -474,14 +497,14 @@ func ParseFilenames(readFileNamesFunc ReadCallback) []*Report {
 	wg.Wait()
 
 	var allReports []*Report
-	for i := 0; i < MaxConcurrency; i++ {
+	for i := 0; i < maxConcurrency; i++ {
 		allReports = append(allReports, (<-reportsCh)...)
 	}
 
 	return allReports
 }
 
-func doParseFile(f FileInfo, needReports bool) (reports []*Report) {
+func (l *Linter) doParseFile(f FileInfo, needReports bool) (reports []*Report) {
 	var err error
 
 	if DebugParseDuration > 0 {
@@ -495,12 +518,12 @@ func doParseFile(f FileInfo, needReports bool) (reports []*Report) {
 
 	if needReports {
 		var w *RootWalker
-		_, w, err = ParseContents(f.Filename, f.Contents, f.LineRanges)
+		_, w, err = l.ParseContents(f.Filename, f.Contents, f.LineRanges)
 		if err == nil {
 			reports = w.GetReports()
 		}
 	} else {
-		err = IndexFile(f.Filename, f.Contents)
+		err = l.IndexFile(f.Filename, f.Contents)
 	}
 
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
@@ -19,159 +20,199 @@ const (
 func init() {
 	allChecks := []CheckInfo{
 		{
-			Name:    "discardExpr",
-			Default: true,
-			Comment: `Report expressions that are evaluated but not used.`,
+			Name:     "discardExpr",
+			Default:  true,
+			Severity: LevelWarning,
+			Comment:  `Report expressions that are evaluated but not used.`,
 		},
 
 		{
-			Name:    "voidResultUsed",
-			Default: true,
-			Comment: `Report usages of the void-type expressions`,
+			Name:     "voidResultUsed",
+			Default:  true,
+			Severity: LevelDoNotReject,
+			Comment:  `Report usages of the void-type expressions`,
 		},
 
 		{
-			Name:    "keywordCase",
-			Default: true,
-			Comment: `Report keywords that are not in the lower case.`,
+			Name:     "keywordCase",
+			Default:  true,
+			Severity: LevelWarning,
+			Comment:  `Report keywords that are not in the lower case.`,
 		},
 
 		{
-			Name:    "accessLevel",
-			Default: true,
-			Comment: `Report erroneous member access.`,
+			Name:     "accessLevel",
+			Default:  true,
+			Severity: LevelError,
+			Comment:  `Report erroneous member access.`,
 		},
 
 		{
-			Name:    "argCount",
-			Default: true,
-			Comment: `Report mismatching args count inside call expressions.`,
+			Name:     "argCount",
+			Default:  true,
+			Severity: LevelError,
+			Comment:  `Report mismatching args count inside call expressions.`,
 		},
 
 		{
-			Name:    "arrayAccess",
-			Default: true,
-			Comment: `Report array access to non-array objects.`,
+			Name:     "arrayAccess",
+			Default:  true,
+			Severity: LevelDoNotReject,
+			Comment:  `Report array access to non-array objects.`,
 		},
 
 		{
-			Name:    "bitwiseOps",
-			Default: true,
-			Comment: `Report suspicious usage of bitwise operations.`,
+			Name:     "bitwiseOps",
+			Default:  true,
+			Severity: LevelWarning,
+			Comment:  `Report suspicious usage of bitwise operations.`,
 		},
 
 		{
-			Name:    "mixedArrayKeys",
-			Default: true,
-			Comment: `Report array literals that have both implicit and explicit keys.`,
+			Name:     "mixedArrayKeys",
+			Default:  true,
+			Severity: LevelWarning,
+			Comment:  `Report array literals that have both implicit and explicit keys.`,
 		},
 
 		{
-			Name:    "dupArrayKeys",
-			Default: true,
-			Comment: `Report duplicated keys in array literals.`,
+			Name:     "dupArrayKeys",
+			Default:  true,
+			Severity: LevelWarning,
+			Comment:  `Report duplicated keys in array literals.`,
 		},
 
 		{
-			Name:    "arraySyntax",
-			Default: true,
-			Comment: `Report usages of old array() syntax.`,
+			Name:     "arraySyntax",
+			Default:  true,
+			Severity: LevelDoNotReject,
+			Comment:  `Report usages of old array() syntax.`,
 		},
 
 		{
-			Name:    "bareTry",
-			Default: true,
-			Comment: `Report try blocks without catch/finally.`,
+			Name:     "bareTry",
+			Default:  true,
+			Severity: LevelError,
+			Comment:  `Report try blocks without catch/finally.`,
 		},
 
 		{
-			Name:    "caseBreak",
-			Default: true,
-			Comment: `Report switch cases without break.`,
+			Name:     "caseBreak",
+			Default:  true,
+			Severity: LevelInformation,
+			Comment:  `Report switch cases without break.`,
 		},
 
 		{
-			Name:    "complexity",
-			Default: true,
-			Comment: `Report funcs/methods that are too complex.`,
+			Name:     "complexity",
+			Default:  true,
+			Severity: LevelDoNotReject,
+			Comment:  `Report funcs/methods that are too complex.`,
 		},
 
 		{
-			Name:    "deadCode",
-			Default: true,
-			Comment: `Report potentially unreachable code.`,
+			Name:     "deadCode",
+			Default:  true,
+			Severity: LevelInformation,
+			Comment:  `Report potentially unreachable code.`,
 		},
 
 		{
-			Name:    "phpdocLint",
-			Default: true,
-			Comment: `Report malformed phpdoc comments.`,
+			Name:     "phpdocLint",
+			Default:  true,
+			Severity: LevelInformation,
+			Comment:  `Report malformed phpdoc comments.`,
 		},
 
 		{
-			Name:    "phpdocType",
-			Default: true,
-			Comment: `Report potential issues in phpdoc types.`,
+			Name:     "phpdocType",
+			Default:  true,
+			Severity: LevelInformation,
+			Comment:  `Report potential issues in phpdoc types.`,
 		},
 
 		{
-			Name:    "phpdoc",
-			Default: true,
-			Comment: `Report missing phpdoc on public methods.`,
+			Name:     "phpdoc",
+			Default:  true,
+			Severity: LevelDoNotReject,
+			Comment:  `Report missing phpdoc on public methods.`,
 		},
 
 		{
-			Name:    "stdInterface",
-			Default: true,
-			Comment: `Report issues related to std PHP interfaces.`,
+			Name:     "stdInterface",
+			Default:  true,
+			Severity: LevelError,
+			Comment:  `Report issues related to std PHP interfaces.`,
 		},
 
 		{
-			Name:    "syntax",
-			Default: true,
-			Comment: `Report syntax errors.`,
+			Name:     "syntax",
+			Default:  true,
+			Severity: LevelError,
+			Comment:  `Report syntax errors.`,
 		},
 
 		{
-			Name:    "undefined",
-			Default: true,
-			Comment: `Report usages of potentially undefined symbols.`,
+			Name:     "undefined",
+			Default:  true,
+			Severity: LevelError,
+			Comment:  `Report usages of potentially undefined symbols.`,
 		},
 
 		{
-			Name:    "unused",
-			Default: true,
-			Comment: `Report potentially unused variables.`,
+			Name:     "unused",
+			Default:  true,
+			Severity: LevelUnused,
+			Comment:  `Report potentially unused variables.`,
 		},
 
 		{
-			Name:    "redundantCast",
-			Default: false,
-			Comment: `Report redundant type casts.`,
+			Name:     "redundantCast",
+			Default:  false,
+			Severity: LevelDoNotReject,
+			Comment:  `Report redundant type casts.`,
 		},
 
 		{
-			Name:    "caseContinue",
-			Default: true,
-			Comment: `Report suspicious 'continue' usages inside switch cases.`,
+			Name:     "caseContinue",
+			Default:  true,
+			Severity: LevelError,
+			Comment:  `Report suspicious 'continue' usages inside switch cases.`,
 		},
 
 		{
-			Name:    "deprecated",
-			Default: false, // Experimental
-			Comment: `Report usages of deprecated symbols.`,
+			Name:     "deprecated",
+			Default:  false, // Experimental
+			Severity: LevelDoNotReject,
+			Comment:  `Report usages of deprecated symbols.`,
 		},
 
 		{
-			Name:    "callStatic",
-			Default: true,
-			Comment: `Report static calls of instance methods and vice versa.`,
+			Name:     "callStatic",
+			Default:  true,
+			Severity: LevelWarning,
+			Comment:  `Report static calls of instance methods and vice versa.`,
 		},
 
 		{
-			Name:    "oldStyleConstructor",
-			Default: true,
-			Comment: `Report old-style (PHP4) class constructors.`,
+			Name:     "oldStyleConstructor",
+			Default:  true,
+			Severity: LevelDoNotReject,
+			Comment:  `Report old-style (PHP4) class constructors.`,
+		},
+
+		{
+			Name:     "dupCode",
+			Default:  true,
+			Severity: LevelDoNotReject,
+			Comment:  `Report duplicated code fragments (only when clones detection is enabled).`,
+		},
+
+		{
+			Name:     "layers",
+			Default:  true,
+			Severity: LevelWarning,
+			Comment:  `Report dependencies that violate architecture layer constraints.`,
 		},
 	}
 
@@ -454,6 +495,27 @@ func isUnderscore(s string) bool {
 	return s == "_"
 }
 
+// DiscardVarPredicate returns IsDiscardVar implementation for the variables name pattern.
+func DiscardVarPredicate(pattern string) (func(string) bool, error) {
+	switch pattern {
+	case "^_$":
+		// Default pattern, only $_ is allowed.
+		return isUnderscore, nil
+	case "^_.*$":
+		// Leading underscore plus anything after it.
+		// Recognize as quite common pattern.
+		return func(s string) bool {
+			return strings.HasPrefix(s, "_")
+		}, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString, nil
+}
+
 // unquote returns unquoted version of s, if there are any quotes.
 func unquote(s string) string {
 	if len(s) >= 2 && s[0] == '\'' || s[0] == '"' {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"math"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -33,6 +34,8 @@ const (
 
 // RootWalker is used to analyze root scope. Mostly defines, function and class definitions are analyzed.
 type RootWalker struct {
+	linter *Linter
+
 	// autoGenerated is set to true when visiting auto-generated files.
 	autoGenerated bool
 
@@ -67,6 +70,19 @@ type RootWalker struct {
 	// exposed meta-information for language server to use
 	Scopes      map[node.Node]*meta.Scope
 	Diagnostics []vscode.Diagnostic
+
+	// ClassDeps contains the classes and traits the file depends on,
+	// it's only collected in language server mode.
+	ClassDeps map[string]struct{}
+
+	// VarDefs contains the variables that define local variables: parameters and
+	// assignments to the variables that are not yet defined in the current scope.
+	// It's only collected in language server mode.
+	VarDefs map[node.Node]struct{}
+
+	// rootScope is a top-level code scope, it's not a part of Scopes
+	// since it's only available after the root level analysis.
+	rootScope *meta.Scope
 }
 
 type phpDocParamEl struct {
@@ -79,22 +95,32 @@ type phpDocParamsMap map[string]phpDocParamEl
 // NewWalkerForLangServer creates a copy of RootWalker to make full analysis of a file
 func NewWalkerForLangServer(prev *RootWalker) *RootWalker {
 	return &RootWalker{
+		linter:         prev.linter,
 		filename:       prev.filename,
 		fileContents:   prev.fileContents,
 		LinesPositions: prev.LinesPositions,
 		Lines:          prev.Lines,
 		lineRanges:     prev.lineRanges,
-		st:             &meta.ClassParseState{},
+		st:             &meta.ClassParseState{Info: prev.linter.info},
 		autoGenerated:  prev.autoGenerated,
+		anyRset:        prev.anyRset,
+		rootRset:       prev.rootRset,
+		localRset:      prev.localRset,
 	}
 }
 
 // NewWalkerForReferencesSearcher allows to access full context of a parser so that we can perform complex
 // searches if needed.
 func NewWalkerForReferencesSearcher(filename string, block BlockCheckerCreateFunc) *RootWalker {
+	return DefaultLinter().NewWalkerForReferencesSearcher(filename, block)
+}
+
+// NewWalkerForReferencesSearcher is NewWalkerForReferencesSearcher that uses the linter index.
+func (l *Linter) NewWalkerForReferencesSearcher(filename string, block BlockCheckerCreateFunc) *RootWalker {
 	d := &RootWalker{
+		linter:      l,
 		filename:    filename,
-		st:          &meta.ClassParseState{},
+		st:          &meta.ClassParseState{Info: l.info},
 		customBlock: []BlockCheckerCreateFunc{block},
 	}
 	return d
@@ -155,16 +181,16 @@ func (d *RootWalker) fileIsAutoGenerated(lines [][]byte) bool {
 // InitCustom is needed to initialize walker state
 func (d *RootWalker) InitCustom() {
 	d.custom = nil
-	for _, createFn := range customRootLinters {
+	for _, createFn := range d.linter.rootCheckers {
 		d.custom = append(d.custom, createFn(&RootContext{w: d}))
 	}
 
-	d.customBlock = customBlockLinters
+	d.customBlock = d.linter.blockCheckers
 }
 
 // UpdateMetaInfo is intended to be used in tests. Do not use it directly!
 func (d *RootWalker) UpdateMetaInfo() {
-	updateMetaInfo(d.filename, &d.meta)
+	d.linter.updateMetaInfo(d.filename, &d.meta)
 }
 
 // scope returns root-level variable scope if applicable.
@@ -218,7 +244,13 @@ func (d *RootWalker) EnterNode(w walker.Walkable) (res bool) {
 	switch n := w.(type) {
 	case *stmt.Interface:
 		d.currentClassNode = n
+		d.getClass()
 		d.checkKeywordCase(n, "interface")
+		if n.Extends != nil {
+			for _, iface := range n.Extends.InterfaceNames {
+				d.reportClassNameDependency(iface)
+			}
+		}
 	case *stmt.Class:
 		d.currentClassNode = n
 		cl := d.getClass()
@@ -228,6 +260,7 @@ func (d *RootWalker) EnterNode(w walker.Walkable) (res bool) {
 				interfaceName, ok := solver.GetClassName(d.st, tr)
 				if ok {
 					cl.Interfaces[interfaceName] = struct{}{}
+					d.reportDependency(tr, depClass, interfaceName)
 				}
 			}
 		}
@@ -244,6 +277,7 @@ func (d *RootWalker) EnterNode(w walker.Walkable) (res bool) {
 		}
 		if n.Extends != nil {
 			d.checkKeywordCase(n.Extends, "extends")
+			d.reportClassNameDependency(n.Extends.ClassName)
 		}
 
 	case *stmt.Trait:
@@ -256,6 +290,7 @@ func (d *RootWalker) EnterNode(w walker.Walkable) (res bool) {
 			traitName, ok := solver.GetClassName(d.st, tr)
 			if ok {
 				cl.Traits[traitName] = struct{}{}
+				d.reportDependency(tr, depClass, traitName)
 			}
 		}
 	case *assign.Assign:
@@ -281,16 +316,20 @@ func (d *RootWalker) EnterNode(w walker.Walkable) (res bool) {
 
 	case *stmt.Namespace:
 		d.checkKeywordCase(n, "namespace")
+	case *stmt.UseList:
+		d.enterUseList(n)
+	case *stmt.GroupUse:
+		d.enterGroupUse(n)
 	}
 
 	for _, c := range d.custom {
 		c.AfterEnterNode(w)
 	}
 
-	if meta.IsIndexingComplete() && d.rootRset != nil {
+	if d.linter.info.IsIndexingComplete() && d.rootRset != nil {
 		n := w.(node.Node)
 		kind := rules.CategorizeNode(n)
-		d.runRules(n, d.scope(), d.rootRset.RulesByKind[kind])
+		d.runRules(n, nil, d.rootRset.RulesByKind[kind])
 	}
 
 	if !res {
@@ -317,20 +356,13 @@ func (d *RootWalker) parseStartPos(pos *position.Position) (startLn []byte, star
 
 // Report registers a single report message about some found problem.
 func (d *RootWalker) Report(n node.Node, level int, checkName, msg string, args ...interface{}) {
-	if !meta.IsIndexingComplete() {
-		return
-	}
-	if d.autoGenerated && !CheckAutoGenerated {
-		return
-	}
-
 	var pos position.Position
 
 	if n == nil {
 		// Hack to parse syntax error message from php-parser.
 		// When in language server mode, do not map syntax errors in order not to
 		// complain about unfinished piece of code that user is currently writing.
-		if strings.Contains(msg, "syntax error") && strings.Contains(msg, " at line ") && !LangServer {
+		if strings.Contains(msg, "syntax error") && strings.Contains(msg, " at line ") && !d.linter.config.LangServer {
 			// it is in form "Syntax error: syntax error: unexpected '*' at line 4"
 			if lastIdx := strings.LastIndexByte(msg, ' '); lastIdx > 0 {
 				lineNumStr := msg[lastIdx+1:]
@@ -347,6 +379,18 @@ func (d *RootWalker) Report(n node.Node, level int, checkName, msg string, args
 		pos = *n.GetPosition()
 	}
 
+	d.reportPos(pos, level, checkName, msg, args...)
+}
+
+// reportPos is like Report, but takes an explicit report position.
+func (d *RootWalker) reportPos(pos position.Position, level int, checkName, msg string, args ...interface{}) {
+	if !d.linter.info.IsIndexingComplete() {
+		return
+	}
+	if d.autoGenerated && !d.linter.config.CheckAutoGenerated {
+		return
+	}
+
 	var endLn []byte
 	var endChar int
 
@@ -366,11 +410,11 @@ func (d *RootWalker) Report(n node.Node, level int, checkName, msg string, args
 		endChar = len(endLn)
 	}
 
-	if LangServer {
+	if d.linter.config.LangServer {
 		severity, ok := vscodeLevelMap[level]
 		if ok {
 			diag := vscode.Diagnostic{
-				Code:     msg,
+				Code:     checkName,
 				Message:  fmt.Sprintf(msg, args...),
 				Severity: severity,
 				Range: vscode.Range{
@@ -383,7 +427,9 @@ func (d *RootWalker) Report(n node.Node, level int, checkName, msg string, args
 				diag.Tags = append(diag.Tags, 1 /* Unnecessary */)
 			}
 
-			d.Diagnostics = append(d.Diagnostics, diag)
+			if filter := d.linter.config.DiagnosticFilter; filter == nil || filter(&diag) {
+				d.Diagnostics = append(d.Diagnostics, diag)
+			}
 		}
 	} else {
 		d.reports = append(d.reports, &Report{
@@ -446,6 +492,7 @@ func (d *RootWalker) handleFuncStmts(params []meta.FuncParam, uses, stmts []node
 	b := &BlockWalker{
 		ctx:          &blockContext{sc: sc},
 		r:            d,
+		linter:       d.linter,
 		unusedVars:   make(map[string][]node.Node),
 		nonLocalVars: make(map[string]struct{}),
 	}
@@ -487,6 +534,7 @@ func (d *RootWalker) handleFuncStmts(params []meta.FuncParam, uses, stmts []node
 		b.addStatement(s)
 		s.Walk(b)
 	}
+	b.runSeqRules(stmts)
 	b.flushUnused()
 
 	// we can mark function as exiting abnormally if and only if
@@ -521,6 +569,17 @@ func (d *RootWalker) getElementPos(n node.Node) meta.ElementPosition {
 	}
 }
 
+// addVarDef records the local variable definition for the language server.
+func (d *RootWalker) addVarDef(n node.Node) {
+	if !d.linter.config.LangServer || !d.linter.info.IsIndexingComplete() {
+		return
+	}
+	if d.VarDefs == nil {
+		d.VarDefs = make(map[node.Node]struct{})
+	}
+	d.VarDefs[n] = struct{}{}
+}
+
 func (d *RootWalker) addScope(n node.Node, sc *meta.Scope) {
 	if d.Scopes == nil {
 		d.Scopes = make(map[node.Node]*meta.Scope)
@@ -577,8 +636,14 @@ func (d *RootWalker) getClass() meta.ClassInfo {
 
 	cl, ok := m[d.st.CurrentClass]
 	if !ok {
+		var flags meta.ClassFlags
+		if _, ok := d.currentClassNode.(*stmt.Interface); ok {
+			flags |= meta.ClassInterface
+		}
+
 		cl = meta.ClassInfo{
 			Pos:              d.getElementPos(d.currentClassNode),
+			Flags:            flags,
 			Parent:           d.st.CurrentParentClass,
 			ParentInterfaces: d.st.CurrentParentInterfaces,
 			Interfaces:       make(map[string]struct{}),
@@ -628,6 +693,7 @@ func (d *RootWalker) enterPropertyList(pl *stmt.PropertyList) bool {
 		nm := p.Variable.Name
 
 		typ := d.parsePHPDocVar(p.PhpDocComment)
+		d.reportTypesDependency(p.Variable, typ)
 		if p.Expr != nil {
 			typ = typ.Append(solver.ExprTypeLocal(d.scope(), d.st, p.Expr))
 		}
@@ -722,6 +788,7 @@ func (d *RootWalker) enterClassMethod(meth *stmt.ClassMethod) bool {
 	}
 	doc := d.parsePHPDoc(meth.PhpDocComment, meth.Params)
 	d.reportPhpdocErrors(meth.MethodName, doc.errs)
+	d.reportReturnTypeDependency(meth.MethodName, meth.ReturnType, doc.returnType)
 	phpdocReturnType := doc.returnType
 	phpDocParamTypes := doc.types
 
@@ -779,6 +846,12 @@ func (d *RootWalker) enterClassMethod(meth *stmt.ClassMethod) bool {
 	if modif.static {
 		funcFlags |= meta.FuncStatic
 	}
+	if insideInterface || modif.abstract {
+		funcFlags |= meta.FuncAbstract
+	}
+	if meth.ReturnType != nil {
+		funcFlags |= meta.FuncReturnHint
+	}
 	if !insideInterface && !modif.abstract && sideEffectFreeFunc(d.scope(), d.st, nil, stmts) {
 		funcFlags |= meta.FuncPure
 	}
@@ -793,9 +866,9 @@ func (d *RootWalker) enterClassMethod(meth *stmt.ClassMethod) bool {
 		Doc:          doc.info,
 	}
 
-	if nm == "getIterator" && meta.IsIndexingComplete() && solver.Implements(d.st.CurrentClass, `\IteratorAggregate`) {
+	if nm == "getIterator" && d.linter.info.IsIndexingComplete() && solver.Implements(d.linter.info, d.st.CurrentClass, `\IteratorAggregate`) {
 		implementsTraversable := returnType.Find(func(typ string) bool {
-			return solver.Implements(typ, `\Traversable`)
+			return solver.Implements(d.linter.info, typ, `\Traversable`)
 		})
 
 		if !implementsTraversable {
@@ -1180,6 +1253,7 @@ func (d *RootWalker) parseFuncArgs(params []node.Node, parTypes phpDocParamsMap,
 		p := param.(*node.Parameter)
 		v := p.Variable
 		parTyp := parTypes[v.Name]
+		d.addVarDef(v)
 
 		if !parTyp.typ.IsEmpty() {
 			sc.AddVarName(v.Name, parTyp.typ, "param", true)
@@ -1191,6 +1265,12 @@ func (d *RootWalker) parseFuncArgs(params []node.Node, parTypes phpDocParamsMap,
 			minArgs++
 		}
 
+		if p.VariableType != nil {
+			d.reportTypeHintDependency(p.VariableType)
+		} else {
+			d.reportTypesDependency(p.Variable, parTyp.typ)
+		}
+
 		if p.VariableType != nil {
 			if varTyp, ok := d.parseTypeNode(p.VariableType); ok {
 				typ = varTyp
@@ -1208,16 +1288,29 @@ func (d *RootWalker) parseFuncArgs(params []node.Node, parTypes phpDocParamsMap,
 		sc.AddVarName(v.Name, typ, "param", true)
 
 		par := meta.FuncParam{
-			Typ:   typ.Immutable(),
-			IsRef: p.ByRef,
+			Typ:        typ.Immutable(),
+			IsRef:      p.ByRef,
+			IsVariadic: p.Variadic,
 		}
 
 		par.Name = v.Name
+		if p.DefaultValue != nil {
+			par.Default = d.nodeSource(p.DefaultValue)
+		}
 		args = append(args, par)
 	}
 	return args, minArgs
 }
 
+// nodeSource returns n source code.
+func (d *RootWalker) nodeSource(n node.Node) string {
+	pos := n.GetPosition()
+	if pos == nil || pos.StartPos < 1 || pos.EndPos > len(d.fileContents) {
+		return ""
+	}
+	return string(d.fileContents[pos.StartPos-1 : pos.EndPos])
+}
+
 func (d *RootWalker) enterFunction(fun *stmt.Function) bool {
 	nm := d.st.Namespace + `\` + fun.FunctionName.Value
 	pos := fun.GetPosition()
@@ -1233,6 +1326,7 @@ func (d *RootWalker) enterFunction(fun *stmt.Function) bool {
 
 	doc := d.parsePHPDoc(fun.PhpDocComment, fun.Params)
 	d.reportPhpdocErrors(fun.FunctionName, doc.errs)
+	d.reportReturnTypeDependency(fun.FunctionName, fun.ReturnType, doc.returnType)
 	phpdocReturnType := doc.returnType
 	phpDocParamTypes := doc.types
 
@@ -1260,6 +1354,9 @@ func (d *RootWalker) enterFunction(fun *stmt.Function) bool {
 	if sideEffectFreeFunc(d.scope(), d.st, nil, fun.Stmts) {
 		funcFlags |= meta.FuncPure
 	}
+	if fun.ReturnType != nil {
+		funcFlags |= meta.FuncReturnHint
+	}
 	d.meta.Functions[nm] = meta.FuncInfo{
 		Params:       params,
 		Pos:          d.getElementPos(fun),
@@ -1429,34 +1526,62 @@ func (d *RootWalker) LeaveNode(n walker.Walkable) {
 	}
 }
 
-func (d *RootWalker) runRules(n node.Node, sc *meta.Scope, rlist []rules.Rule) {
+// runRules reports all rlist rules that match n.
+// ctx is nil for the nodes that are not inside any block.
+func (d *RootWalker) runRules(n node.Node, ctx *blockContext, rlist []rules.Rule) {
+	sc := d.scope()
+	if ctx != nil {
+		sc = ctx.sc
+	}
 	for i := range rlist {
 		rule := &rlist[i]
-		if loc := d.matchRule(n, sc, rule); loc != nil {
-			d.Report(loc, rule.Level, rule.Name, rule.Message)
+		if !d.checkRuleContext(&rule.Context, ctx) {
+			continue
+		}
+		if loc, msg := d.matchRule(n, sc, rule); loc != nil {
+			d.Report(loc, rule.Level, rule.Name, msg)
+		}
+	}
+}
+
+// checkRuleContext reports whether the current walker state
+// satisfies the rule context constraints.
+func (d *RootWalker) checkRuleContext(c *rules.Context, ctx *blockContext) bool {
+	if c.InClass != "" && (d.st.CurrentClass == "" || !rules.MatchName(c.InClass, d.st.CurrentClass)) {
+		return false
+	}
+	if c.NotInClass != "" && d.st.CurrentClass != "" && rules.MatchName(c.NotInClass, d.st.CurrentClass) {
+		return false
+	}
+	if c.InMethod != "" {
+		if d.st.CurrentClass == "" || d.st.CurrentFunction == "" || !rules.MatchName(c.InMethod, d.st.CurrentFunction) {
+			return false
 		}
 	}
+	if c.InNamespace != "" && !rules.MatchName(c.InNamespace, d.st.Namespace) {
+		return false
+	}
+	if c.InLoop && (ctx == nil || !ctx.insideLoop) {
+		return false
+	}
+	if c.NotInTry && ctx != nil && ctx.insideTry {
+		return false
+	}
+	return true
 }
 
-func (d *RootWalker) matchRule(n node.Node, sc *meta.Scope, rule *rules.Rule) node.Node {
+// matchRule returns the rule report location and message.
+// Location is nil if rule doesn't match n.
+func (d *RootWalker) matchRule(n node.Node, sc *meta.Scope, rule *rules.Rule) (node.Node, string) {
 	var location node.Node
+	var message string
 
 	rule.Matcher.Find(n, func(m *phpgrep.MatchData) bool {
 		if location != nil {
 			return false
 		}
 
-		matched := false
-		if len(rule.Filters) == 0 {
-			matched = true
-		} else {
-			for _, filterSet := range rule.Filters {
-				if d.checkFilterSet(m, sc, filterSet) {
-					matched = true
-					break
-				}
-			}
-		}
+		matched := d.checkRuleMatch(m, sc, rule)
 
 		// If location is explicitly set, use named match set.
 		// Otherwise peek the root target node.
@@ -1466,11 +1591,105 @@ func (d *RootWalker) matchRule(n node.Node, sc *meta.Scope, rule *rules.Rule) no
 		case matched:
 			location = n
 		}
+		if location != nil {
+			message = d.renderRuleMessage(rule.Message, sc, m)
+		}
 
 		return !matched // Do not continue if we found a match
 	})
 
-	return location
+	return location, message
+}
+
+// runSeqRules reports all rlist sequence rules matches inside stmts.
+func (d *RootWalker) runSeqRules(stmts []node.Node, ctx *blockContext, rlist []rules.Rule) {
+	for i := range rlist {
+		rule := &rlist[i]
+		if !d.checkRuleContext(&rule.Context, ctx) {
+			continue
+		}
+		rule.Matcher.FindSeq(stmts, func(m *phpgrep.MatchData) bool {
+			if !d.checkRuleMatch(m, ctx.sc, rule) {
+				return true
+			}
+			location := m.Node
+			if rule.Location != "" {
+				location = m.Named[rule.Location]
+			}
+			if location != nil {
+				d.Report(location, rule.Level, rule.Name, d.renderRuleMessage(rule.Message, ctx.sc, m))
+			}
+			return true
+		})
+	}
+}
+
+var ruleMessagePlaceholder = regexp.MustCompile(`\{\{\s*(type\s+)?\$(\w+)\s*\}\}`)
+
+// renderRuleMessage replaces {{$x}} and {{type $x}} message
+// placeholders with the m captures source text and types.
+// Placeholders that refer to unknown captures are left as is.
+func (d *RootWalker) renderRuleMessage(msg string, sc *meta.Scope, m *phpgrep.MatchData) string {
+	if !strings.Contains(msg, "{{") {
+		return msg
+	}
+	return ruleMessagePlaceholder.ReplaceAllStringFunc(msg, func(placeholder string) string {
+		parts := ruleMessagePlaceholder.FindStringSubmatch(placeholder)
+		n := m.Named[parts[2]]
+		if n == nil {
+			return placeholder
+		}
+		var text string
+		if parts[1] != "" {
+			typ := solver.ExprType(sc, d.st, n)
+			resolved := solver.ResolveTypes(d.linter.info, d.st.CurrentClass, typ, make(map[string]struct{}))
+			text = meta.NewTypesMapFromMap(resolved).String()
+		} else {
+			text = strings.Join(strings.Fields(string(phpgrep.NodeText(n, d.fileContents))), " ")
+		}
+		// Message is used as a format string.
+		return strings.Replace(text, "%", "%%", -1)
+	})
+}
+
+// checkRuleMatch reports whether m satisfies the rule filters
+// and @not-contains constraints.
+func (d *RootWalker) checkRuleMatch(m *phpgrep.MatchData, sc *meta.Scope, rule *rules.Rule) bool {
+	if len(rule.Filters) != 0 {
+		matched := false
+		for _, filterSet := range rule.Filters {
+			if d.checkFilterSet(m, sc, filterSet) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return !matchNested(rule.NotContains, m)
+}
+
+// matchNested reports whether any of the patterns matches inside the m code.
+func matchNested(patterns []rules.NestedPattern, m *phpgrep.MatchData) bool {
+	nodes := m.Stmts
+	if nodes == nil {
+		nodes = []node.Node{m.Node}
+	}
+	found := false
+	for _, p := range patterns {
+		for _, n := range nodes {
+			p.Matcher.FindBound(n, m.Named, func(*phpgrep.MatchData) bool {
+				found = true
+				return false
+			})
+			if found {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 func (d *RootWalker) checkTypeFilter(typeExpr phpdoc.TypeExpr, sc *meta.Scope, nn node.Node) bool {
@@ -1489,11 +1708,40 @@ func (d *RootWalker) checkFilterSet(m *phpgrep.MatchData, sc *meta.Scope, filter
 		if !d.checkTypeFilter(filter.Type, sc, nn) {
 			return false
 		}
+		if nn == nil {
+			return false
+		}
+		if filter.NotType != nil && d.checkTypeFilter(filter.NotType, sc, nn) {
+			return false
+		}
+		if filter.Implements != "" && !d.checkImplementsFilter(filter.Implements, sc, nn) {
+			return false
+		}
+		if filter.Pure && !sideEffectFree(sc, d.st, nil, nn) {
+			return false
+		}
+		if filter.Const && !isConstExpr(nn) {
+			return false
+		}
+		for _, f := range filter.Text {
+			if !f.MatchText(string(phpgrep.NodeText(nn, d.fileContents))) {
+				return false
+			}
+		}
 	}
 
 	return true
 }
 
+// checkImplementsFilter reports whether nn type has a class that
+// is equal to className, extends or implements it.
+func (d *RootWalker) checkImplementsFilter(className string, sc *meta.Scope, nn node.Node) bool {
+	typ := solver.ExprType(sc, d.st, nn)
+	return typ.Find(func(typ string) bool {
+		return classImplements(d.linter.info, typ, className)
+	})
+}
+
 func (d *RootWalker) checkKeywordCase(n node.Node, keyword string) {
 	// Only works for nodes that have a keyword of interest
 	// as the leftmost token.
@@ -0,0 +1,135 @@
+package linter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/setpill/noverify/src/rules"
+)
+
+// RuleTestFailure describes a failed rule test case.
+type RuleTestFailure struct {
+	Rule *rules.Rule
+	Test rules.Test
+
+	// Message explains why the test failed.
+	Message string
+}
+
+type ruleTestCase struct {
+	rule     *rules.Rule
+	test     rules.Test
+	rset     *rules.Set
+	filename string
+	code     []byte
+}
+
+// RunRuleTests runs @test-match and @test-nomatch test cases of all rset rules
+// with a new linter that uses the package-level settings, so the package-level
+// meta info is not affected. Stubs are loaded from StubsDir.
+// Returns the number of executed test cases and a list of failures.
+func RunRuleTests(rset *rules.Set) (int, []RuleTestFailure) {
+	return NewLinter(GlobalConfig()).RunRuleTests(rset)
+}
+
+// RunRuleTests runs @test-match and @test-nomatch test cases of all rset rules.
+// Returns the number of executed test cases and a list of failures.
+//
+// Every test case is analyzed separately with only the tested rule enabled.
+// Test cases are indexed as ordinary files, so the linter
+// should not be used for anything else.
+func (l *Linter) RunRuleTests(rset *rules.Set) (int, []RuleTestFailure) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var cases []*ruleTestCase
+	addCases := func(scoped *rules.ScopedSet, local bool, dst func(*rules.Set) *rules.ScopedSet) {
+		for kind, list := range scoped.RulesByKind {
+			for i := range list {
+				rule := &list[i]
+				for _, test := range rule.Tests {
+					single := rules.NewSet()
+					dst(single).RulesByKind[kind] = []rules.Rule{*rule}
+					cases = append(cases, &ruleTestCase{
+						rule:     rule,
+						test:     test,
+						rset:     single,
+						filename: fmt.Sprintf("rules-test/%s/test%d.php", rule.Path, len(cases)),
+						code:     ruleTestCode(test.Code, local),
+					})
+				}
+			}
+		}
+	}
+	addCases(rset.Any, false, func(s *rules.Set) *rules.ScopedSet { return s.Any })
+	addCases(rset.Root, false, func(s *rules.Set) *rules.ScopedSet { return s.Root })
+	addCases(rset.Local, true, func(s *rules.Set) *rules.ScopedSet { return s.Local })
+
+	l.initStubs()
+	l.info.SetIndexingComplete(false)
+	for _, c := range cases {
+		_, w, err := l.ParseContents(c.filename, c.code, nil)
+		if err == nil {
+			w.UpdateMetaInfo()
+		}
+	}
+	l.info.SetIndexingComplete(true)
+
+	oldRules := l.config.Rules
+	defer func() { l.config.Rules = oldRules }()
+
+	var failures []RuleTestFailure
+	for _, c := range cases {
+		l.config.Rules = c.rset
+		if msg := l.runRuleTestCase(c); msg != "" {
+			failures = append(failures, RuleTestFailure{
+				Rule:    c.rule,
+				Test:    c.test,
+				Message: msg,
+			})
+		}
+	}
+
+	return len(cases), failures
+}
+
+// runRuleTestCase returns a failure message or an empty string if test passed.
+func (l *Linter) runRuleTestCase(c *ruleTestCase) string {
+	_, w, err := l.ParseContents(c.filename, c.code, nil)
+	if err != nil {
+		return err.Error()
+	}
+
+	matched := false
+	for _, r := range w.GetReports() {
+		switch r.CheckName() {
+		case "syntax":
+			return r.msg
+		case c.rule.Name:
+			matched = true
+		}
+	}
+
+	switch {
+	case c.test.Match && !matched:
+		return "expected a match, but rule didn't trigger"
+	case !c.test.Match && matched:
+		return "unexpected match"
+	}
+	return ""
+}
+
+// ruleTestCode converts test code snippet into a PHP file contents.
+// Snippets for the local rules are wrapped into a function.
+func ruleTestCode(code string, local bool) []byte {
+	if strings.HasPrefix(code, "<?php") {
+		return []byte(code)
+	}
+	if !strings.HasSuffix(code, ";") && !strings.HasSuffix(code, "}") {
+		code += ";"
+	}
+	if local {
+		return []byte("<?php\nfunction __rule_test() {\n" + code + "\n}\n")
+	}
+	return []byte("<?php\n" + code + "\n")
+}
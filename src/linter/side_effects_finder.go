@@ -61,14 +61,14 @@ func (f *sideEffectsFinder) functionCallIsPure(n *expr.FunctionCall) bool {
 		}
 	}
 
-	if !meta.IsIndexingComplete() {
+	if !f.st.MetaInfo().IsIndexingComplete() {
 		return false
 	}
 	if funcName != "" {
 		// We can't properly annotate builtin funcs
 		// as pure during the indexing, since we don't have
 		// their PHP sources.
-		_, ok := meta.GetInternalFunctionInfo(funcName)
+		_, ok := f.st.MetaInfo().GetInternalFunctionInfo(funcName)
 		if ok {
 			return false
 		}
@@ -82,7 +82,7 @@ func (f *sideEffectsFinder) functionCallIsPure(n *expr.FunctionCall) bool {
 }
 
 func (f *sideEffectsFinder) staticCallIsPure(n *expr.StaticCall) bool {
-	if !meta.IsIndexingComplete() {
+	if !f.st.MetaInfo().IsIndexingComplete() {
 		return false
 	}
 	methodName, ok := n.Call.(*node.Identifier)
@@ -93,12 +93,12 @@ func (f *sideEffectsFinder) staticCallIsPure(n *expr.StaticCall) bool {
 	if !ok {
 		return false
 	}
-	info, _, ok := solver.FindMethod(className, methodName.Value)
+	info, _, ok := solver.FindMethod(f.st.MetaInfo(), className, methodName.Value)
 	return ok && info.IsPure() && info.ExitFlags == 0
 }
 
 func (f *sideEffectsFinder) methodCallIsPure(n *expr.MethodCall) bool {
-	if !meta.IsIndexingComplete() {
+	if !f.st.MetaInfo().IsIndexingComplete() {
 		return false
 	}
 	methodName, ok := n.Method.(*node.Identifier)
@@ -110,8 +110,8 @@ func (f *sideEffectsFinder) methodCallIsPure(n *expr.MethodCall) bool {
 		return false
 	}
 	return typ.Find(func(typ string) bool {
-		info, impl, ok := solver.FindMethod(typ, methodName.Value)
-		if meta.IsInternalClass(impl) {
+		info, impl, ok := solver.FindMethod(f.st.MetaInfo(), typ, methodName.Value)
+		if f.st.MetaInfo().IsInternalClass(impl) {
 			return false
 		}
 		return ok && info.IsPure() && info.ExitFlags == 0
@@ -8,6 +8,7 @@ import (
 	"github.com/setpill/noverify/src/meta"
 	"github.com/setpill/noverify/src/php/parser/node"
 	"github.com/setpill/noverify/src/php/parser/node/expr"
+	"github.com/setpill/noverify/src/php/parser/node/expr/binary"
 	"github.com/setpill/noverify/src/php/parser/node/name"
 	"github.com/setpill/noverify/src/php/parser/node/scalar"
 	"github.com/setpill/noverify/src/php/parser/printer"
@@ -46,8 +47,8 @@ func FlagsToString(f int) string {
 	return "Exit flags: [" + strings.Join(res, ", ") + "], digits: " + fmt.Sprintf("%d", f)
 }
 
-func haveMagicMethod(class string, methodName string) bool {
-	_, _, ok := solver.FindMethod(class, methodName)
+func haveMagicMethod(info *meta.Index, class string, methodName string) bool {
+	_, _, ok := solver.FindMethod(info, class, methodName)
 	return ok
 }
 
@@ -180,7 +181,8 @@ type funcCallInfo struct {
 func resolveFunctionCall(sc *meta.Scope, st *meta.ClassParseState, customTypes []solver.CustomType, call *expr.FunctionCall) funcCallInfo {
 	var res funcCallInfo
 	res.canAnalyze = true
-	if !meta.IsIndexingComplete() {
+	info := st.MetaInfo()
+	if !info.IsIndexingComplete() {
 		return res
 	}
 
@@ -196,19 +198,19 @@ func resolveFunctionCall(sc *meta.Scope, st *meta.ClassParseState, customTypes [
 				nameStr = alias + `\` + meta.NamePartsToString(nm.Parts[1:])
 			}
 			res.fqName = nameStr
-			res.info, res.defined = meta.Info.GetFunction(res.fqName)
+			res.info, res.defined = info.GetFunction(res.fqName)
 		} else {
 			res.fqName = st.Namespace + `\` + nameStr
-			res.info, res.defined = meta.Info.GetFunction(res.fqName)
+			res.info, res.defined = info.GetFunction(res.fqName)
 			if !res.defined && st.Namespace != "" {
 				res.fqName = `\` + nameStr
-				res.info, res.defined = meta.Info.GetFunction(res.fqName)
+				res.info, res.defined = info.GetFunction(res.fqName)
 			}
 		}
 
 	case *name.FullyQualified:
 		res.fqName = meta.FullyQualifiedToString(nm)
-		res.info, res.defined = meta.Info.GetFunction(res.fqName)
+		res.info, res.defined = info.GetFunction(res.fqName)
 	default:
 		res.defined = false
 
@@ -216,7 +218,7 @@ func resolveFunctionCall(sc *meta.Scope, st *meta.ClassParseState, customTypes [
 			if res.defined {
 				return
 			}
-			res.info, _, res.defined = solver.FindMethod(typ, `__invoke`)
+			res.info, _, res.defined = solver.FindMethod(info, typ, `__invoke`)
 		})
 
 		if !res.defined {
@@ -226,3 +228,83 @@ func resolveFunctionCall(sc *meta.Scope, st *meta.ClassParseState, customTypes [
 
 	return res
 }
+
+// classImplements reports whether className is equal to parentName,
+// extends or implements it.
+func classImplements(info *meta.Index, className, parentName string) bool {
+	visited := make(map[string]struct{}, 8)
+	for {
+		if strings.EqualFold(className, parentName) {
+			return true
+		}
+		if solver.Implements(info, className, parentName) {
+			return true
+		}
+		if _, ok := visited[className]; ok {
+			return false
+		}
+		visited[className] = struct{}{}
+
+		class, ok := info.GetClass(className)
+		if !ok || class.Parent == "" {
+			return false
+		}
+		className = class.Parent
+	}
+}
+
+// isConstExpr reports whether n is a compile-time constant expression,
+// like the ones that are permitted inside class constant initializers.
+func isConstExpr(n node.Node) bool {
+	v := constExprChecker{isConst: true}
+	n.Walk(&v)
+	return v.isConst
+}
+
+type constExprChecker struct {
+	isConst bool
+}
+
+func (v *constExprChecker) EnterNode(w walker.Walkable) bool {
+	if !v.isConst {
+		return false
+	}
+
+	switch n := w.(type) {
+	case *scalar.Lnumber, *scalar.Dnumber, *scalar.String, *scalar.MagicConstant,
+		*expr.ConstFetch, *expr.Array, *expr.ArrayItem, *expr.Ternary,
+		*expr.UnaryMinus, *expr.UnaryPlus, *expr.BooleanNot, *expr.BitwiseNot,
+		*name.Name, *name.FullyQualified, *name.Relative, *name.NamePart, *node.Identifier:
+		return true
+
+	case *expr.ClassConstFetch:
+		switch n.Class.(type) {
+		case *name.Name, *name.FullyQualified, *name.Relative, *node.Identifier:
+			return true
+		}
+
+	case *scalar.Heredoc:
+		// Only nowdoc-like heredocs without interpolation are constant.
+		for _, p := range n.Parts {
+			if _, ok := p.(*scalar.EncapsedStringPart); !ok {
+				v.isConst = false
+				return false
+			}
+		}
+		return false
+
+	case *binary.BitwiseAnd, *binary.BitwiseOr, *binary.BitwiseXor,
+		*binary.BooleanAnd, *binary.BooleanOr, *binary.Coalesce, *binary.Concat,
+		*binary.Div, *binary.Equal, *binary.Greater, *binary.GreaterOrEqual,
+		*binary.Identical, *binary.LogicalAnd, *binary.LogicalOr, *binary.LogicalXor,
+		*binary.Minus, *binary.Mod, *binary.Mul, *binary.NotEqual, *binary.NotIdentical,
+		*binary.Plus, *binary.Pow, *binary.ShiftLeft, *binary.ShiftRight,
+		*binary.Smaller, *binary.SmallerOrEqual, *binary.Spaceship:
+		return true
+	}
+
+	v.isConst = false
+	return false
+}
+
+func (v *constExprChecker) LeaveNode(w walker.Walkable) {}
@@ -0,0 +1,207 @@
+package linttest_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/setpill/noverify/src/linter"
+	"github.com/setpill/noverify/src/linttest"
+)
+
+const externalCheckerEnv = "NOVERIFY_TEST_EXTERNAL_CHECKER"
+
+func TestExternalChecker(t *testing.T) {
+	os.Setenv(externalCheckerEnv, "1")
+	defer os.Unsetenv(externalCheckerEnv)
+
+	c, err := linter.StartExternalChecker(os.Args[0] + " -test.run=^TestExternalCheckerProcess$")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	linter.ExternalCheckers = []*linter.ExternalChecker{c}
+	defer func() {
+		linter.ExternalCheckers = nil
+		if err := c.Close(); err != nil {
+			t.Errorf("close: %v", err)
+		}
+	}()
+
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+/** @return string */
+function get_name() { return 'x'; }
+
+function f() {
+  $x = 10;
+  eval($x);
+  $_ = get_name();
+}
+`)
+	test.Expect = []string{
+		"eval argument type is int at _file0.php:7\n  eval($x);\n  ^^^^^^^^",
+		"get_name returns string",
+	}
+	test.RunAndMatch()
+}
+
+func TestExternalCheckerTimeout(t *testing.T) {
+	os.Setenv(externalCheckerEnv, "hang")
+	defer os.Unsetenv(externalCheckerEnv)
+
+	defer func(timeout time.Duration) { linter.ExternalCheckerTimeout = timeout }(linter.ExternalCheckerTimeout)
+	linter.ExternalCheckerTimeout = 200 * time.Millisecond
+
+	c, err := linter.StartExternalChecker(os.Args[0] + " -test.run=^TestExternalCheckerProcess$")
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	linter.ExternalCheckers = []*linter.ExternalChecker{c}
+	defer func() { linter.ExternalCheckers = nil }()
+
+	start := time.Now()
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+function f() {
+  eval('1');
+}
+`)
+	test.RunAndMatch()
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("analysis took %s, the checker is not killed", elapsed)
+	}
+
+	err = c.Close()
+	if err == nil || !strings.Contains(err.Error(), "killed") {
+		t.Errorf("close: expected the checker process to be killed, got %v", err)
+	}
+}
+
+// TestExternalCheckerProcess is not a real test, it implements
+// an external checker process for TestExternalChecker.
+//
+// It reports all eval calls and function calls of the known functions.
+// In "hang" mode it never responds to the check requests.
+func TestExternalCheckerProcess(t *testing.T) {
+	mode := os.Getenv(externalCheckerEnv)
+	if mode != "1" && mode != "hang" {
+		return
+	}
+	defer os.Exit(0)
+
+	dec := json.NewDecoder(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+
+	type message struct {
+		ID     int             `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+		Result json.RawMessage `json:"result"`
+	}
+	type astNode struct {
+		Kind   string                     `json:"kind"`
+		Type   string                     `json:"type"`
+		Fields map[string]json.RawMessage `json:"fields"`
+		Pos    map[string]int             `json:"pos"`
+	}
+
+	metaRequestID := 0
+	lookupFunction := func(name string) map[string]interface{} {
+		metaRequestID++
+		enc.Encode(map[string]interface{}{
+			"id":     metaRequestID,
+			"method": "meta",
+			"params": map[string]string{"kind": "function", "name": name},
+		})
+		var resp message
+		if err := dec.Decode(&resp); err != nil {
+			panic(err)
+		}
+		var fn map[string]interface{}
+		json.Unmarshal(resp.Result, &fn)
+		return fn
+	}
+
+	var reports []map[string]interface{}
+	report := func(n *astNode, format string, args ...interface{}) {
+		reports = append(reports, map[string]interface{}{
+			"check_name": "external",
+			"severity":   "WARNING",
+			"message":    fmt.Sprintf(format, args...),
+			"line":       n.Pos["start_line"],
+			"start_char": n.Pos["start_char"],
+			"end_char":   n.Pos["end_char"],
+		})
+	}
+
+	var walk func(data json.RawMessage)
+	walk = func(data json.RawMessage) {
+		switch {
+		case strings.HasPrefix(string(data), "["):
+			var list []json.RawMessage
+			json.Unmarshal(data, &list)
+			for _, x := range list {
+				walk(x)
+			}
+			return
+		case !strings.HasPrefix(string(data), "{"):
+			return
+		}
+
+		var n astNode
+		json.Unmarshal(data, &n)
+		switch n.Kind {
+		case "expr.Eval":
+			var arg astNode
+			json.Unmarshal(n.Fields["expr"], &arg)
+			report(&n, "eval argument type is %s", arg.Type)
+		case "expr.FunctionCall":
+			var name struct {
+				Fields struct {
+					Parts []struct {
+						Fields struct {
+							Value string `json:"value"`
+						} `json:"fields"`
+					} `json:"parts"`
+				} `json:"fields"`
+			}
+			json.Unmarshal(n.Fields["function"], &name)
+			if len(name.Fields.Parts) == 1 {
+				funcName := name.Fields.Parts[0].Fields.Value
+				if fn := lookupFunction(funcName); fn != nil {
+					report(&n, "%s returns %s", funcName, fn["return_type"])
+				}
+			}
+		}
+		for _, f := range n.Fields {
+			walk(f)
+		}
+	}
+
+	for {
+		var msg message
+		if err := dec.Decode(&msg); err != nil {
+			return
+		}
+		switch msg.Method {
+		case "initialize":
+			enc.Encode(map[string]interface{}{"id": msg.ID, "result": map[string]interface{}{}})
+		case "check":
+			if mode == "hang" {
+				select {}
+			}
+			var params struct {
+				AST json.RawMessage `json:"ast"`
+			}
+			json.Unmarshal(msg.Params, &params)
+			reports = nil
+			walk(params.AST)
+			enc.Encode(map[string]interface{}{"id": msg.ID, "result": map[string]interface{}{"reports": reports}})
+		case "shutdown":
+			return
+		}
+	}
+}
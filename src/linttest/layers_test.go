@@ -0,0 +1,173 @@
+package linttest_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/setpill/noverify/src/layers"
+	"github.com/setpill/noverify/src/linter"
+	"github.com/setpill/noverify/src/linttest"
+)
+
+const testLayersConfig = `{
+  "layers": [
+    {"name": "Domain", "namespaces": ["App\\Domain"]},
+    {"name": "Infra", "namespaces": ["App\\Infra"], "allow": ["Domain"]},
+    {"name": "UI", "namespaces": ["App\\UI"], "allow": ["Domain", "Infra"]}
+  ]
+}`
+
+func TestLayersViolations(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+namespace App\Domain;
+
+use App\Infra\Db;
+
+interface Repo {}
+
+class User {
+  /** @var \App\Infra\Db */
+  private $db;
+
+  /** @return Db */
+  public function save(\App\UI\Form $form) {
+    if ($form instanceof \App\UI\Form) {
+      return new \App\Infra\Db();
+    }
+    return \App\Infra\Db::instance();
+  }
+}
+`)
+	test.AddFile(`<?php
+namespace App\Infra;
+
+class Db implements \App\Domain\Repo {
+  /** @return Db */
+  public static function instance() {
+    echo new \App\Domain\User();
+    return new Db();
+  }
+}
+`)
+	test.AddFile(`<?php
+namespace App\UI;
+
+class Form extends \App\Infra\Db {
+  /** @return \App\Domain\User */
+  public function f() {
+    return new \App\Domain\User();
+  }
+}
+`)
+	test.Expect = []string{
+		`class \App\Infra\Db from layer Infra is not allowed to be used in layer Domain`,
+		`class \App\Infra\Db from layer Infra is not allowed to be used in layer Domain`,
+		`class \App\Infra\Db from layer Infra is not allowed to be used in layer Domain`,
+		`class \App\Infra\Db from layer Infra is not allowed to be used in layer Domain`,
+		`class \App\Infra\Db from layer Infra is not allowed to be used in layer Domain`,
+		`class \App\UI\Form from layer UI is not allowed to be used in layer Domain`,
+		`class \App\UI\Form from layer UI is not allowed to be used in layer Domain`,
+	}
+	runLayersTest(t, test)
+}
+
+func TestLayersGroupUse(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+namespace App\Domain;
+
+use App\Infra\{Db, Cache};
+use App\Infra\{function connect, const TIMEOUT};
+use function App\Infra\{disconnect};
+`)
+	test.AddFile(`<?php
+namespace App\Infra;
+
+const TIMEOUT = 10;
+
+class Db {}
+class Cache {}
+
+function connect() {}
+function disconnect() {}
+`)
+	test.Expect = []string{
+		`class \App\Infra\Db from layer Infra is not allowed to be used in layer Domain`,
+		`class \App\Infra\Cache from layer Infra is not allowed to be used in layer Domain`,
+		`function \App\Infra\connect from layer Infra is not allowed to be used in layer Domain`,
+		`constant \App\Infra\TIMEOUT from layer Infra is not allowed to be used in layer Domain`,
+		`function \App\Infra\disconnect from layer Infra is not allowed to be used in layer Domain`,
+	}
+	runLayersTest(t, test)
+}
+
+func TestLayersCaseInsensitive(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+namespace app\domain;
+
+class Order {
+  /** @return mixed */
+  public function f() {
+    return new \APP\INFRA\Db();
+  }
+}
+`)
+	test.AddFile(`<?php
+namespace APP\INFRA;
+
+class Db {}
+`)
+	test.Expect = []string{
+		`class \APP\INFRA\Db from layer Infra is not allowed to be used in layer Domain`,
+	}
+	runLayersTest(t, test)
+}
+
+func TestLayersGraph(t *testing.T) {
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+namespace A;
+function f() { return new \B\Foo(); }
+`)
+	test.AddFile(`<?php
+namespace B;
+class Foo {
+  /** @return mixed */
+  public function f() { return \C\g(); }
+}
+`)
+	test.AddFile(`<?php
+namespace C;
+function g() { return \A\f(); }
+`)
+
+	oldGraph := linter.DepsGraph
+	linter.DepsGraph = layers.NewGraph()
+	test.RunAndMatch()
+	graph := linter.DepsGraph
+	linter.DepsGraph = oldGraph
+
+	var buf strings.Builder
+	graph.Print(&buf)
+	want := `\A -> \B (1 refs)
+\B -> \C (1 refs)
+\C -> \A (1 refs)
+cycle: [\A \B \C]
+`
+	if buf.String() != want {
+		t.Errorf("graph mismatch:\nhave:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func runLayersTest(t *testing.T, test *linttest.Suite) {
+	config, err := layers.Parse(strings.NewReader(testLayersConfig))
+	if err != nil {
+		t.Fatalf("parse layers config: %v", err)
+	}
+	oldLayers := linter.Layers
+	linter.Layers = config
+	test.RunAndMatch()
+	linter.Layers = oldLayers
+}
@@ -146,7 +146,7 @@ func (s *Suite) RunLinter() []*linter.Report {
 	meta.ResetInfo()
 
 	if len(s.LoadStubs) != 0 {
-		if err := cmd.LoadEmbeddedStubs(s.LoadStubs); err != nil {
+		if err := cmd.LoadEmbeddedStubs(linter.DefaultLinter(), s.LoadStubs); err != nil {
 			s.t.Fatalf("load stubs: %v", err)
 		}
 	}
@@ -1,11 +1,14 @@
 package linttest_test
 
 import (
+	"fmt"
+	"sort"
 	"strings"
 	"testing"
 
 	"github.com/setpill/noverify/src/linter"
 	"github.com/setpill/noverify/src/linttest"
+	"github.com/setpill/noverify/src/meta"
 	"github.com/setpill/noverify/src/rules"
 )
 
@@ -286,6 +289,400 @@ $name = "NoVerify"; // No warning
 	runRulesTest(t, test, rfile)
 }
 
+func TestRuleFilters(t *testing.T) {
+	rfile := `<?php
+/**
+ * @warning superglobal is passed to the query
+ * @filter $x ~ ^\$_(GET|POST)
+ */
+query($x);
+
+/**
+ * @warning non-constant format string
+ * @not-type string $format
+ * @or
+ * @type string $format
+ * @filter $format !~ ^['"]
+ */
+sprintf($format, ${"*"});
+
+/**
+ * @warning exceptions can't be JSON-encoded
+ * @type-implements \Throwable $e
+ */
+json_encode($e);
+
+/**
+ * @warning call result is not used in the condition
+ * @pure $cond
+ */
+assert($cond);
+
+/**
+ * @warning use a constant instead
+ * @const $x
+ */
+define_once($x);
+`
+
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+interface Throwable {}
+class Exception implements Throwable {}
+class MyException extends Exception {}
+
+function query($q) {}
+function sprintf($format, ...$args) { return ''; }
+function assert($x) {}
+function define_once($x) {}
+function json_encode($x) { return ''; }
+function f() { return 1; }
+function g() { echo 1; return 1; }
+
+const C = 1;
+
+function test($arg) {
+  query($_GET);    // Warning
+  query($_SERVER); // No warning
+  query($arg);     // No warning
+
+  $_ = sprintf(10, 1);      // Warning: not a string
+  $_ = sprintf($arg, 1);    // Warning: not a string
+  $s = 'x';
+  $_ = sprintf($s, 1);      // Warning: variable
+  $_ = sprintf('%d', 1);    // No warning
+
+  $_ = json_encode(new MyException()); // Warning
+  $_ = json_encode(new Exception());   // Warning
+  $_ = json_encode('x');               // No warning
+
+  assert($arg == 1);  // Warning
+  assert(g() == 1);   // No warning
+
+  define_once(1 + C * 2);      // Warning
+  define_once(['a' => C]);     // Warning
+  define_once(1 + $arg);       // No warning
+  define_once(f());            // No warning
+}
+`)
+
+	test.Expect = []string{
+		`superglobal is passed to the query`,
+		`non-constant format string`,
+		`non-constant format string`,
+		`non-constant format string`,
+		`exceptions can't be JSON-encoded`,
+		`exceptions can't be JSON-encoded`,
+		`call result is not used in the condition`,
+		`use a constant instead`,
+		`use a constant instead`,
+	}
+	runRulesTest(t, test, rfile)
+}
+
+func TestRuleContext(t *testing.T) {
+	rfile := `<?php
+/**
+ * @warning DB query inside a loop
+ * @scope local
+ * @in-loop
+ */
+db_query(${"*"});
+
+/**
+ * @warning repositories should be created by factories
+ * @not-in-class *Factory
+ */
+new $repo(${"*"});
+
+/**
+ * @warning constructor calls an overridable method
+ * @in-class App\*
+ * @in-method __construct
+ */
+$this->$method(${"*"});
+
+/**
+ * @warning legacy code uses die
+ * @in-namespace App\Legacy\*
+ * @not-in-try
+ */
+legacy_die($x);
+`
+
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+function db_query($q) {}
+function legacy_die($x) {}
+
+class Repo {}
+
+class RepoFactory {
+  /** create */
+  public function create() { return new Repo(); }
+}
+
+function loops($xs) {
+  db_query('a');
+  foreach ($xs as $x) {
+    db_query($x);
+    if ($x) {
+      db_query('b');
+    }
+  }
+  $_ = function() { db_query('c'); };
+  $repo = new Repo();
+  return $repo;
+}
+`)
+	test.AddFile(`<?php
+namespace App;
+
+class Base {
+  public function __construct() {
+    $this->init();
+  }
+
+  /** init */
+  public function init() {
+    $this->done();
+  }
+
+  /** done */
+  public function done() {}
+}
+`)
+	test.AddFile(`<?php
+namespace App\Legacy\Controllers;
+
+function f() {
+  legacy_die(1);
+  try {
+    legacy_die(2);
+  } catch (\Exception $_) {
+  }
+}
+`)
+	test.AddFile(`<?php
+namespace Other;
+
+function g() {
+  \legacy_die(3);
+}
+`)
+
+	test.Expect = []string{
+		`DB query inside a loop`,
+		`DB query inside a loop`,
+		`repositories should be created by factories`,
+		`constructor calls an overridable method`,
+		`legacy code uses die`,
+	}
+	runRulesTest(t, test, rfile)
+}
+
+func TestRuleSequence(t *testing.T) {
+	rfile := `<?php
+/**
+ * @warning file is not closed before return
+ * @scope local
+ * @not-contains fclose($f)
+ */
+{
+  $f = fopen(${"*"});
+  ${"*"};
+  return $_;
+}
+
+/**
+ * @warning lock is acquired twice
+ * @location $second
+ */
+{
+  $_ = lock($x);
+  ${"*"};
+  $second = lock($x);
+}
+`
+
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+function fopen($name) { return 1; }
+function fclose($f) {}
+function fread($f) { return ''; }
+function lock($x) { return 1; }
+
+function f1() {
+  $f = fopen('a');
+  $s = fread($f);
+  return $s;
+}
+
+function f2() {
+  $f = fopen('a');
+  $s = fread($f);
+  fclose($f);
+  return $s;
+}
+
+function f3($cond) {
+  $f = fopen('a');
+  if ($cond) {
+    fclose($f);
+  }
+  return 1;
+}
+
+function f4($g) {
+  $f = fopen('a');
+  fclose($g);
+  return $f;
+}
+
+function f5() {
+  $l1 = lock(1);
+  $l2 = lock(2);
+  $l3 = lock(1);
+  return [$l1, $l2, $l3];
+}
+`)
+
+	test.Expect = []string{
+		`file is not closed before return`,
+		`file is not closed before return`,
+		`lock is acquired twice`,
+	}
+	runRulesTest(t, test, rfile)
+}
+
+func TestRuleSequenceUnbraced(t *testing.T) {
+	rfile := `<?php
+/**
+ * @warning file is not closed before return
+ * @scope local
+ * @not-contains fclose($f)
+ */
+$f = fopen($_);
+${"*"};
+return $_;
+
+/**
+ * @warning die is called
+ */
+die($_);
+`
+
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+function fopen($name) { return 1; }
+function fclose($f) {}
+
+function f1() {
+  $f = fopen('a');
+  echo 1;
+  return $f;
+}
+
+function f2() {
+  $f = fopen('a');
+  fclose($f);
+  return 1;
+}
+
+function f3() {
+  die(1);
+}
+`)
+
+	test.Expect = []string{
+		`file is not closed before return`,
+		`die is called`,
+	}
+	runRulesTest(t, test, rfile)
+}
+
+func TestRuleMessageInterpolation(t *testing.T) {
+	rfile := `<?php
+/**
+ * @warning {{$x}} of type {{type $x}} is compared with {{$y}}, {{$z}} stays as is
+ */
+$x == $y;
+`
+
+	test := linttest.NewSuite(t)
+	test.AddFile(`<?php
+function sprintf($format, ...$args) { return ''; }
+
+function f($s) {
+  $i = 10;
+  $_ = $i == sprintf('%d',
+    $s);
+}
+`)
+
+	test.Expect = []string{
+		`$i of type int is compared with sprintf('%d', $s), {{$z}} stays as is`,
+	}
+	runRulesTest(t, test, rfile)
+}
+
+func TestRuleTestCases(t *testing.T) {
+	rfile := `<?php
+/**
+ * @warning use count instead of sizeof
+ * @test-match sizeof($a);
+ * @test-nomatch count($a);
+ * @test-match count($a)
+ */
+sizeof($_);
+
+/**
+ * @warning self-assignment
+ * @scope local
+ * @test-match $x = $x
+ * @test-nomatch $x = $y
+ * @test-match <?php $x = $x;
+ */
+$x = $x;
+
+/**
+ * @warning non-string needle
+ * @type !string $needle
+ * @test-match strpos($s, 10)
+ * @test-match strpos($s, 'x')
+ * @test-nomatch strpos($s, 'x')
+ */
+strpos($_, $needle);
+`
+	rparser := rules.NewParser()
+	rset, err := rparser.Parse("rules.php", strings.NewReader(rfile))
+	if err != nil {
+		t.Fatalf("parse rules: %v", err)
+	}
+
+	total, failures := linter.RunRuleTests(rset)
+	if total != 9 {
+		t.Errorf("expected 9 tests, got %d", total)
+	}
+	if _, ok := meta.Info.GetFunction(`\__rule_test`); ok {
+		t.Errorf("rule test cases are indexed into the package-level meta info")
+	}
+
+	var have []string
+	for _, f := range failures {
+		have = append(have, fmt.Sprintf("%d: %s: %s", f.Test.Line, f.Test.Code, f.Message))
+	}
+	sort.Strings(have)
+	want := []string{
+		"15: <?php $x = $x;: expected a match, but rule didn't trigger",
+		"23: strpos($s, 'x'): expected a match, but rule didn't trigger",
+		"6: count($a): expected a match, but rule didn't trigger",
+	}
+	if strings.Join(have, "\n") != strings.Join(want, "\n") {
+		t.Errorf("unexpected failures:\n%s", strings.Join(have, "\n"))
+	}
+}
+
 func runRulesTest(t *testing.T, test *linttest.Suite, rfile string) {
 	rparser := rules.NewParser()
 	rset, err := rparser.Parse("<test>", strings.NewReader(rfile))
@@ -8,24 +8,30 @@ import (
 	"github.com/setpill/noverify/src/php/parser/node/name"
 )
 
-var (
-	internalFunctions         FunctionsMap
-	internalFunctionOverrides FunctionsOverrideMap
-	internalClasses           ClassesMap
-
-	indexingComplete bool
-
-	// Info contains global meta information for all classes, functions, etc.
-	Info info
-)
+// Info contains global meta information for all classes, functions, etc.
+// It's the index that is used by the package-level functions.
+var Info *Index
 
 func init() {
 	ResetInfo()
 }
 
-// ResetInfo creates empty meta info
+// ResetInfo creates empty meta info.
+// The internal symbols and the indexing complete callbacks are kept.
 func ResetInfo() {
-	Info = info{
+	prev := Info
+	Info = NewIndex()
+	if prev != nil {
+		Info.internalFunctions = prev.internalFunctions
+		Info.internalFunctionOverrides = prev.internalFunctionOverrides
+		Info.internalClasses = prev.internalClasses
+		Info.onCompleteCallbacks = prev.onCompleteCallbacks
+	}
+}
+
+// NewIndex returns an empty index.
+func NewIndex() *Index {
+	return &Index{
 		Scope:                 NewScope(),
 		allFiles:              make(map[string]bool),
 		allTraits:             make(TraitsMap),
@@ -38,11 +44,11 @@ func ResetInfo() {
 		perFileFunctions:      make(map[string]FunctionsMap),
 		perFileConstants:      make(map[string]ConstantsMap),
 	}
-
-	indexingComplete = false
 }
 
-type info struct {
+// Index is the meta information about all classes, functions, etc.
+// of a project, including the internal symbols from the stubs.
+type Index struct {
 	sync.Mutex
 	*Scope
 	allFiles              map[string]bool
@@ -55,6 +61,13 @@ type info struct {
 	perFileClasses        map[string]ClassesMap
 	perFileFunctions      map[string]FunctionsMap
 	perFileConstants      map[string]ConstantsMap
+
+	internalFunctions         FunctionsMap
+	internalFunctionOverrides FunctionsOverrideMap
+	internalClasses           ClassesMap
+
+	indexingComplete    bool
+	onCompleteCallbacks []func()
 }
 
 // PerFile contains all meta information about the specified file
@@ -65,26 +78,26 @@ type PerFile struct {
 	Constants ConstantsMap
 }
 
-func (i *info) GetConstant(nm string) (res ConstantInfo, ok bool) {
+func (i *Index) GetConstant(nm string) (res ConstantInfo, ok bool) {
 	res, ok = i.allConstants[nm]
 	return res, ok
 }
 
-func (i *info) NumConstants() int {
+func (i *Index) NumConstants() int {
 	return len(i.allConstants)
 }
 
-func (i *info) GetClass(nm string) (res ClassInfo, ok bool) {
+func (i *Index) GetClass(nm string) (res ClassInfo, ok bool) {
 	res, ok = i.allClasses[nm]
 	return res, ok
 }
 
-func (i *info) GetTrait(nm string) (res ClassInfo, ok bool) {
+func (i *Index) GetTrait(nm string) (res ClassInfo, ok bool) {
 	res, ok = i.allTraits[nm]
 	return res, ok
 }
 
-func (i *info) GetClassOrTrait(nm string) (res ClassInfo, ok bool) {
+func (i *Index) GetClassOrTrait(nm string) (res ClassInfo, ok bool) {
 	res, ok = i.allClasses[nm]
 	if ok {
 		return res, true
@@ -93,29 +106,29 @@ func (i *info) GetClassOrTrait(nm string) (res ClassInfo, ok bool) {
 	return res, ok
 }
 
-func (i *info) NumClasses() int {
+func (i *Index) NumClasses() int {
 	return len(i.allClasses)
 }
 
-func (i *info) GetFunction(nm string) (res FuncInfo, ok bool) {
+func (i *Index) GetFunction(nm string) (res FuncInfo, ok bool) {
 	res, ok = i.allFunctions[nm]
 	return res, ok
 }
 
-func (i *info) GetFunctionOverride(nm string) (res FuncInfoOverride, ok bool) {
+func (i *Index) GetFunctionOverride(nm string) (res FuncInfoOverride, ok bool) {
 	res, ok = i.allFunctionsOverrides[nm]
 	return res, ok
 }
 
-func (i *info) NumFunctions() int {
+func (i *Index) NumFunctions() int {
 	return len(i.allFunctions)
 }
 
-func (i *info) NumFilesWithFunctions() int {
+func (i *Index) NumFilesWithFunctions() int {
 	return len(i.perFileFunctions)
 }
 
-func (i *info) FindFunctions(substr string) (res []string) {
+func (i *Index) FindFunctions(substr string) (res []string) {
 	for f := range i.allFunctions {
 		if strings.HasPrefix(f, substr) {
 			res = append(res, f)
@@ -124,7 +137,7 @@ func (i *info) FindFunctions(substr string) (res []string) {
 	return res
 }
 
-func (i *info) FindConstants(substr string) (res []string) {
+func (i *Index) FindConstants(substr string) (res []string) {
 	for c := range i.allConstants {
 		if strings.HasPrefix(c, substr) {
 			res = append(res, c)
@@ -133,35 +146,63 @@ func (i *info) FindConstants(substr string) (res []string) {
 	return res
 }
 
-func (i *info) InitStubs() {
+// IterateClasses calls cb for every known class and interface.
+func (i *Index) IterateClasses(cb func(name string, class ClassInfo)) {
+	for nm, class := range i.allClasses {
+		cb(nm, class)
+	}
+}
+
+// IterateTraits calls cb for every known trait.
+func (i *Index) IterateTraits(cb func(name string, trait ClassInfo)) {
+	for nm, trait := range i.allTraits {
+		cb(nm, trait)
+	}
+}
+
+// IterateFunctions calls cb for every known function.
+func (i *Index) IterateFunctions(cb func(name string, fn FuncInfo)) {
+	for nm, fn := range i.allFunctions {
+		cb(nm, fn)
+	}
+}
+
+// IterateConstants calls cb for every known global constant.
+func (i *Index) IterateConstants(cb func(name string, c ConstantInfo)) {
+	for nm, c := range i.allConstants {
+		cb(nm, c)
+	}
+}
+
+func (i *Index) InitStubs() {
 	i.Lock()
 	defer i.Unlock()
 
-	internalFunctions = make(FunctionsMap)
+	i.internalFunctions = make(FunctionsMap)
 	for k, v := range i.allFunctions {
-		internalFunctions[k] = v
+		i.internalFunctions[k] = v
 	}
 
-	internalClasses = make(ClassesMap)
+	i.internalClasses = make(ClassesMap)
 	for k, v := range i.allClasses {
-		internalClasses[k] = v
+		i.internalClasses[k] = v
 	}
 
-	internalFunctionOverrides = make(FunctionsOverrideMap)
+	i.internalFunctionOverrides = make(FunctionsOverrideMap)
 	for k, v := range i.allFunctionsOverrides {
-		internalFunctionOverrides[k] = v
+		i.internalFunctionOverrides[k] = v
 	}
 }
 
-func (i *info) AddFilenameNonLocked(filename string) {
+func (i *Index) AddFilenameNonLocked(filename string) {
 	i.allFiles[filename] = true
 }
 
-func (i *info) FileExists(filename string) bool {
+func (i *Index) FileExists(filename string) bool {
 	return i.allFiles[filename]
 }
 
-func (i *info) GetMetaForFile(filename string) (res PerFile) {
+func (i *Index) GetMetaForFile(filename string) (res PerFile) {
 	if t, ok := i.perFileTraits[filename]; ok {
 		res.Traits = t
 	}
@@ -181,7 +222,7 @@ func (i *info) GetMetaForFile(filename string) (res PerFile) {
 	return res
 }
 
-func (i *info) DeleteMetaForFileNonLocked(filename string) {
+func (i *Index) DeleteMetaForFileNonLocked(filename string) {
 	oldClasses := i.perFileClasses[filename]
 	delete(i.allFiles, filename)
 	delete(i.perFileClasses, filename)
@@ -216,7 +257,7 @@ func (i *info) DeleteMetaForFileNonLocked(filename string) {
 	}
 }
 
-func (i *info) AddClassesNonLocked(filename string, m ClassesMap) {
+func (i *Index) AddClassesNonLocked(filename string, m ClassesMap) {
 	i.perFileClasses[filename] = m
 	for k, v := range m {
 		// TODO: resolve duplicate class conflicts
@@ -224,7 +265,7 @@ func (i *info) AddClassesNonLocked(filename string, m ClassesMap) {
 	}
 }
 
-func (i *info) AddTraitsNonLocked(filename string, m ClassesMap) {
+func (i *Index) AddTraitsNonLocked(filename string, m ClassesMap) {
 	i.perFileTraits[filename] = m
 	for k, v := range m {
 		// TODO: resolve duplicate trait conflicts
@@ -232,7 +273,7 @@ func (i *info) AddTraitsNonLocked(filename string, m ClassesMap) {
 	}
 }
 
-func (i *info) AddFunctionsNonLocked(filename string, m FunctionsMap) {
+func (i *Index) AddFunctionsNonLocked(filename string, m FunctionsMap) {
 	i.perFileFunctions[filename] = m
 
 	for k, v := range m {
@@ -243,7 +284,7 @@ func (i *info) AddFunctionsNonLocked(filename string, m FunctionsMap) {
 	}
 }
 
-func (i *info) AddFunctionsOverridesNonLocked(filename string, m FunctionsOverrideMap) {
+func (i *Index) AddFunctionsOverridesNonLocked(filename string, m FunctionsOverrideMap) {
 	// TODO: support filename map
 
 	for k, v := range m {
@@ -251,7 +292,7 @@ func (i *info) AddFunctionsOverridesNonLocked(filename string, m FunctionsOverri
 	}
 }
 
-func (i *info) AddConstantsNonLocked(filename string, m ConstantsMap) {
+func (i *Index) AddConstantsNonLocked(filename string, m ConstantsMap) {
 	i.perFileConstants[filename] = m
 
 	for k, v := range m {
@@ -259,16 +300,21 @@ func (i *info) AddConstantsNonLocked(filename string, m ConstantsMap) {
 	}
 }
 
-func (i *info) AddToGlobalScopeNonLocked(filename string, sc *Scope) {
+func (i *Index) AddToGlobalScopeNonLocked(filename string, sc *Scope) {
 	sc.Iterate(func(nm string, typ TypesMap, alwaysDefined bool) {
 		i.AddVarName(nm, typ, "global", alwaysDefined)
 	})
 }
 
 type FuncParam struct {
-	IsRef bool
-	Name  string
-	Typ   TypesMap
+	IsRef      bool
+	IsVariadic bool
+	Name       string
+	Typ        TypesMap
+
+	// Default is a default value source code.
+	// It's empty for parameters without default values.
+	Default string
 }
 
 type PhpDocInfo struct {
@@ -281,6 +327,10 @@ type FuncFlags uint8
 const (
 	FuncStatic FuncFlags = 1 << iota
 	FuncPure
+	// FuncAbstract is set for abstract and interface methods.
+	FuncAbstract
+	// FuncReturnHint is set for functions with the return type hint.
+	FuncReturnHint
 )
 
 type FuncInfo struct {
@@ -294,8 +344,9 @@ type FuncInfo struct {
 	Doc          PhpDocInfo
 }
 
-func (info *FuncInfo) IsStatic() bool { return info.Flags&FuncStatic != 0 }
-func (info *FuncInfo) IsPure() bool   { return info.Flags&FuncPure != 0 }
+func (info *FuncInfo) IsStatic() bool   { return info.Flags&FuncStatic != 0 }
+func (info *FuncInfo) IsPure() bool     { return info.Flags&FuncPure != 0 }
+func (info *FuncInfo) IsAbstract() bool { return info.Flags&FuncAbstract != 0 }
 
 type OverrideType int
 
@@ -346,8 +397,16 @@ type ConstantInfo struct {
 	AccessLevel AccessLevel
 }
 
+type ClassFlags uint8
+
+const (
+	// ClassInterface is set for interfaces.
+	ClassInterface ClassFlags = 1 << iota
+)
+
 type ClassInfo struct {
 	Pos              ElementPosition
+	Flags            ClassFlags
 	Parent           string
 	ParentInterfaces []string // interfaces allow multiple inheritance
 	Traits           map[string]struct{}
@@ -357,6 +416,8 @@ type ClassInfo struct {
 	Constants        ConstantsMap
 }
 
+func (info *ClassInfo) IsInterface() bool { return info.Flags&ClassInterface != 0 }
+
 type ClassParseState struct {
 	IsTrait                 bool
 	Namespace               string
@@ -366,6 +427,18 @@ type ClassParseState struct {
 	CurrentParentClass      string
 	CurrentParentInterfaces []string // interfaces allow for multiple inheritance...
 	CurrentFunction         string   // current method or function name
+
+	// Info is the index that is used to resolve the symbols.
+	// The global Info is used if it's nil.
+	Info *Index
+}
+
+// MetaInfo returns the index that is used to resolve the symbols.
+func (st *ClassParseState) MetaInfo() *Index {
+	if st.Info == nil {
+		return Info
+	}
+	return st.Info
 }
 
 type TraitsMap map[string]ClassInfo
@@ -383,43 +456,65 @@ type ElementPosition struct {
 	Length    int32 // body length
 }
 
-func IsInternalClass(className string) bool {
-	_, ok := internalClasses[className]
+func (i *Index) IsInternalClass(className string) bool {
+	_, ok := i.internalClasses[className]
 	return ok
 }
 
-func GetInternalFunctionInfo(fn string) (info FuncInfo, ok bool) {
-	info, ok = internalFunctions[fn]
+func (i *Index) GetInternalFunctionInfo(fn string) (info FuncInfo, ok bool) {
+	info, ok = i.internalFunctions[fn]
 	return info, ok
 }
 
-func GetInternalFunctionOverrideInfo(fn string) (info FuncInfoOverride, ok bool) {
-	info, ok = internalFunctionOverrides[fn]
+func (i *Index) GetInternalFunctionOverrideInfo(fn string) (info FuncInfoOverride, ok bool) {
+	info, ok = i.internalFunctionOverrides[fn]
 	return info, ok
 }
 
-var onCompleteCallbacks []func()
-
-func OnIndexingComplete(cb func()) {
-	if indexingComplete {
+func (i *Index) OnIndexingComplete(cb func()) {
+	if i.indexingComplete {
 		cb()
 	} else {
-		onCompleteCallbacks = append(onCompleteCallbacks, cb)
+		i.onCompleteCallbacks = append(i.onCompleteCallbacks, cb)
 	}
 }
 
-func SetIndexingComplete(complete bool) {
-	indexingComplete = complete
+func (i *Index) SetIndexingComplete(complete bool) {
+	i.indexingComplete = complete
 
 	if complete {
-		for _, cb := range onCompleteCallbacks {
+		for _, cb := range i.onCompleteCallbacks {
 			cb()
 		}
 	}
 }
 
+func (i *Index) IsIndexingComplete() bool {
+	return i.indexingComplete
+}
+
+func IsInternalClass(className string) bool {
+	return Info.IsInternalClass(className)
+}
+
+func GetInternalFunctionInfo(fn string) (info FuncInfo, ok bool) {
+	return Info.GetInternalFunctionInfo(fn)
+}
+
+func GetInternalFunctionOverrideInfo(fn string) (info FuncInfoOverride, ok bool) {
+	return Info.GetInternalFunctionOverrideInfo(fn)
+}
+
+func OnIndexingComplete(cb func()) {
+	Info.OnIndexingComplete(cb)
+}
+
+func SetIndexingComplete(complete bool) {
+	Info.SetIndexingComplete(complete)
+}
+
 func IsIndexingComplete() bool {
-	return indexingComplete
+	return Info.IsIndexingComplete()
 }
 
 func FullyQualifiedToString(n *name.FullyQualified) string {
@@ -2128,7 +2128,7 @@ yydefault:
 
 			yylex.(*Parser).returnTokenToPool(yyDollar, &yyVAL)
 
-			if yylex.(*Parser).currentToken.Value == "\xff" {
+			if yylex.(*Parser).currentToken.Value == "\uFFFD" {
 				yylex.(*Parser).setFreeFloating(yylex.(*Parser).rootNode, freefloating.End, yylex.(*Parser).currentToken.FreeFloating)
 			}
 		}
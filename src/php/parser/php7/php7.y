@@ -308,7 +308,7 @@ start:
 
                 yylex.(*Parser).returnTokenToPool(yyDollar, &yyVAL)
                 
-                if yylex.(*Parser).currentToken.Value == "\xff" {
+                if yylex.(*Parser).currentToken.Value == "\uFFFD" {
                     yylex.(*Parser).setFreeFloating(yylex.(*Parser).rootNode, freefloating.End, yylex.(*Parser).currentToken.FreeFloating)
                 }
             }
@@ -7,6 +7,7 @@ import (
 	"gotest.tools/assert"
 
 	"github.com/setpill/noverify/src/php/parser/errors"
+	"github.com/setpill/noverify/src/php/parser/freefloating"
 	"github.com/setpill/noverify/src/php/parser/node"
 	"github.com/setpill/noverify/src/php/parser/node/expr"
 	"github.com/setpill/noverify/src/php/parser/node/expr/assign"
@@ -14134,3 +14135,18 @@ func TestPhp7ControlCharsErrors(t *testing.T) {
 	actual := php7parser.GetErrors()
 	assert.DeepEqual(t, expected, actual)
 }
+
+func TestPhp7EndFreeFloating(t *testing.T) {
+	src := "<?php echo $a;\n// trailing comment\n"
+
+	php7parser := php7.NewParser(bytes.NewBufferString(src), "test.php")
+	php7parser.WithFreeFloating()
+	php7parser.Parse()
+
+	ff := php7parser.GetRootNode().GetFreeFloating()
+	var end string
+	for _, s := range (*ff)[freefloating.End] {
+		end += s.Value
+	}
+	assert.Equal(t, "\n// trailing comment\n", end)
+}
@@ -0,0 +1,867 @@
+package printer
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/setpill/noverify/src/php/parser/freefloating"
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/node/expr"
+	"github.com/setpill/noverify/src/php/parser/node/name"
+	"github.com/setpill/noverify/src/php/parser/node/scalar"
+	"github.com/setpill/noverify/src/php/parser/node/stmt"
+	"github.com/setpill/noverify/src/php/parser/position"
+	"github.com/setpill/noverify/src/php/parser/walker"
+)
+
+// NewFormatter returns a PrettyPrinter that formats code according to the PSR-12 coding style.
+//
+// Printed AST must be parsed from src with freefloating enabled:
+// src is used to preserve comments, blank lines, parentheses and
+// string literals of the original code.
+//
+// Argument lists, parameter lists and arrays that don't fit into
+// lineWidth columns are split into several lines, one item per line.
+func NewFormatter(w io.Writer, src []byte, lineWidth int) *PrettyPrinter {
+	fw := &formatWriter{w: w}
+	return &PrettyPrinter{
+		w:         fw,
+		indentStr: "    ",
+		f: &formatState{
+			src:       src,
+			lineWidth: lineWidth,
+			fw:        fw,
+		},
+	}
+}
+
+// formatState is a PrettyPrinter state that is only used by the formatter.
+type formatState struct {
+	src       []byte
+	lineWidth int
+	fw        *formatWriter
+
+	// comments are all comments of the printed file sorted by their position.
+	// comments[next:] are not printed yet.
+	comments []freefloating.String
+	next     int
+
+	// lastPos is a source offset of the last printed statement or comment end.
+	// It's used to preserve blank lines between statements.
+	lastPos int
+
+	// lineComment is true if the last printed comment
+	// requires a line break after it.
+	lineComment bool
+
+	// blankLine is true if the next line must be preceded by a blank line.
+	blankLine bool
+
+	// measuring is true while a single-line list width is computed.
+	measuring bool
+
+	// stack contains nodes that are being printed.
+	stack []node.Node
+
+	// parens is a number of parentheses around expressions in the source code.
+	parens map[node.Node]int
+}
+
+// fmtPrint is Print implementation for the formatter mode.
+func (p *PrettyPrinter) fmtPrint(n node.Node) {
+	if n == nil {
+		return
+	}
+	f := p.f
+	f.stack = append(f.stack, n)
+
+	parens := p.fmtParens(n)
+	for i := 0; i < parens; i++ {
+		io.WriteString(p.w, "(")
+	}
+	if isParenthesizable(n) {
+		f.fw.openParens = 0
+	}
+	p.printNode(n)
+	for i := 0; i < parens; i++ {
+		io.WriteString(p.w, ")")
+	}
+
+	f.stack = f.stack[:len(f.stack)-1]
+}
+
+// PrintStmts prints stmts that belong to the root statements tree,
+// it's used to format a part of the file. Statements are printed one per line
+// with the depth indentation along with the comments between them.
+//
+// Comments before the first statement and after the last statement line are not printed.
+// The printer must be created by NewFormatter.
+func (p *PrettyPrinter) PrintStmts(root *node.Root, stmts []node.Node, depth int) {
+	f := p.f
+	p.fmtInit(root)
+	if len(stmts) == 0 {
+		return
+	}
+
+	start := stmts[0].GetPosition().StartPos
+	for f.next < len(f.comments) && f.comments[f.next].Position.StartPos < start {
+		f.next++
+	}
+	f.lastPos = start
+
+	p.indentDepth = depth - 1
+	p.fmtPrintStmts(stmts, start, true)
+	io.WriteString(p.w, "\n")
+	f.fw.Flush()
+}
+
+// fmtInit collects the root comments and parentheses.
+func (p *PrettyPrinter) fmtInit(root *node.Root) {
+	f := p.f
+	f.comments = collectComments(root)
+	parens := &parensCounter{src: f.src, parens: make(map[node.Node]int)}
+	root.Walk(parens)
+	f.parens = parens.parens
+}
+
+func (p *PrettyPrinter) fmtPrintRoot(n *node.Root) {
+	f := p.f
+	p.fmtInit(n)
+
+	for _, s := range n.Stmts {
+		if _, ok := s.(*stmt.InlineHtml); ok {
+			// Mixed PHP and HTML files are printed as is:
+			// they can't follow the PSR-12 anyway.
+			f.fw.writeVerbatim(string(f.src))
+			f.fw.Flush()
+			return
+		}
+	}
+
+	io.WriteString(p.w, "<?php")
+	// The opening tag is a header block too, so it's separated
+	// from the header blocks that follow it by a blank line.
+	f.blankLine = len(n.Stmts) != 0 && isHeaderStmt(n.Stmts[0])
+	p.indentDepth--
+	p.fmtPrintStmts(n.Stmts, len(f.src)+1, false)
+	p.indentDepth++
+	io.WriteString(p.w, "\n")
+	f.fw.Flush()
+}
+
+// fmtPrintNodes is printNodes implementation for the formatter mode.
+func (p *PrettyPrinter) fmtPrintNodes(nn []node.Node) {
+	p.fmtPrintStmts(nn, p.fmtBlockEnd(), true)
+}
+
+// fmtPrintStmts prints statements, one per line, along with the comments
+// that are located before the end source offset.
+//
+// If first is true, no line break is inserted before the first statement.
+func (p *PrettyPrinter) fmtPrintStmts(nn []node.Node, end int, first bool) {
+	f := p.f
+	p.indentDepth++
+
+	newLine := func(start int) {
+		if !first {
+			io.WriteString(p.w, "\n")
+			if f.blankLine || p.fmtHasBlankLine(f.lastPos, start) {
+				io.WriteString(p.w, "\n")
+			}
+		}
+		first = false
+		f.blankLine = false
+		p.printIndent()
+	}
+
+	for i, n := range nn {
+		var next node.Node
+		if i+1 < len(nn) {
+			next = nn[i+1]
+		}
+
+		pos := n.GetPosition()
+		if pos == nil {
+			newLine(f.lastPos)
+			p.Print(n)
+			f.blankLine = blankLineAfter(n, next)
+			continue
+		}
+		for f.next < len(f.comments) && f.comments[f.next].Position.StartPos < pos.StartPos {
+			c := f.comments[f.next]
+			newLine(c.Position.StartPos)
+			p.fmtComment(c)
+		}
+		newLine(pos.StartPos)
+		p.Print(n)
+		f.lastPos = pos.EndPos
+		p.fmtTrailingComments(pos)
+		f.blankLine = blankLineAfter(n, next)
+	}
+	for f.next < len(f.comments) && f.comments[f.next].Position.StartPos < end {
+		c := f.comments[f.next]
+		newLine(c.Position.StartPos)
+		p.fmtComment(c)
+	}
+
+	p.indentDepth--
+}
+
+// blankLineAfter reports whether n must be followed by a blank line.
+// PSR-12 requires a blank line after the declare statement,
+// the namespace declaration and the block of use declarations.
+func blankLineAfter(n, next node.Node) bool {
+	switch n := n.(type) {
+	case *stmt.Declare:
+		_, ok := n.Stmt.(*stmt.Nop)
+		return ok
+	case *stmt.Namespace:
+		// Namespaces with braces have their own blocks.
+		return n.Stmts == nil
+	case *stmt.UseList, *stmt.GroupUse:
+		switch next.(type) {
+		case *stmt.UseList, *stmt.GroupUse:
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// isHeaderStmt reports whether n belongs to the PSR-12 file header.
+func isHeaderStmt(n node.Node) bool {
+	switch n := n.(type) {
+	case *stmt.Declare:
+		_, ok := n.Stmt.(*stmt.Nop)
+		return ok
+	case *stmt.Namespace:
+		return n.Stmts == nil
+	case *stmt.UseList, *stmt.GroupUse:
+		return true
+	}
+	return false
+}
+
+// fmtBlockEnd returns a source offset of the statements block end
+// for the printNodes call.
+func (p *PrettyPrinter) fmtBlockEnd() int {
+	stack := p.f.stack
+	if len(stack) == 0 {
+		return len(p.f.src) + 1
+	}
+
+	var next node.Node
+	switch n := stack[len(stack)-1].(type) {
+	case *stmt.Try:
+		// Try statements are followed by catches and finally
+		// that have their own statements.
+		if len(n.Catches) != 0 {
+			next = n.Catches[0]
+		} else if n.Finally != nil {
+			next = n.Finally
+		}
+	case *stmt.If:
+		if len(n.ElseIf) != 0 {
+			next = n.ElseIf[0]
+		} else if n.Else != nil {
+			next = n.Else
+		}
+	}
+	if next != nil && next.GetPosition() != nil {
+		return next.GetPosition().StartPos
+	}
+
+	if pos := stack[len(stack)-1].GetPosition(); pos != nil {
+		return pos.EndPos
+	}
+	return 0
+}
+
+// fmtBody prints a control structure body.
+// Bodies without braces are enclosed by them.
+func (p *PrettyPrinter) fmtBody(n node.Node) {
+	switch s := n.(type) {
+	case *stmt.Nop:
+		p.Print(s)
+	case *stmt.StmtList:
+		io.WriteString(p.w, " ")
+		p.Print(s)
+	default:
+		io.WriteString(p.w, " {\n")
+		end := 0
+		if pos := s.GetPosition(); pos != nil {
+			end = pos.EndPos
+		}
+		p.fmtPrintStmts([]node.Node{s}, end, true)
+		io.WriteString(p.w, "\n")
+		p.printIndent()
+		io.WriteString(p.w, "}")
+	}
+}
+
+// fmtBodySeparator prints whitespace between a control structure body
+// and the following keyword, like `} else`.
+func (p *PrettyPrinter) fmtBodySeparator(body node.Node) {
+	if _, ok := body.(*stmt.Nop); ok {
+		io.WriteString(p.w, "\n")
+		p.printIndent()
+		return
+	}
+	io.WriteString(p.w, " ")
+}
+
+// fmtList prints comma-separated items enclosed by open and close.
+//
+// Items are printed one per line if they don't fit into the line width,
+// if there are comments between them or if the first item was located
+// on the next line after openLine in the original source.
+// end is a source offset of the list end, tail is a width of the
+// code that follows the list on the same line.
+//
+// Returns true if items were printed one per line.
+func (p *PrettyPrinter) fmtList(open, close string, items []node.Node, openLine, end, tail int, trailingComma bool) bool {
+	f := p.f
+
+	multiline := false
+	if len(items) != 0 {
+		if pos := items[0].GetPosition(); pos != nil && openLine != 0 && pos.StartLine > openLine {
+			multiline = true
+		}
+	}
+	if !multiline && p.fmtHasListComments(items, end) {
+		multiline = true
+	}
+	if !multiline && !f.measuring && f.lineWidth > 0 {
+		width := p.fmtMeasure(func() {
+			p.fmtSingleLineList(open, close, items)
+		})
+		multiline = width+tail > f.lineWidth
+	}
+
+	if !multiline {
+		p.fmtSingleLineList(open, close, items)
+		return false
+	}
+
+	io.WriteString(p.w, open)
+	p.indentDepth++
+	for i, item := range items {
+		pos := item.GetPosition()
+		if pos != nil {
+			for f.next < len(f.comments) && f.comments[f.next].Position.StartPos < pos.StartPos {
+				io.WriteString(p.w, "\n")
+				p.printIndent()
+				p.fmtComment(f.comments[f.next])
+			}
+		}
+		io.WriteString(p.w, "\n")
+		p.printIndent()
+		p.Print(item)
+		if i != len(items)-1 || trailingComma {
+			io.WriteString(p.w, ",")
+		}
+		if pos != nil {
+			p.fmtTrailingComments(pos)
+		}
+	}
+	for f.next < len(f.comments) && f.comments[f.next].Position.StartPos < end {
+		io.WriteString(p.w, "\n")
+		p.printIndent()
+		p.fmtComment(f.comments[f.next])
+	}
+	p.indentDepth--
+	io.WriteString(p.w, "\n")
+	p.printIndent()
+	io.WriteString(p.w, close)
+	return true
+}
+
+func (p *PrettyPrinter) fmtSingleLineList(open, close string, items []node.Node) {
+	io.WriteString(p.w, open)
+	p.joinPrint(", ", items)
+	io.WriteString(p.w, close)
+}
+
+// fmtHasListComments reports whether there are comments
+// between the list items or after the last item.
+func (p *PrettyPrinter) fmtHasListComments(items []node.Node, end int) bool {
+	f := p.f
+	for i := f.next; i < len(f.comments); i++ {
+		c := f.comments[i].Position
+		if c.StartPos >= end {
+			return false
+		}
+		inside := false
+		for _, item := range items {
+			if pos := item.GetPosition(); pos != nil && c.StartPos >= pos.StartPos && c.StartPos <= pos.EndPos {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			return true
+		}
+	}
+	return false
+}
+
+// fmtMeasure returns a column where the first line printed by fn ends.
+// Nothing is written to the output.
+func (p *PrettyPrinter) fmtMeasure(fn func()) int {
+	f := p.f
+	oldW, oldFW, oldNext, oldLastPos, oldLineComment := p.w, f.fw, f.next, f.lastPos, f.lineComment
+
+	var buf bytes.Buffer
+	fw := &formatWriter{
+		w:          &buf,
+		col0:       oldFW.column(),
+		openParens: oldFW.openParens,
+	}
+	p.w = fw
+	f.fw = fw
+	f.measuring = true
+	fn()
+	fw.Flush()
+	f.measuring = false
+	p.w, f.fw, f.next, f.lastPos, f.lineComment = oldW, oldFW, oldNext, oldLastPos, oldLineComment
+
+	firstLine := buf.String()
+	if i := strings.IndexByte(firstLine, '\n'); i != -1 {
+		firstLine = firstLine[:i]
+	}
+	return fw.col0 + len(firstLine)
+}
+
+// fmtWidth returns a width of the first line of n.
+func (p *PrettyPrinter) fmtWidth(n node.Node) int {
+	col := p.f.fw.column()
+	return p.fmtMeasure(func() {
+		p.Print(n)
+	}) - col
+}
+
+// fmtTrailingComments prints comments that are located inside the
+// node and comments that follow it on the same line.
+func (p *PrettyPrinter) fmtTrailingComments(pos *position.Position) {
+	f := p.f
+	first := true
+	for f.next < len(f.comments) {
+		c := f.comments[f.next]
+		if c.Position.StartPos > pos.EndPos && c.Position.StartLine != pos.EndLine {
+			break
+		}
+		if !first && f.lineComment {
+			io.WriteString(p.w, "\n")
+			p.printIndent()
+		} else {
+			io.WriteString(p.w, " ")
+		}
+		p.fmtComment(c)
+		first = false
+	}
+}
+
+// fmtComment prints the next comment.
+// Continuation lines of the multi-line doc comments are re-indented.
+func (p *PrettyPrinter) fmtComment(c freefloating.String) {
+	f := p.f
+	f.next++
+
+	text := strings.TrimRight(c.Value, " \t\r\n")
+	f.lastPos = c.Position.StartPos - 1 + len(text)
+	f.lineComment = !strings.HasPrefix(text, "/*")
+
+	lines := strings.Split(text, "\n")
+	io.WriteString(p.w, lines[0])
+	for _, l := range lines[1:] {
+		trimmed := strings.TrimLeft(l, " \t")
+		if strings.HasPrefix(trimmed, "*") {
+			io.WriteString(p.w, "\n")
+			p.printIndent()
+			io.WriteString(p.w, " "+trimmed)
+		} else {
+			f.fw.writeVerbatim("\n" + l)
+		}
+	}
+}
+
+// fmtVerbatim prints n source code as is.
+// Returns false if n source code is unknown.
+func (p *PrettyPrinter) fmtVerbatim(n node.Node) bool {
+	pos := n.GetPosition()
+	if pos == nil || pos.StartPos < 1 || pos.EndPos > len(p.f.src) {
+		return false
+	}
+	p.f.fw.writeVerbatim(string(p.f.src[pos.StartPos-1 : pos.EndPos]))
+	return true
+}
+
+// fmtHeredoc prints heredoc (or nowdoc) body as is.
+// Returns false if the heredoc source code is unknown.
+func (p *PrettyPrinter) fmtHeredoc(n *scalar.Heredoc) bool {
+	pos := n.GetPosition()
+	if pos == nil || pos.StartPos < 1 || pos.EndPos > len(p.f.src) {
+		return false
+	}
+	body := p.f.src[pos.StartPos-1 : pos.EndPos]
+	nl := bytes.IndexByte(body, '\n')
+	if nl == -1 {
+		return false
+	}
+	io.WriteString(p.w, "<<<"+n.Label)
+	p.f.fw.writeVerbatim(string(body[nl:]))
+	return true
+}
+
+// fmtParens returns a number of parentheses that should be printed around n.
+// Parentheses of the original source code are preserved.
+func (p *PrettyPrinter) fmtParens(n node.Node) int {
+	// Some of the parentheses are printed as a part of the parent node syntax.
+	parens := p.f.parens[n] - p.f.fw.openParens
+	if parens < 0 {
+		return 0
+	}
+	return parens
+}
+
+// parensCounter finds parentheses around every expression of the source code.
+//
+// Node positions don't include parentheses, so node extents
+// are computed in a post-order traversal: every node extent
+// includes its children extents along with their parentheses.
+type parensCounter struct {
+	src    []byte
+	parens map[node.Node]int
+	stack  [][]extent
+}
+
+// extent is a [start, end) source code range.
+type extent struct {
+	start int
+	end   int
+}
+
+func (c *parensCounter) EnterNode(w walker.Walkable) bool {
+	c.stack = append(c.stack, nil)
+	return true
+}
+
+func (c *parensCounter) LeaveNode(w walker.Walkable) {
+	children := c.stack[len(c.stack)-1]
+	c.stack = c.stack[:len(c.stack)-1]
+
+	n, ok := w.(node.Node)
+	if !ok {
+		return
+	}
+	ext, ok := extent{}, false
+	if pos := n.GetPosition(); pos != nil {
+		ext, ok = extent{start: pos.StartPos - 1, end: pos.EndPos}, true
+	}
+	for _, child := range children {
+		if !ok {
+			ext, ok = child, true
+			continue
+		}
+		if child.start < ext.start {
+			ext.start = child.start
+		}
+		if child.end > ext.end {
+			ext.end = child.end
+		}
+	}
+	if !ok {
+		return
+	}
+
+	if isParenthesizable(n) {
+		ext = c.countParens(n, ext)
+	}
+	if len(c.stack) != 0 {
+		c.stack[len(c.stack)-1] = append(c.stack[len(c.stack)-1], ext)
+	}
+}
+
+// countParens records a number of parentheses around ext
+// and returns the extent that includes them.
+func (c *parensCounter) countParens(n node.Node, ext extent) extent {
+	var open []int
+	for i := ext.start - 1; i >= 0 && i < len(c.src); i-- {
+		if c.src[i] == '(' {
+			open = append(open, i)
+		} else if !isSpace(c.src[i]) {
+			break
+		}
+	}
+	var closing []int
+	for i := ext.end; i >= 0 && i < len(c.src); i++ {
+		if c.src[i] == ')' {
+			closing = append(closing, i)
+		} else if !isSpace(c.src[i]) {
+			break
+		}
+	}
+
+	parens := len(open)
+	if len(closing) < parens {
+		parens = len(closing)
+	}
+	if parens == 0 {
+		return ext
+	}
+	c.parens[n] = parens
+	return extent{start: open[parens-1], end: closing[parens-1] + 1}
+}
+
+// isParenthesizable reports whether n is an expression that can be
+// enclosed by parentheses.
+func isParenthesizable(n node.Node) bool {
+	switch n.(type) {
+	case *node.SimpleVar, *node.Var:
+		return true
+	case *expr.ArrayItem, *expr.ClosureUse, *scalar.EncapsedStringPart:
+		return false
+	}
+	pkg := reflect.TypeOf(n).Elem().PkgPath()
+	switch pkg[strings.LastIndexByte(pkg, '/')+1:] {
+	case "expr", "assign", "binary", "cast", "scalar":
+		return true
+	}
+	return false
+}
+
+// isBoolOrNull reports whether n is a true, false or null constant name.
+func isBoolOrNull(n node.Node) bool {
+	nm, ok := n.(*name.Name)
+	if !ok || len(nm.Parts) != 1 {
+		return false
+	}
+	part, ok := nm.Parts[0].(*name.NamePart)
+	if !ok {
+		return false
+	}
+	switch strings.ToLower(part.Value) {
+	case "true", "false", "null":
+		return true
+	}
+	return false
+}
+
+// fmtHasBlankLine reports whether there is a blank line
+// between the from and to source offsets.
+func (p *PrettyPrinter) fmtHasBlankLine(from, to int) bool {
+	src := p.f.src
+	if to > len(src) {
+		to = len(src)
+	}
+	newlines := 0
+	for i := from; i >= 0 && i < to; i++ {
+		switch c := src[i]; {
+		case c == '\n':
+			newlines++
+			if newlines == 2 {
+				return true
+			}
+		case !isSpace(c):
+			newlines = 0
+		}
+	}
+	return false
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// startLine returns n start line or 0 if it's unknown.
+func startLine(n node.Node) int {
+	if n == nil || n.GetPosition() == nil {
+		return 0
+	}
+	return n.GetPosition().StartLine
+}
+
+// endPos returns n end source offset or 0 if it's unknown.
+func endPos(n node.Node) int {
+	if n == nil || n.GetPosition() == nil {
+		return 0
+	}
+	return n.GetPosition().EndPos
+}
+
+// arrayItemNodes converts array items to nodes.
+// Empty trailing item that is produced by a trailing comma is removed.
+func arrayItemNodes(items []*expr.ArrayItem) []node.Node {
+	if len(items) != 0 {
+		if last := items[len(items)-1]; last == nil || (last.Key == nil && last.Val == nil) {
+			items = items[:len(items)-1]
+		}
+	}
+	res := make([]node.Node, len(items))
+	for i, item := range items {
+		res[i] = item
+	}
+	return res
+}
+
+type commentsCollector struct {
+	comments []freefloating.String
+}
+
+func (c *commentsCollector) EnterNode(w walker.Walkable) bool {
+	n, ok := w.(node.Node)
+	if !ok || n.GetFreeFloating() == nil {
+		return true
+	}
+	for _, list := range *n.GetFreeFloating() {
+		for _, s := range list {
+			if s.StringType == freefloating.CommentType && s.Position != nil {
+				c.comments = append(c.comments, s)
+			}
+		}
+	}
+	return true
+}
+
+func (c *commentsCollector) LeaveNode(w walker.Walkable) {}
+
+func collectComments(root node.Node) []freefloating.String {
+	c := &commentsCollector{}
+	root.Walk(c)
+	sort.Slice(c.comments, func(i, j int) bool {
+		return c.comments[i].Position.StartPos < c.comments[j].Position.StartPos
+	})
+	return c.comments
+}
+
+// formatWriter removes trailing whitespace, excessive blank lines and
+// blank lines after the opening and before the closing braces.
+//
+// Verbatim text (like string literals contents) is written unchanged.
+type formatWriter struct {
+	w io.Writer
+
+	line []byte
+
+	// col0 is a column of the first line start.
+	col0 int
+
+	// blankLines is a number of pending blank lines.
+	blankLines int
+
+	// afterBrace is true if the last written line ends with an opening brace.
+	afterBrace bool
+
+	// started is true if some line was already written.
+	started bool
+
+	// openParens is a number of opening parentheses at the end of the
+	// written text, whitespace is ignored.
+	openParens int
+}
+
+func (fw *formatWriter) Write(b []byte) (int, error) {
+	for _, c := range b {
+		if c == '\n' {
+			fw.endLine(false)
+			continue
+		}
+		fw.line = append(fw.line, c)
+		switch c {
+		case ' ', '\t':
+		case '(':
+			fw.openParens++
+		default:
+			fw.openParens = 0
+		}
+	}
+	return len(b), nil
+}
+
+func (fw *formatWriter) writeVerbatim(s string) {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if i != 0 {
+			fw.endLine(true)
+		}
+		fw.line = append(fw.line, l...)
+	}
+	fw.openParens = 0
+}
+
+func (fw *formatWriter) column() int {
+	if fw.started {
+		return len(fw.line)
+	}
+	return fw.col0 + len(fw.line)
+}
+
+func (fw *formatWriter) endLine(verbatim bool) {
+	line := fw.line
+	fw.line = nil
+
+	if !verbatim {
+		line = bytes.TrimRight(line, " \t")
+		if len(line) == 0 {
+			fw.blankLines++
+			return
+		}
+	}
+
+	trimmed := bytes.TrimLeft(line, " \t")
+	closing := !verbatim && isClosingLine(trimmed)
+	if fw.blankLines != 0 && fw.started && !fw.afterBrace && !closing {
+		fw.w.Write([]byte("\n"))
+	}
+	fw.blankLines = 0
+
+	fw.w.Write(line)
+	fw.w.Write([]byte("\n"))
+	fw.started = true
+	fw.afterBrace = !verbatim && bytes.HasSuffix(line, []byte("{"))
+}
+
+// isClosingLine reports whether line closes a block:
+// it starts with a closing brace or an alternative syntax keyword.
+func isClosingLine(line []byte) bool {
+	if len(line) == 0 {
+		return false
+	}
+	if line[0] == '}' {
+		return true
+	}
+	for _, kw := range closingKeywords {
+		if !bytes.HasPrefix(line, []byte(kw)) {
+			continue
+		}
+		rest := line[len(kw):]
+		if len(rest) == 0 || !isIdentChar(rest[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+var closingKeywords = []string{
+	"endif", "endwhile", "endfor", "endforeach", "endswitch", "enddeclare", "elseif", "else",
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// Flush writes the last unterminated line.
+func (fw *formatWriter) Flush() {
+	if len(fw.line) != 0 {
+		line := fw.line
+		fw.line = nil
+		if fw.blankLines != 0 && fw.started && !fw.afterBrace {
+			fw.w.Write([]byte("\n"))
+		}
+		fw.blankLines = 0
+		fw.w.Write(line)
+	}
+}
@@ -19,6 +19,9 @@ type PrettyPrinter struct {
 	w           io.Writer
 	indentStr   string
 	indentDepth int
+
+	// f is not nil for the PrettyPrinter created by NewFormatter.
+	f *formatState
 }
 
 // NewPrettyPrinter -  Constructor for PrettyPrinter
@@ -31,6 +34,10 @@ func NewPrettyPrinter(w io.Writer, indentStr string) *PrettyPrinter {
 }
 
 func (p *PrettyPrinter) Print(n node.Node) {
+	if p.f != nil {
+		p.fmtPrint(n)
+		return
+	}
 	p.printNode(n)
 }
 
@@ -64,7 +71,44 @@ func (p *PrettyPrinter) joinPrint(glue string, nn []node.Node) {
 	}
 }
 
+func (p *PrettyPrinter) printArguments(args *node.ArgumentList) {
+	if p.f != nil {
+		p.fmtList("(", ")", args.Arguments, startLine(args), endPos(args), 1, false)
+		return
+	}
+
+	io.WriteString(p.w, "(")
+	p.joinPrint(", ", args.Arguments)
+	io.WriteString(p.w, ")")
+}
+
+// printParams prints function parameters.
+// Returns true if they were printed one per line.
+func (p *PrettyPrinter) printParams(params []node.Node, openLine int, returnType node.Node) bool {
+	if p.f != nil {
+		end := 0
+		if len(params) != 0 {
+			end = endPos(params[len(params)-1]) + 1
+		}
+		tail := 0
+		if returnType != nil && !p.f.measuring {
+			tail = len(": ") + p.fmtWidth(returnType)
+		}
+		return p.fmtList("(", ")", params, openLine, end, tail, false)
+	}
+
+	io.WriteString(p.w, "(")
+	p.joinPrint(", ", params)
+	io.WriteString(p.w, ")")
+	return false
+}
+
 func (p *PrettyPrinter) printNodes(nn []node.Node) {
+	if p.f != nil {
+		p.fmtPrintNodes(nn)
+		return
+	}
+
 	p.indentDepth++
 	l := len(nn) - 1
 	for k, n := range nn {
@@ -421,6 +465,11 @@ func (p *PrettyPrinter) printNode(n node.Node) {
 func (p *PrettyPrinter) printNodeRoot(n node.Node) {
 	v := n.(*node.Root)
 
+	if p.f != nil {
+		p.fmtPrintRoot(v)
+		return
+	}
+
 	if len(v.Stmts) > 0 {
 		firstStmt := v.Stmts[0]
 		v.Stmts = v.Stmts[1:]
@@ -544,6 +593,11 @@ func (p *PrettyPrinter) printScalarDNumber(n node.Node) {
 func (p *PrettyPrinter) printScalarString(n node.Node) {
 	v := n.(*scalar.String).Value
 
+	if p.f != nil {
+		p.f.fw.writeVerbatim(v)
+		return
+	}
+
 	io.WriteString(p.w, v)
 }
 
@@ -554,6 +608,10 @@ func (p *PrettyPrinter) printScalarEncapsedStringPart(n node.Node) {
 
 func (p *PrettyPrinter) printScalarEncapsed(n node.Node) {
 	nn := n.(*scalar.Encapsed)
+	if p.f != nil && p.fmtVerbatim(nn) {
+		return
+	}
+
 	io.WriteString(p.w, "\"")
 
 	for _, part := range nn.Parts {
@@ -573,6 +631,10 @@ func (p *PrettyPrinter) printScalarEncapsed(n node.Node) {
 func (p *PrettyPrinter) printScalarHeredoc(n node.Node) {
 	nn := n.(*scalar.Heredoc)
 
+	if p.f != nil && p.fmtHeredoc(nn) {
+		return
+	}
+
 	io.WriteString(p.w, "<<<")
 	io.WriteString(p.w, nn.Label)
 	io.WriteString(p.w, "\n")
@@ -919,50 +981,51 @@ func (p *PrettyPrinter) printBinarySpaceship(n node.Node) {
 func (p *PrettyPrinter) printArray(n node.Node) {
 	nn := n.(*cast.Array)
 
-	io.WriteString(p.w, "(array)")
-	p.Print(nn.Expr)
+	p.printCast("(array)", nn.Expr)
 }
 
 func (p *PrettyPrinter) printBool(n node.Node) {
 	nn := n.(*cast.Bool)
 
-	io.WriteString(p.w, "(bool)")
-	p.Print(nn.Expr)
+	p.printCast("(bool)", nn.Expr)
 }
 
 func (p *PrettyPrinter) printDouble(n node.Node) {
 	nn := n.(*cast.Double)
 
-	io.WriteString(p.w, "(float)")
-	p.Print(nn.Expr)
+	p.printCast("(float)", nn.Expr)
 }
 
 func (p *PrettyPrinter) printInt(n node.Node) {
 	nn := n.(*cast.Int)
 
-	io.WriteString(p.w, "(int)")
-	p.Print(nn.Expr)
+	p.printCast("(int)", nn.Expr)
 }
 
 func (p *PrettyPrinter) printObject(n node.Node) {
 	nn := n.(*cast.Object)
 
-	io.WriteString(p.w, "(object)")
-	p.Print(nn.Expr)
+	p.printCast("(object)", nn.Expr)
 }
 
 func (p *PrettyPrinter) printString(n node.Node) {
 	nn := n.(*cast.String)
 
-	io.WriteString(p.w, "(string)")
-	p.Print(nn.Expr)
+	p.printCast("(string)", nn.Expr)
 }
 
 func (p *PrettyPrinter) printUnset(n node.Node) {
 	nn := n.(*cast.Unset)
 
-	io.WriteString(p.w, "(unset)")
-	p.Print(nn.Expr)
+	p.printCast("(unset)", nn.Expr)
+}
+
+func (p *PrettyPrinter) printCast(cast string, e node.Node) {
+	io.WriteString(p.w, cast)
+	if p.f != nil {
+		io.WriteString(p.w, " ")
+	}
+	p.Print(e)
 }
 
 // expr
@@ -989,6 +1052,15 @@ func (p *PrettyPrinter) printExprArrayItem(n node.Node) {
 func (p *PrettyPrinter) printExprArray(n node.Node) {
 	nn := n.(*expr.Array)
 
+	if p.f != nil {
+		open, close := "array(", ")"
+		if nn.ShortSyntax {
+			open, close = "[", "]"
+		}
+		p.fmtList(open, close, arrayItemNodes(nn.Items), startLine(nn), endPos(nn), 1, true)
+		return
+	}
+
 	if nn.ShortSyntax {
 		io.WriteString(p.w, "[")
 		p.joinPrintArrayItems(", ", nn.Items)
@@ -1048,9 +1120,7 @@ func (p *PrettyPrinter) printExprClosure(n node.Node) {
 		io.WriteString(p.w, "&")
 	}
 
-	io.WriteString(p.w, "(")
-	p.joinPrint(", ", nn.Params)
-	io.WriteString(p.w, ")")
+	p.printParams(nn.Params, startLine(nn), nn.ReturnType)
 
 	if nn.ClosureUse != nil {
 		io.WriteString(p.w, " ")
@@ -1072,6 +1142,11 @@ func (p *PrettyPrinter) printExprClosure(n node.Node) {
 func (p *PrettyPrinter) printExprConstFetch(n node.Node) {
 	nn := n.(*expr.ConstFetch)
 
+	if p.f != nil && isBoolOrNull(nn.Constant) {
+		io.WriteString(p.w, strings.ToLower(nn.Constant.(*name.Name).Parts[0].(*name.NamePart).Value))
+		return
+	}
+
 	p.Print(nn.Constant)
 }
 
@@ -1114,9 +1189,7 @@ func (p *PrettyPrinter) printExprFunctionCall(n node.Node) {
 	nn := n.(*expr.FunctionCall)
 
 	p.Print(nn.Function)
-	io.WriteString(p.w, "(")
-	p.joinPrint(", ", nn.ArgumentList.Arguments)
-	io.WriteString(p.w, ")")
+	p.printArguments(nn.ArgumentList)
 }
 
 func (p *PrettyPrinter) printExprInclude(n node.Node) {
@@ -1168,10 +1241,8 @@ func (p *PrettyPrinter) printExprMethodCall(n node.Node) {
 
 	p.Print(nn.Variable)
 	io.WriteString(p.w, "->")
-	p.Print(nn.Method)
-	io.WriteString(p.w, "(")
-	p.joinPrint(", ", nn.ArgumentList.Arguments)
-	io.WriteString(p.w, ")")
+	p.printMemberName(nn.Method)
+	p.printArguments(nn.ArgumentList)
 }
 
 func (p *PrettyPrinter) printExprNew(n node.Node) {
@@ -1181,9 +1252,11 @@ func (p *PrettyPrinter) printExprNew(n node.Node) {
 	p.Print(nn.Class)
 
 	if nn.ArgumentList != nil {
-		io.WriteString(p.w, "(")
-		p.joinPrint(", ", nn.ArgumentList.Arguments)
-		io.WriteString(p.w, ")")
+		p.printArguments(nn.ArgumentList)
+	} else if p.f != nil {
+		if _, ok := nn.Class.(*stmt.Class); !ok {
+			io.WriteString(p.w, "()")
+		}
 	}
 }
 
@@ -1228,7 +1301,7 @@ func (p *PrettyPrinter) printExprPropertyFetch(n node.Node) {
 
 	p.Print(nn.Variable)
 	io.WriteString(p.w, "->")
-	p.Print(nn.Property)
+	p.printMemberName(nn.Property)
 }
 
 func (p *PrettyPrinter) printExprReference(n node.Node) {
@@ -1255,6 +1328,10 @@ func (p *PrettyPrinter) printExprRequireOnce(n node.Node) {
 func (p *PrettyPrinter) printExprShellExec(n node.Node) {
 	nn := n.(*expr.ShellExec)
 
+	if p.f != nil && p.fmtVerbatim(nn) {
+		return
+	}
+
 	io.WriteString(p.w, "`")
 	for _, part := range nn.Parts {
 		switch part.(type) {
@@ -1274,10 +1351,8 @@ func (p *PrettyPrinter) printExprStaticCall(n node.Node) {
 
 	p.Print(nn.Class)
 	io.WriteString(p.w, "::")
-	p.Print(nn.Call)
-	io.WriteString(p.w, "(")
-	p.joinPrint(", ", nn.ArgumentList.Arguments)
-	io.WriteString(p.w, ")")
+	p.printMemberName(nn.Call)
+	p.printArguments(nn.ArgumentList)
 }
 
 func (p *PrettyPrinter) printExprStaticPropertyFetch(n node.Node) {
@@ -1308,6 +1383,12 @@ func (p *PrettyPrinter) printExprUnaryMinus(n node.Node) {
 	nn := n.(*expr.UnaryMinus)
 
 	io.WriteString(p.w, "-")
+	switch nn.Expr.(type) {
+	case *expr.UnaryMinus, *expr.PreDec:
+		if p.f == nil || p.fmtParens(nn.Expr) == 0 {
+			io.WriteString(p.w, " ")
+		}
+	}
 	p.Print(nn.Expr)
 }
 
@@ -1315,6 +1396,12 @@ func (p *PrettyPrinter) printExprUnaryPlus(n node.Node) {
 	nn := n.(*expr.UnaryPlus)
 
 	io.WriteString(p.w, "+")
+	switch nn.Expr.(type) {
+	case *expr.UnaryPlus, *expr.PreInc:
+		if p.f == nil || p.fmtParens(nn.Expr) == 0 {
+			io.WriteString(p.w, " ")
+		}
+	}
 	p.Print(nn.Expr)
 }
 
@@ -1325,7 +1412,20 @@ func (p *PrettyPrinter) printExprSimpleVar(nn *node.SimpleVar) {
 func (p *PrettyPrinter) printExprVar(n node.Node) {
 	nn := n.(*node.Var)
 	io.WriteString(p.w, "$")
-	p.Print(nn.Expr)
+	p.printMemberName(nn.Expr)
+}
+
+// printMemberName prints a dynamic member (or variable) name.
+// Names that are not identifiers or variables are enclosed by braces.
+func (p *PrettyPrinter) printMemberName(n node.Node) {
+	switch n.(type) {
+	case *node.Identifier, *node.SimpleVar, *node.Var:
+		p.Print(n)
+	default:
+		io.WriteString(p.w, "{")
+		p.Print(n)
+		io.WriteString(p.w, "}")
+	}
 }
 
 func (p *PrettyPrinter) printExprYieldFrom(n node.Node) {
@@ -1338,7 +1438,11 @@ func (p *PrettyPrinter) printExprYieldFrom(n node.Node) {
 func (p *PrettyPrinter) printExprYield(n node.Node) {
 	nn := n.(*expr.Yield)
 
-	io.WriteString(p.w, "yield ")
+	io.WriteString(p.w, "yield")
+
+	if nn.Key != nil || nn.Value != nil {
+		io.WriteString(p.w, " ")
+	}
 
 	if nn.Key != nil {
 		p.Print(nn.Key)
@@ -1403,9 +1507,7 @@ func (p *PrettyPrinter) printStmtClassMethod(n node.Node) {
 	}
 
 	p.Print(nn.MethodName)
-	io.WriteString(p.w, "(")
-	p.joinPrint(", ", nn.Params)
-	io.WriteString(p.w, ")")
+	multiline := p.printParams(nn.Params, startLine(nn.MethodName), nn.ReturnType)
 
 	if nn.ReturnType != nil {
 		io.WriteString(p.w, ": ")
@@ -1414,8 +1516,12 @@ func (p *PrettyPrinter) printStmtClassMethod(n node.Node) {
 
 	switch s := nn.Stmt.(type) {
 	case *stmt.StmtList:
-		io.WriteString(p.w, "\n")
-		p.printIndent()
+		if multiline {
+			io.WriteString(p.w, " ")
+		} else {
+			io.WriteString(p.w, "\n")
+			p.printIndent()
+		}
 		io.WriteString(p.w, "{\n")
 		p.printNodes(s.Stmts)
 		io.WriteString(p.w, "\n")
@@ -1441,9 +1547,7 @@ func (p *PrettyPrinter) printStmtClass(n node.Node) {
 	}
 
 	if nn.ArgumentList != nil {
-		io.WriteString(p.w, "(")
-		p.joinPrint(", ", nn.ArgumentList.Arguments)
-		io.WriteString(p.w, ")")
+		p.printArguments(nn.ArgumentList)
 	}
 
 	if nn.Extends != nil {
@@ -1456,9 +1560,14 @@ func (p *PrettyPrinter) printStmtClass(n node.Node) {
 		p.joinPrint(", ", nn.Implements.InterfaceNames)
 	}
 
-	io.WriteString(p.w, "\n")
-	p.printIndent()
-	io.WriteString(p.w, "{\n")
+	if p.f != nil && nn.ClassName == nil {
+		// Anonymous class.
+		io.WriteString(p.w, " {\n")
+	} else {
+		io.WriteString(p.w, "\n")
+		p.printIndent()
+		io.WriteString(p.w, "{\n")
+	}
 	p.printNodes(nn.Stmts)
 	io.WriteString(p.w, "\n")
 	p.printIndent()
@@ -1503,9 +1612,26 @@ func (p *PrettyPrinter) printStmtDeclare(n node.Node) {
 	nn := n.(*stmt.Declare)
 
 	io.WriteString(p.w, "declare(")
-	p.joinPrint(", ", nn.Consts)
+	if p.f != nil {
+		for k, c := range nn.Consts {
+			if k > 0 {
+				io.WriteString(p.w, ", ")
+			}
+			c := c.(*stmt.Constant)
+			p.Print(c.ConstantName)
+			io.WriteString(p.w, "=")
+			p.Print(c.Expr)
+		}
+	} else {
+		p.joinPrint(", ", nn.Consts)
+	}
 	io.WriteString(p.w, ")")
 
+	if p.f != nil {
+		p.fmtBody(nn.Stmt)
+		return
+	}
+
 	switch s := nn.Stmt.(type) {
 	case *stmt.Nop:
 		p.Print(s)
@@ -1535,6 +1661,15 @@ func (p *PrettyPrinter) printStmtDo(n node.Node) {
 	nn := n.(*stmt.Do)
 	io.WriteString(p.w, "do")
 
+	if p.f != nil {
+		p.fmtBody(nn.Stmt)
+		p.fmtBodySeparator(nn.Stmt)
+		io.WriteString(p.w, "while (")
+		p.Print(nn.Cond)
+		io.WriteString(p.w, ");")
+		return
+	}
+
 	switch s := nn.Stmt.(type) {
 	case *stmt.StmtList:
 		io.WriteString(p.w, " ")
@@ -1578,6 +1713,11 @@ func (p *PrettyPrinter) printStmtElseif(n node.Node) {
 	} else {
 		io.WriteString(p.w, ")")
 
+		if p.f != nil {
+			p.fmtBody(nn.Stmt)
+			return
+		}
+
 		switch s := nn.Stmt.(type) {
 		case *stmt.Nop:
 			p.Print(s)
@@ -1607,6 +1747,19 @@ func (p *PrettyPrinter) printStmtElse(n node.Node) {
 	} else {
 		io.WriteString(p.w, "else")
 
+		if p.f != nil {
+			if s, ok := nn.Stmt.(*stmt.If); ok {
+				io.WriteString(p.w, " ")
+				p.Print(s)
+				return
+			}
+		}
+
+		if p.f != nil {
+			p.fmtBody(nn.Stmt)
+			return
+		}
+
 		switch s := nn.Stmt.(type) {
 		case *stmt.Nop:
 			p.Print(s)
@@ -1645,11 +1798,22 @@ func (p *PrettyPrinter) printStmtFor(n node.Node) {
 	nn := n.(*stmt.For)
 
 	io.WriteString(p.w, "for (")
-	p.joinPrint(", ", nn.Init)
-	io.WriteString(p.w, "; ")
-	p.joinPrint(", ", nn.Cond)
-	io.WriteString(p.w, "; ")
-	p.joinPrint(", ", nn.Loop)
+	if p.f != nil {
+		p.joinPrint(", ", nn.Init)
+		for _, part := range [][]node.Node{nn.Cond, nn.Loop} {
+			io.WriteString(p.w, ";")
+			if len(part) != 0 {
+				io.WriteString(p.w, " ")
+				p.joinPrint(", ", part)
+			}
+		}
+	} else {
+		p.joinPrint(", ", nn.Init)
+		io.WriteString(p.w, "; ")
+		p.joinPrint(", ", nn.Cond)
+		io.WriteString(p.w, "; ")
+		p.joinPrint(", ", nn.Loop)
+	}
 
 	if nn.AltSyntax {
 		io.WriteString(p.w, ") :\n")
@@ -1663,6 +1827,11 @@ func (p *PrettyPrinter) printStmtFor(n node.Node) {
 	} else {
 		io.WriteString(p.w, ")")
 
+		if p.f != nil {
+			p.fmtBody(nn.Stmt)
+			return
+		}
+
 		switch s := nn.Stmt.(type) {
 		case *stmt.Nop:
 			p.Print(s)
@@ -1704,6 +1873,11 @@ func (p *PrettyPrinter) printStmtForeach(n node.Node) {
 		p.printIndent()
 		io.WriteString(p.w, "endforeach;")
 	} else {
+		if p.f != nil {
+			p.fmtBody(nn.Stmt)
+			return
+		}
+
 		switch s := nn.Stmt.(type) {
 		case *stmt.Nop:
 			p.Print(s)
@@ -1731,16 +1905,20 @@ func (p *PrettyPrinter) printStmtFunction(n node.Node) {
 
 	p.Print(nn.FunctionName)
 
-	io.WriteString(p.w, "(")
-	p.joinPrint(", ", nn.Params)
-	io.WriteString(p.w, ")")
+	multiline := p.printParams(nn.Params, startLine(nn.FunctionName), nn.ReturnType)
 
 	if nn.ReturnType != nil {
 		io.WriteString(p.w, ": ")
 		p.Print(nn.ReturnType)
 	}
 
-	io.WriteString(p.w, " {\n")
+	if p.f != nil && !multiline {
+		io.WriteString(p.w, "\n")
+		p.printIndent()
+		io.WriteString(p.w, "{\n")
+	} else {
+		io.WriteString(p.w, " {\n")
+	}
 	p.printNodes(nn.Stmts)
 	io.WriteString(p.w, "\n")
 	p.printIndent()
@@ -1811,6 +1989,18 @@ func (p *PrettyPrinter) printStmtIf(n node.Node) {
 		io.WriteString(p.w, "\n")
 		p.printIndent()
 		io.WriteString(p.w, "endif;")
+	} else if p.f != nil {
+		p.fmtBody(nn.Stmt)
+		body := nn.Stmt
+		for _, elseif := range nn.ElseIf {
+			p.fmtBodySeparator(body)
+			p.Print(elseif)
+			body = elseif.(*stmt.ElseIf).Stmt
+		}
+		if nn.Else != nil {
+			p.fmtBodySeparator(body)
+			p.Print(nn.Else)
+		}
 	} else {
 		switch s := nn.Stmt.(type) {
 		case *stmt.Nop:
@@ -1928,8 +2118,11 @@ func (p *PrettyPrinter) printStmtProperty(n node.Node) {
 func (p *PrettyPrinter) printStmtReturn(n node.Node) {
 	nn := n.(*stmt.Return)
 
-	io.WriteString(p.w, "return ")
-	p.Print(nn.Expr)
+	io.WriteString(p.w, "return")
+	if nn.Expr != nil {
+		io.WriteString(p.w, " ")
+		p.Print(nn.Expr)
+	}
 	io.WriteString(p.w, ";")
 }
 
@@ -1997,8 +2190,10 @@ func (p *PrettyPrinter) printStmtThrow(n node.Node) {
 func (p *PrettyPrinter) printStmtTraitMethodRef(n node.Node) {
 	nn := n.(*stmt.TraitMethodRef)
 
-	p.Print(nn.Trait)
-	io.WriteString(p.w, "::")
+	if nn.Trait != nil {
+		p.Print(nn.Trait)
+		io.WriteString(p.w, "::")
+	}
 	p.Print(nn.Method)
 }
 
@@ -2073,6 +2268,18 @@ func (p *PrettyPrinter) printStmtTry(n node.Node) {
 	p.printIndent()
 	io.WriteString(p.w, "}")
 
+	if p.f != nil {
+		for _, c := range nn.Catches {
+			io.WriteString(p.w, " ")
+			p.Print(c)
+		}
+		if nn.Finally != nil {
+			io.WriteString(p.w, " ")
+			p.Print(nn.Finally)
+		}
+		return
+	}
+
 	if nn.Catches != nil {
 		io.WriteString(p.w, "\n")
 		p.indentDepth--
@@ -2143,6 +2350,11 @@ func (p *PrettyPrinter) printStmtWhile(n node.Node) {
 	} else {
 		io.WriteString(p.w, ")")
 
+		if p.f != nil {
+			p.fmtBody(nn.Stmt)
+			return
+		}
+
 		switch s := nn.Stmt.(type) {
 		case *stmt.Nop:
 			p.Print(s)
@@ -1663,6 +1663,24 @@ func TestPrintMethodCall(t *testing.T) {
 	}
 }
 
+func TestPrintMethodCallExpr(t *testing.T) {
+	o := bytes.NewBufferString("")
+
+	p := printer.NewPrettyPrinter(o, "    ")
+	p.Print(&expr.MethodCall{
+		Variable:     &node.SimpleVar{Name: "foo"},
+		Method:       &binary.Concat{Left: &node.SimpleVar{Name: "a"}, Right: &scalar.String{Value: "'b'"}},
+		ArgumentList: &node.ArgumentList{},
+	})
+
+	expected := `$foo->{$a . 'b'}()`
+	actual := o.String()
+
+	if expected != actual {
+		t.Errorf("\nexpected: %s\ngot: %s\n", expected, actual)
+	}
+}
+
 func TestPrintNew(t *testing.T) {
 	o := bytes.NewBufferString("")
 
@@ -1784,6 +1802,23 @@ func TestPrintPropertyFetch(t *testing.T) {
 	}
 }
 
+func TestPrintPropertyFetchExpr(t *testing.T) {
+	o := bytes.NewBufferString("")
+
+	p := printer.NewPrettyPrinter(o, "    ")
+	p.Print(&expr.PropertyFetch{
+		Variable: &node.SimpleVar{Name: "foo"},
+		Property: &scalar.String{Value: "'bar'"},
+	})
+
+	expected := `$foo->{'bar'}`
+	actual := o.String()
+
+	if expected != actual {
+		t.Errorf("\nexpected: %s\ngot: %s\n", expected, actual)
+	}
+}
+
 func TestPrintExprReference(t *testing.T) {
 	o := bytes.NewBufferString("")
 
@@ -1937,6 +1972,24 @@ func TestPrintStaticCall(t *testing.T) {
 	}
 }
 
+func TestPrintStaticCallExpr(t *testing.T) {
+	o := bytes.NewBufferString("")
+
+	p := printer.NewPrettyPrinter(o, "    ")
+	p.Print(&expr.StaticCall{
+		Class:        &name.Name{Parts: []node.Node{&name.NamePart{Value: "Foo"}}},
+		Call:         &scalar.String{Value: "'bar'"},
+		ArgumentList: &node.ArgumentList{},
+	})
+
+	expected := `Foo::{'bar'}()`
+	actual := o.String()
+
+	if expected != actual {
+		t.Errorf("\nexpected: %s\ngot: %s\n", expected, actual)
+	}
+}
+
 func TestPrintStaticPropertyFetch(t *testing.T) {
 	o := bytes.NewBufferString("")
 
@@ -2005,6 +2058,22 @@ func TestPrintUnaryMinus(t *testing.T) {
 	}
 }
 
+func TestPrintUnaryMinusNested(t *testing.T) {
+	o := bytes.NewBufferString("")
+
+	p := printer.NewPrettyPrinter(o, "    ")
+	p.Print(&expr.UnaryMinus{
+		Expr: &expr.UnaryMinus{Expr: &expr.PreDec{Variable: &node.SimpleVar{Name: "var"}}},
+	})
+
+	expected := `- - --$var`
+	actual := o.String()
+
+	if expected != actual {
+		t.Errorf("\nexpected: %s\ngot: %s\n", expected, actual)
+	}
+}
+
 func TestPrintUnaryPlus(t *testing.T) {
 	o := bytes.NewBufferString("")
 
@@ -2021,6 +2090,22 @@ func TestPrintUnaryPlus(t *testing.T) {
 	}
 }
 
+func TestPrintUnaryPlusNested(t *testing.T) {
+	o := bytes.NewBufferString("")
+
+	p := printer.NewPrettyPrinter(o, "    ")
+	p.Print(&expr.UnaryPlus{
+		Expr: &expr.UnaryPlus{Expr: &expr.PreInc{Variable: &node.SimpleVar{Name: "var"}}},
+	})
+
+	expected := `+ + ++$var`
+	actual := o.String()
+
+	if expected != actual {
+		t.Errorf("\nexpected: %s\ngot: %s\n", expected, actual)
+	}
+}
+
 func TestPrintVariable(t *testing.T) {
 	o := bytes.NewBufferString("")
 
@@ -2035,6 +2120,20 @@ func TestPrintVariable(t *testing.T) {
 	}
 }
 
+func TestPrintVariableExpr(t *testing.T) {
+	o := bytes.NewBufferString("")
+
+	p := printer.NewPrettyPrinter(o, "    ")
+	p.Print(&node.Var{Expr: &scalar.String{Value: "'var'"}})
+
+	expected := `${'var'}`
+	actual := o.String()
+
+	if expected != actual {
+		t.Errorf("\nexpected: %s\ngot: %s\n", expected, actual)
+	}
+}
+
 func TestPrintYieldFrom(t *testing.T) {
 	o := bytes.NewBufferString("")
 
@@ -2084,6 +2183,20 @@ func TestPrintYieldFull(t *testing.T) {
 	}
 }
 
+func TestPrintYieldEmpty(t *testing.T) {
+	o := bytes.NewBufferString("")
+
+	p := printer.NewPrettyPrinter(o, "    ")
+	p.Print(&expr.Yield{})
+
+	expected := `yield`
+	actual := o.String()
+
+	if expected != actual {
+		t.Errorf("\nexpected: %s\ngot: %s\n", expected, actual)
+	}
+}
+
 // stmt
 
 func TestPrintAltElseIf(t *testing.T) {
@@ -3610,6 +3723,20 @@ func TestPrintReturn(t *testing.T) {
 	}
 }
 
+func TestPrintReturnEmpty(t *testing.T) {
+	o := bytes.NewBufferString("")
+
+	p := printer.NewPrettyPrinter(o, "    ")
+	p.Print(&stmt.Return{})
+
+	expected := `return;`
+	actual := o.String()
+
+	if expected != actual {
+		t.Errorf("\nexpected: %s\ngot: %s\n", expected, actual)
+	}
+}
+
 func TestPrintStaticVar(t *testing.T) {
 	o := bytes.NewBufferString("")
 
@@ -3784,6 +3911,22 @@ func TestPrintStmtTraitMethodRef(t *testing.T) {
 	}
 }
 
+func TestPrintStmtTraitMethodRefMethodOnly(t *testing.T) {
+	o := bytes.NewBufferString("")
+
+	p := printer.NewPrettyPrinter(o, "    ")
+	p.Print(&stmt.TraitMethodRef{
+		Method: &node.Identifier{Value: "a"},
+	})
+
+	expected := `a`
+	actual := o.String()
+
+	if expected != actual {
+		t.Errorf("\nexpected: %s\ngot: %s\n", expected, actual)
+	}
+}
+
 func TestPrintStmtTraitUseAlias(t *testing.T) {
 	o := bytes.NewBufferString("")
 
@@ -0,0 +1,277 @@
+package phpfmt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxEditDistance limits the diff algorithm complexity.
+// Files with more changed lines are considered to be completely different.
+const maxEditDistance = 2000
+
+// Edit replaces original lines [StartLine, EndLine) with NewText.
+// Lines are 0-based. StartLine == EndLine means insertion.
+type Edit struct {
+	StartLine int
+	EndLine   int
+	NewText   string
+}
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+// op is a single line diff operation.
+// For opEqual and opDelete, line is a line of the first text,
+// for opInsert it's a line of the second one.
+type op struct {
+	kind opKind
+	a    int
+	b    int
+	line string
+}
+
+// Edits returns a list of line edits that transform a into b.
+func Edits(a, b []byte) []Edit {
+	var res []Edit
+	var cur *Edit
+	for _, o := range diffLines(splitLines(string(a)), splitLines(string(b))) {
+		if o.kind == opEqual {
+			if cur != nil {
+				res = append(res, *cur)
+				cur = nil
+			}
+			continue
+		}
+		if cur == nil {
+			cur = &Edit{StartLine: o.a, EndLine: o.a}
+		}
+		switch o.kind {
+		case opDelete:
+			cur.EndLine = o.a + 1
+		case opInsert:
+			cur.NewText += o.line
+		}
+	}
+	if cur != nil {
+		res = append(res, *cur)
+	}
+	return res
+}
+
+// Diff returns a unified diff between the original and formatted file contents.
+// Returns an empty string if contents are equal.
+func Diff(filename string, a, b []byte) string {
+	ops := diffLines(splitLines(string(a)), splitLines(string(b)))
+
+	const context = 3
+
+	var sb strings.Builder
+	for i := 0; i < len(ops); {
+		if ops[i].kind == opEqual {
+			i++
+			continue
+		}
+
+		// Find the hunk end: a place where changes are
+		// followed by more than 2*context equal lines.
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != opEqual {
+				end = j + 1
+				continue
+			}
+			if j-end >= 2*context {
+				break
+			}
+		}
+		end += context
+		if end > len(ops) {
+			end = len(ops)
+		}
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s.orig\n+++ %s\n", filename, filename)
+		}
+		writeHunk(&sb, ops[start:end])
+		i = end
+	}
+	return sb.String()
+}
+
+func writeHunk(sb *strings.Builder, ops []op) {
+	aStart, bStart := ops[0].a, ops[0].b
+	aLen, bLen := 0, 0
+	for _, o := range ops {
+		switch o.kind {
+		case opEqual:
+			aLen++
+			bLen++
+		case opDelete:
+			aLen++
+		case opInsert:
+			bLen++
+		}
+	}
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+	for _, o := range ops {
+		switch o.kind {
+		case opEqual:
+			sb.WriteString(" ")
+		case opDelete:
+			sb.WriteString("-")
+		case opInsert:
+			sb.WriteString("+")
+		}
+		sb.WriteString(o.line)
+		if !strings.HasSuffix(o.line, "\n") {
+			sb.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(start, length int) string {
+	if length == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if length == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, length)
+}
+
+// splitLines splits s into lines, line terminators are preserved.
+func splitLines(s string) []string {
+	var lines []string
+	for s != "" {
+		i := strings.IndexByte(s, '\n')
+		if i == -1 {
+			lines = append(lines, s)
+			break
+		}
+		lines = append(lines, s[:i+1])
+		s = s[i+1:]
+	}
+	return lines
+}
+
+// diffLines returns a shortest list of operations that transform a into b.
+//
+// It's a Myers diff algorithm. Common prefix and suffix are skipped.
+// If the edit distance is greater than maxEditDistance,
+// all lines between them are replaced.
+func diffLines(a, b []string) []op {
+	var res []op
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		res = append(res, op{kind: opEqual, a: prefix, b: prefix, line: a[prefix]})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	res = append(res, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], prefix, prefix)...)
+
+	for i := suffix; i > 0; i-- {
+		ai, bi := len(a)-i, len(b)-i
+		res = append(res, op{kind: opEqual, a: ai, b: bi, line: a[ai]})
+	}
+	return res
+}
+
+func myers(a, b []string, aOffset, bOffset int) []op {
+	n, m := len(a), len(b)
+	max := n + m
+	if max > 2*maxEditDistance {
+		max = 2 * maxEditDistance
+	}
+
+	// v[k+offset] is the furthest x reached on the diagonal k.
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+
+	found := false
+	for d := 0; d <= max && !found; d++ {
+		trace = append(trace, append([]int(nil), v...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+				x = v[k+1+offset]
+			} else {
+				x = v[k-1+offset] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+offset] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+
+	if !found {
+		res := make([]op, 0, n+m)
+		for i, l := range a {
+			res = append(res, op{kind: opDelete, a: aOffset + i, b: bOffset, line: l})
+		}
+		for i, l := range b {
+			res = append(res, op{kind: opInsert, a: aOffset + n, b: bOffset + i, line: l})
+		}
+		return res
+	}
+
+	// Backtrack the path.
+	var rev []op
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+offset]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			rev = append(rev, op{kind: opEqual, a: aOffset + x, b: bOffset + y, line: a[x]})
+		}
+		if x == prevX {
+			y--
+			rev = append(rev, op{kind: opInsert, a: aOffset + x, b: bOffset + y, line: b[y]})
+		} else {
+			x--
+			rev = append(rev, op{kind: opDelete, a: aOffset + x, b: bOffset + y, line: a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		rev = append(rev, op{kind: opEqual, a: aOffset + x, b: bOffset + y, line: a[x]})
+	}
+
+	res := make([]op, len(rev))
+	for i, o := range rev {
+		res[len(rev)-1-i] = o
+	}
+	return res
+}
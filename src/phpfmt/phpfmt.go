@@ -0,0 +1,44 @@
+// Package phpfmt formats PHP code according to the PSR-12 coding style.
+//
+// Formatting is based on the printer.PrettyPrinter: code is parsed
+// and printed back, comments, blank lines and parentheses are preserved.
+// Files that contain inline HTML are left unchanged.
+package phpfmt
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/php7"
+	"github.com/setpill/noverify/src/php/parser/printer"
+)
+
+// DefaultLineWidth is a max line width that is used by Format.
+const DefaultLineWidth = 120
+
+// Format returns formatted src.
+//
+// Filename is only used in error messages.
+// Code with syntax errors is not formatted, the first error is returned instead.
+func Format(filename string, src []byte) ([]byte, error) {
+	root, err := parse(filename, src)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	printer.NewFormatter(&buf, src, DefaultLineWidth).Print(root)
+	return buf.Bytes(), nil
+}
+
+// parse parses src with freefloating enabled, as the formatter requires.
+func parse(filename string, src []byte) (*node.Root, error) {
+	p := php7.NewParser(bytes.NewReader(src), filename)
+	p.WithFreeFloating()
+	p.Parse()
+	if errs := p.GetErrors(); len(errs) != 0 {
+		return nil, errors.New(errs[0].String())
+	}
+	return p.GetRootNode(), nil
+}
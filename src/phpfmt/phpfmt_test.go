@@ -0,0 +1,403 @@
+package phpfmt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{
+			name: "indentation and braces",
+			in: `<?php
+class Foo extends Bar implements Baz {
+  public function f($a,$b){
+    if($a){return $b;}
+    else if ($b) return $a;
+    else{ return null; }
+  }
+}
+`,
+			out: `<?php
+class Foo extends Bar implements Baz
+{
+    public function f($a, $b)
+    {
+        if ($a) {
+            return $b;
+        } else if ($b) {
+            return $a;
+        } else {
+            return null;
+        }
+    }
+}
+`,
+		},
+		{
+			name: "comments",
+			in: `<?php
+// leading comment
+function f() {
+    /**
+     * Doc comment.
+     */
+    $x = 1; // trailing comment
+
+    # hash comment
+    return $x;
+    // last comment
+}
+// EOF comment
+`,
+			out: `<?php
+// leading comment
+function f()
+{
+    /**
+     * Doc comment.
+     */
+    $x = 1; // trailing comment
+
+    # hash comment
+    return $x;
+    // last comment
+}
+// EOF comment
+`,
+		},
+		{
+			name: "long arguments",
+			in: `<?php
+$result = some_function_with_a_long_name($first_argument, $second_argument, $third_argument, $fourth_argument, $fifth_argument);
+foo(1,
+  2);
+bar(
+  1, 2);
+`,
+			out: `<?php
+$result = some_function_with_a_long_name(
+    $first_argument,
+    $second_argument,
+    $third_argument,
+    $fourth_argument,
+    $fifth_argument
+);
+foo(1, 2);
+bar(
+    1,
+    2
+);
+`,
+		},
+		{
+			name: "long parameters",
+			in: `<?php
+function long_function_name(int $first_parameter, string $second_parameter, array $third_parameter, $fourth_parameter): ?string {
+  return null;
+}
+`,
+			out: `<?php
+function long_function_name(
+    int $first_parameter,
+    string $second_parameter,
+    array $third_parameter,
+    $fourth_parameter
+): ?string {
+    return null;
+}
+`,
+		},
+		{
+			name: "arrays",
+			in: `<?php
+$a = array(1,2,3);
+$b = [
+  'a' => 1, // one
+  'b' => 2
+];
+`,
+			out: `<?php
+$a = array(1, 2, 3);
+$b = [
+    'a' => 1, // one
+    'b' => 2,
+];
+`,
+		},
+		{
+			name: "parentheses and casts",
+			in: `<?php
+$x = ($a + $b) * (int)$c;
+$y = - -$z;
+$obj = new Foo;
+$v = NULL ?: TRUE;
+`,
+			out: `<?php
+$x = ($a + $b) * (int) $c;
+$y = - -$z;
+$obj = new Foo();
+$v = null ?: true;
+`,
+		},
+		{
+			name: "strings are kept",
+			in: `<?php
+$s = "a  $b  c";
+echo <<<EOT
+  text  {$x}
+EOT;
+`,
+			out: `<?php
+$s = "a  $b  c";
+echo <<<EOT
+  text  {$x}
+EOT;
+`,
+		},
+		{
+			name: "header blocks",
+			in: `<?php
+declare(strict_types=1);
+namespace App;
+function f() {}
+`,
+			out: `<?php
+
+declare(strict_types=1);
+
+namespace App;
+
+function f()
+{
+}
+`,
+		},
+		{
+			name: "namespace and use blank lines",
+			in: `<?php
+namespace App;
+use A\B;
+use function A\{f, g};
+// comment
+use C;
+class Foo {}
+`,
+			out: `<?php
+
+namespace App;
+
+use A\B;
+use function A\{f, g};
+// comment
+use C;
+
+class Foo
+{
+}
+`,
+		},
+		{
+			name: "inline html is not formatted",
+			in: `<html><?php if($a){ ?>x<?php } ?></html>
+`,
+			out: `<html><?php if($a){ ?>x<?php } ?></html>
+`,
+		},
+	}
+
+	for _, test := range tests {
+		res, err := Format("test.php", []byte(test.in))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+		if string(res) != test.out {
+			t.Errorf("%s: unexpected result:\n%s\nwant:\n%s", test.name, res, test.out)
+			continue
+		}
+
+		again, err := Format("test.php", res)
+		if err != nil {
+			t.Errorf("%s: format result: %v", test.name, err)
+			continue
+		}
+		if string(again) != string(res) {
+			t.Errorf("%s: formatting is not idempotent:\n%s", test.name, again)
+		}
+	}
+}
+
+func TestFormatSyntaxError(t *testing.T) {
+	_, err := Format("test.php", []byte("<?php\nfunction f( {\n"))
+	if err == nil {
+		t.Fatalf("expected a syntax error")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := "<?php\n$a = 1;\n$b = 2;\n$c = 3;\n$d = 4;\n$e = 5;\n"
+	b := "<?php\n$a = 1;\n$b = 2;\n$c = 30;\n$d = 4;\n$e = 5;\n"
+
+	want := `--- test.php.orig
++++ test.php
+@@ -1,6 +1,6 @@
+ <?php
+ $a = 1;
+ $b = 2;
+-$c = 3;
++$c = 30;
+ $d = 4;
+ $e = 5;
+`
+	if got := Diff("test.php", []byte(a), []byte(b)); got != want {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+	if got := Diff("test.php", []byte(a), []byte(a)); got != "" {
+		t.Errorf("expected empty diff, got:\n%s", got)
+	}
+}
+
+func TestFormatRange(t *testing.T) {
+	src := `<?php
+$a=1;
+$b=2;
+$c=3;
+`
+	edits, err := FormatRange("test.php", []byte(src), 2, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(edits) != 1 {
+		t.Fatalf("expected 1 edit, got %+v", edits)
+	}
+	e := edits[0]
+	if e.StartLine != 2 || e.EndLine != 3 || e.NewText != "$b = 2;\n" {
+		t.Errorf("unexpected edit: %+v", e)
+	}
+
+	lines := strings.Split(src, "\n")
+	all := Edits([]byte(src), []byte(strings.Join(lines, "\n")))
+	if len(all) != 0 {
+		t.Errorf("expected no edits for equal texts, got %+v", all)
+	}
+}
+
+func TestFormatRangeStatements(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		startLine int
+		endLine   int
+		out       string
+	}{
+		{
+			name: "nested statement",
+			in: `<?php
+class Foo {
+  function f() {
+    $a=1;
+    if($a){$b=2;}
+    $c=3;
+  }
+}
+`,
+			startLine: 4,
+			endLine:   4,
+			out: `<?php
+class Foo {
+  function f() {
+    $a=1;
+        if ($a) {
+            $b = 2;
+        }
+    $c=3;
+  }
+}
+`,
+		},
+		{
+			name: "statements with comments",
+			in: `<?php
+function f() {
+$a=1; // first
+  // second
+ $b=2;
+   return $a+$b;
+}
+`,
+			startLine: 2,
+			endLine:   4,
+			out: `<?php
+function f() {
+    $a = 1; // first
+    // second
+    $b = 2;
+   return $a+$b;
+}
+`,
+		},
+		{
+			name: "statement on the open tag line",
+			in: `<?php $a=1;
+$b=2;
+`,
+			startLine: 0,
+			endLine:   0,
+			out: `<?php
+$a = 1;
+$b = 2;
+`,
+		},
+		{
+			name: "no statements",
+			in: `<?php
+$a=1;
+
+// comment
+$b=2;
+`,
+			startLine: 2,
+			endLine:   3,
+			out: `<?php
+$a=1;
+
+// comment
+$b=2;
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			edits, err := FormatRange("test.php", []byte(test.in), test.startLine, test.endLine)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out := applyEdits(test.in, edits); out != test.out {
+				t.Errorf("unexpected result:\n%s\nexpected:\n%s", out, test.out)
+			}
+		})
+	}
+}
+
+func applyEdits(src string, edits []Edit) string {
+	lines := splitLines(src)
+	var sb strings.Builder
+	line := 0
+	for _, e := range edits {
+		for ; line < e.StartLine; line++ {
+			sb.WriteString(lines[line])
+		}
+		sb.WriteString(e.NewText)
+		line = e.EndLine
+	}
+	for ; line < len(lines); line++ {
+		sb.WriteString(lines[line])
+	}
+	return sb.String()
+}
@@ -0,0 +1,221 @@
+package phpfmt
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/node/stmt"
+	"github.com/setpill/noverify/src/php/parser/printer"
+)
+
+// FormatRange returns edits that format src lines between startLine
+// and endLine inclusively (lines are 0-based).
+//
+// Only the statements that intersect with the lines range are formatted:
+// the innermost run of sibling statements that covers the range is printed
+// with the indentation of its block. If the statements share their lines
+// with other code, like a statement that follows `<?php` on the same line,
+// the enclosing statements are formatted instead, up to the whole file.
+func FormatRange(filename string, src []byte, startLine, endLine int) ([]Edit, error) {
+	root, err := parse(filename, src)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range root.Stmts {
+		if _, ok := s.(*stmt.InlineHtml); ok {
+			// Mixed PHP and HTML files are not formatted.
+			return nil, nil
+		}
+	}
+
+	candidates := rangeCandidates(root, startLine+1, endLine+1)
+	if len(candidates) == 0 {
+		// There are no statements in the range.
+		return nil, nil
+	}
+
+	for i := len(candidates) - 1; i >= 0; i-- {
+		list := candidates[i]
+		if !occupiesLines(src, list.stmts) {
+			continue
+		}
+
+		var buf bytes.Buffer
+		printer.NewFormatter(&buf, src, DefaultLineWidth).PrintStmts(root, list.stmts, list.depth)
+
+		first := list.stmts[0].GetPosition().StartLine - 1
+		last := list.stmts[len(list.stmts)-1].GetPosition().EndLine
+		lines := splitLines(string(src))
+		old := strings.Join(lines[first:last], "")
+
+		edits := Edits([]byte(old), buf.Bytes())
+		for i := range edits {
+			edits[i].StartLine += first
+			edits[i].EndLine += first
+		}
+		return edits, nil
+	}
+
+	var buf bytes.Buffer
+	printer.NewFormatter(&buf, src, DefaultLineWidth).Print(root)
+	return Edits(src, buf.Bytes()), nil
+}
+
+// stmtList is a list of sibling statements that are printed with the same indentation.
+type stmtList struct {
+	stmts []node.Node
+	depth int
+}
+
+// rangeCandidates returns the runs of sibling statements that intersect
+// with the lines range (lines are 1-based), from the outermost to the innermost one.
+//
+// Every next run is nested into the previous one that consists of a single statement.
+func rangeCandidates(root *node.Root, startLine, endLine int) []stmtList {
+	var res []stmtList
+
+	lists := []stmtList{{stmts: root.Stmts}}
+	for {
+		var run stmtList
+		for _, l := range lists {
+			run = stmtList{stmts: intersectingStmts(l.stmts, startLine, endLine), depth: l.depth}
+			if len(run.stmts) != 0 {
+				break
+			}
+		}
+		if len(run.stmts) == 0 {
+			return res
+		}
+		res = append(res, run)
+		if len(run.stmts) != 1 {
+			return res
+		}
+		lists = nestedStmts(run.stmts[0], run.depth)
+	}
+}
+
+// intersectingStmts returns the statements that intersect with the lines range.
+func intersectingStmts(stmts []node.Node, startLine, endLine int) []node.Node {
+	from, to := -1, -1
+	for i, s := range stmts {
+		pos := s.GetPosition()
+		if pos == nil || pos.StartLine > endLine || pos.EndLine < startLine {
+			continue
+		}
+		if from == -1 {
+			from = i
+		}
+		to = i + 1
+	}
+	if from == -1 {
+		return nil
+	}
+	return stmts[from:to]
+}
+
+// nestedStmts returns the statement lists of n blocks.
+// depth is n indentation depth.
+func nestedStmts(n node.Node, depth int) []stmtList {
+	switch n := n.(type) {
+	case *stmt.StmtList:
+		return []stmtList{{stmts: n.Stmts, depth: depth + 1}}
+	case *stmt.Namespace:
+		return []stmtList{{stmts: n.Stmts, depth: depth + 1}}
+	case *stmt.Function:
+		return []stmtList{{stmts: n.Stmts, depth: depth + 1}}
+	case *stmt.Class:
+		return []stmtList{{stmts: n.Stmts, depth: depth + 1}}
+	case *stmt.Interface:
+		return []stmtList{{stmts: n.Stmts, depth: depth + 1}}
+	case *stmt.Trait:
+		return []stmtList{{stmts: n.Stmts, depth: depth + 1}}
+	case *stmt.Case:
+		return []stmtList{{stmts: n.Stmts, depth: depth + 1}}
+	case *stmt.Default:
+		return []stmtList{{stmts: n.Stmts, depth: depth + 1}}
+	case *stmt.Catch:
+		return []stmtList{{stmts: n.Stmts, depth: depth + 1}}
+	case *stmt.Finally:
+		return []stmtList{{stmts: n.Stmts, depth: depth + 1}}
+	case *stmt.ClassMethod:
+		return bodyStmts(n.Stmt, depth)
+	case *stmt.Switch:
+		return []stmtList{{stmts: n.CaseList.Cases, depth: depth + 1}}
+	case *stmt.While:
+		return bodyStmts(n.Stmt, depth)
+	case *stmt.Do:
+		return bodyStmts(n.Stmt, depth)
+	case *stmt.For:
+		return bodyStmts(n.Stmt, depth)
+	case *stmt.Foreach:
+		return bodyStmts(n.Stmt, depth)
+	case *stmt.Declare:
+		return bodyStmts(n.Stmt, depth)
+
+	case *stmt.Try:
+		res := []stmtList{{stmts: n.Stmts, depth: depth + 1}}
+		for _, c := range n.Catches {
+			res = append(res, nestedStmts(c, depth)...)
+		}
+		if n.Finally != nil {
+			res = append(res, nestedStmts(n.Finally, depth)...)
+		}
+		return res
+
+	case *stmt.If:
+		res := bodyStmts(n.Stmt, depth)
+		for _, elseif := range n.ElseIf {
+			res = append(res, bodyStmts(elseif.(*stmt.ElseIf).Stmt, depth)...)
+		}
+		if n.Else != nil {
+			if elseif, ok := n.Else.(*stmt.Else).Stmt.(*stmt.If); ok {
+				res = append(res, nestedStmts(elseif, depth)...)
+			} else {
+				res = append(res, bodyStmts(n.Else.(*stmt.Else).Stmt, depth)...)
+			}
+		}
+		return res
+	}
+
+	return nil
+}
+
+// bodyStmts returns the statement list of the control structure body.
+// Bodies without braces are printed inside the braces, so they're indented as well.
+func bodyStmts(body node.Node, depth int) []stmtList {
+	switch body := body.(type) {
+	case nil:
+		return nil
+	case *stmt.StmtList:
+		return []stmtList{{stmts: body.Stmts, depth: depth + 1}}
+	default:
+		return []stmtList{{stmts: []node.Node{body}, depth: depth + 1}}
+	}
+}
+
+// occupiesLines reports whether the statements don't share their lines with other code.
+// Comments that follow the last statement on the same line are printed along with it.
+func occupiesLines(src []byte, stmts []node.Node) bool {
+	start := stmts[0].GetPosition().StartPos - 1
+	lineStart := bytes.LastIndexByte(src[:start], '\n') + 1
+	if len(bytes.TrimSpace(src[lineStart:start])) != 0 {
+		return false
+	}
+
+	end := stmts[len(stmts)-1].GetPosition().EndPos
+	tail := src[end:]
+	if i := bytes.IndexByte(tail, '\n'); i != -1 {
+		tail = tail[:i]
+	}
+	tail = bytes.TrimSpace(tail)
+	switch {
+	case len(tail) == 0:
+		return true
+	case bytes.HasPrefix(tail, []byte("//")), bytes.HasPrefix(tail, []byte("#")):
+		return !bytes.Contains(tail, []byte("?>"))
+	case bytes.HasPrefix(tail, []byte("/*")):
+		return bytes.HasSuffix(tail, []byte("*/")) && bytes.Count(tail, []byte("*/")) == 1
+	}
+	return false
+}
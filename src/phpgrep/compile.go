@@ -1,6 +1,7 @@
 package phpgrep
 
 import (
+	"errors"
 	"strings"
 
 	"github.com/setpill/noverify/src/php/parser/node"
@@ -28,6 +29,22 @@ func compile(opts *Compiler, pattern []byte) (*Matcher, error) {
 
 	m := &Matcher{m: matcher{root: root}}
 
+	// A sequence pattern is parsed from several statements
+	// without the enclosing braces, see parsePHP7expr.
+	if list, ok := root.(*stmt.StmtList); ok && list.GetPosition() == nil {
+		seq := list.Stmts
+		for len(seq) != 0 && isSeqGap(seq[0]) {
+			seq = seq[1:]
+		}
+		for len(seq) != 0 && isSeqGap(seq[len(seq)-1]) {
+			seq = seq[:len(seq)-1]
+		}
+		if len(seq) == 0 {
+			return nil, errors.New("sequence pattern consists of gaps only")
+		}
+		m.m.seq = seq
+	}
+
 	return m, nil
 }
 
@@ -15,8 +15,6 @@ package phpgrep
 
 // TODO(quasilyte): unimplemented features.
 //
-// - Replace functionality.
-//
 // - Handle case sensitivity carefully (provide an option?).
 //
 // - stmt.Expression vs normal expressions named captures (should they match?).
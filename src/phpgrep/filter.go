@@ -0,0 +1,133 @@
+package phpgrep
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/setpill/noverify/src/php/parser/node"
+)
+
+type filterOp int
+
+const (
+	filterEq filterOp = iota
+	filterNotEq
+	filterRegexp
+	filterNotRegexp
+)
+
+// Filter is an additional constraint on a named capture source text.
+//
+// Filters are written as `name op value`:
+//	x=a,b     - $x text is "a" or "b"
+//	x!=a,b    - $x text is neither "a" nor "b"
+//	x~regexp  - $x text matches regexp
+//	x!~regexp - $x text doesn't match regexp
+type Filter struct {
+	// Name is a capture name, without a leading "$".
+	Name string
+
+	op     filterOp
+	values []string
+	re     *regexp.Regexp
+}
+
+var filterRegexpSyntax = regexp.MustCompile(`^\$?([a-zA-Z_][a-zA-Z0-9_]*)(!=|!~|=|~)`)
+
+// IsFilter reports whether s looks like a filter expression.
+func IsFilter(s string) bool {
+	return filterRegexpSyntax.MatchString(s)
+}
+
+// ParseFilter parses a filter expression.
+func ParseFilter(s string) (*Filter, error) {
+	m := filterRegexpSyntax.FindStringSubmatch(s)
+	if m == nil {
+		return nil, fmt.Errorf("%s: expected `name op value` filter, op is one of =, !=, ~, !~", s)
+	}
+	f := &Filter{Name: m[1]}
+	value := s[len(m[0]):]
+
+	switch m[2] {
+	case "=", "!=":
+		f.op = filterEq
+		if m[2] == "!=" {
+			f.op = filterNotEq
+		}
+		f.values = strings.Split(value, ",")
+	case "~", "!~":
+		f.op = filterRegexp
+		if m[2] == "!~" {
+			f.op = filterNotRegexp
+		}
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", s, err)
+		}
+		f.re = re
+	}
+
+	return f, nil
+}
+
+// MatchText reports whether capture source text satisfies the filter.
+func (f *Filter) MatchText(text string) bool {
+	switch f.op {
+	case filterEq, filterNotEq:
+		found := false
+		for _, v := range f.values {
+			if v == text {
+				found = true
+				break
+			}
+		}
+		return found == (f.op == filterEq)
+	case filterRegexp:
+		return f.re.MatchString(text)
+	case filterNotRegexp:
+		return !f.re.MatchString(text)
+	}
+	return false
+}
+
+// String returns the filter source form.
+func (f *Filter) String() string {
+	switch f.op {
+	case filterEq:
+		return f.Name + "=" + strings.Join(f.values, ",")
+	case filterNotEq:
+		return f.Name + "!=" + strings.Join(f.values, ",")
+	case filterRegexp:
+		return f.Name + "~" + f.re.String()
+	default:
+		return f.Name + "!~" + f.re.String()
+	}
+}
+
+// MatchFilters reports whether all filters are satisfied by m captures.
+// A filter that refers to a missing capture is never satisfied.
+//
+// src is the source code the match was found in.
+func MatchFilters(m *MatchData, src []byte, filters []*Filter) bool {
+	for _, f := range filters {
+		n, ok := m.Named[f.Name]
+		if !ok || n == nil {
+			return false
+		}
+		if !f.MatchText(string(NodeText(n, src))) {
+			return false
+		}
+	}
+	return true
+}
+
+// NodeText returns the n source code text.
+// Returns nil if n has no valid position.
+func NodeText(n node.Node, src []byte) []byte {
+	pos := getNodePos(n)
+	if pos == nil || pos.EndPos > len(src) {
+		return nil
+	}
+	return src[pos.StartPos-1 : pos.EndPos]
+}
@@ -17,6 +17,12 @@ import (
 type matcher struct {
 	root node.Node
 
+	// seq is a statements list of the sequence pattern.
+	seq []node.Node
+
+	// bound are pre-bound named matches.
+	bound map[string]node.Node
+
 	handler func(*MatchData) bool
 	named   map[string]node.Node
 
@@ -40,6 +46,66 @@ func (m *matcher) findAST(root node.Node, callback func(*MatchData) bool) {
 	root.Walk(m)
 }
 
+func (m *matcher) resetNamed() {
+	m.named = make(map[string]node.Node, len(m.bound))
+	for name, n := range m.bound {
+		m.named[name] = n
+	}
+}
+
+// findSeq calls the handler for every non-overlapping m.seq match inside stmts.
+// Returns false if the handler asked not to look for the nested matches.
+func (m *matcher) findSeq(stmts []node.Node) bool {
+	nested := true
+	for i := 0; i < len(stmts); i++ {
+		m.resetNamed()
+		n := m.matchSeq(m.seq, stmts[i:])
+		if n == -1 || getNodePos(stmts[i]) == nil {
+			continue
+		}
+		m.data.Node = stmts[i]
+		m.data.Named = m.named
+		m.data.Stmts = stmts[i : i+n]
+		if !m.handler(&m.data) {
+			nested = false
+		}
+		i += n - 1
+	}
+	return nested
+}
+
+// matchSeq matches xs pattern statements with the ys prefix.
+// Returns the number of matched ys statements or -1.
+func (m *matcher) matchSeq(xs, ys []node.Node) int {
+	if len(xs) == 0 {
+		return 0
+	}
+
+	if isSeqGap(xs[0]) {
+		// Non-greedy: try to skip as few statements as possible.
+		for skip := 0; skip <= len(ys); skip++ {
+			named := make(map[string]node.Node, len(m.named))
+			for k, v := range m.named {
+				named[k] = v
+			}
+			if n := m.matchSeq(xs[1:], ys[skip:]); n != -1 {
+				return skip + n
+			}
+			m.named = named
+		}
+		return -1
+	}
+
+	if len(ys) == 0 || !m.eqNode(xs[0], ys[0]) {
+		return -1
+	}
+	n := m.matchSeq(xs[1:], ys[1:])
+	if n == -1 {
+		return -1
+	}
+	return n + 1
+}
+
 func (m *matcher) eqNameParts(xs, ys []node.Node) bool {
 	if len(xs) != len(ys) {
 		return false
@@ -775,7 +841,14 @@ func (m *matcher) EnterNode(w walker.Walkable) bool {
 		return true
 	}
 
-	m.named = map[string]node.Node{}
+	if m.seq != nil {
+		if stmts := nodeStmts(n); len(stmts) != 0 {
+			return m.findSeq(stmts)
+		}
+		return true
+	}
+
+	m.resetNamed()
 
 	if ok && m.eqNode(m.root, n) {
 		pos := getNodePos(n)
@@ -784,6 +857,7 @@ func (m *matcher) EnterNode(w walker.Walkable) bool {
 		}
 		m.data.Node = n
 		m.data.Named = m.named
+		m.data.Stmts = nil
 
 		return m.handler(&m.data)
 	}
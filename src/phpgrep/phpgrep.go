@@ -21,6 +21,38 @@ type Matcher struct {
 type MatchData struct {
 	Node  node.Node
 	Named map[string]node.Node
+
+	// Stmts is a list of matched statements for the sequence patterns.
+	// Node is the first of them.
+	Stmts []node.Node
+}
+
+// Text returns the matched source code text.
+// For the sequence patterns it spans all matched statements.
+//
+// src is the source code the match was found in.
+func (m *MatchData) Text(src []byte) []byte {
+	from, to, ok := m.span()
+	if !ok || to > len(src) {
+		return nil
+	}
+	return src[from:to]
+}
+
+// span returns the match source code offsets.
+func (m *MatchData) span() (from, to int, ok bool) {
+	first := getNodePos(m.Node)
+	if first == nil {
+		return 0, 0, false
+	}
+	last := first
+	if len(m.Stmts) != 0 {
+		last = getNodePos(m.Stmts[len(m.Stmts)-1])
+		if last == nil {
+			return 0, 0, false
+		}
+	}
+	return first.StartPos - 1, last.EndPos, true
 }
 
 // Clone returns a deep copy of m.
@@ -32,9 +64,40 @@ func (m *Matcher) Clone() *Matcher {
 //
 // For malformed inputs (like code with syntax errors), returns false.
 func (m *Matcher) Match(root node.Node) bool {
+	m.m.bound = nil
 	return m.m.matchAST(root)
 }
 
 func (m *Matcher) Find(root node.Node, callback func(*MatchData) bool) {
+	m.m.bound = nil
+	m.m.findAST(root, callback)
+}
+
+// FindBound is like Find, but pattern variables from bound
+// are pre-bound to the given nodes, so they only match
+// the nodes that are equal to them.
+func (m *Matcher) FindBound(root node.Node, bound map[string]node.Node, callback func(*MatchData) bool) {
+	m.m.bound = bound
 	m.m.findAST(root, callback)
 }
+
+// FindSeq calls callback for every sequence pattern match inside
+// the stmts list. Unlike Find, it doesn't look inside the statements.
+// Does nothing if m is not a sequence pattern.
+func (m *Matcher) FindSeq(stmts []node.Node, callback func(*MatchData) bool) {
+	if m.m.seq == nil {
+		return
+	}
+	m.m.handler = callback
+	m.m.bound = nil
+	m.m.findSeq(stmts)
+}
+
+// IsSequence reports whether m is a statements sequence pattern,
+// like `$f = fopen($_); ${"*"}; fclose($f);`.
+//
+// Sequence patterns match consecutive statements of the same block,
+// ${"*"} statement matches any number of statements.
+func (m *Matcher) IsSequence() bool {
+	return m.m.seq != nil
+}
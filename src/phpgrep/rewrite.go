@@ -0,0 +1,287 @@
+package phpgrep
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/setpill/noverify/src/php/parser/node"
+	"github.com/setpill/noverify/src/php/parser/node/expr"
+	"github.com/setpill/noverify/src/php/parser/node/expr/assign"
+	"github.com/setpill/noverify/src/php/parser/node/name"
+	"github.com/setpill/noverify/src/php/parser/node/scalar"
+	"github.com/setpill/noverify/src/php/parser/node/stmt"
+	"github.com/setpill/noverify/src/php/parser/walker"
+)
+
+// Template is a compiled replacement pattern.
+//
+// Every $name variable of the template that is bound by the matched
+// pattern is substituted with the captured node source text,
+// everything else is copied as is. So the code formatting of both
+// the template and the captured nodes is preserved.
+//
+// Captured expressions are parenthesized when they're used
+// as operator operands, so `$x * 2` with `$x=$a+1` becomes `($a+1) * 2`.
+type Template struct {
+	src   []byte
+	holes []templateHole
+
+	// atomic is true if the template expression can be used
+	// as an operand without parentheses.
+	atomic bool
+}
+
+type templateHole struct {
+	name string
+
+	// from and to are hole offsets inside Template.src.
+	from int
+	to   int
+
+	// operand is true if a complex captured expression
+	// needs to be parenthesized when placed inside the hole.
+	operand bool
+}
+
+// CompileTemplate compiles a replacement pattern.
+func CompileTemplate(repl []byte) (*Template, error) {
+	root, code, err := parsePHP7(repl)
+	if err != nil {
+		return nil, err
+	}
+
+	// Expression templates are parsed with an additional "<?php " prefix.
+	offset := len(code) - len(repl)
+	if !bytes.HasPrefix(repl, []byte("<?")) {
+		offset = len("<?php ")
+	}
+
+	if st, ok := root.(*stmt.Expression); ok {
+		root = st.Expr
+	}
+
+	c := &templateCompiler{
+		tmpl:   &Template{src: repl, atomic: isAtomicExpr(root)},
+		code:   code,
+		offset: offset,
+	}
+	root.Walk(c)
+	sort.Slice(c.tmpl.holes, func(i, j int) bool {
+		return c.tmpl.holes[i].from < c.tmpl.holes[j].from
+	})
+	return c.tmpl, nil
+}
+
+type templateCompiler struct {
+	tmpl   *Template
+	code   []byte
+	offset int
+	stack  []node.Node
+}
+
+func (c *templateCompiler) EnterNode(w walker.Walkable) bool {
+	n, ok := w.(node.Node)
+	if !ok {
+		return true
+	}
+
+	if v, ok := n.(*node.SimpleVar); ok {
+		pos := getNodePos(v)
+		if pos != nil && pos.StartPos-1 >= c.offset {
+			var parent node.Node
+			if len(c.stack) != 0 {
+				parent = c.stack[len(c.stack)-1]
+			}
+			c.tmpl.holes = append(c.tmpl.holes, templateHole{
+				name:    v.Name,
+				from:    pos.StartPos - 1 - c.offset,
+				to:      pos.EndPos - c.offset,
+				operand: isOperand(parent, v) && !c.parenthesized(pos.StartPos-1, pos.EndPos),
+			})
+		}
+	}
+
+	c.stack = append(c.stack, n)
+	return true
+}
+
+func (c *templateCompiler) LeaveNode(w walker.Walkable) {
+	if _, ok := w.(node.Node); ok {
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+}
+
+func (c *templateCompiler) parenthesized(from, to int) bool {
+	return parenthesized(c.code, from, to)
+}
+
+// parenthesized reports whether code[from:to] is enclosed in parentheses.
+func parenthesized(code []byte, from, to int) bool {
+	before := bytes.TrimRight(code[:from], " \t\r\n")
+	after := bytes.TrimLeft(code[to:], " \t\r\n")
+	return bytes.HasSuffix(before, []byte("(")) && bytes.HasPrefix(after, []byte(")"))
+}
+
+// isOperand reports whether n is used as an operand of the parent
+// expression, so its precedence matters.
+func isOperand(parent, n node.Node) bool {
+	switch p := parent.(type) {
+	case nil, *node.Root, *node.Argument, *expr.ArrayItem, *stmt.Expression, *stmt.Return, *stmt.Echo:
+		return false
+	case *expr.ArrayDimFetch:
+		return p.Dim != n
+	case *assign.Assign:
+		return p.Expression != n
+	case *assign.Concat:
+		return p.Expression != n
+	case *assign.Plus:
+		return p.Expression != n
+	case *assign.Minus:
+		return p.Expression != n
+	case *assign.Mul:
+		return p.Expression != n
+	case *assign.Div:
+		return p.Expression != n
+	}
+	return true
+}
+
+// isAtomicExpr reports whether n can be used as an operand
+// of any operator without parentheses.
+func isAtomicExpr(n node.Node) bool {
+	switch n.(type) {
+	case *node.SimpleVar, *node.Var, *name.Name, *name.FullyQualified, *name.Relative,
+		*scalar.Lnumber, *scalar.Dnumber, *scalar.String, *scalar.Encapsed, *scalar.MagicConstant,
+		*expr.ConstFetch, *expr.ClassConstFetch, *expr.Array, *expr.Isset, *expr.Empty,
+		*expr.FunctionCall, *expr.MethodCall, *expr.StaticCall,
+		*expr.PropertyFetch, *expr.StaticPropertyFetch, *expr.ArrayDimFetch:
+		return true
+	default:
+		return false
+	}
+}
+
+// Expand returns the template text with holes filled by m captures.
+//
+// src is the source code the match was found in.
+func (t *Template) Expand(m *MatchData, src []byte) []byte {
+	var buf bytes.Buffer
+	last := 0
+	for _, h := range t.holes {
+		n, ok := m.Named[h.name]
+		if !ok || n == nil {
+			continue
+		}
+		text := NodeText(n, src)
+		if text == nil {
+			continue
+		}
+		buf.Write(t.src[last:h.from])
+		if h.operand && !isAtomicExpr(n) {
+			buf.WriteByte('(')
+			buf.Write(text)
+			buf.WriteByte(')')
+		} else {
+			buf.Write(text)
+		}
+		last = h.to
+	}
+	buf.Write(t.src[last:])
+	return buf.Bytes()
+}
+
+// Replace replaces all m matches inside root with the expanded tmpl.
+// Nested matches are not replaced, only the outermost ones are.
+//
+// src is the root source code. If accept is not nil, it's
+// called for every match and can reject it by returning false.
+//
+// Returns the updated source code and the number of replacements.
+func (m *Matcher) Replace(root node.Node, src []byte, tmpl *Template, accept func(*MatchData) bool) ([]byte, int) {
+	type edit struct {
+		from, to int
+		text     []byte
+	}
+	var edits []edit
+
+	// parents are only needed to parenthesize the non-atomic templates.
+	var parents map[node.Node]node.Node
+
+	m.Find(root, func(data *MatchData) bool {
+		if accept != nil && !accept(data) {
+			return true
+		}
+		from, to, ok := data.span()
+		if !ok {
+			return true
+		}
+		text := tmpl.Expand(data, src)
+		if !tmpl.atomic && data.Stmts == nil {
+			if parents == nil {
+				parents = collectParents(root)
+			}
+			if isOperand(parents[data.Node], data.Node) && !parenthesized(src, from, to) {
+				text = append(append([]byte("("), text...), ')')
+			}
+		}
+		edits = append(edits, edit{
+			from: from,
+			to:   to,
+			text: text,
+		})
+		return false // Don't look for the nested matches
+	})
+
+	if len(edits) == 0 {
+		return src, 0
+	}
+
+	sort.Slice(edits, func(i, j int) bool {
+		return edits[i].from < edits[j].from
+	})
+
+	var buf bytes.Buffer
+	last := 0
+	count := 0
+	for _, e := range edits {
+		if e.from < last {
+			continue
+		}
+		buf.Write(src[last:e.from])
+		buf.Write(e.text)
+		last = e.to
+		count++
+	}
+	buf.Write(src[last:])
+	return buf.Bytes(), count
+}
+
+// collectParents returns a mapping from every root node to its parent.
+func collectParents(root node.Node) map[node.Node]node.Node {
+	c := &parentsCollector{parents: make(map[node.Node]node.Node)}
+	root.Walk(c)
+	return c.parents
+}
+
+type parentsCollector struct {
+	parents map[node.Node]node.Node
+	stack   []node.Node
+}
+
+func (c *parentsCollector) EnterNode(w walker.Walkable) bool {
+	n, ok := w.(node.Node)
+	if !ok {
+		return true
+	}
+	if len(c.stack) != 0 {
+		c.parents[n] = c.stack[len(c.stack)-1]
+	}
+	c.stack = append(c.stack, n)
+	return true
+}
+
+func (c *parentsCollector) LeaveNode(w walker.Walkable) {
+	if _, ok := w.(node.Node); ok {
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+}
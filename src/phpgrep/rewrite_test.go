@@ -0,0 +1,162 @@
+package phpgrep
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		text   string
+		want   bool
+	}{
+		{`x=1,2`, `1`, true},
+		{`x=1,2`, `2`, true},
+		{`x=1,2`, `3`, false},
+		{`x!=1,2`, `3`, true},
+		{`x!=1,2`, `1`, false},
+		{`x~^\$_`, `$_GET`, true},
+		{`$x~^\$_`, `$foo`, false},
+		{`x!~^\$_`, `$foo`, true},
+		{`x!~^\$_`, `$_POST`, false},
+	}
+
+	for _, test := range tests {
+		f, err := ParseFilter(test.filter)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.filter, err)
+			continue
+		}
+		if f.Name != "x" {
+			t.Errorf("%s: unexpected name %q", test.filter, f.Name)
+		}
+		if have := f.MatchText(test.text); have != test.want {
+			t.Errorf("%s: match(%q): have %v, want %v", test.filter, test.text, have, test.want)
+		}
+	}
+
+	for _, bad := range []string{`x`, `1=2`, `x~(`} {
+		if _, err := ParseFilter(bad); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestReplace(t *testing.T) {
+	tests := []struct {
+		pattern string
+		repl    string
+		filters []string
+		input   string
+		want    string
+	}{
+		{
+			pattern: `array_key_exists($k, $a)`,
+			repl:    `isset($a[$k])`,
+			input:   `<?php if (array_key_exists( 'x' , $arr )) { f(!array_key_exists($k . 'a', $b->c)); }`,
+			want:    `<?php if (isset($arr['x'])) { f(!isset($b->c[$k . 'a'])); }`,
+		},
+		{
+			pattern: `f($x)`,
+			repl:    `$x * 2`,
+			input:   `<?php $a = f($b + 1); $c = !f(1);`,
+			want:    `<?php $a = ($b + 1) * 2; $c = !(1 * 2);`,
+		},
+		{
+			pattern: `f($x, $x)`,
+			repl:    `g($x)`,
+			input:   `<?php f(1, 1); f(1, 2); f(f(2, 2), f(2, 2));`,
+			want:    `<?php g(1); f(1, 2); g(f(2, 2));`,
+		},
+		{
+			pattern: `f($x)`,
+			repl:    `g($x)`,
+			filters: []string{`x~^\$`},
+			input:   `<?php f($a); f(1);`,
+			want:    `<?php g($a); f(1);`,
+		},
+	}
+
+	for _, test := range tests {
+		var c Compiler
+		m := mustCompile(t, &c, test.pattern)
+		tmpl, err := CompileTemplate([]byte(test.repl))
+		if err != nil {
+			t.Fatalf("%s: compile template: %v", test.repl, err)
+		}
+		var filters []*Filter
+		for _, s := range test.filters {
+			f, err := ParseFilter(s)
+			if err != nil {
+				t.Fatalf("%s: parse filter: %v", s, err)
+			}
+			filters = append(filters, f)
+		}
+
+		src := []byte(test.input)
+		root, _, err := parsePHP7(src)
+		if err != nil {
+			t.Fatalf("%s: parse: %v", test.input, err)
+		}
+		have, _ := m.Replace(root, src, tmpl, func(data *MatchData) bool {
+			return MatchFilters(data, src, filters)
+		})
+		if string(have) != test.want {
+			t.Errorf("%s -> %s:\nhave: %s\nwant: %s", test.pattern, test.repl, have, test.want)
+		}
+	}
+}
+
+func TestFindSeq(t *testing.T) {
+	tests := []struct {
+		pattern string
+		input   string
+		want    []string
+	}{
+		{
+			pattern: `$f = fopen($_); ${"*"}; fclose($f);`,
+			input: `<?php
+$f = fopen('a'); read($f); fclose($f);
+function g() { $h = fopen('b'); fclose($h); $x = 1; }
+$f = fopen('c'); fclose($other);`,
+			want: []string{
+				`$f = fopen('a'); read($f); fclose($f);`,
+				`$h = fopen('b'); fclose($h);`,
+			},
+		},
+		{
+			pattern: `${"*"}; $x = 1; $y = 2; ${"*"}`,
+			input:   `<?php $a = 1; $b = 2; $c = 1; if (1) { $d = 1; $e = 2; }`,
+			want:    []string{`$a = 1; $b = 2;`, `$d = 1; $e = 2;`},
+		},
+	}
+
+	for _, test := range tests {
+		var c Compiler
+		m := mustCompile(t, &c, test.pattern)
+		if !m.IsSequence() {
+			t.Fatalf("%s: expected a sequence pattern", test.pattern)
+		}
+		src := []byte(test.input)
+		root, _, err := parsePHP7(src)
+		if err != nil {
+			t.Fatalf("%s: parse: %v", test.input, err)
+		}
+		var have []string
+		m.Find(root, func(data *MatchData) bool {
+			from := data.Stmts[0].GetPosition().StartPos - 1
+			to := data.Stmts[len(data.Stmts)-1].GetPosition().EndPos
+			have = append(have, string(src[from:to]))
+			return true
+		})
+		if strings.Join(have, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s:\nhave: %q\nwant: %q", test.pattern, have, test.want)
+		}
+	}
+
+	var c Compiler
+	if _, err := c.Compile([]byte(`${"*"}; ${"*"};`)); err == nil {
+		t.Errorf("expected an error for a gaps-only pattern")
+	}
+}
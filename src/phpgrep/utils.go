@@ -173,10 +173,56 @@ func parsePHP7expr(code []byte) (node.Node, []byte, error) {
 		return nil, code, err
 	}
 	stmts := root.(*node.Root).Stmts
-	if len(stmts) == 0 {
+	// Drop the empty statements, like the one after the appended ';'.
+	for len(stmts) != 0 {
+		if _, ok := stmts[len(stmts)-1].(*stmt.Nop); !ok {
+			break
+		}
+		stmts = stmts[:len(stmts)-1]
+	}
+	switch len(stmts) {
+	case 0:
 		return &stmt.Nop{}, code, nil
+	case 1:
+		return stmts[0], code, nil
+	default:
+		// Several statements form a sequence pattern.
+		return &stmt.StmtList{Stmts: stmts}, code, nil
+	}
+}
+
+// isSeqGap reports whether n is a `${"*"};` statement.
+func isSeqGap(n node.Node) bool {
+	e, ok := n.(*stmt.Expression)
+	return ok && matchMetaVar(e.Expr, "*")
+}
+
+// nodeStmts returns n statements list, if n has any.
+func nodeStmts(n node.Node) []node.Node {
+	switch n := n.(type) {
+	case *node.Root:
+		return n.Stmts
+	case *stmt.StmtList:
+		return n.Stmts
+	case *stmt.Function:
+		return n.Stmts
+	case *expr.Closure:
+		return n.Stmts
+	case *stmt.Namespace:
+		return n.Stmts
+	case *stmt.Case:
+		return n.Stmts
+	case *stmt.Default:
+		return n.Stmts
+	case *stmt.Try:
+		return n.Stmts
+	case *stmt.Catch:
+		return n.Stmts
+	case *stmt.Finally:
+		return n.Stmts
+	default:
+		return nil
 	}
-	return root.(*node.Root).Stmts[0], code, nil
 }
 
 func parsePHP7root(code []byte) (node.Node, error) {
@@ -21,6 +21,8 @@ import (
 
 var magicComment = regexp.MustCompile(`\* @(?:warning|error|info|maybe) `)
 
+var textFilterSyntax = regexp.MustCompile(`^\$([a-zA-Z_][a-zA-Z0-9_]*)\s*(!=|!~|=|~)\s*(.*)$`)
+
 type parseError struct {
 	filename string
 	lineNum  int
@@ -64,32 +66,61 @@ func (p *parser) parse(filename string, r io.Reader) (*Set, error) {
 	p.filename = filename
 	p.sources = sources
 	p.res = res
-	for _, st := range root.Stmts {
-		if err := p.parseRule(st); err != nil {
+	stmts := root.Stmts
+	for len(stmts) != 0 {
+		comment, commentLine := ruleComment(stmts[0])
+		if comment == "" {
+			stmts = stmts[1:]
+			continue
+		}
+
+		// Statements without rule comments that follow the rule
+		// statement belong to its sequence pattern.
+		n := 1
+		for n < len(stmts) {
+			if c, _ := ruleComment(stmts[n]); c != "" {
+				break
+			}
+			n++
+		}
+
+		if err := p.parseRule(stmts[:n], comment, commentLine); err != nil {
 			return p.res, err
 		}
+		stmts = stmts[n:]
 	}
 
 	return p.res, nil
 }
 
-func (p *parser) parseRule(st node.Node) error {
-	comment := ""
+// ruleComment returns the statement doc comment with the rule attributes
+// and the comment line. Empty string is returned if there is no such comment.
+func ruleComment(st node.Node) (string, int) {
 	for _, ff := range (*st.GetFreeFloating())[freefloating.Start] {
 		if ff.StringType != freefloating.CommentType {
 			continue
 		}
 		if strings.HasPrefix(ff.Value, "/**") && magicComment.MatchString(ff.Value) {
-			comment = ff.Value
-			break
+			line := 0
+			if ff.Position != nil {
+				line = ff.Position.StartLine
+			}
+			return ff.Value, line
 		}
 	}
-	if comment == "" {
-		return nil
-	}
+	return "", 0
+}
+
+// parseRule parses a rule that is defined by the comment of the first statement.
+// Several statements form a sequence pattern.
+func (p *parser) parseRule(stmts []node.Node, comment string, commentLine int) error {
+	st := stmts[0]
 
 	var rule Rule
-	rule.Name = fmt.Sprintf("%s:%d", filepath.Base(p.filename), st.GetPosition().StartLine)
+	rule.Doc = commentText(comment)
+	rule.Filename = p.filename
+	rule.Line = st.GetPosition().StartLine
+	rule.Name = fmt.Sprintf("%s:%d", filepath.Base(p.filename), rule.Line)
 	critical := false
 	unnamed := true
 
@@ -183,6 +214,124 @@ func (p *parser) parseRule(st node.Node) error {
 			filter.Type = typeExpr
 			filterSet[name] = filter
 
+		case "not-type":
+			if len(part.Params) != 2 {
+				return p.errorf(st, "@not-type expects exactly 2 params, got %d", len(part.Params))
+			}
+			name, err := p.filterVar(st, part, part.Params[1])
+			if err != nil {
+				return err
+			}
+			filter := filterSet[name]
+			if filter.NotType != nil {
+				return p.errorf(st, "$%s: duplicate not-type constraint", name)
+			}
+			typeExpr, err := p.typeParser.ParseType(part.Params[0])
+			if err != nil {
+				return p.errorf(st, "$%s: parseType(%s): %v", name, part.Params[0], err)
+			}
+			filter.NotType = typeExpr
+			filterSet = p.setFilter(filterSet, name, filter)
+
+		case "type-implements":
+			if len(part.Params) != 2 {
+				return p.errorf(st, "@type-implements expects exactly 2 params, got %d", len(part.Params))
+			}
+			name, err := p.filterVar(st, part, part.Params[1])
+			if err != nil {
+				return err
+			}
+			filter := filterSet[name]
+			if filter.Implements != "" {
+				return p.errorf(st, "$%s: duplicate type-implements constraint", name)
+			}
+			filter.Implements = `\` + strings.TrimPrefix(part.Params[0], `\`)
+			filterSet = p.setFilter(filterSet, name, filter)
+
+		case "pure", "const":
+			if len(part.Params) != 1 {
+				return p.errorf(st, "@%s expects exactly 1 param, got %d", part.Name, len(part.Params))
+			}
+			name, err := p.filterVar(st, part, part.Params[0])
+			if err != nil {
+				return err
+			}
+			filter := filterSet[name]
+			if part.Name == "pure" {
+				filter.Pure = true
+			} else {
+				filter.Const = true
+			}
+			filterSet = p.setFilter(filterSet, name, filter)
+
+		case "filter":
+			// @filter $x ~ regexp
+			m := textFilterSyntax.FindStringSubmatch(part.ParamsText)
+			if m == nil {
+				return p.errorf(st, "@filter expects a `$var op value` param, got %q", part.ParamsText)
+			}
+			name := m[1]
+			textFilter, err := phpgrep.ParseFilter(name + m[2] + m[3])
+			if err != nil {
+				return p.errorf(st, "@filter: %v", err)
+			}
+			filter := filterSet[name]
+			filter.Text = append(filter.Text, textFilter)
+			filterSet = p.setFilter(filterSet, name, filter)
+
+		case "not-contains":
+			if part.ParamsText == "" {
+				return p.errorf(st, "@not-contains expects a pattern param")
+			}
+			m, err := p.compiler.Compile([]byte(part.ParamsText))
+			if err != nil {
+				return p.errorf(st, "@not-contains: pattern compilation error: %v", err)
+			}
+			rule.NotContains = append(rule.NotContains, NestedPattern{
+				Source:  part.ParamsText,
+				Matcher: m,
+			})
+
+		case "in-class", "not-in-class", "in-method", "in-namespace":
+			if len(part.Params) != 1 {
+				return p.errorf(st, "@%s expects exactly 1 param, got %d", part.Name, len(part.Params))
+			}
+			var dst *string
+			switch part.Name {
+			case "in-class":
+				dst = &rule.Context.InClass
+			case "not-in-class":
+				dst = &rule.Context.NotInClass
+			case "in-method":
+				dst = &rule.Context.InMethod
+			case "in-namespace":
+				dst = &rule.Context.InNamespace
+			}
+			if *dst != "" {
+				return p.errorf(st, "duplicate @%s constraint", part.Name)
+			}
+			*dst = part.Params[0]
+		case "in-loop":
+			if len(part.Params) != 0 {
+				return p.errorf(st, "@in-loop expects no params, got %d", len(part.Params))
+			}
+			rule.Context.InLoop = true
+		case "not-in-try":
+			if len(part.Params) != 0 {
+				return p.errorf(st, "@not-in-try expects no params, got %d", len(part.Params))
+			}
+			rule.Context.NotInTry = true
+
+		case "test-match", "test-nomatch":
+			if part.ParamsText == "" {
+				return p.errorf(st, "@%s expects a PHP code snippet", part.Name)
+			}
+			rule.Tests = append(rule.Tests, Test{
+				Code:  part.ParamsText,
+				Match: part.Name == "test-match",
+				Line:  commentLine + part.Line - 1,
+			})
+
 		default:
 			return p.errorf(st, "unknown attribute @%s on line %d", part.Name, part.Line)
 		}
@@ -199,17 +348,45 @@ func (p *parser) parseRule(st node.Node) error {
 		rule.Filters = append(rule.Filters, filterSet)
 	}
 
+	// A block pattern `{ $x; ${"*"}; $y; }` and several statements
+	// `$x; ${"*"}; $y;` are statements sequences.
 	pos := st.GetPosition()
-	m, err := p.compiler.Compile(p.sources[pos.StartPos-1 : pos.EndPos])
+	from, to := pos.StartPos-1, pos.EndPos
+	list, isBlock := st.(*stmt.StmtList)
+	isSeq := isBlock || len(stmts) > 1
+	switch {
+	case isBlock && len(stmts) > 1:
+		return p.errorf(st, "sequence pattern statements must be either enclosed in {} or not")
+	case isBlock:
+		if len(list.Stmts) < 2 {
+			return p.errorf(st, "sequence pattern must contain at least 2 statements")
+		}
+		from = list.Stmts[0].GetPosition().StartPos - 1
+		to = list.Stmts[len(list.Stmts)-1].GetPosition().EndPos
+	case isSeq:
+		to = stmts[len(stmts)-1].GetPosition().EndPos
+	}
+	m, err := p.compiler.Compile(p.sources[from:to])
 	if err != nil {
 		return p.errorf(st, "pattern compilation error: %v", err)
 	}
 	rule.Matcher = m
+	if isBlock {
+		rule.Pattern = string(p.sources[pos.StartPos-1 : pos.EndPos])
+	} else {
+		rule.Pattern = string(p.sources[from:to])
+	}
 
 	if st2, ok := st.(*stmt.Expression); ok {
 		st = st2.Expr
 	}
 	kind := CategorizeNode(st)
+	if isSeq {
+		if !m.IsSequence() {
+			return p.errorf(st, "can't compile sequence pattern")
+		}
+		kind = KindSequence
+	}
 	if kind == KindNone {
 		return p.errorf(st, "can't categorize pattern node: %T", st)
 	}
@@ -218,6 +395,40 @@ func (p *parser) parseRule(st node.Node) error {
 	return nil
 }
 
+// commentText returns the doc comment lines that are not attributes
+// joined with a space.
+func commentText(comment string) string {
+	var parts []string
+	for _, ln := range strings.Split(comment, "\n") {
+		ln = strings.TrimSpace(ln)
+		ln = strings.TrimSuffix(ln, "*/")
+		ln = strings.TrimPrefix(ln, "/*")
+		ln = strings.TrimPrefix(ln, "*")
+		ln = strings.TrimSpace(ln)
+		if ln == "" || strings.HasPrefix(ln, "@") {
+			continue
+		}
+		parts = append(parts, ln)
+	}
+	return strings.Join(parts, " ")
+}
+
+// filterVar returns a filter phpgrep variable name without "$".
+func (p *parser) filterVar(st node.Node, part phpdoc.CommentPart, param string) (string, error) {
+	if !strings.HasPrefix(param, "$") {
+		return "", p.errorf(st, "@%s: %s is not a phpgrep variable", part.Name, param)
+	}
+	return strings.TrimPrefix(param, "$"), nil
+}
+
+func (p *parser) setFilter(filterSet map[string]Filter, name string, filter Filter) map[string]Filter {
+	if filterSet == nil {
+		filterSet = map[string]Filter{}
+	}
+	filterSet[name] = filter
+	return filterSet
+}
+
 func (p *parser) errorf(n node.Node, format string, args ...interface{}) *parseError {
 	pos := n.GetPosition()
 	return &parseError{
@@ -39,6 +39,10 @@ const (
 	KindOther         // All remaining kinds that are not None
 	KindOtherUnlikely // Second Other category, even less priority
 
+	// KindSequence rules are matched against the statement lists.
+	// CategorizeNode never returns it, see Matcher.IsSequence.
+	KindSequence
+
 	_KindCount // Should be always the last one
 )
 
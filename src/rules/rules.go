@@ -1,7 +1,9 @@
 package rules
 
 import (
+	"bytes"
 	"io"
+	"io/ioutil"
 
 	"github.com/setpill/noverify/src/phpdoc"
 	"github.com/setpill/noverify/src/phpgrep"
@@ -27,6 +29,38 @@ func NewSet() *Set {
 	}
 }
 
+// ParseFiles parses all filenames rules into a single rule set.
+func ParseFiles(filenames []string) (*Set, error) {
+	p := NewParser()
+	res := NewSet()
+	for _, filename := range filenames {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		rset, err := p.Parse(filename, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		res.append(rset)
+	}
+	return res, nil
+}
+
+// append adds all src rules to the set.
+func (set *Set) append(src *Set) {
+	appendRules := func(dst, src *ScopedSet) {
+		for i, list := range src.RulesByKind {
+			dst.RulesByKind[i] = append(dst.RulesByKind[i], list...)
+		}
+	}
+	appendRules(set.Any, src.Any)
+	appendRules(set.Root, src.Root)
+	appendRules(set.Local, src.Local)
+	set.AlwaysAllowed = append(set.AlwaysAllowed, src.AlwaysAllowed...)
+	set.AlwaysCritical = append(set.AlwaysCritical, src.AlwaysCritical...)
+}
+
 // Set is a result of rule file parsing.
 type Set struct {
 	Any   *ScopedSet // Anywhere
@@ -60,8 +94,17 @@ type Rule struct {
 	Level int
 
 	// Message is a report text that is printed when this rule matches.
+	//
+	// {{$x}} placeholders are replaced with the $x captured node source text
+	// and {{type $x}} placeholders are replaced with its inferred type.
 	Message string
 
+	// Doc is a rule description: the rule comment text that is not an attribute.
+	Doc string
+
+	// Pattern is a phpgrep pattern source text.
+	Pattern string
+
 	// Location is a phpgrep variable name that should be used as a warning location.
 	// Empty string selects the root node.
 	Location string
@@ -74,9 +117,72 @@ type Rule struct {
 	// Every filter set is a mapping of phpgrep variable to a filter.
 	Filters []map[string]Filter
 
+	// NotContains is a list of patterns that must not match
+	// anywhere inside the matched code.
+	NotContains []NestedPattern
+
+	// Context restricts the places where the rule can match.
+	Context Context
+
+	// Filename and Line locate the rule pattern in the rule file.
+	Filename string
+	Line     int
+
+	// Tests are rule test cases defined by @test-match and @test-nomatch attributes.
+	Tests []Test
+
 	scope string
 }
 
+// NestedPattern is a pattern that is matched inside the rule match.
+//
+// Variables that are bound by the rule pattern match
+// only the nodes that are equal to their captured values.
+type NestedPattern struct {
+	// Source is the pattern text.
+	Source string
+
+	Matcher *phpgrep.Matcher
+}
+
+// Context describes constraints on the place where the rule pattern is matched.
+//
+// Name patterns are matched case-insensitively and can contain "*"
+// that matches any sequence of characters, see MatchName.
+type Context struct {
+	// InClass is a class name pattern the match must be inside of.
+	InClass string
+
+	// NotInClass is a class name pattern the match must not be inside of.
+	NotInClass string
+
+	// InMethod is a method name pattern the match must be inside of.
+	InMethod string
+
+	// InNamespace is a namespace pattern the match must be inside of.
+	InNamespace string
+
+	// InLoop requires the match to be inside a loop body.
+	InLoop bool
+
+	// NotInTry requires the match to be outside of a try block.
+	NotInTry bool
+}
+
+// Test is a rule test case: a PHP code snippet that should
+// (or should not) trigger the rule.
+type Test struct {
+	// Code is a PHP code snippet.
+	// If it doesn't start with "<?php", it's a statements list.
+	Code string
+
+	// Match tells whether the rule should match the Code.
+	Match bool
+
+	// Line is a rule file line that defines the test.
+	Line int
+}
+
 // String returns a rule printer representation.
 func (r *Rule) String() string {
 	return formatRule(r)
@@ -84,5 +190,22 @@ func (r *Rule) String() string {
 
 // Filter describes constraints that should be applied to a given phpgrep variable.
 type Filter struct {
+	// Type is a type the variable must be compatible with.
 	Type phpdoc.TypeExpr
+
+	// NotType is a type the variable must not be compatible with.
+	NotType phpdoc.TypeExpr
+
+	// Implements is a FQN of the class or interface that the variable
+	// type must be equal to, extend or implement.
+	Implements string
+
+	// Text is a list of the variable source text constraints.
+	Text []*phpgrep.Filter
+
+	// Pure requires the variable to be a side-effect-free expression.
+	Pure bool
+
+	// Const requires the variable to be a compile-time constant expression.
+	Const bool
 }
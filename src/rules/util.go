@@ -11,6 +11,10 @@ func formatRule(r *Rule) string {
 
 	buf.WriteString("/**\n")
 
+	if r.Doc != "" {
+		buf.WriteString(" * " + r.Doc + "\n")
+	}
+
 	switch r.Level {
 	case lintapi.LevelError:
 		buf.WriteString(" * @error " + r.Message + "\n")
@@ -34,6 +38,29 @@ func formatRule(r *Rule) string {
 		buf.WriteString(" * @scope " + r.scope + "\n")
 	}
 
+	for _, p := range r.NotContains {
+		buf.WriteString(" * @not-contains " + p.Source + "\n")
+	}
+
+	if r.Context.InClass != "" {
+		buf.WriteString(" * @in-class " + r.Context.InClass + "\n")
+	}
+	if r.Context.NotInClass != "" {
+		buf.WriteString(" * @not-in-class " + r.Context.NotInClass + "\n")
+	}
+	if r.Context.InMethod != "" {
+		buf.WriteString(" * @in-method " + r.Context.InMethod + "\n")
+	}
+	if r.Context.InNamespace != "" {
+		buf.WriteString(" * @in-namespace " + r.Context.InNamespace + "\n")
+	}
+	if r.Context.InLoop {
+		buf.WriteString(" * @in-loop\n")
+	}
+	if r.Context.NotInTry {
+		buf.WriteString(" * @not-in-try\n")
+	}
+
 	for i, filters := range r.Filters {
 		for name, filter := range filters {
 			if filter.Type != nil {
@@ -41,14 +68,73 @@ func formatRule(r *Rule) string {
 				buf.WriteString(filter.Type.String())
 				buf.WriteString(" $" + name + "\n")
 			}
+			if filter.NotType != nil {
+				buf.WriteString(" * @not-type ")
+				buf.WriteString(filter.NotType.String())
+				buf.WriteString(" $" + name + "\n")
+			}
+			if filter.Implements != "" {
+				buf.WriteString(" * @type-implements " + filter.Implements + " $" + name + "\n")
+			}
+			if filter.Pure {
+				buf.WriteString(" * @pure $" + name + "\n")
+			}
+			if filter.Const {
+				buf.WriteString(" * @const $" + name + "\n")
+			}
+			for _, f := range filter.Text {
+				buf.WriteString(" * @filter $" + f.String() + "\n")
+			}
 		}
 		if i != len(r.Filters)-1 {
 			buf.WriteString(" * @or\n")
 		}
 	}
 
+	for _, test := range r.Tests {
+		if test.Match {
+			buf.WriteString(" * @test-match " + test.Code + "\n")
+		} else {
+			buf.WriteString(" * @test-nomatch " + test.Code + "\n")
+		}
+	}
+
 	buf.WriteString(" */")
 
 	return buf.String()
 
 }
+
+// MatchName reports whether a class, method or namespace name
+// matches the pattern of the rule Context.
+//
+// Both names are compared case-insensitively, leading "\" is ignored.
+// A "*" inside the pattern matches any sequence of characters.
+// Patterns ending with `\*` also match the namespace itself,
+// so `App\Legacy\*` matches both `App\Legacy` and `App\Legacy\Foo`.
+func MatchName(pattern, name string) bool {
+	pattern = strings.ToLower(strings.TrimPrefix(pattern, `\`))
+	name = strings.ToLower(strings.TrimPrefix(name, `\`))
+	if strings.HasSuffix(pattern, `\*`) && name == strings.TrimSuffix(pattern, `\*`) {
+		return true
+	}
+	return matchWildcard(pattern, name)
+}
+
+func matchWildcard(pattern, s string) bool {
+	star := strings.IndexByte(pattern, '*')
+	if star == -1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, pattern[:star]) {
+		return false
+	}
+	s = s[star:]
+	pattern = pattern[star+1:]
+	for i := 0; i <= len(s); i++ {
+		if matchWildcard(pattern, s[i:]) {
+			return true
+		}
+	}
+	return false
+}
@@ -50,7 +50,8 @@ func ExprType(sc *meta.Scope, cs *meta.ClassParseState, n node.Node) meta.TypesM
 func ExprTypeCustom(sc *meta.Scope, cs *meta.ClassParseState, n node.Node, custom []CustomType) meta.TypesMap {
 	m := ExprTypeLocalCustom(sc, cs, n, custom)
 
-	if !meta.IsIndexingComplete() {
+	info := cs.MetaInfo()
+	if !info.IsIndexingComplete() {
 		return m
 	}
 
@@ -66,7 +67,7 @@ func ExprTypeCustom(sc *meta.Scope, cs *meta.ClassParseState, n node.Node, custo
 			}
 		}()
 
-		for kk := range resolveType(cs.CurrentClass, k, visitedMap) {
+		for kk := range resolveType(info, cs.CurrentClass, k, visitedMap) {
 			newMap[kk] = struct{}{}
 		}
 	})
@@ -78,12 +79,12 @@ func ExprTypeCustom(sc *meta.Scope, cs *meta.ClassParseState, n node.Node, custo
 }
 
 func internalFuncType(nm string, sc *meta.Scope, cs *meta.ClassParseState, c *expr.FunctionCall, custom []CustomType) (typ meta.TypesMap, ok bool) {
-	fn, ok := meta.GetInternalFunctionInfo(nm)
+	fn, ok := cs.MetaInfo().GetInternalFunctionInfo(nm)
 	if !ok || fn.Typ.IsEmpty() {
 		return meta.TypesMap{}, false
 	}
 
-	override, ok := meta.GetInternalFunctionOverrideInfo(nm)
+	override, ok := cs.MetaInfo().GetInternalFunctionOverrideInfo(nm)
 	if !ok || len(c.ArgumentList.Arguments) <= override.ArgNum {
 		return fn.Typ, true
 	}
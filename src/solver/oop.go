@@ -55,21 +55,21 @@ func GetConstant(cs *meta.ClassParseState, constNode node.Node) (constName strin
 	case *name.Name:
 		nameStr := meta.NameToString(nm)
 		nameWithNs := cs.Namespace + `\` + nameStr
-		ci, ok = meta.Info.GetConstant(nameWithNs)
+		ci, ok = cs.MetaInfo().GetConstant(nameWithNs)
 		if ok {
 			return nameWithNs, ci, true
 		}
 
 		if cs.Namespace != "" {
 			nameRootNs := `\` + nameStr
-			ci, ok = meta.Info.GetConstant(nameRootNs)
+			ci, ok = cs.MetaInfo().GetConstant(nameRootNs)
 			if ok {
 				return nameRootNs, ci, ok
 			}
 		}
 	case *name.FullyQualified:
 		nameStr := meta.FullyQualifiedToString(nm)
-		ci, ok = meta.Info.GetConstant(nameStr)
+		ci, ok = cs.MetaInfo().GetConstant(nameStr)
 		if ok {
 			return nameStr, ci, true
 		}
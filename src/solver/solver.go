@@ -20,19 +20,21 @@ func mixedType() map[string]struct{} {
 
 // ResolveType resolves function calls, method calls and global variables.
 //   curStaticClass is current class name (if inside the class, otherwise "")
-func resolveType(curStaticClass, typ string, visitedMap map[string]struct{}) (result map[string]struct{}) {
-	r := resolver{visited: visitedMap}
+func resolveType(info *meta.Index, curStaticClass, typ string, visitedMap map[string]struct{}) (result map[string]struct{}) {
+	r := resolver{info: info, visited: visitedMap}
 	return r.resolveType(curStaticClass, typ)
 }
 
 // ResolveTypes resolves function calls, method calls and global variables.
 //   curStaticClass is current class name (if inside the class, otherwise "")
-func ResolveTypes(curStaticClass string, m meta.TypesMap, visitedMap map[string]struct{}) map[string]struct{} {
-	r := resolver{visited: visitedMap}
+//   info is the index that is used to resolve the symbols
+func ResolveTypes(info *meta.Index, curStaticClass string, m meta.TypesMap, visitedMap map[string]struct{}) map[string]struct{} {
+	r := resolver{info: info, visited: visitedMap}
 	return r.resolveTypes(curStaticClass, m)
 }
 
 type resolver struct {
+	info    *meta.Index
 	visited map[string]struct{}
 }
 
@@ -63,14 +65,14 @@ func (r *resolver) resolveTypeNoLateStaticBinding(class, typ string) map[string]
 
 	switch typ[0] {
 	case meta.WGlobal:
-		varTyp, ok := meta.Info.GetVarNameType(meta.UnwrapGlobal(typ))
+		varTyp, ok := r.info.GetVarNameType(meta.UnwrapGlobal(typ))
 		if ok {
 			for tt := range r.resolveTypes(class, varTyp) {
 				res[tt] = struct{}{}
 			}
 		}
 	case meta.WConstant:
-		ci, ok := meta.Info.GetConstant(meta.UnwrapConstant(typ))
+		ci, ok := r.info.GetConstant(meta.UnwrapConstant(typ))
 		if ok {
 			for tt := range r.resolveTypes(class, ci.Typ) {
 				res[tt] = struct{}{}
@@ -87,15 +89,15 @@ func (r *resolver) resolveTypeNoLateStaticBinding(class, typ string) map[string]
 				res[strings.TrimSuffix(tt, "[]")] = struct{}{}
 			case tt == "mixed":
 				res["mixed"] = struct{}{}
-			case Implements(tt, `\ArrayAccess`):
-				offsetGet, _, ok := FindMethod(tt, "offsetGet")
+			case Implements(r.info, tt, `\ArrayAccess`):
+				offsetGet, _, ok := FindMethod(r.info, tt, "offsetGet")
 				if ok {
 					for tt := range r.resolveTypes(tt, offsetGet.Typ) {
 						res[tt] = struct{}{}
 					}
 				}
-			case Implements(tt, `\Traversable`):
-				current, _, ok := FindMethod(tt, "current")
+			case Implements(r.info, tt, `\Traversable`):
+				current, _, ok := FindMethod(r.info, tt, "current")
 				if ok {
 					for tt := range r.resolveTypes(tt, current.Typ) {
 						res[tt] = struct{}{}
@@ -105,10 +107,10 @@ func (r *resolver) resolveTypeNoLateStaticBinding(class, typ string) map[string]
 		}
 	case meta.WFunctionCall:
 		nm := meta.UnwrapFunctionCall(typ)
-		fn, ok := meta.Info.GetFunction(nm)
+		fn, ok := r.info.GetFunction(nm)
 		// functions can fall back to root namespace
 		if !ok && strings.Count(nm, `\`) > 1 {
-			fn, ok = meta.Info.GetFunction(nm[strings.LastIndex(nm, `\`):])
+			fn, ok = r.info.GetFunction(nm[strings.LastIndex(nm, `\`):])
 		}
 
 		if ok {
@@ -118,7 +120,7 @@ func (r *resolver) resolveTypeNoLateStaticBinding(class, typ string) map[string]
 		expr, methodName := meta.UnwrapInstanceMethodCall(typ)
 
 		for className := range r.resolveType(class, expr) {
-			info, _, ok := FindMethod(className, methodName)
+			info, _, ok := FindMethod(r.info, className, methodName)
 			if ok {
 				for tt := range r.resolveTypes(className, info.Typ) {
 					res[tt] = struct{}{}
@@ -129,7 +131,7 @@ func (r *resolver) resolveTypeNoLateStaticBinding(class, typ string) map[string]
 		expr, propertyName := meta.UnwrapInstancePropertyFetch(typ)
 
 		for className := range r.resolveType(class, expr) {
-			info, _, ok := FindProperty(className, propertyName)
+			info, _, ok := FindProperty(r.info, className, propertyName)
 			if ok {
 				for tt := range r.resolveTypes(class, info.Typ) {
 					res[tt] = struct{}{}
@@ -138,17 +140,17 @@ func (r *resolver) resolveTypeNoLateStaticBinding(class, typ string) map[string]
 				// If there is a __get method, it might have
 				// a @return annotation that will help to
 				// get appropriate type for dynamic property lookup.
-				get, _, ok := FindMethod(className, "__get")
+				get, _, ok := FindMethod(r.info, className, "__get")
 				if ok {
 					return r.resolveTypes(class, get.Typ)
 				}
 			}
 		}
 	case meta.WBaseMethodParam:
-		return solveBaseMethodParam(class, typ, visitedMap, res)
+		return solveBaseMethodParam(r.info, class, typ, visitedMap, res)
 	case meta.WStaticMethodCall:
 		className, methodName := meta.UnwrapStaticMethodCall(typ)
-		info, _, ok := FindMethod(className, methodName)
+		info, _, ok := FindMethod(r.info, className, methodName)
 		if ok {
 			for tt := range r.resolveTypes(className, info.Typ) {
 				res[tt] = struct{}{}
@@ -156,13 +158,13 @@ func (r *resolver) resolveTypeNoLateStaticBinding(class, typ string) map[string]
 		}
 	case meta.WStaticPropertyFetch:
 		className, propertyName := meta.UnwrapStaticPropertyFetch(typ)
-		info, _, ok := FindProperty(className, propertyName)
+		info, _, ok := FindProperty(r.info, className, propertyName)
 		if ok {
 			return r.resolveTypes(class, info.Typ)
 		}
 	case meta.WClassConstFetch:
 		className, constName := meta.UnwrapClassConstFetch(typ)
-		info, _, ok := FindConstant(className, constName)
+		info, _, ok := FindConstant(r.info, className, constName)
 		if ok {
 			return r.resolveTypes(class, info.Typ)
 		}
@@ -173,13 +175,13 @@ func (r *resolver) resolveTypeNoLateStaticBinding(class, typ string) map[string]
 	return res
 }
 
-func solveBaseMethodParam(curStaticClass, typ string, visitedMap, res map[string]struct{}) map[string]struct{} {
+func solveBaseMethodParam(info *meta.Index, curStaticClass, typ string, visitedMap, res map[string]struct{}) map[string]struct{} {
 	index, className, methodName := meta.UnwrapBaseMethodParam(typ)
-	class, ok := meta.Info.GetClass(className)
+	class, ok := info.GetClass(className)
 	if ok {
 		// TODO(quasilyte): walk parent interfaces as well?
 		for ifaceName := range class.Interfaces {
-			iface, ok := meta.Info.GetClass(ifaceName)
+			iface, ok := info.GetClass(ifaceName)
 			if !ok {
 				continue
 			}
@@ -188,7 +190,7 @@ func solveBaseMethodParam(curStaticClass, typ string, visitedMap, res map[string
 				continue
 			}
 			if len(fn.Params) > int(index) {
-				return ResolveTypes(curStaticClass, fn.Params[index].Typ, visitedMap)
+				return ResolveTypes(info, curStaticClass, fn.Params[index].Typ, visitedMap)
 			}
 		}
 	}
@@ -233,20 +235,20 @@ func (r *resolver) resolveTypes(class string, m meta.TypesMap) map[string]struct
 }
 
 // FindMethod searches for a method in specified class
-func FindMethod(className string, methodName string) (res meta.FuncInfo, implClassName string, ok bool) {
-	return findMethod(className, methodName, make(map[string]struct{}))
+func FindMethod(info *meta.Index, className string, methodName string) (res meta.FuncInfo, implClassName string, ok bool) {
+	return findMethod(info, className, methodName, make(map[string]struct{}))
 }
 
-func findMethod(className string, methodName string, visitedMap map[string]struct{}) (res meta.FuncInfo, implClassName string, ok bool) {
+func findMethod(info *meta.Index, className string, methodName string, visitedMap map[string]struct{}) (res meta.FuncInfo, implClassName string, ok bool) {
 	for {
 		if _, ok := visitedMap[className]; ok {
 			return res, "", false
 		}
 		visitedMap[className] = struct{}{}
 
-		class, ok := meta.Info.GetClass(className)
+		class, ok := info.GetClass(className)
 		if !ok {
-			class, ok = meta.Info.GetTrait(className)
+			class, ok = info.GetTrait(className)
 			if !ok {
 				return res, "", false
 			}
@@ -258,7 +260,7 @@ func findMethod(className string, methodName string, visitedMap map[string]struc
 		}
 
 		for trait := range class.Traits {
-			res, implClassName, ok = findMethod(trait, methodName, visitedMap)
+			res, implClassName, ok = findMethod(info, trait, methodName, visitedMap)
 			if ok {
 				return res, implClassName, ok
 			}
@@ -266,7 +268,7 @@ func findMethod(className string, methodName string, visitedMap map[string]struc
 
 		// interfaces support multiple inheritance and I use a separate property for that for now
 		for _, parentIfaceName := range class.ParentInterfaces {
-			res, implClassName, ok = findMethod(parentIfaceName, methodName, visitedMap)
+			res, implClassName, ok = findMethod(info, parentIfaceName, methodName, visitedMap)
 			if ok {
 				return res, implClassName, ok
 			}
@@ -281,20 +283,20 @@ func findMethod(className string, methodName string, visitedMap map[string]struc
 }
 
 // FindProperty searches for a property in specified class (both static and instance properties)
-func FindProperty(className string, propertyName string) (res meta.PropertyInfo, implClassName string, ok bool) {
-	return findProperty(className, propertyName, make(map[string]struct{}))
+func FindProperty(info *meta.Index, className string, propertyName string) (res meta.PropertyInfo, implClassName string, ok bool) {
+	return findProperty(info, className, propertyName, make(map[string]struct{}))
 }
 
-func findProperty(className string, propertyName string, visitedMap map[string]struct{}) (res meta.PropertyInfo, implClassName string, ok bool) {
+func findProperty(info *meta.Index, className string, propertyName string, visitedMap map[string]struct{}) (res meta.PropertyInfo, implClassName string, ok bool) {
 	for {
 		if _, ok := visitedMap[className]; ok {
 			return res, "", false
 		}
 		visitedMap[className] = struct{}{}
 
-		class, ok := meta.Info.GetClass(className)
+		class, ok := info.GetClass(className)
 		if !ok {
-			class, ok = meta.Info.GetTrait(className)
+			class, ok = info.GetTrait(className)
 			if !ok {
 				return res, "", false
 			}
@@ -306,7 +308,7 @@ func findProperty(className string, propertyName string, visitedMap map[string]s
 		}
 
 		for trait := range class.Traits {
-			res, implClassName, ok = findProperty(trait, propertyName, visitedMap)
+			res, implClassName, ok = findProperty(info, trait, propertyName, visitedMap)
 			if ok {
 				return res, implClassName, ok
 			}
@@ -321,11 +323,11 @@ func findProperty(className string, propertyName string, visitedMap map[string]s
 }
 
 // Implements checks if className implements interfaceName
-func Implements(className string, interfaceName string) bool {
+func Implements(info *meta.Index, className string, interfaceName string) bool {
 	visited := make(map[string]struct{}, 8)
 
 	for {
-		class, ok := meta.Info.GetClass(className)
+		class, ok := info.GetClass(className)
 		if !ok {
 			return false
 		}
@@ -336,7 +338,7 @@ func Implements(className string, interfaceName string) bool {
 		}
 
 		for iface := range class.Interfaces {
-			if interfaceExtends(iface, interfaceName, visited) {
+			if interfaceExtends(info, iface, interfaceName, visited) {
 				return true
 			}
 		}
@@ -350,14 +352,14 @@ func Implements(className string, interfaceName string) bool {
 }
 
 // interfaceExtends checks if interface orig extends interface parent
-func interfaceExtends(orig string, parent string, visited map[string]struct{}) bool {
+func interfaceExtends(info *meta.Index, orig string, parent string, visited map[string]struct{}) bool {
 	if _, ok := visited[orig]; ok {
 		return false
 	}
 
 	visited[orig] = struct{}{}
 
-	class, ok := meta.Info.GetClass(orig)
+	class, ok := info.GetClass(orig)
 	if !ok {
 		return false
 	}
@@ -367,7 +369,7 @@ func interfaceExtends(orig string, parent string, visited map[string]struct{}) b
 			return true
 		}
 
-		if interfaceExtends(iface, parent, visited) {
+		if interfaceExtends(info, iface, parent, visited) {
 			return true
 		}
 	}
@@ -376,12 +378,12 @@ func interfaceExtends(orig string, parent string, visited map[string]struct{}) b
 }
 
 // FindConstant searches for a costant in specified class and returns actual class that contains the constant.
-func FindConstant(className string, constName string) (res meta.ConstantInfo, implClassName string, ok bool) {
+func FindConstant(info *meta.Index, className string, constName string) (res meta.ConstantInfo, implClassName string, ok bool) {
 	visitedClasses := make(map[string]struct{}, 8) // expecting to be not so many inheritance levels
-	return findConstant(className, constName, visitedClasses)
+	return findConstant(info, className, constName, visitedClasses)
 }
 
-func findConstant(className string, constName string, visitedClasses map[string]struct{}) (res meta.ConstantInfo, implClassName string, ok bool) {
+func findConstant(info *meta.Index, className string, constName string, visitedClasses map[string]struct{}) (res meta.ConstantInfo, implClassName string, ok bool) {
 	for {
 		// check for inheritance loops
 		if _, ok := visitedClasses[className]; ok {
@@ -390,14 +392,14 @@ func findConstant(className string, constName string, visitedClasses map[string]
 
 		visitedClasses[className] = struct{}{}
 
-		class, ok := meta.Info.GetClass(className)
+		class, ok := info.GetClass(className)
 		if !ok {
 			return res, "", false
 		}
 
 		// inferfaces can have constants...
 		for ifaceName := range class.Interfaces {
-			res, implClassName, ok = findConstant(ifaceName, constName, visitedClasses)
+			res, implClassName, ok = findConstant(info, ifaceName, constName, visitedClasses)
 			if ok {
 				return res, implClassName, ok
 			}
@@ -410,7 +412,7 @@ func findConstant(className string, constName string, visitedClasses map[string]
 
 		// interfaces support multiple inheritance and I use a separate property for that for now
 		for _, parentIfaceName := range class.ParentInterfaces {
-			res, implClassName, ok = findConstant(parentIfaceName, constName, visitedClasses)
+			res, implClassName, ok = findConstant(info, parentIfaceName, constName, visitedClasses)
 			if ok {
 				return res, implClassName, ok
 			}
@@ -7,6 +7,15 @@ type Capability struct {
 	DidSave             bool `json:"didSave"`
 }
 
+type CompletionCapability struct {
+	Capability
+
+	CompletionItem struct {
+		// SnippetSupport is true if the client supports snippets as insert text.
+		SnippetSupport bool `json:"snippetSupport"`
+	} `json:"completionItem"`
+}
+
 type WorkspaceCapabilities struct {
 	ApplyEdit              bool
 	DidChangeConfiguration Capability `json:"didChangeConfiguration"`
@@ -16,26 +25,32 @@ type WorkspaceCapabilities struct {
 }
 
 type TextDocumentCapabilities struct {
-	Synchronization   Capability `json:"synchronization"`
-	Completion        Capability `json:"completion"`
-	Hover             Capability `json:"hover"`
-	SignatureHelp     Capability `json:"signatureHelp"`
-	Definition        Capability `json:"definition"`
-	References        Capability `json:"references"`
-	DocumentHighlight Capability `json:"documentHighlight"`
-	DocumentSymbol    Capability `json:"documentSymbol"`
-	CodeAction        Capability `json:"codeAction"`
-	CodeLens          Capability `json:"codeLens"`
-	Formatting        Capability `json:"formatting"`
-	RangeFormatting   Capability `json:"rangeFormatting"`
-	OnTypeFormatting  Capability `json:"onTypeFormatting"`
-	Rename            Capability `json:"rename"`
-	DocumentLink      Capability `json:"documentLink"`
+	Synchronization   Capability           `json:"synchronization"`
+	Completion        CompletionCapability `json:"completion"`
+	Hover             Capability           `json:"hover"`
+	SignatureHelp     Capability           `json:"signatureHelp"`
+	Definition        Capability           `json:"definition"`
+	References        Capability           `json:"references"`
+	DocumentHighlight Capability           `json:"documentHighlight"`
+	DocumentSymbol    Capability           `json:"documentSymbol"`
+	CodeAction        Capability           `json:"codeAction"`
+	CodeLens          Capability           `json:"codeLens"`
+	Formatting        Capability           `json:"formatting"`
+	RangeFormatting   Capability           `json:"rangeFormatting"`
+	OnTypeFormatting  Capability           `json:"onTypeFormatting"`
+	Rename            Capability           `json:"rename"`
+	DocumentLink      Capability           `json:"documentLink"`
+}
+
+type WindowCapabilities struct {
+	// WorkDoneProgress is true if the client supports server initiated progress.
+	WorkDoneProgress bool `json:"workDoneProgress"`
 }
 
 type CapabilitiesSections struct {
 	Workspace    WorkspaceCapabilities    `json:"workspace"`
 	TextDocument TextDocumentCapabilities `json:"textDocument"`
+	Window       WindowCapabilities       `json:"window"`
 }
 
 type TextDocumentDidOpenParams struct {
@@ -53,10 +68,54 @@ type InitializeParams struct {
 	RootURI      string               `json:"rootUri"`
 	Capabilities CapabilitiesSections `json:"capabilities"`
 	Trace        string               `json:"trace"`
+
+	InitializationOptions InitializationOptions `json:"initializationOptions"`
+}
+
+// InitializationOptions are the noverify specific initialization options.
+type InitializationOptions struct {
+	// WorkspaceDiagnostics enables diagnostics for all workspace files, not only opened ones.
+	WorkspaceDiagnostics bool `json:"workspaceDiagnostics"`
+
+	Settings
+}
+
+// Settings are the noverify language server settings.
+// Empty values mean that the command line flags values are used.
+type Settings struct {
+	// EnabledChecks is a list of enabled checks, all checks are enabled if it's empty.
+	EnabledChecks []string `json:"enabledChecks"`
+
+	// DisabledChecks is a list of disabled checks.
+	DisabledChecks []string `json:"disabledChecks"`
+
+	// Severities maps check names to "error", "warning", "information" or "hint".
+	Severities map[string]string `json:"severities"`
+
+	// Rules is a list of dynamic rules files, like -rules flag.
+	Rules []string `json:"rules"`
+
+	// Exclude is a regexp for filenames that are not reported, like -exclude flag.
+	Exclude string `json:"exclude"`
+
+	// UnusedVarRegex is a regexp for discarded variables, like -unused-var-regex flag.
+	UnusedVarRegex string `json:"unusedVarRegex"`
+
+	// StubsDir is a phpstorm-stubs directory, like -stubs-dir flag.
+	StubsDir string `json:"stubsDir"`
+}
+
+type DidChangeConfigurationParams struct {
+	Settings struct {
+		NoVerify Settings `json:"noverify"`
+	} `json:"settings"`
 }
 
 type ContentChange struct {
-	Text string `json:"text"`
+	// Range is nil if Text is the full document contents.
+	Range       *Range `json:"range,omitempty"`
+	RangeLength int    `json:"rangeLength,omitempty"`
+	Text        string `json:"text"`
 }
 
 type TextDocumentDidChangeParams struct {
@@ -98,3 +157,133 @@ type FileEvent struct {
 type DidChangeWatchedFilesParams struct {
 	Changes []FileEvent `json:"changes"`
 }
+
+type DocumentFormattingParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+}
+
+type DocumentRangeFormattingParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Range Range `json:"range"`
+}
+
+type WorkspaceSymbolParams struct {
+	Query string `json:"query"`
+}
+
+type SignatureHelpParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position Position `json:"position"`
+}
+
+type PrepareRenameParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position Position `json:"position"`
+}
+
+type RenameParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position Position `json:"position"`
+	NewName  string   `json:"newName"`
+}
+
+type CodeActionParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Range   Range `json:"range"`
+	Context struct {
+		Diagnostics []Diagnostic `json:"diagnostics"`
+	} `json:"context"`
+}
+
+type CancelParams struct {
+	ID int `json:"id"`
+}
+
+type ImplementationParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position Position `json:"position"`
+}
+
+type CallHierarchyPrepareParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position Position `json:"position"`
+}
+
+type CallHierarchyCallsParams struct {
+	Item CallHierarchyItem `json:"item"`
+}
+
+type TypeHierarchyPrepareParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position Position `json:"position"`
+}
+
+type TypeHierarchyParams struct {
+	Item TypeHierarchyItem `json:"item"`
+}
+
+type InlayHintParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Range Range `json:"range"`
+}
+
+type SemanticTokensParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+}
+
+type WorkDoneProgressCreateParams struct {
+	Token string `json:"token"`
+}
+
+type ProgressParams struct {
+	Token string      `json:"token"`
+	Value interface{} `json:"value"`
+}
+
+type DocumentHighlightParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position Position `json:"position"`
+}
+
+type FoldingRangeParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+}
+
+type SelectionRangeParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Positions []Position `json:"positions"`
+}
+
+type CodeLensParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+}
@@ -1,5 +1,7 @@
 package vscode
 
+import "encoding/json"
+
 // https://github.com/Microsoft/language-server-protocol/blob/master/versions/protocol-2-x.md
 
 type Position struct {
@@ -88,6 +90,11 @@ type PublishDiagnosticsParams struct {
 	 */
 	URI string `json:"uri"`
 
+	/**
+	 * The version number of the document the diagnostics are published for.
+	 */
+	Version int `json:"version,omitempty"`
+
 	/**
 	 * An array of diagnostic information items.
 	 */
@@ -145,18 +152,27 @@ type CompletionItem struct {
 	 * A string that should be used when filtering a set of
 	 * completion items. When `falsy` the label is used.
 	 */
-	// filterText?: string;
+	FilterText string `json:"filterText,omitempty"`
 	/**
 	 * A string that should be inserted a document when selecting
 	 * this completion. When `falsy` the label is used.
 	 */
 	InsertText string `json:"insertText,omitempty"`
+	/**
+	 * The format of the insert text, plain text or snippet.
+	 */
+	InsertTextFormat int `json:"insertTextFormat,omitempty"`
 	/**
 	 * An edit which is applied to a document when selecting
 	 * this completion. When an edit is provided the value of
 	 * insertText is ignored.
 	 */
-	// textEdit?: TextEdit;
+	TextEdit *TextEdit `json:"textEdit,omitempty"`
+	/**
+	 * An optional array of additional text edits that are applied when
+	 * selecting this completion, like adding the use statement.
+	 */
+	AdditionalTextEdits []TextEdit `json:"additionalTextEdits,omitempty"`
 	/**
 	 * An data entry field that is preserved on a completion item between
 	 * a completion and a completion resolve request.
@@ -164,6 +180,12 @@ type CompletionItem struct {
 	// data?: any
 }
 
+// enum InsertTextFormat
+const (
+	InsertTextFormatPlainText = 1
+	InsertTextFormatSnippet   = 2
+)
+
 type SymbolInformation struct {
 	/**
 	 * The name of this symbol.
@@ -207,3 +229,374 @@ const (
 	SymbolKindBoolean     = 17
 	SymbolKindArray       = 18
 )
+
+type TextEdit struct {
+	/**
+	 * The range of the text document to be manipulated. To insert
+	 * text into a document create a range where start === end.
+	 */
+	Range Range `json:"range"`
+
+	/**
+	 * The string to be inserted. For delete operations use an
+	 * empty string.
+	 */
+	NewText string `json:"newText"`
+}
+
+type SignatureHelp struct {
+	/**
+	 * One or more signatures.
+	 */
+	Signatures []SignatureInformation `json:"signatures"`
+
+	/**
+	 * The active signature.
+	 */
+	ActiveSignature int `json:"activeSignature"`
+
+	/**
+	 * The active parameter of the active signature.
+	 */
+	ActiveParameter int `json:"activeParameter"`
+}
+
+type SignatureInformation struct {
+	/**
+	 * The label of this signature. Will be shown in
+	 * the UI.
+	 */
+	Label string `json:"label"`
+
+	/**
+	 * The human-readable doc-comment of this signature. Will be shown
+	 * in the UI but can be omitted.
+	 */
+	Documentation string `json:"documentation,omitempty"`
+
+	/**
+	 * The parameters of this signature.
+	 */
+	Parameters []ParameterInformation `json:"parameters"`
+}
+
+type ParameterInformation struct {
+	/**
+	 * The label of this parameter. It must be a substring
+	 * of its containing signature label.
+	 */
+	Label string `json:"label"`
+
+	/**
+	 * The human-readable doc-comment of this parameter. Will be shown
+	 * in the UI but can be omitted.
+	 */
+	Documentation string `json:"documentation,omitempty"`
+}
+
+type WorkspaceEdit struct {
+	/**
+	 * Holds changes to existing resources.
+	 */
+	Changes map[string][]TextEdit `json:"changes"`
+}
+
+const (
+	CodeActionQuickFix = "quickfix"
+	CodeActionRefactor = "refactor"
+)
+
+type CodeAction struct {
+	/**
+	 * A short, human-readable, title for this code action.
+	 */
+	Title string `json:"title"`
+
+	/**
+	 * The kind of the code action, like "quickfix" or "refactor".
+	 */
+	Kind string `json:"kind,omitempty"`
+
+	/**
+	 * The diagnostics that this code action resolves.
+	 */
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+
+	/**
+	 * The workspace edit this code action performs.
+	 */
+	Edit *WorkspaceEdit `json:"edit,omitempty"`
+}
+
+type CallHierarchyItem struct {
+	/**
+	 * The name of this item.
+	 */
+	Name string `json:"name"`
+
+	/**
+	 * The kind of this item.
+	 */
+	Kind int `json:"kind"`
+
+	/**
+	 * More detail for this item, e.g. the class name of a method.
+	 */
+	Detail string `json:"detail,omitempty"`
+
+	/**
+	 * The resource identifier of this item.
+	 */
+	URI string `json:"uri"`
+
+	/**
+	 * The range enclosing this symbol.
+	 */
+	Range Range `json:"range"`
+
+	/**
+	 * The range that should be selected and revealed when this symbol is being picked.
+	 */
+	SelectionRange Range `json:"selectionRange"`
+
+	/**
+	 * A data entry field that is preserved between a call hierarchy
+	 * prepare and incoming calls or outgoing calls requests.
+	 */
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+type CallHierarchyIncomingCall struct {
+	/**
+	 * The item that makes the call.
+	 */
+	From CallHierarchyItem `json:"from"`
+
+	/**
+	 * The ranges at which the calls appear.
+	 */
+	FromRanges []Range `json:"fromRanges"`
+}
+
+type CallHierarchyOutgoingCall struct {
+	/**
+	 * The item that is called.
+	 */
+	To CallHierarchyItem `json:"to"`
+
+	/**
+	 * The ranges at which this item is called.
+	 */
+	FromRanges []Range `json:"fromRanges"`
+}
+
+type TypeHierarchyItem struct {
+	/**
+	 * The name of this item.
+	 */
+	Name string `json:"name"`
+
+	/**
+	 * The kind of this item.
+	 */
+	Kind int `json:"kind"`
+
+	/**
+	 * More detail for this item, e.g. the namespace of a class.
+	 */
+	Detail string `json:"detail,omitempty"`
+
+	/**
+	 * The resource identifier of this item.
+	 */
+	URI string `json:"uri"`
+
+	/**
+	 * The range enclosing this symbol.
+	 */
+	Range Range `json:"range"`
+
+	/**
+	 * The range that should be selected and revealed when this symbol is being picked.
+	 */
+	SelectionRange Range `json:"selectionRange"`
+
+	/**
+	 * A data entry field that is preserved between a type hierarchy
+	 * prepare and supertypes or subtypes requests.
+	 */
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// enum InlayHintKind
+const (
+	InlayHintKindType      = 1
+	InlayHintKindParameter = 2
+)
+
+type InlayHint struct {
+	/**
+	 * The position of this hint.
+	 */
+	Position Position `json:"position"`
+
+	/**
+	 * The label of this hint.
+	 */
+	Label string `json:"label"`
+
+	/**
+	 * The kind of this hint.
+	 */
+	Kind int `json:"kind,omitempty"`
+
+	/**
+	 * Render padding before the hint.
+	 */
+	PaddingLeft bool `json:"paddingLeft,omitempty"`
+
+	/**
+	 * Render padding after the hint.
+	 */
+	PaddingRight bool `json:"paddingRight,omitempty"`
+}
+
+type SemanticTokens struct {
+	/**
+	 * The encoded tokens: for every token there are 5 integers,
+	 * line delta, start character delta, length, token type and modifiers.
+	 */
+	Data []int `json:"data"`
+}
+
+type WorkDoneProgressBegin struct {
+	Kind string `json:"kind"` // always "begin"
+
+	/**
+	 * Mandatory title of the progress operation.
+	 */
+	Title string `json:"title"`
+
+	/**
+	 * Optional progress message.
+	 */
+	Message string `json:"message,omitempty"`
+
+	/**
+	 * Optional progress percentage, from 0 to 100.
+	 */
+	Percentage *int `json:"percentage,omitempty"`
+}
+
+type WorkDoneProgressReport struct {
+	Kind string `json:"kind"` // always "report"
+
+	/**
+	 * Optional progress message.
+	 */
+	Message string `json:"message,omitempty"`
+
+	/**
+	 * Optional progress percentage, from 0 to 100.
+	 */
+	Percentage *int `json:"percentage,omitempty"`
+}
+
+type WorkDoneProgressEnd struct {
+	Kind string `json:"kind"` // always "end"
+
+	/**
+	 * Optional final message.
+	 */
+	Message string `json:"message,omitempty"`
+}
+
+// enum DocumentHighlightKind
+const (
+	DocumentHighlightText  = 1
+	DocumentHighlightRead  = 2
+	DocumentHighlightWrite = 3
+)
+
+type DocumentHighlight struct {
+	/**
+	 * The range this highlight applies to.
+	 */
+	Range Range `json:"range"`
+
+	/**
+	 * The highlight kind, default is text.
+	 */
+	Kind int `json:"kind,omitempty"`
+}
+
+// enum FoldingRangeKind
+const (
+	FoldingRangeComment = "comment"
+	FoldingRangeImports = "imports"
+	FoldingRangeRegion  = "region"
+)
+
+type FoldingRange struct {
+	/**
+	 * The zero-based start line of the range to fold.
+	 */
+	StartLine int `json:"startLine"`
+
+	/**
+	 * The zero-based end line of the range to fold.
+	 */
+	EndLine int `json:"endLine"`
+
+	/**
+	 * Describes the kind of the folding range, like "comment" or "imports".
+	 */
+	Kind string `json:"kind,omitempty"`
+}
+
+type SelectionRange struct {
+	/**
+	 * The range of this selection range.
+	 */
+	Range Range `json:"range"`
+
+	/**
+	 * The parent selection range containing this range.
+	 */
+	Parent *SelectionRange `json:"parent,omitempty"`
+}
+
+type Command struct {
+	/**
+	 * Title of the command, like "save".
+	 */
+	Title string `json:"title"`
+
+	/**
+	 * The identifier of the actual command handler.
+	 */
+	Command string `json:"command"`
+
+	/**
+	 * Arguments that the command handler should be invoked with.
+	 */
+	Arguments []interface{} `json:"arguments,omitempty"`
+}
+
+type CodeLens struct {
+	/**
+	 * The range in which this code lens is valid.
+	 */
+	Range Range `json:"range"`
+
+	/**
+	 * The command this code lens represents, it's set by the resolve request.
+	 */
+	Command *Command `json:"command,omitempty"`
+
+	/**
+	 * A data entry field that is preserved between a code lens
+	 * and a code lens resolve request.
+	 */
+	Data json.RawMessage `json:"data,omitempty"`
+}
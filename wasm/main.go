@@ -5,31 +5,22 @@ import (
 	"syscall/js"
 
 	"github.com/setpill/noverify/src/linter"
-	"github.com/setpill/noverify/src/meta"
-	"github.com/setpill/noverify/src/php/parser/node"
 	"github.com/setpill/noverify/src/vscode"
 )
 
-func parse(filename string, contents string) (rootNode node.Node, w *linter.RootWalker, err error) {
-	rootNode, w, err = linter.ParseContents(filename, []byte(contents), "UTF-8", nil)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	if !meta.IsIndexingComplete() {
-		w.UpdateMetaInfo()
-	}
-
-	return rootNode, w, nil
-}
-
+// getReports analyzes the contents with a new linter, so the declarations
+// of the previously analyzed contents are not indexed.
 func getReports(contents string) ([]vscode.Diagnostic, error) {
-	meta.ResetInfo()
-	if _, _, err := parse(`demo.php`, contents); err != nil {
+	config := linter.NewConfig()
+	config.LangServer = true
+	l := linter.NewLinter(config)
+	l.InitStubs()
+
+	if err := l.IndexFile(`demo.php`, []byte(contents)); err != nil {
 		return nil, err
 	}
-	meta.SetIndexingComplete(true)
-	_, w, err := parse(`demo.php`, contents)
+	l.MetaInfo().SetIndexingComplete(true)
+	_, w, err := l.ParseContents(`demo.php`, []byte(contents), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -37,10 +28,6 @@ func getReports(contents string) ([]vscode.Diagnostic, error) {
 }
 
 func main() {
-	linter.LangServer = true
-
-	go linter.MemoryLimiterThread()
-
 	js.Global().Set("analyzeCallback", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
 		text := js.Global().Get("editor").Call("getValue").String()
 		diags, err := getReports(text)